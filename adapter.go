@@ -1,16 +1,18 @@
 package httpcompression // import "github.com/CAFxX/httpcompression"
 
 import (
-	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/CAFxX/httpcompression/contrib/andybalholm/brotli"
 	cgzip "github.com/CAFxX/httpcompression/contrib/compress/gzip"
 	"github.com/CAFxX/httpcompression/contrib/compress/zlib"
-	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
 )
 
 const (
@@ -23,8 +25,57 @@ const (
 	_range          = "Range"
 )
 
+const (
+	brotliEncoding    = "br"
+	zstandardEncoding = "zstd"
+)
+
 type codings map[string]float64
 
+// The helpers below are used instead of the maps package and of the clear
+// and min/max builtins, that the Yaegi interpreter does not support (see
+// contrib/traefik).
+
+func (c codings) clone() codings {
+	cc := make(codings, len(c))
+	for k, v := range c {
+		cc[k] = v
+	}
+	return cc
+}
+
+func (c codings) equal(o codings) bool {
+	if len(c) != len(o) {
+		return false
+	}
+	for k, v := range c {
+		if ov, ok := o[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (c codings) reset() {
+	for k := range c {
+		delete(c, k)
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 const (
 	// DefaultMinSize is the default minimum response body size for which we enable compression.
 	//
@@ -45,82 +96,335 @@ const (
 // is a no-op.
 // An error will be returned if invalid options are given.
 func Adapter(opts ...Option) (func(http.Handler) http.Handler, error) {
+	c, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return adapter(c, &pools{}), nil
+}
+
+func newConfig(opts ...Option) (config, error) {
 	c := config{
 		prefer:     PreferServer,
 		compressor: comps{},
 	}
-	for _, o := range opts {
-		err := o(&c)
-		if err != nil {
-			return nil, err
-		}
+	if err := c.apply(opts...); err != nil {
+		return config{}, err
+	}
+	if err := c.validate(); err != nil {
+		return config{}, err
+	}
+	return c, nil
+}
+
+// MustAdapter is like Adapter, but it panics if invalid options are given.
+// It is meant to be used when wiring the middleware in main.
+func MustAdapter(opts ...Option) func(http.Handler) http.Handler {
+	a, err := Adapter(opts...)
+	if err != nil {
+		panic(err)
 	}
+	return a
+}
 
-	if len(c.compressor) == 0 {
+// MustDefaultAdapter is like DefaultAdapter, but it panics if invalid
+// options are given.
+func MustDefaultAdapter(opts ...Option) func(http.Handler) http.Handler {
+	a, err := DefaultAdapter(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// pools holds the pools used by the middleware. They don't depend on the
+// configuration, so they can be shared by middlewares with different configurations.
+type pools struct {
+	buf    sync.Pool // pool of buffers (buf *[]byte) used by compressWriter
+	writer sync.Pool // pool of *compressWriter
+
+	bufStats    poolCounters
+	writerStats poolCounters
+}
+
+// poolCounters counts the objects obtained from a pool (see PoolStats).
+type poolCounters struct {
+	gets  atomic.Uint64 // objects obtained from the pool
+	news  atomic.Uint64 // objects created because the pool was empty
+	inUse atomic.Int64  // objects obtained and not yet returned
+}
+
+func (pc *poolCounters) got(created bool) {
+	pc.gets.Add(1)
+	if created {
+		pc.news.Add(1)
+	}
+	pc.inUse.Add(1)
+}
+
+func (pc *poolCounters) put() {
+	pc.inUse.Add(-1)
+}
+
+func adapter(c config, p *pools) func(http.Handler) http.Handler {
+	if len(c.routes) > 0 {
+		return routesAdapter(c, p)
+	}
+	if len(c.compressor) == 0 && !c.dict.enabled() {
 		// No compressors have been configured, so there is no useful work
 		// that this adapter can do.
 		return func(h http.Handler) http.Handler {
 			return h
-		}, nil
+		}
 	}
 
-	bufPool := &sync.Pool{}
-	writerPool := &sync.Pool{}
-
 	return func(h http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			addVaryHeader(w.Header(), acceptEncoding)
-
-			accept := parseEncodings(r.Header.Values(acceptEncoding))
-			common := acceptedCompression(accept, c.compressor)
-			if len(common) == 0 {
+		return &compressHandler{config: &c, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if upgradeRequest(r) {
 				h.ServeHTTP(w, r)
 				return
 			}
-
-			// We do not handle range requests when compression is used, as the
-			// range specified applies to the compressed data, not to the uncompressed one.
-			// So we would need to (1) ensure that compressors are deterministic and (2)
-			// generate the whole uncompressed response anyway, compress it, and then discard
-			// the bits outside of the range.
-			// Let's keep it simple, and simply ignore completely the range header.
-			// We also need to remove the Accept: Range header from any response that is
-			// compressed; this is done in the ResponseWriter.
-			// See https://github.com/nytimes/gziphandler/issues/83.
-			r.Header.Del(_range)
-
-			gw, _ := writerPool.Get().(*compressWriter)
-			if gw == nil {
-				gw = &compressWriter{}
+			if nestedRequest(r) {
+				if c.nested != nil {
+					c.nested(r)
+				}
+				h.ServeHTTP(w, r)
+				return
 			}
-			*gw = compressWriter{
-				ResponseWriter: w,
-				config:         c,
-				accept:         accept,
-				common:         common,
-				pool:           bufPool,
+			if c.discovery != nil && c.discover(w, r) {
+				return
 			}
-			defer func() {
-				// Important: gw.Close() must be called *always*, as this will
-				// in turn Close() the compressor. This is important because
-				// it is guaranteed by the CompressorProvider interface, and
-				// because some compressors may be implemented via cgo, and they
-				// may rely on Close() being called to release memory resources.
-				// TODO: expose the error
-				_ = gw.Close() // expose the error
-				*gw = compressWriter{}
-				writerPool.Put(gw)
-			}()
-
-			if _, ok := w.(http.CloseNotifier); ok {
-				w = compressWriterWithCloseNotify{gw}
-			} else {
-				w = gw
+			if c.reject && c.notAcceptable(w, r) {
+				return
 			}
+			w, r, end := c.start(w, r, p)
+			defer end() // the error is passed to the hooks (see ErrorHandler)
 
 			h.ServeHTTP(w, r)
-		})
-	}, nil
+		})}
+	}
+}
+
+// gateEncodings applies to the encodings accepted by the client the options
+// that restrict them for r. If trace is not nil, it is called with the name
+// of each option that changed them (see NegotiationHandler).
+func (c *config) gateEncodings(w http.ResponseWriter, r *http.Request, accept codings, trace func(option string)) {
+	var before codings
+	if trace != nil {
+		before = accept.clone()
+	}
+	if c.assumeGzip != nil {
+		c.assumeGzipFor(w, r, accept)
+		traceGate(trace, "AssumeGzip", &before, accept)
+	}
+	if len(c.protocols) > 0 {
+		c.gateProtocols(r, accept)
+		traceGate(trace, "EncodingProtocols", &before, accept)
+	}
+	if c.proxies != nil {
+		c.gateProxies(r, accept)
+		traceGate(trace, "Intermediaries", &before, accept)
+	}
+	if len(c.secretURLs) > 0 && c.secretURL(r) {
+		accept.reset()
+		traceGate(trace, "SecretURLs", &before, accept)
+	}
+	if c.egress != nil && c.egress.gates() {
+		accept.reset()
+		traceGate(trace, "EgressAware", &before, accept)
+	}
+}
+
+// seesAll reports whether the options need to see all the responses, also
+// those that can not be compressed (see Tee, PolicySkipHeader and
+// LevelOverrides). The requests of the clients that accept no encoding still
+// keep their Range and If-Range headers, and their responses Accept-Ranges,
+// as they can not be compressed.
+func (c *config) seesAll() bool {
+	return c.tee != nil || c.skipHeader != nil || (c.levels != nil && c.levels.header != "")
+}
+
+func traceGate(trace func(option string), option string, before *codings, accept codings) {
+	if trace != nil && !(*before).equal(accept) {
+		trace(option)
+		*before = accept.clone()
+	}
+}
+
+// start starts the response to r, written to w: it negotiates the encoding,
+// and returns the ResponseWriter and the request to be passed to the
+// handler, and the function to be called once the handler has returned,
+// that completes the response and returns the error of the compressor, if
+// any.
+func (c *config) start(w http.ResponseWriter, r *http.Request, p *pools) (http.ResponseWriter, *http.Request, func() error) {
+	addVaryHeader(w.Header(), acceptEncoding)
+
+	accept, common := c.negotiate(w, r)
+	var (
+		dict *dictChoice
+		use  *dictRecorder
+	)
+	if c.dict.enabled() {
+		addVaryHeader(w.Header(), availableDictionary)
+		dict = c.dict.negotiate(r, accept)
+		use = c.dict.newDictRecorder(r, accept)
+	}
+	if len(common) == 0 && dict == nil && use == nil && !c.seesAll() {
+		if len(c.hooks) == 0 {
+			return w, r, func() error { return nil }
+		}
+		sw := &startWriter{ResponseWriter: w, c: c, r: r}
+		w = c.wrapWriter(sw, r)
+		c.writerNegotiated(r, "")
+		return w, r, func() error {
+			sw.start(http.StatusOK)
+			c.writerClosed(r, "", nil)
+			return nil
+		}
+	}
+
+	// We do not handle range requests when compression is used, as the
+	// range specified applies to the compressed data, not to the uncompressed one.
+	// So we would need to (1) ensure that compressors are deterministic and (2)
+	// generate the whole uncompressed response anyway, compress it, and then discard
+	// the bits outside of the range.
+	// Let's keep it simple: the Range header is passed to the handler, and partial
+	// responses (206) are never compressed, so that the ranges keep applying to the
+	// uncompressed representation. We also need to remove the Accept-Ranges header
+	// from any response that is compressed, so that clients do not send range
+	// requests for it; this is done in the ResponseWriter.
+	// A client resuming a compressed response with If-Range would however get a
+	// range of the uncompressed one, and append it to the compressed bytes, if the
+	// validator of the compressed response is also the one of the uncompressed one:
+	// the If-Range requests are passed to the handler only if the compressed
+	// responses have their own strong ETags (see EncodingETags), that never match
+	// the ones of the handler, so that the handler sends the whole response.
+	// See https://github.com/nytimes/gziphandler/issues/83.
+	if len(common) > 0 {
+		if v := r.Header.Get(ifRange); v != "" && (!c.etags || !strings.HasPrefix(v, `"`)) {
+			r.Header.Del(_range)
+			r.Header.Del(ifRange)
+		}
+	}
+
+	gw, _ := p.writer.Get().(*compressWriter)
+	p.writerStats.got(gw == nil)
+	if gw == nil {
+		gw = &compressWriter{}
+	}
+	poolGot(gw)
+	*gw = compressWriter{
+		ResponseWriter: w,
+		config:         *c,
+		accept:         accept,
+		common:         common,
+		minSize:        c.minSize,
+		waitSize:       c.minSize,
+		dict:           dict,
+		use:            use,
+		pools:          p,
+		ctx:            r.Context(),
+	}
+	if len(c.encMinSize) > 0 {
+		gw.minSize, gw.waitSize = c.minSizes(common, dict)
+	}
+	if c.oneShot > gw.waitSize && !c.deterministic {
+		gw.waitSize = c.oneShot
+	}
+	if c.cache != nil {
+		gw.cacheURL = cacheURL(r)
+	}
+	if c.learn != nil {
+		gw.learn = c.learn.pattern(r)
+	}
+	if c.costs != nil {
+		gw.cost = c.costs.pattern(r)
+	}
+	end := func() error {
+		// Important: gw.Close() must be called *always*, as this will
+		// in turn Close() the compressor. This is important because
+		// it is guaranteed by the CompressorProvider interface, and
+		// because some compressors may be implemented via cgo, and they
+		// may rely on Close() being called to release memory resources.
+		err := gw.Close()
+		if use != nil {
+			use.done(err)
+		}
+		if len(c.hooks) > 0 {
+			c.writerClosed(r, gw.enc, err)
+		}
+		if gw.abandoned() {
+			// The abandoned compressor may still reference gw.
+			p.writerStats.put()
+			return err
+		}
+		poolPut(gw)
+		*gw = compressWriter{}
+		poolPoisonWriter(gw)
+		p.writer.Put(gw)
+		p.writerStats.put()
+		return err
+	}
+
+	w = gw.wrap()
+
+	enc := ""
+	if dict != nil {
+		enc = dict.enc
+	} else if len(common) > 0 {
+		enc = preferredEncoding(accept, c.compressor, common, c.prefer)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), encodingKey{}, enc))
+	if c.canary {
+		r = r.WithContext(context.WithValue(r.Context(), canaryKey{}, true))
+	}
+	if c.tenants != nil {
+		r = r.WithContext(context.WithValue(r.Context(), tenantKey{}, c.tenants.key(r)))
+	}
+	if c.etags {
+		r, gw.sent = c.handlerETags(r)
+	}
+	if c.capture != nil && c.capture.match(r) {
+		gw.capture = r
+	}
+	if c.signatures != nil && c.signatures.resign != nil {
+		gw.signed = r
+	}
+	if c.tee != nil {
+		gw.teeReq = r
+	}
+	if c.skipHeader != nil && len(c.secretURLs) > 0 {
+		gw.secret = c.secretURL(r)
+	}
+	if len(c.hooks) > 0 {
+		gw.req = r
+		w = c.wrapWriter(w, r)
+	}
+
+	return w, r, end
+}
+
+type encodingKey struct{}
+
+// EncodingFromRequest returns the Content-Encoding negotiated by the
+// middleware for the request r, as seen by the handler wrapped by the
+// middleware, or the empty string if the response will not be compressed.
+// The response may still not be compressed, e.g. because it is smaller
+// than MinSize, because of its Content-Type, or because the handler sets
+// the Content-Encoding itself (e.g. to serve a precompressed variant in the
+// negotiated encoding). The returned encoding does not take into account
+// the restrictions of specific compressors (e.g. EncodingMinSize), so the
+// response may also be compressed with a different encoding.
+func EncodingFromRequest(r *http.Request) string {
+	enc, _ := r.Context().Value(encodingKey{}).(string)
+	return enc
+}
+
+// compressHandler is a handler wrapped by the middleware. It allows to
+// inspect the configuration of the middleware (see ListCompressors).
+type compressHandler struct {
+	http.Handler
+	config *config
 }
 
 func addVaryHeader(h http.Header, value string) {
@@ -132,38 +436,167 @@ func addVaryHeader(h http.Header, value string) {
 	h.Add(vary, value)
 }
 
-// DefaultAdapter is like Adapter, but it includes sane defaults for general usage.
-// Currently the defaults enable gzip and brotli compression, and set a minimum body size
-// of 200 bytes.
-// The provided opts override the defaults.
-// The defaults are not guaranteed to remain constant over time: if you want to avoid this
-// use Adapter directly.
-func DefaultAdapter(opts ...Option) (func(http.Handler) http.Handler, error) {
-	defaults := []Option{
-		DeflateCompressionLevel(zlib.DefaultCompression),
-		GzipCompressionLevel(gzip.DefaultCompression),
-		BrotliCompressionLevel(brotli.DefaultCompression),
-		defaultZstandardCompressor(),
-		MinSize(DefaultMinSize),
-	}
-	opts = append(defaults, opts...)
-	return Adapter(opts...)
-}
-
 // Used for functional configuration.
 type config struct {
 	minSize      int                 // Specifies the minimum response size to gzip. If the response length is bigger than this value, it is compressed.
+	encMinSize   map[string]int      // Minimum response sizes of specific encodings, overriding minSize.
 	contentTypes []parsedContentType // Only compress if the response is one of these content-types. All are accepted if empty.
 	blacklist    bool
+	always       []parsedContentType // Compress these content-types regardless of their size.
 	prefer       PreferType
 	compressor   comps
+	cache        *cacheConfig
+	once         *onceConfig
+	stale        *staleConfig
+	dict         *dictConfig
+	routes       []route
+	hooks        []WriterHook
+
+	deterministic bool                   // see Deterministic
+	zstdMaxWindow int                    // see ZstandardMaxWindow; 0 means DefaultZstandardMaxWindow
+	learn         *learnConfig           // see LearnEncodings
+	protocols     map[string]protocolReq // see EncodingProtocols
+	assumeGzip    []string               // see AssumeGzip
+	proxies       ProxyDetector          // see Intermediaries
+	capture       *captureConfig         // see DebugCapture
+	secretURLs    []*regexp.Regexp       // see SecretURLs
+	oneShot       int                    // see OneShotMaxSize
+	byteRanges    bool                   // see CompressByteRanges
+	nested        func(r *http.Request)  // see OnNested
+	digests       []string               // see ContentDigest
+	signatures    *signatureConfig       // see SignedResponses
+	heartbeats    bool                   // see Heartbeats
+	heartbeatSize int                    // see Heartbeats
+	quotas        map[string]*quota      // see EncodingQuota
+	discovery     *discoveryConfig       // see EncodingDiscovery
+	reject        bool                   // see RejectNotAcceptable
+	canary        bool                   // see Canary
+	tenants       *tenantConfig          // see TenantKey
+	costs         *CostTracker           // see TrackCosts
+	parts         *partsConfig           // see MixedReplaceParts
+	serverTiming  bool                   // see ServerTiming
+	backpressure  *backpressureConfig    // see Backpressure
+	etags         bool                   // see EncodingETags
+	tee           teeFunc                // see Tee
+	closeTimeout  time.Duration          // see CloseTimeout
+	skipHeader    *skipHeader            // see PolicySkipHeader
+	levels        *levelOverrides        // see LevelOverrides
+	egress        *egressConfig          // see EgressAware
+	disabled      map[string]bool        // see DisableEncoding
+}
+
+// apply applies opts to c. All the options are applied even if some of
+// them fail: the errors of all the failing options are returned, joined.
+func (c *config) apply(opts ...Option) error {
+	var errs []error
+	for _, o := range opts {
+		if err := o(c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// optionError is the error of an invalid option, reported with the name of
+// the function that returned the option.
+type optionError struct {
+	option string
+	err    error
+}
+
+func (e *optionError) Error() string {
+	if e.option == "" {
+		return e.err.Error()
+	}
+	return e.option + ": " + e.err.Error()
+}
+
+func (e *optionError) Unwrap() error {
+	return e.err
+}
+
+// named returns an option applying o, whose errors are reported with name,
+// the name of the function that returned the option (e.g. "MinSize"). The
+// errors of the options combined by o keep their names.
+func named(name string, o Option) Option {
+	return func(c *config) error {
+		err := o(c)
+		var oe *optionError
+		if err != nil && !errors.As(err, &oe) {
+			err = &optionError{name, err}
+		}
+		return err
+	}
+}
+
+// validate checks the consistency of the options that depend on each other.
+func (c *config) validate() error {
+	if c.once != nil && c.cache == nil {
+		return fmt.Errorf("the CompressOnce option requires the VariantCache option")
+	}
+	if c.stale != nil && c.cache == nil {
+		return fmt.Errorf("the StaleWhileRevalidate option requires the VariantCache option")
+	}
+	if err := c.validateRoutes(); err != nil {
+		return err
+	}
+	// After validateRoutes, as the routes can change the maximum window.
+	c.dropLargeZstdWindows()
+	c.dropNondeterministic()
+	return nil
+}
+
+// clone returns a copy of c that can be modified without affecting c.
+func (c config) clone() config {
+	c.contentTypes = append([]parsedContentType(nil), c.contentTypes...)
+	c.always = append([]parsedContentType(nil), c.always...)
+	compressor := make(comps, len(c.compressor))
+	for k, v := range c.compressor {
+		compressor[k] = v
+	}
+	c.compressor = compressor
+	if c.encMinSize != nil {
+		encMinSize := make(map[string]int, len(c.encMinSize))
+		for k, v := range c.encMinSize {
+			encMinSize[k] = v
+		}
+		c.encMinSize = encMinSize
+	}
+	if c.protocols != nil {
+		protocols := make(map[string]protocolReq, len(c.protocols))
+		for k, v := range c.protocols {
+			protocols[k] = v
+		}
+		c.protocols = protocols
+	}
+	if c.disabled != nil {
+		disabled := make(map[string]bool, len(c.disabled))
+		for k, v := range c.disabled {
+			disabled[k] = v
+		}
+		c.disabled = disabled
+	}
+	if c.quotas != nil {
+		quotas := make(map[string]*quota, len(c.quotas))
+		for k, v := range c.quotas {
+			quotas[k] = v
+		}
+		c.quotas = quotas
+	}
+	c.dict = c.dict.clone()
+	c.routes = append([]route(nil), c.routes...)
+	c.hooks = append([]WriterHook(nil), c.hooks...)
+	c.secretURLs = append([]*regexp.Regexp(nil), c.secretURLs...)
+	return c
 }
 
 type comps map[string]comp
 
 type comp struct {
-	comp     CompressorProvider
-	priority int
+	comp         CompressorProvider
+	priority     int
+	contentTypes []parsedContentType // if not empty, the compressor is used only for these content types
+	level        *int                // the compression level, if known (see Describe)
 }
 
 // Option can be passed to Handler to control its configuration.
@@ -172,13 +605,60 @@ type Option func(c *config) error
 // MinSize is an option that controls the minimum size of payloads that
 // should be compressed. The default is DefaultMinSize.
 func MinSize(size int) Option {
-	return func(c *config) error {
+	return named("MinSize", func(c *config) error {
 		if size < 0 {
 			return fmt.Errorf("minimum size can not be negative: %d", size)
 		}
 		c.minSize = size
 		return nil
+	})
+}
+
+// EncodingMinSize is an option that controls the minimum size of payloads
+// that should be compressed with the specified Content-Encoding, overriding
+// MinSize for it (e.g. to use brotli only for payloads larger than 1KB, and
+// gzip for smaller ones). The beginning of the responses is buffered until
+// the minimum sizes of all the encodings accepted by the client are
+// reached (or the response ends), and then the response is compressed
+// with one of the encodings whose minimum size is satisfied.
+func EncodingMinSize(contentEncoding string, size int) Option {
+	return named("EncodingMinSize", func(c *config) error {
+		if size < 0 {
+			return fmt.Errorf("minimum size can not be negative: %d", size)
+		}
+		if c.encMinSize == nil {
+			c.encMinSize = map[string]int{}
+		}
+		c.encMinSize[contentEncoding] = size
+		return nil
+	})
+}
+
+// encodingMinSize returns the minimum size of the payloads to compress with
+// the encoding enc.
+func (c *config) encodingMinSize(enc string) int {
+	if size, ok := c.encMinSize[enc]; ok {
+		return size
 	}
+	return c.minSize
+}
+
+// minSizes returns the smallest and the largest minimum sizes of the
+// encodings in common and of the dictionary encoding, if any.
+func (c *config) minSizes(common []string, dict *dictChoice) (lo, hi int) {
+	encs := common
+	if dict != nil {
+		encs = append([]string{dict.enc}, common...)
+	}
+	if len(encs) == 0 {
+		return c.minSize, c.minSize
+	}
+	lo, hi = c.encodingMinSize(encs[0]), c.encodingMinSize(encs[0])
+	for _, enc := range encs[1:] {
+		size := c.encodingMinSize(enc)
+		lo, hi = minInt(lo, size), maxInt(hi, size)
+	}
+	return lo, hi
 }
 
 // DeflateCompressionLevel is an option that controls the Deflate compression
@@ -187,9 +667,9 @@ func MinSize(size int) Option {
 func DeflateCompressionLevel(level int) Option {
 	c, err := zlib.New(zlib.Options{Level: level})
 	if err != nil {
-		return errorOption(err)
+		return errorOption("DeflateCompressionLevel", err)
 	}
-	return DeflateCompressor(c)
+	return withLevel(DeflateCompressor(c), zlib.Encoding, level)
 }
 
 // GzipCompressionLevel is an option that controls the Gzip compression
@@ -198,21 +678,9 @@ func DeflateCompressionLevel(level int) Option {
 func GzipCompressionLevel(level int) Option {
 	c, err := NewDefaultGzipCompressor(level)
 	if err != nil {
-		return errorOption(err)
-	}
-	return GzipCompressor(c)
-}
-
-// BrotliCompressionLevel is an option that controls the Brotli compression
-// level to be used when compressing payloads.
-// The default is 3 (the same default used in the reference brotli C
-// implementation).
-func BrotliCompressionLevel(level int) Option {
-	c, err := brotli.New(brotli.Options{Quality: level})
-	if err != nil {
-		return errorOption(err)
+		return errorOption("GzipCompressionLevel", err)
 	}
-	return BrotliCompressor(c)
+	return withLevel(GzipCompressor(c), cgzip.Encoding, level)
 }
 
 // DeflateCompressor is an option to specify a custom compressor factory for Deflate.
@@ -227,28 +695,45 @@ func GzipCompressor(g CompressorProvider) Option {
 
 // BrotliCompressor is an option to specify a custom compressor factory for Brotli.
 func BrotliCompressor(b CompressorProvider) Option {
-	return Compressor(brotli.Encoding, -100, b)
+	return Compressor(brotliEncoding, -100, b)
 }
 
 // ZstandardCompressor is an option to specify a custom compressor factory for Zstandard.
 func ZstandardCompressor(b CompressorProvider) Option {
-	return Compressor(zstd.Encoding, -50, b)
+	return Compressor(zstandardEncoding, -50, b)
 }
 
 func NewDefaultGzipCompressor(level int) (CompressorProvider, error) {
 	return cgzip.New(cgzip.Options{Level: level})
 }
 
-func defaultZstandardCompressor() Option {
-	zstdComp, err := zstd.New()
-	if err != nil {
-		return errorOption(fmt.Errorf("initializing zstd compressor: %w", err))
+// withLevel returns an option applying o, that configures the compressor
+// for contentEncoding, and recording level as the level of the compressor.
+func withLevel(o Option, contentEncoding string, level int) Option {
+	return func(c *config) error {
+		if err := o(c); err != nil {
+			return err
+		}
+		if cc, ok := c.compressor[contentEncoding]; ok {
+			cc.level = &level
+			c.compressor[contentEncoding] = cc
+		}
+		return nil
 	}
-	return ZstandardCompressor(zstdComp)
 }
 
-func errorOption(err error) Option {
+// errorOption returns an option that always fails with err, reported with
+// name (see named).
+func errorOption(name string, err error) Option {
+	err = &optionError{name, err}
 	return func(_ *config) error {
 		return err
 	}
 }
+
+// options returns an option applying all opts.
+func options(opts ...Option) Option {
+	return func(c *config) error {
+		return c.apply(opts...)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build cgo
+// +build cgo
+
+package httpcompression
+
+import (
+	"fmt"
+
+	"github.com/CAFxX/httpcompression/contrib/google/cbrotli"
+	"github.com/CAFxX/httpcompression/contrib/valyala/gozstd"
+	gcbrotli "github.com/google/brotli/go/cbrotli"
+	vzstd "github.com/valyala/gozstd"
+)
+
+// cgoCompressors reports whether the benchmarks can use the cgo compressors.
+const cgoCompressors = true
+
+func newCgoCompressor(ae string, d int) (CompressorProvider, error) {
+	switch ae {
+	case googleCbrotli:
+		return cbrotli.New(gcbrotli.WriterOptions{Quality: d})
+	case valyalaGozstd:
+		return gozstd.New(vzstd.WriterParams{CompressionLevel: d})
+	}
+	return nil, fmt.Errorf("unknown compressor %q", ae)
+}
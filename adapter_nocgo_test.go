@@ -0,0 +1,13 @@
+//go:build !cgo
+// +build !cgo
+
+package httpcompression
+
+import "fmt"
+
+// cgoCompressors reports whether the benchmarks can use the cgo compressors.
+const cgoCompressors = false
+
+func newCgoCompressor(ae string, d int) (CompressorProvider, error) {
+	return nil, fmt.Errorf("compressor %q requires cgo", ae)
+}
@@ -3,7 +3,9 @@ package httpcompression
 import (
 	"bytes"
 	"compress/gzip"
+	stdzlib "compress/zlib"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -12,19 +14,17 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/CAFxX/httpcompression/contrib/andybalholm/brotli"
-	"github.com/CAFxX/httpcompression/contrib/google/cbrotli"
 	kpgzip "github.com/CAFxX/httpcompression/contrib/klauspost/gzip"
 	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
-	"github.com/CAFxX/httpcompression/contrib/valyala/gozstd"
 	"github.com/stretchr/testify/assert"
 
 	ibrotli "github.com/andybalholm/brotli"
-	gcbrotli "github.com/google/brotli/go/cbrotli"
 	kpzstd "github.com/klauspost/compress/zstd"
-	vzstd "github.com/valyala/gozstd"
 )
 
 const (
@@ -89,6 +89,7 @@ func TestParseEncodings2(t *testing.T) {
 }
 
 func TestGzipHandler(t *testing.T) {
+	skipMinimal(t)
 	t.Parallel()
 
 	const gzipEncoding = "gzip"
@@ -339,6 +340,7 @@ func TestGzipHandlerSmallBodyNoCompression(t *testing.T) {
 }
 
 func TestGzipHandlerRepeatedCompressionGzip(t *testing.T) {
+	skipMinimal(t)
 	t.Parallel()
 
 	handler := newTestHandler(testBody)
@@ -654,7 +656,7 @@ func TestGzipHandlerDoubleWriteHeader(t *testing.T) {
 	}
 	assert.Empty(t, body)
 	header := rec.Header()
-	assert.Equal(t, "gzip", header.Get("Content-Encoding"))
+	assert.Empty(t, header.Get("Content-Encoding"))
 	assert.Equal(t, "Accept-Encoding", header.Get("Vary"))
 	assert.Equal(t, 304, rec.Code)
 }
@@ -724,6 +726,56 @@ func TestFlushBeforeWrite(t *testing.T) {
 	assert.NotEqual(t, b, w.Body.Bytes())
 }
 
+func TestFlushBeforeWriteHeaders(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		contentType   string
+		contentLength int
+		flushed       bool
+		encoding      string
+	}{
+		"not compressible":       {"image/png", 0, true, ""},
+		"known length":           {"text/plain", len(testBody), true, "gzip"},
+		"known length too small": {"text/plain", 10, true, ""},
+		"unknown length":         {"text/plain", 0, false, "gzip"},
+		"unknown content type":   {"", len(testBody), false, "gzip"},
+	}
+	for n, c := range cases {
+		c := c
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			w := httptest.NewRecorder()
+			mw, _ := DefaultAdapter(ContentTypes([]string{"text/plain"}, false))
+			handler := mw(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				if c.contentType != "" {
+					rw.Header().Set(contentType, c.contentType)
+				}
+				if c.contentLength != 0 {
+					rw.Header().Set(contentLength, strconv.Itoa(c.contentLength))
+				}
+				rw.(http.Flusher).Flush()
+				assert.Equal(t, c.flushed, w.Flushed)
+				assert.Equal(t, 0, w.Body.Len())
+				io.WriteString(rw, testBody)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(acceptEncoding, "gzip")
+			handler.ServeHTTP(w, r)
+
+			res := w.Result()
+			assert.Equal(t, c.encoding, res.Header.Get(contentEncoding))
+			if c.encoding == "" {
+				return
+			}
+			d, err := decodeGzip(w.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, testBody, string(d))
+		})
+	}
+}
+
 func TestFlushAfterWrite(t *testing.T) {
 	t.Parallel()
 
@@ -748,6 +800,53 @@ func TestFlushAfterWrite(t *testing.T) {
 	assert.NotEqual(t, b, w.Body.Bytes())
 }
 
+type brokenResponseWriter struct {
+	http.ResponseWriter
+	err error
+}
+
+func (w brokenResponseWriter) Write(b []byte) (int, error) {
+	return 0, w.err
+}
+
+func (w brokenResponseWriter) FlushError() error {
+	return w.err
+}
+
+// plainResponseWriter does not implement http.Flusher.
+type plainResponseWriter struct {
+	h http.Header
+}
+
+func (w *plainResponseWriter) Header() http.Header         { return w.h }
+func (w *plainResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *plainResponseWriter) WriteHeader(int)             {}
+
+func TestFlushError(t *testing.T) {
+	t.Parallel()
+
+	errBroken := errors.New("connection closed")
+	b := []byte(strings.Repeat(testBody, 10))
+	mw, _ := DefaultAdapter()
+	var err error
+	handler := mw(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set(contentType, "text/plain")
+		rw.Write(b)
+		err = http.NewResponseController(rw).Flush()
+	}))
+	serve := func(w http.ResponseWriter, enc string) error {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", enc)
+		handler.ServeHTTP(w, r)
+		return err
+	}
+
+	assert.NoError(t, serve(httptest.NewRecorder(), "gzip"))
+	assert.ErrorIs(t, serve(brokenResponseWriter{httptest.NewRecorder(), errBroken}, "gzip"), errBroken)
+	assert.ErrorIs(t, serve(brokenResponseWriter{httptest.NewRecorder(), errBroken}, "identity"), errBroken)
+	assert.ErrorIs(t, serve(&plainResponseWriter{h: http.Header{}}, "gzip"), http.ErrNotSupported)
+}
+
 func TestImplementCloseNotifier(t *testing.T) {
 	t.Parallel()
 
@@ -789,6 +888,112 @@ func TestNotImplementCloseNotifier(t *testing.T) {
 	})).ServeHTTP(httptest.NewRecorder(), request)
 }
 
+func TestUnwrap(t *testing.T) {
+	t.Parallel()
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(acceptEncoding, "gzip")
+	mw, _ := DefaultAdapter()
+	res := httptest.NewRecorder()
+	mw(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		u, ok := rw.(interface{ Unwrap() http.ResponseWriter })
+		if assert.True(t, ok, "response writer must implement Unwrap") {
+			assert.Same(t, res, u.Unwrap())
+		}
+	})).ServeHTTP(res, request)
+}
+
+func TestImplementOptionalInterfaces(t *testing.T) {
+	t.Parallel()
+
+	mw, _ := DefaultAdapter(ContentTypes([]string{"image/png"}, true))
+	serve := func(res http.ResponseWriter, h http.HandlerFunc) {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set(acceptEncoding, "gzip")
+		mw(h).ServeHTTP(res, request)
+	}
+
+	serve(httptest.NewRecorder(), func(rw http.ResponseWriter, req *http.Request) {
+		_, ok := rw.(http.Pusher)
+		assert.False(t, ok, "response writer must not implement http.Pusher")
+		_, ok = rw.(io.ReaderFrom)
+		assert.False(t, ok, "response writer must not implement io.ReaderFrom")
+	})
+
+	res := &mockRWPushReadFrom{ResponseRecorder: httptest.NewRecorder()}
+	serve(res, func(rw http.ResponseWriter, req *http.Request) {
+		_, ok := rw.(http.Flusher)
+		assert.True(t, ok, "response writer must implement http.Flusher")
+		_, ok = rw.(http.CloseNotifier)
+		assert.False(t, ok, "response writer must not implement http.CloseNotifier")
+		p, ok := rw.(http.Pusher)
+		if assert.True(t, ok, "response writer must implement http.Pusher") {
+			assert.NoError(t, p.Push("/style.css", nil))
+		}
+		rw.Header().Set(contentType, "text/plain")
+		rf, ok := rw.(io.ReaderFrom)
+		if assert.True(t, ok, "response writer must implement io.ReaderFrom") {
+			n, err := rf.ReadFrom(strings.NewReader(testBody))
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(testBody)), n)
+		}
+	})
+	assert.Equal(t, []string{"/style.css"}, res.pushed)
+	// The compressed responses are not passed to the underlying ReadFrom...
+	assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+	assert.Zero(t, res.readFrom)
+	b, err := decodeGzip(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, testBody, string(b))
+
+	// ...while the uncompressed ones are, once the middleware has decided
+	// not to compress them.
+	res = &mockRWPushReadFrom{ResponseRecorder: httptest.NewRecorder()}
+	body := strings.Repeat(testBody, 32)
+	serve(res, func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set(contentType, "image/png")
+		n, err := rw.(io.ReaderFrom).ReadFrom(strings.NewReader(body))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(body)), n)
+	})
+	assert.Empty(t, res.Header().Get(contentEncoding))
+	assert.Equal(t, body, res.Body.String())
+	assert.NotZero(t, res.readFrom)
+
+	// The rest of the compressed responses larger than the buffer of
+	// ReadFrom is copied once the encoding has been chosen.
+	res = &mockRWPushReadFrom{ResponseRecorder: httptest.NewRecorder()}
+	body = strings.Repeat(testBody, 1+2*readFromBuf/len(testBody))
+	serve(res, func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set(contentType, "text/plain")
+		n, err := rw.(io.ReaderFrom).ReadFrom(strings.NewReader(body))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(body)), n)
+	})
+	assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+	assert.Zero(t, res.readFrom)
+	b, err = decodeGzip(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(b))
+}
+
+type mockRWPushReadFrom struct {
+	*httptest.ResponseRecorder
+	pushed   []string
+	readFrom int64
+}
+
+func (m *mockRWPushReadFrom) Push(target string, _ *http.PushOptions) error {
+	m.pushed = append(m.pushed, target)
+	return nil
+}
+
+func (m *mockRWPushReadFrom) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.Copy(m.ResponseRecorder, r)
+	m.readFrom += n
+	return n, err
+}
+
 type mockRWCloseNotify struct{ called bool }
 
 func (m *mockRWCloseNotify) CloseNotify() <-chan bool {
@@ -1079,6 +1284,7 @@ func TestAcceptRanges(t *testing.T) {
 	cases := map[string]struct {
 		contentType    string
 		writeHeader    bool
+		partial        bool
 		_range         string
 		acceptEncoding string
 		body           string
@@ -1088,15 +1294,20 @@ func TestAcceptRanges(t *testing.T) {
 		expectContentEncoding string
 	}{
 		// if the response is compressed, we do not support accept-ranges/range
-		"supported-encoding range":                      {"text/plain", false, "bytes=100-110", "gzip", testBody, "", "", "gzip"},
-		"supported-encoding range explicit-writeheader": {"text/plain", true, "bytes=100-110", "gzip", testBody, "", "", "gzip"},
+		"supported-encoding range":                      {"text/plain", false, false, "bytes=100-110", "gzip", testBody, "bytes=100-110", "", "gzip"},
+		"supported-encoding range explicit-writeheader": {"text/plain", true, false, "bytes=100-110", "gzip", testBody, "bytes=100-110", "", "gzip"},
+		// partial responses are never compressed
+		"supported-encoding partial": {"text/plain", true, true, "bytes=100-110", "gzip", testBody[100:111], "bytes=100-110", "bytes", ""},
 		// if the client does not accept one of the enabled encodings, we support accept-ranges/range
-		"unsupported-encoding range":                      {"text/plain", false, "bytes=100-110", "unknown", testBody, "bytes=100-110", "bytes", ""},
-		"unsupported-encoding range explicit-writeheader": {"text/plain", true, "bytes=100-110", "unknown", testBody, "bytes=100-110", "bytes", ""},
-		// if the content-type is not allowed to be compressed, we still strip the accept-ranges/range headers
-		// because we can't know this until the handler starts writing the response. See also the comments in adapter.go.
-		"not-whitelisted-type range":                      {"unknown/type", false, "bytes=100-110", "gzip", testBody, "", "", ""},
-		"not-whitelisted-type range explicit-writeheader": {"unknown/type", true, "bytes=100-110", "gzip", testBody, "", "", ""},
+		"unsupported-encoding range":                      {"text/plain", false, false, "bytes=100-110", "unknown", testBody, "bytes=100-110", "bytes", ""},
+		"unsupported-encoding range explicit-writeheader": {"text/plain", true, false, "bytes=100-110", "unknown", testBody, "bytes=100-110", "bytes", ""},
+		// if the content-type is not allowed to be compressed, we support accept-ranges/range
+		"not-whitelisted-type range":                      {"unknown/type", false, false, "bytes=100-110", "gzip", testBody, "bytes=100-110", "bytes", ""},
+		"not-whitelisted-type range explicit-writeheader": {"unknown/type", true, false, "bytes=100-110", "gzip", testBody, "bytes=100-110", "bytes", ""},
+		"not-whitelisted-type partial":                    {"unknown/type", true, true, "bytes=100-110", "gzip", testBody[100:111], "bytes=100-110", "bytes", ""},
+		// the responses smaller than MinSize are not compressed either
+		"below-minsize partial": {"text/plain", true, true, "bytes=100-110", "gzip", testBody[100:105], "bytes=100-110", "bytes", ""},
+		"below-minsize range":   {"text/plain", true, false, "bytes=100-110", "gzip", testBody[:5], "bytes=100-110", "bytes", ""},
 	}
 
 	for n, c := range cases {
@@ -1104,17 +1315,21 @@ func TestAcceptRanges(t *testing.T) {
 		t.Run(n, func(t *testing.T) {
 			t.Parallel()
 
+			status := http.StatusOK
+			if c.partial {
+				status = http.StatusPartialContent
+			}
 			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				assert.Equal(t, c.expectRange, r.Header.Get("Range"))
 				w.Header().Set(contentType, c.contentType)
 				w.Header().Set(acceptRanges, "bytes")
 				if c.writeHeader {
-					w.WriteHeader(http.StatusOK)
+					w.WriteHeader(status)
 				}
 				w.Write([]byte(c.body))
 			})
 
-			wrapper, err := DefaultAdapter(ContentTypes([]string{"text/plain"}, false))
+			wrapper, err := DefaultAdapter(ContentTypes([]string{"text/plain"}, false), MinSize(10))
 			assert.Nil(t, err, "DefaultAdapter returned error")
 
 			req, _ := http.NewRequest("GET", "/", nil)
@@ -1124,13 +1339,172 @@ func TestAcceptRanges(t *testing.T) {
 			wrapper(handler).ServeHTTP(resp, req)
 			res := resp.Result()
 
-			assert.Equal(t, 200, res.StatusCode)
+			assert.Equal(t, status, res.StatusCode)
 			assert.Equal(t, c.expectAcceptRanges, res.Header.Get(acceptRanges))
 			assert.Equal(t, c.expectContentEncoding, res.Header.Get(contentEncoding))
 		})
 	}
 }
 
+func TestIfRangeResume(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat(testBody, 10)
+	modtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	wrapper, err := DefaultAdapter()
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := wrapper(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(etag, `"v1"`)
+		w.Header().Set(contentType, "text/plain")
+		http.ServeContent(w, r, "", modtime, strings.NewReader(body))
+	}))
+	serve := func(header http.Header, accept string) *http.Response {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header = header
+		req.Header.Set(acceptEncoding, accept)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res.Result()
+	}
+
+	res := serve(http.Header{}, "gzip")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "gzip", res.Header.Get(contentEncoding))
+
+	// Resuming the compressed response must not return a range of the
+	// uncompressed one.
+	for _, v := range []string{res.Header.Get(etag), res.Header.Get("Last-Modified")} {
+		res = serve(http.Header{_range: {"bytes=10-"}, ifRange: {v}}, "gzip")
+		assert.Equal(t, http.StatusOK, res.StatusCode, v)
+		assert.Equal(t, "gzip", res.Header.Get(contentEncoding), v)
+	}
+
+	// The ranges are still served to the clients that do not accept the
+	// compressed responses.
+	res = serve(http.Header{_range: {"bytes=10-19"}, ifRange: {`"v1"`}}, "identity")
+	assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+	assert.Empty(t, res.Header.Get(contentEncoding))
+	b, _ := io.ReadAll(res.Body)
+	assert.Equal(t, body[10:20], string(b))
+}
+
+func TestIfRangeResumeEncodingETags(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat(testBody, 10)
+	modtime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	wrapper, err := DefaultAdapter(EncodingETags())
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := wrapper(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(etag, `"v1"`)
+		w.Header().Set(contentType, "text/plain")
+		http.ServeContent(w, r, "", modtime, strings.NewReader(body))
+	}))
+	serve := func(header http.Header) *http.Response {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header = header
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res.Result()
+	}
+
+	res := serve(http.Header{})
+	assert.Equal(t, "gzip", res.Header.Get(contentEncoding))
+	assert.Equal(t, `"v1-gzip"`, res.Header.Get(etag))
+
+	// The validators of the compressed response never match the ones of the
+	// handler, that sends the whole response again.
+	for _, v := range []string{res.Header.Get(etag), res.Header.Get("Last-Modified")} {
+		res = serve(http.Header{_range: {"bytes=10-"}, ifRange: {v}})
+		assert.Equal(t, http.StatusOK, res.StatusCode, v)
+		assert.Equal(t, "gzip", res.Header.Get(contentEncoding), v)
+	}
+
+	// The ranges of the uncompressed response are still served.
+	res = serve(http.Header{_range: {"bytes=10-19"}, ifRange: {`"v1"`}})
+	assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+	assert.Empty(t, res.Header.Get(contentEncoding))
+	b, _ := io.ReadAll(res.Body)
+	assert.Equal(t, body[10:20], string(b))
+}
+
+func TestMultipartByteRanges(t *testing.T) {
+	t.Parallel()
+
+	const ct = "multipart/byteranges; boundary=3d6b6a416f9b5"
+	body := "--3d6b6a416f9b5\r\nContent-Type: text/plain\r\nContent-Range: bytes 0-99/4000\r\n\r\n" + testBody[:100] +
+		"\r\n--3d6b6a416f9b5\r\nContent-Type: text/plain\r\nContent-Range: bytes 200-299/4000\r\n\r\n" + testBody[200:300] +
+		"\r\n--3d6b6a416f9b5--\r\n"
+	for _, c := range []struct {
+		status int
+		opts   []Option
+		enc    string
+	}{
+		{http.StatusPartialContent, nil, ""},
+		{http.StatusOK, nil, ""},
+		{http.StatusPartialContent, []Option{CompressByteRanges()}, "gzip"},
+	} {
+		wrapper, err := DefaultAdapter(append(c.opts, MinSize(0))...)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.NotEmpty(t, r.Header.Get(_range))
+			w.Header().Set(contentType, ct)
+			w.WriteHeader(c.status)
+			io.WriteString(w, body)
+		})
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		req.Header.Set(_range, "bytes=0-99,200-299")
+		res := httptest.NewRecorder()
+		wrapper(handler).ServeHTTP(res, req)
+
+		assert.Equal(t, c.status, res.Code)
+		assert.Equal(t, c.enc, res.Header().Get(contentEncoding))
+		d, err := decodeBody(res.Body, c.enc)
+		assert.NoError(t, err)
+		assert.Equal(t, body, string(d))
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	t.Parallel()
+
+	for _, body := range []string{"", testBody} {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(vary, "Origin")
+			w.Header().Set(contentType, "text/plain")
+			w.Header().Set(contentEncoding, "identity")
+			w.Header().Set("ETag", `"v1"`)
+			w.WriteHeader(http.StatusNotModified)
+			io.WriteString(w, body)
+		})
+		wrapper, err := DefaultAdapter(MinSize(0))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		req.Header.Set("If-None-Match", `"v1"`)
+		resp := httptest.NewRecorder()
+		wrapper(handler).ServeHTTP(resp, req)
+		res := resp.Result()
+
+		assert.Equal(t, http.StatusNotModified, res.StatusCode)
+		assert.Equal(t, []string{"Origin", acceptEncoding}, res.Header.Values(vary))
+		assert.Equal(t, `"v1"`, res.Header.Get("ETag"))
+		_, ok := res.Header[contentEncoding]
+		assert.False(t, ok)
+	}
+}
+
 func TestShortFirstWrite(t *testing.T) {
 	t.Parallel()
 
@@ -1179,6 +1553,10 @@ func BenchmarkAdapter(b *testing.B) {
 		comps = map[string]int{stdlibGzip: 9, andybalholmBrotli: 11}
 		sizes = []int{100, 1000, 100000}
 	}
+	if !cgoCompressors {
+		delete(comps, googleCbrotli)
+		delete(comps, valyalaGozstd)
+	}
 
 	for _, size := range sizes {
 		b.Run(fmt.Sprintf("%d", size), func(b *testing.B) {
@@ -1243,12 +1621,10 @@ func benchmark(b *testing.B, parallel bool, size int, ae string, d int) {
 		enc, err = kpgzip.New(kpgzip.Options{Level: d})
 	case andybalholmBrotli:
 		enc, err = brotli.New(brotli.Options{Quality: d})
-	case googleCbrotli:
-		enc, err = cbrotli.New(gcbrotli.WriterOptions{Quality: d})
 	case klauspostZstd:
 		enc, err = zstd.New(kpzstd.WithEncoderLevel(kpzstd.EncoderLevel(d)))
-	case valyalaGozstd:
-		enc, err = gozstd.New(vzstd.WriterParams{CompressionLevel: d})
+	default:
+		enc, err = newCgoCompressor(ae, d)
 	}
 	if err != nil {
 		b.Fatal(err)
@@ -1347,3 +1723,232 @@ func decodeGzip(i io.Reader) ([]byte, error) {
 	}
 	return io.ReadAll(r)
 }
+
+// decodeBody decodes a body with the Content-Encoding enc.
+func decodeBody(i io.Reader, enc string) ([]byte, error) {
+	switch enc {
+	case "":
+		return io.ReadAll(i)
+	case "gzip":
+		return decodeGzip(i)
+	case "br":
+		return io.ReadAll(ibrotli.NewReader(i))
+	case "deflate":
+		r, err := stdzlib.NewReader(i)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	case "zstd":
+		r, err := kpzstd.NewReader(i)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+	return nil, fmt.Errorf("unsupported encoding: %q", enc)
+}
+
+func TestOptionErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := Adapter(MinSize(-1), GzipCompressionLevel(42), Prefer(PreferType(9)), ZstandardCompressionLevel(0))
+	if !assert.Error(t, err) {
+		return
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if assert.Len(t, lines, 4) {
+		assert.True(t, strings.HasPrefix(lines[0], "MinSize: "), lines[0])
+		assert.True(t, strings.HasPrefix(lines[1], "GzipCompressionLevel: "), lines[1])
+		assert.True(t, strings.HasPrefix(lines[2], "Prefer: "), lines[2])
+		assert.True(t, strings.HasPrefix(lines[3], "ZstandardCompressionLevel: "), lines[3])
+	}
+
+	// Errors of options combined by other options keep their names.
+	_, err = Adapter(Route(MatchPathPrefix("/"), MinSize(-2)))
+	assert.ErrorContains(t, err, "MinSize: minimum size can not be negative: -2")
+
+	assert.Panics(t, func() { MustAdapter(MinSize(-1)) })
+	assert.Panics(t, func() { MustDefaultAdapter(MinSize(-1)) })
+	assert.NotNil(t, MustDefaultAdapter())
+}
+
+func TestDisableEncoding(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	c, err := newConfig(append(defaultOptions(), DisableEncoding("zstd", "deflate", "dcb", "lz4"))...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotContains(t, c.compressor, "zstd")
+	assert.NotContains(t, c.compressor, "deflate")
+	assert.Contains(t, c.compressor, "gzip")
+	assert.Contains(t, c.compressor, "br")
+	assert.NotContains(t, c.dict.comps, "dcb")
+	assert.Contains(t, c.dict.comps, "dcz")
+
+	mw, err := DefaultAdapter(DisableEncoding("zstd", "br"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testBody))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, "zstd, br, gzip")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+}
+
+func TestEncodingMinSize(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	mw, err := DefaultAdapter(MinSize(100), EncodingMinSize("br", 1000), EncodingMinSize("deflate", 50))
+	if !assert.NoError(t, err) {
+		return
+	}
+	cases := []struct {
+		accept string
+		writes []int
+		cl     bool
+		enc    string
+	}{
+		{"br, gzip", []int{500}, false, "gzip"},
+		{"br, gzip", []int{1500}, false, "br"},
+		{"br, gzip", []int{500, 700}, false, "br"},
+		{"br, gzip", []int{200, 200}, false, "gzip"},
+		{"br, gzip", []int{500}, true, "gzip"},
+		{"br, gzip", []int{50}, false, ""},
+		{"br", []int{500}, false, ""},
+		{"br", []int{500, 500}, false, "br"},
+		{"gzip, deflate", []int{70}, false, "deflate"},
+		{"gzip, deflate", []int{70}, true, "deflate"},
+		{"gzip", []int{70}, false, ""},
+	}
+	for _, c := range cases {
+		h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(contentType, "text/plain")
+			if c.cl {
+				n := 0
+				for _, l := range c.writes {
+					n += l
+				}
+				w.Header().Set(contentLength, strconv.Itoa(n))
+			}
+			for _, l := range c.writes {
+				w.Write([]byte(strings.Repeat("a", l)))
+			}
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, c.accept)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, c.enc, res.Header().Get(contentEncoding), "%+v", c)
+		body, err := decodeBody(res.Body, c.enc)
+		if assert.NoError(t, err, "%+v", c) {
+			total := 0
+			for _, l := range c.writes {
+				total += l
+			}
+			assert.Len(t, body, total, "%+v", c)
+		}
+	}
+
+	_, err = Adapter(EncodingMinSize("br", -1))
+	assert.Error(t, err)
+}
+
+func TestPriority(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	mw, err := DefaultAdapter(Priority("gzip", 100), Priority("dcb", 0))
+	if !assert.NoError(t, err) {
+		return
+	}
+	c, err := newConfig(append(defaultOptions(), Priority("gzip", 100), Priority("dcb", 0))...)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, c.dict.comps["dcb"].priority)
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testBody))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, "zstd, br, gzip")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+
+	_, err = DefaultAdapter(Priority("lz4", 1))
+	assert.Error(t, err)
+}
+
+func TestEncodingFromRequest(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	mw, err := DefaultAdapter()
+	if !assert.NoError(t, err) {
+		return
+	}
+	var enc string
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc = EncodingFromRequest(r)
+	}))
+	for accept, want := range map[string]string{
+		"gzip, br":   "br",
+		"gzip":       "gzip",
+		"identity":   "",
+		"":           "",
+		"zstd;q=0.1": "zstd",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, accept)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, want, enc, accept)
+	}
+	assert.Equal(t, "", EncodingFromRequest(httptest.NewRequest("GET", "/", nil)))
+}
+
+func TestAlwaysCompressContentTypes(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	mw, err := DefaultAdapter(AlwaysCompressContentTypes("image/svg+xml", "application/wasm"), EncodingMinSize("br", 1000))
+	if !assert.NoError(t, err) {
+		return
+	}
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg"><rect/></svg>`
+	for _, c := range []struct {
+		ct, accept, enc string
+	}{
+		{"image/svg+xml", "gzip", "gzip"},
+		{"image/svg+xml; charset=utf-8", "gzip, br", "br"},
+		{"application/wasm", "gzip", "gzip"},
+		{"text/plain", "gzip", ""},
+		{"", "gzip", ""},
+	} {
+		h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c.ct != "" {
+				w.Header().Set(contentType, c.ct)
+			}
+			w.Write([]byte(svg))
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, c.accept)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, c.enc, res.Header().Get(contentEncoding), c.ct)
+		body, err := decodeBody(res.Body, c.enc)
+		if assert.NoError(t, err) {
+			assert.Equal(t, svg, string(body), c.ct)
+		}
+	}
+
+	_, err = Adapter(AlwaysCompressContentTypes("text/html; x"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,301 @@
+package httpcompression
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cgzip "github.com/CAFxX/httpcompression/contrib/compress/gzip"
+	"github.com/CAFxX/httpcompression/contrib/compress/zlib"
+)
+
+// adminRecentErrors is the number of recent errors reported by AdminHandler.
+const adminRecentErrors = 10
+
+// AdminReport is the live state of a Middleware, as served by its
+// AdminHandler.
+type AdminReport struct {
+	// Disabled reports whether the compression of the responses has been
+	// disabled (see Middleware.Disable).
+	Disabled bool `json:"disabled,omitempty"`
+	// Config is the current configuration of the middleware.
+	Config ConfigReport `json:"config"`
+	// Providers is the health of the providers of the configured
+	// compressors, by decreasing priority.
+	Providers []ProviderReport `json:"providers"`
+	// Pools are the statistics of the pools of the middleware, that are
+	// shared with the middlewares returned by With.
+	Pools PoolReport `json:"pools"`
+	// Since is when the middleware started counting the responses.
+	Since time.Time `json:"since"`
+	// Responses is the number of responses completed by the middleware, by
+	// Content-Encoding ("identity" for the responses not compressed).
+	Responses map[string]uint64 `json:"responses"`
+	// Errors is the number of responses that failed to be completed (e.g.
+	// because a compressor or the connection failed), by Content-Encoding.
+	Errors map[string]uint64 `json:"errors,omitempty"`
+	// RecentErrors are the last errors, most recent first.
+	RecentErrors []AdminError `json:"recentErrors,omitempty"`
+	// Costs are the costs of compressing the responses by pattern, if the
+	// TrackCosts option is used.
+	Costs map[string]CostStats `json:"costs,omitempty"`
+}
+
+// ProviderReport describes the health of the provider of a compressor (see
+// AdminReport).
+type ProviderReport struct {
+	// Encoding is the Content-Encoding of the compressor.
+	Encoding string `json:"encoding"`
+	// Provider is the Go type of the CompressorProvider.
+	Provider string `json:"provider"`
+	// Healthy reports whether the provider is usable: providers
+	// implementing HealthChecker report their own health, and a failover
+	// chain is healthy if any of its providers is.
+	Healthy bool `json:"healthy"`
+	// Failover is the health of each provider of the chain, if the
+	// compressor was configured with FailoverCompressor.
+	Failover []FailoverReport `json:"failover,omitempty"`
+}
+
+// FailoverReport is the health of a provider of a failover chain (see
+// FailoverCompressor).
+type FailoverReport struct {
+	// Provider is the Go type of the CompressorProvider.
+	Provider string `json:"provider"`
+	// Healthy reports whether the provider is usable.
+	Healthy bool `json:"healthy"`
+}
+
+// PoolReport holds the statistics of the pools of a Middleware (see
+// AdminReport).
+type PoolReport struct {
+	// Writers is the pool of the ResponseWriters passed to the handlers.
+	Writers PoolStats `json:"writers"`
+	// Buffers is the pool of the buffers holding the beginning of the
+	// responses, until the Content-Encoding is chosen.
+	Buffers PoolStats `json:"buffers"`
+}
+
+// PoolStats are the statistics of a pool (see PoolReport).
+type PoolStats struct {
+	// Gets is the number of objects obtained from the pool.
+	Gets uint64 `json:"gets"`
+	// News is the number of objects allocated because the pool was empty.
+	News uint64 `json:"news"`
+	// InUse is the number of objects currently in use.
+	InUse int64 `json:"inUse"`
+}
+
+// AdminError is an error that occurred while completing a response (see
+// AdminReport).
+type AdminError struct {
+	Time     time.Time `json:"time"`
+	Encoding string    `json:"encoding"`
+	URL      string    `json:"url"`
+	Error    string    `json:"error"`
+}
+
+// AdminHandler returns a handler that responds to GET requests with a JSON
+// AdminReport describing the live state of the middleware: its current
+// configuration, the health of its providers, the statistics of its pools,
+// and the number of responses and errors since it was created. It is meant
+// for operational introspection, so it must be mounted behind an internal
+// port or an authenticating middleware, and not wrapped by m.
+//
+// If allowChanges is true, the handler also accepts POST requests changing
+// the options of the middleware, in the form values:
+//
+//   - encoding=gzip&level=9 sets the compression level of an encoding
+//     (gzip, deflate, br or zstd, see GzipCompressionLevel and the other
+//     *CompressionLevel options);
+//   - encoding=br&disable=true disables an encoding (see DisableEncoding);
+//   - disable=true, without an encoding, disables the compression of all the
+//     responses, and disable=false enables it again (see Middleware.Disable).
+//
+// The changes of the encodings apply on top of the current options, until
+// the next Reload, and the response is the AdminReport reflecting them. Invalid changes are
+// rejected with a 400 Bad Request, keeping the current options.
+func (m *Middleware) AdminHandler(allowChanges bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		case r.Method == http.MethodPost && allowChanges:
+			if err := m.adminChange(r); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			allow := "GET, HEAD"
+			if allowChanges {
+				allow += ", POST"
+			}
+			w.Header().Set("Allow", allow)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		b, err := json.MarshalIndent(m.adminReport(), "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(contentType, "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(append(b, '\n'))
+	})
+}
+
+// adminLevelOptions are the options setting the compression level of each
+// encoding, for AdminHandler.
+var adminLevelOptions = map[string]func(level int) Option{
+	cgzip.Encoding:    GzipCompressionLevel,
+	zlib.Encoding:     DeflateCompressionLevel,
+	brotliEncoding:    BrotliCompressionLevel,
+	zstandardEncoding: ZstandardCompressionLevel,
+}
+
+func (m *Middleware) adminChange(r *http.Request) error {
+	enc := r.FormValue("encoding")
+	if enc == "" {
+		v := r.FormValue("disable")
+		if v == "" {
+			return fmt.Errorf("missing encoding")
+		}
+		disable, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid disable %q", v)
+		}
+		m.disabled.Store(disable)
+		return nil
+	}
+	var opts []Option
+	if v := r.FormValue("level"); v != "" {
+		level, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid level %q", v)
+		}
+		opt, ok := adminLevelOptions[enc]
+		if !ok {
+			return fmt.Errorf("the compression level of %q can not be changed", enc)
+		}
+		opts = append(opts, opt(level))
+	}
+	if v := r.FormValue("disable"); v != "" {
+		disable, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid disable %q", v)
+		}
+		if disable {
+			opts = append(opts, DisableEncoding(enc))
+		}
+	}
+	if len(opts) == 0 {
+		return fmt.Errorf("no changes for %q", enc)
+	}
+	return m.update(opts...)
+}
+
+func (m *Middleware) adminReport() AdminReport {
+	c := m.current().config
+	rep := AdminReport{
+		Disabled: m.disabled.Load(),
+		Config:   c.report(),
+		Pools: PoolReport{
+			Writers: m.pools.writerStats.stats(),
+			Buffers: m.pools.bufStats.stats(),
+		},
+	}
+	if c.costs != nil {
+		rep.Costs = c.costs.Stats()
+	}
+	for _, e := range rep.Config.Encodings {
+		rep.Providers = append(rep.Providers, providerReport(e.Encoding, c.compressor[e.Encoding].comp))
+	}
+	m.stats.report(&rep)
+	return rep
+}
+
+func providerReport(enc string, p CompressorProvider) ProviderReport {
+	rep := ProviderReport{Encoding: enc, Provider: fmt.Sprintf("%T", p), Healthy: true}
+	switch p := p.(type) {
+	case *failover:
+		rep.Healthy = false
+		for i, healthy := range p.health() {
+			rep.Failover = append(rep.Failover, FailoverReport{Provider: fmt.Sprintf("%T", p.providers[i]), Healthy: healthy})
+			rep.Healthy = rep.Healthy || healthy
+		}
+	case HealthChecker:
+		rep.Healthy = p.Healthy()
+	}
+	return rep
+}
+
+func (pc *poolCounters) stats() PoolStats {
+	return PoolStats{Gets: pc.gets.Load(), News: pc.news.Load(), InUse: pc.inUse.Load()}
+}
+
+// adminStats counts the responses completed by a Middleware.
+type adminStats struct {
+	since     time.Time
+	responses sync.Map // Content-Encoding -> *atomic.Uint64
+	errors    sync.Map // Content-Encoding -> *atomic.Uint64
+
+	mu     sync.Mutex
+	recent []AdminError // the last adminRecentErrors errors, oldest first
+}
+
+func newAdminStats() *adminStats {
+	return &adminStats{since: time.Now()}
+}
+
+func (s *adminStats) hook() WriterHook {
+	return WriterHook{Closed: func(r *http.Request, enc string, err error) {
+		if enc == "" {
+			enc = identity
+		}
+		count(&s.responses, enc)
+		if err == nil {
+			return
+		}
+		count(&s.errors, enc)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if len(s.recent) == adminRecentErrors {
+			s.recent = append(s.recent[:0], s.recent[1:]...)
+		}
+		s.recent = append(s.recent, AdminError{Time: time.Now(), Encoding: enc, URL: r.URL.String(), Error: err.Error()})
+	}}
+}
+
+func count(m *sync.Map, key string) {
+	n, ok := m.Load(key)
+	if !ok {
+		n, _ = m.LoadOrStore(key, new(atomic.Uint64))
+	}
+	n.(*atomic.Uint64).Add(1)
+}
+
+func counts(m *sync.Map) map[string]uint64 {
+	c := map[string]uint64{}
+	m.Range(func(k, v any) bool {
+		c[k.(string)] = v.(*atomic.Uint64).Load()
+		return true
+	})
+	return c
+}
+
+func (s *adminStats) report(rep *AdminReport) {
+	rep.Since = s.since
+	rep.Responses = counts(&s.responses)
+	if errs := counts(&s.errors); len(errs) > 0 {
+		rep.Errors = errs
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.recent) - 1; i >= 0; i-- {
+		rep.RecentErrors = append(rep.RecentErrors, s.recent[i])
+	}
+}
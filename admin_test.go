@@ -0,0 +1,131 @@
+package httpcompression
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminHandler(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	m, err := DefaultMiddleware()
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(testBody))
+	}))
+	get := func(accept string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, accept)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res.Header().Get(contentEncoding)
+	}
+	report := func(ah http.Handler, method string, form url.Values) (AdminReport, int) {
+		req := httptest.NewRequest(method, "/debug/compression/admin", strings.NewReader(form.Encode()))
+		req.Header.Set(contentType, "application/x-www-form-urlencoded")
+		res := httptest.NewRecorder()
+		ah.ServeHTTP(res, req)
+		var rep AdminReport
+		if res.Code == http.StatusOK {
+			assert.Equal(t, "application/json", res.Header().Get(contentType))
+			assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &rep))
+		}
+		return rep, res.Code
+	}
+
+	assert.Equal(t, "br", get("gzip, br"))
+	assert.Equal(t, "", get("identity"))
+
+	ro := m.AdminHandler(false)
+	rep, code := report(ro, "GET", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]uint64{"br": 1, "identity": 1}, rep.Responses)
+	assert.Empty(t, rep.Errors)
+	assert.Equal(t, uint64(1), rep.Pools.Writers.Gets) // the identity response does not use a writer
+	assert.Equal(t, int64(0), rep.Pools.Writers.InUse)
+	assert.Equal(t, int64(0), rep.Pools.Buffers.InUse)
+	if assert.Len(t, rep.Providers, len(rep.Config.Encodings)) {
+		for i, p := range rep.Providers {
+			assert.Equal(t, rep.Config.Encodings[i].Encoding, p.Encoding)
+			assert.True(t, p.Healthy, p.Encoding)
+		}
+	}
+	_, code = report(ro, "POST", url.Values{"encoding": {"br"}, "disable": {"true"}})
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+	assert.Equal(t, "br", get("gzip, br"))
+
+	rw := m.AdminHandler(true)
+	rep, code = report(rw, "POST", url.Values{"encoding": {"br"}, "disable": {"true"}})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "gzip", get("gzip, br"))
+	for _, e := range rep.Config.Encodings {
+		assert.NotEqual(t, "br", e.Encoding)
+	}
+
+	rep, code = report(rw, "POST", url.Values{"encoding": {"gzip"}, "level": {"1"}})
+	assert.Equal(t, http.StatusOK, code)
+	for _, e := range rep.Config.Encodings {
+		if e.Encoding == "gzip" && assert.NotNil(t, e.Level) {
+			assert.Equal(t, 1, *e.Level)
+		}
+	}
+
+	for _, form := range []url.Values{
+		{},
+		{"encoding": {"gzip"}},
+		{"encoding": {"gzip"}, "level": {"fast"}},
+		{"encoding": {"gzip"}, "level": {"42"}},
+		{"encoding": {"unknown"}, "level": {"1"}},
+	} {
+		_, code = report(rw, "POST", form)
+		assert.Equal(t, http.StatusBadRequest, code, form.Encode())
+	}
+	assert.Equal(t, "gzip", get("gzip, br"))
+
+	// Reload replaces the changes.
+	assert.NoError(t, m.Reload())
+	assert.Equal(t, "br", get("gzip, br"))
+}
+
+func TestAdminHandlerErrors(t *testing.T) {
+	t.Parallel()
+
+	p := newFailingProvider(t, 0)
+	m, err := NewMiddleware(GzipCompressor(p), MinSize(0))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testBody))
+	}))
+	req := httptest.NewRequest("GET", "/broken?id=1", nil)
+	req.Header.Set(acceptEncoding, "gzip")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	p.healthy.Store(false)
+
+	res := httptest.NewRecorder()
+	m.AdminHandler(false).ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+	var rep AdminReport
+	if !assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &rep)) {
+		return
+	}
+	assert.Equal(t, map[string]uint64{"gzip": 1}, rep.Errors)
+	if assert.Len(t, rep.RecentErrors, 1) {
+		assert.Equal(t, "gzip", rep.RecentErrors[0].Encoding)
+		assert.Equal(t, "/broken?id=1", rep.RecentErrors[0].URL)
+		assert.Equal(t, errTestCompressor.Error(), rep.RecentErrors[0].Error)
+	}
+	if assert.Len(t, rep.Providers, 1) {
+		assert.False(t, rep.Providers[0].Healthy)
+	}
+}
@@ -0,0 +1,248 @@
+package httpcompression
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	cgzip "github.com/CAFxX/httpcompression/contrib/compress/gzip"
+)
+
+// ArchiveFormat is the format of the archives served by Archive.
+type ArchiveFormat int
+
+const (
+	// TarGz is a tar archive compressed with gzip (application/gzip).
+	TarGz ArchiveFormat = iota
+	// Zip is a zip archive, whose files are compressed with deflate
+	// (application/zip).
+	Zip
+)
+
+// ArchiveEntry is a file of the archives served by Archive.
+type ArchiveEntry struct {
+	// Name is the slash-separated path of the file in the archive.
+	Name string
+	// Size is the size of the file. It must be exact for TarGz archives,
+	// whose headers precede the content of the files.
+	Size int64
+	// Mode is the mode of the file; if zero, 0644 is used.
+	Mode fs.FileMode
+	// ModTime is the modification time of the file.
+	ModTime time.Time
+	// Open returns the content of the file.
+	Open func() (io.ReadCloser, error)
+}
+
+// Archive is a handler streaming a set of files as a downloadable archive
+// (e.g. for "download all" endpoints), compressing them with the same pooled
+// gzip compressors used by the middleware for TarGz archives, and with
+// pooled deflate writers for Zip archives. The archive is written while the
+// files are read, so it is never buffered, and the streaming stops as soon
+// as the client goes away (i.e. when the context of the request is done).
+//
+// As the archives are already compressed, Archive must not be wrapped by the
+// middleware, unless application/gzip and application/zip are excluded
+// with ContentTypes.
+type Archive struct {
+	// Format is the format of the archive.
+	Format ArchiveFormat
+	// Name is the file name of the archive proposed to the client, in the
+	// Content-Disposition header (e.g. "files.tar.gz").
+	Name string
+	// Level is the gzip or deflate compression level; if zero, the default
+	// level is used.
+	Level int
+	// Entries returns the files of the archive served for r. If it returns
+	// an error, the response is a 500 Internal Server Error.
+	Entries func(r *http.Request) ([]ArchiveEntry, error)
+
+	once  sync.Once
+	err   error
+	gzip  CompressorProvider
+	flate sync.Pool
+}
+
+// ArchiveFS returns a function, for Archive.Entries, returning all the
+// regular files in fsys.
+func ArchiveFS(fsys fs.FS) func(r *http.Request) ([]ArchiveEntry, error) {
+	return func(r *http.Request) ([]ArchiveEntry, error) {
+		var entries []ArchiveEntry
+		err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			entries = append(entries, ArchiveEntry{
+				Name:    name,
+				Size:    fi.Size(),
+				Mode:    fi.Mode(),
+				ModTime: fi.ModTime(),
+				Open:    func() (io.ReadCloser, error) { return fsys.Open(name) },
+			})
+			return nil
+		})
+		return entries, err
+	}
+}
+
+func (a *Archive) init() {
+	level := a.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	if a.Format == TarGz {
+		a.gzip, a.err = cgzip.New(cgzip.Options{Level: level})
+		return
+	}
+	if _, err := flate.NewWriter(io.Discard, level); err != nil {
+		a.err = err
+		return
+	}
+	a.flate.New = func() any {
+		fw, _ := flate.NewWriter(nil, level)
+		return fw
+	}
+}
+
+// ServeHTTP implements http.Handler. If writing the archive fails after the
+// response has been started, the response is aborted (see
+// http.ErrAbortHandler), so that the client does not receive a truncated
+// archive that looks complete.
+func (a *Archive) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.once.Do(a.init)
+	if a.err != nil {
+		http.Error(w, a.err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entries, err := a.Entries(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ct := "application/gzip"
+	if a.Format == Zip {
+		ct = "application/zip"
+	}
+	w.Header().Set(contentType, ct)
+	if a.Name != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+	}
+	if a.Format == Zip {
+		err = a.writeZip(r.Context(), w, entries)
+	} else {
+		err = a.writeTarGz(r.Context(), w, entries)
+	}
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (a *Archive) writeTarGz(ctx context.Context, w io.Writer, entries []ArchiveEntry) error {
+	gw := a.gzip.Get(w)
+	defer gw.Close()
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     e.Name,
+			Size:     e.Size,
+			Mode:     int64(entryMode(e)),
+			ModTime:  e.ModTime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if err := copyEntry(ctx, tw, e); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func (a *Archive) writeZip(ctx context.Context, w io.Writer, entries []ArchiveEntry) error {
+	zw := zip.NewWriter(w)
+	zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		fw := a.flate.Get().(*flate.Writer)
+		fw.Reset(w)
+		return &pooledFlateWriter{Writer: fw, pool: &a.flate}, nil
+	})
+	for _, e := range entries {
+		hdr := &zip.FileHeader{
+			Name:     e.Name,
+			Method:   zip.Deflate,
+			Modified: e.ModTime,
+		}
+		hdr.SetMode(entryMode(e))
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if err := copyEntry(ctx, fw, e); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func entryMode(e ArchiveEntry) fs.FileMode {
+	if e.Mode == 0 {
+		return 0644
+	}
+	return e.Mode.Perm()
+}
+
+// copyEntry copies the content of e to w, until ctx is done.
+func copyEntry(ctx context.Context, w io.Writer, e ArchiveEntry) error {
+	r, err := e.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, ctxReader{ctx, r})
+	return err
+}
+
+// ctxReader is a reader that fails once its context is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(b []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(b)
+}
+
+// pooledFlateWriter returns its flate.Writer to the pool once closed.
+type pooledFlateWriter struct {
+	*flate.Writer
+	pool *sync.Pool
+}
+
+func (w *pooledFlateWriter) Close() error {
+	if w.Writer == nil {
+		return nil
+	}
+	err := w.Writer.Close()
+	w.Writer.Reset(nil)
+	w.pool.Put(w.Writer)
+	w.Writer = nil
+	return err
+}
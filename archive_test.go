@@ -0,0 +1,95 @@
+package httpcompression
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchive(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte(testBody), Mode: 0600},
+		"css/style.css": {Data: []byte(testBody[:100])},
+		"empty":         {},
+	}
+	exp := map[string]string{
+		"index.html":    testBody,
+		"css/style.css": testBody[:100],
+		"empty":         "",
+	}
+
+	for _, format := range []ArchiveFormat{TarGz, Zip} {
+		a := &Archive{Format: format, Name: "all files.tar.gz", Entries: ArchiveFS(fsys)}
+		req := httptest.NewRequest("GET", "/download", nil)
+		res := httptest.NewRecorder()
+		a.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, `attachment; filename="all files.tar.gz"`, res.Header().Get("Content-Disposition"))
+		files := map[string]string{}
+		if format == TarGz {
+			assert.Equal(t, "application/gzip", res.Header().Get(contentType))
+			gr, err := gzip.NewReader(res.Body)
+			if !assert.NoError(t, err) {
+				continue
+			}
+			tr := tar.NewReader(gr)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err) {
+					break
+				}
+				b, err := io.ReadAll(tr)
+				assert.NoError(t, err)
+				files[hdr.Name] = string(b)
+				if hdr.Name == "index.html" {
+					assert.EqualValues(t, 0600, hdr.Mode)
+				}
+			}
+		} else {
+			assert.Equal(t, "application/zip", res.Header().Get(contentType))
+			zr, err := zip.NewReader(bytes.NewReader(res.Body.Bytes()), int64(res.Body.Len()))
+			if !assert.NoError(t, err) {
+				continue
+			}
+			for _, f := range zr.File {
+				assert.Equal(t, zip.Deflate, f.Method)
+				r, err := f.Open()
+				if !assert.NoError(t, err) {
+					continue
+				}
+				b, err := io.ReadAll(r)
+				assert.NoError(t, err)
+				files[f.Name] = string(b)
+			}
+		}
+		assert.Equal(t, exp, files)
+
+		// The streaming stops once the client goes away.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req = httptest.NewRequest("GET", "/download", nil).WithContext(ctx)
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			a.ServeHTTP(httptest.NewRecorder(), req)
+		})
+	}
+
+	a := &Archive{Format: Zip, Level: 42, Entries: ArchiveFS(fsys)}
+	res := httptest.NewRecorder()
+	a.ServeHTTP(res, httptest.NewRequest("GET", "/download", nil))
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+}
@@ -0,0 +1,49 @@
+package httpcompression
+
+import (
+	"net/http"
+	"strings"
+
+	cgzip "github.com/CAFxX/httpcompression/contrib/compress/gzip"
+)
+
+const userAgent = "User-Agent"
+
+// AssumeGzip is an option that, for the requests without an Accept-Encoding
+// header, assumes that the client accepts gzip if its User-Agent contains
+// one of userAgents (if none is specified, "Mozilla/5.0", that is sent by
+// all the modern browsers). Some proxies strip the Accept-Encoding header:
+// like Apache's mod_deflate configurations using BrowserMatch, this
+// heuristic allows to still compress the responses to the clients that are
+// known to support gzip.
+//
+// Requests with an empty Accept-Encoding header are not affected, as the
+// clients explicitly asked for uncompressed responses. The responses to the
+// requests without Accept-Encoding have a Vary: User-Agent header, as they
+// depend on it.
+func AssumeGzip(userAgents ...string) Option {
+	if len(userAgents) == 0 {
+		userAgents = []string{"Mozilla/5.0"}
+	}
+	userAgents = append([]string(nil), userAgents...)
+	return func(c *config) error {
+		c.assumeGzip = userAgents
+		return nil
+	}
+}
+
+// assumeGzipFor adds gzip to accept if the request has no Accept-Encoding
+// header and its User-Agent is known (see AssumeGzip).
+func (c *config) assumeGzipFor(w http.ResponseWriter, r *http.Request, accept codings) {
+	if _, ok := r.Header[acceptEncoding]; ok {
+		return
+	}
+	addVaryHeader(w.Header(), userAgent)
+	ua := r.Header.Get(userAgent)
+	for _, s := range c.assumeGzip {
+		if strings.Contains(ua, s) {
+			accept[cgzip.Encoding] = defaultQValue
+			return
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssumeGzip(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	a, err := DefaultAdapter(AssumeGzip())
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(strings.Repeat(testBody, 10)))
+	}))
+	serve := func(ua string, accept ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(userAgent, ua)
+		if len(accept) > 0 {
+			req.Header.Set(acceptEncoding, accept[0])
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	const browser = "Mozilla/5.0 (X11; Linux x86_64; rv:130.0) Gecko/20100101 Firefox/130.0"
+	res := serve(browser)
+	assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+	assert.Contains(t, res.Header().Values(vary), userAgent)
+	d, err := decodeGzip(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat(testBody, 10), string(d))
+
+	assert.Equal(t, "", serve("curl/8.0").Header().Get(contentEncoding))
+	res = serve(browser, "")
+	assert.Equal(t, "", res.Header().Get(contentEncoding))
+	assert.NotContains(t, res.Header().Values(vary), userAgent)
+	assert.Equal(t, "br", serve(browser, "br").Header().Get(contentEncoding))
+}
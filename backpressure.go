@@ -0,0 +1,124 @@
+package httpcompression
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// LevelSetter is an optional interface that can be implemented by the
+// compressors returned by CompressorProvider.Get whose compression level can
+// be changed while compressing a stream (see Backpressure).
+type LevelSetter interface {
+	// SetLevel sets the compression level of the data written from now on,
+	// with the same meaning of the levels of the compressor.
+	SetLevel(level int) error
+}
+
+// BackpressureLevels are the compression levels used for an encoding by the
+// Backpressure option.
+type BackpressureLevels struct {
+	// Fast is the level used when the client reads the response as fast as
+	// it is written.
+	Fast int
+	// Slow is the level used when the client can not keep up with the
+	// response.
+	Slow int
+}
+
+// Backpressure is an option that adapts the compression level of each
+// compressed response to the speed of the client: the time spent writing
+// the compressed data to the underlying ResponseWriter is measured, and when
+// it exceeds threshold (on average, for each write) the CPU is not the
+// bottleneck, so the response is compressed with the Slow level; when the
+// writes take less than a quarter of threshold the response is compressed
+// with the Fast level again.
+//
+// The levels are set in levels, by Content-Encoding, and they are only
+// changed for the compressors implementing LevelSetter (e.g. the zstd
+// compressor of DefaultAdapter); the responses start with the level of the
+// compressor. The errors returned by SetLevel are returned by the writes of
+// the handler. Backpressure is ignored when the Deterministic option is used.
+func Backpressure(threshold time.Duration, levels map[string]BackpressureLevels) Option {
+	return named("Backpressure", func(c *config) error {
+		if threshold <= 0 {
+			return fmt.Errorf("backpressure threshold must be positive: %v", threshold)
+		}
+		if len(levels) == 0 {
+			return fmt.Errorf("backpressure levels can not be empty")
+		}
+		bp := &backpressureConfig{threshold: threshold, levels: make(map[string]BackpressureLevels, len(levels))}
+		for enc, l := range levels {
+			bp.levels[enc] = l
+		}
+		c.backpressure = bp
+		return nil
+	})
+}
+
+type backpressureConfig struct {
+	threshold time.Duration
+	levels    map[string]BackpressureLevels
+}
+
+// levelParent is the parent of a compressor whose level is adapted to the
+// time spent writing its output (see Backpressure).
+type levelParent struct {
+	w         io.Writer
+	ls        LevelSetter // the compressor, if it implements LevelSetter
+	threshold time.Duration
+	levels    BackpressureLevels
+	level     int           // the current level, or -1 if unknown
+	avg       time.Duration // the moving average of the time spent in each write
+	want      int           // the level to be set by adjust, or -1
+}
+
+func newLevelParent(w io.Writer, bp *backpressureConfig, levels BackpressureLevels, level *int) *levelParent {
+	p := &levelParent{w: w, threshold: bp.threshold, levels: levels, level: -1, want: -1}
+	if level != nil {
+		p.level = *level
+	}
+	return p
+}
+
+func (p *levelParent) Write(b []byte) (int, error) {
+	start := time.Now()
+	n, err := p.w.Write(b)
+	d := time.Since(start)
+	if p.avg == 0 {
+		p.avg = d
+	} else {
+		p.avg = (3*p.avg + d) / 4
+	}
+	switch {
+	case p.avg >= p.threshold:
+		p.want = p.levels.Slow
+	case p.avg < p.threshold/4:
+		p.want = p.levels.Fast
+	}
+	return n, err
+}
+
+// adjust changes the level of the compressor, if needed. It must not be
+// called while the compressor is writing to p.
+func (p *levelParent) adjust() error {
+	if p.ls == nil || p.want < 0 || p.want == p.level {
+		return nil
+	}
+	level := p.want
+	p.want = -1
+	if err := p.ls.SetLevel(level); err != nil {
+		return err
+	}
+	p.level = level
+	return nil
+}
+
+// writeAdjusting writes b to the compressor, and then adjusts its level.
+func (w *compressWriter) writeAdjusting(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	if err == nil {
+		err = w.level.adjust()
+	}
+	return n, err
+}
@@ -0,0 +1,93 @@
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// levelProvider is a provider whose compressors record the levels set by
+// SetLevel.
+type levelProvider struct {
+	CompressorProvider
+	mu     sync.Mutex
+	levels []int
+}
+
+func (p *levelProvider) Get(w io.Writer) io.WriteCloser {
+	return &levelWriter{WriteCloser: p.CompressorProvider.Get(w), p: p}
+}
+
+type levelWriter struct {
+	io.WriteCloser
+	p *levelProvider
+}
+
+func (w *levelWriter) Flush() error {
+	return w.WriteCloser.(Flusher).Flush()
+}
+
+func (w *levelWriter) SetLevel(level int) error {
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+	w.p.levels = append(w.p.levels, level)
+	return nil
+}
+
+// slowResponseWriter is a ResponseWriter whose writes take delay.
+type slowResponseWriter struct {
+	*httptest.ResponseRecorder
+	delay time.Duration
+}
+
+func (w slowResponseWriter) Write(b []byte) (int, error) {
+	time.Sleep(w.delay)
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestBackpressure(t *testing.T) {
+	t.Parallel()
+
+	serve := func(delay time.Duration) []int {
+		gz, err := NewDefaultGzipCompressor(6)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		p := &levelProvider{CompressorProvider: gz}
+		a, err := Adapter(GzipCompressor(p), Backpressure(time.Millisecond, map[string]BackpressureLevels{
+			"gzip": {Fast: 1, Slow: 9},
+		}))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(contentType, "text/plain")
+			for i := 0; i < 4; i++ {
+				io.WriteString(w, testBody)
+				w.(http.Flusher).Flush()
+			}
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := slowResponseWriter{httptest.NewRecorder(), delay}
+		h.ServeHTTP(res, req)
+		assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+		b, err := decodeGzip(res.Body)
+		assert.NoError(t, err)
+		assert.Len(t, b, 4*len(testBody))
+		return p.levels
+	}
+
+	assert.Equal(t, []int{1}, serve(0))
+	assert.Contains(t, serve(5*time.Millisecond), 9)
+
+	_, err := Adapter(Backpressure(0, map[string]BackpressureLevels{"gzip": {1, 9}}))
+	assert.Error(t, err)
+	_, err = Adapter(Backpressure(time.Millisecond, nil))
+	assert.Error(t, err)
+}
@@ -0,0 +1,272 @@
+// Package bench replays recorded responses through a configured
+// httpcompression middleware, and reports its throughput, compression ratio,
+// allocations and latency, so that configurations can be compared
+// reproducibly, on the same responses, across machines.
+//
+//	responses, err := bench.LoadDir("./samples")
+//	compress, err := httpcompression.DefaultAdapter(httpcompression.BrotliCompressionLevel(5))
+//	res, err := bench.Run(compress, responses, bench.Config{Requests: 10000})
+//	fmt.Println(res)
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultAcceptEncoding is the Accept-Encoding of the requests of the
+// Responses that do not specify one.
+const DefaultAcceptEncoding = "gzip, deflate, br, zstd"
+
+// Response is a recorded response, served to the middleware by Run.
+type Response struct {
+	// Method and Target are the method and the request-target of the
+	// request (by default GET /).
+	Method, Target string
+	// AcceptEncoding is the Accept-Encoding header of the request; if
+	// empty, DefaultAcceptEncoding is used.
+	AcceptEncoding string
+	// Status is the status code of the response (by default 200).
+	Status int
+	// Header is the header of the response, e.g. with its Content-Type.
+	Header http.Header
+	// Body is the uncompressed body of the response.
+	Body []byte
+}
+
+// Config controls how Run replays the responses.
+type Config struct {
+	// Requests is the number of requests served, cycling through the
+	// responses. If zero, each response is served once.
+	Requests int
+	// Concurrency is the number of requests served concurrently. If zero,
+	// runtime.GOMAXPROCS(0) is used.
+	Concurrency int
+}
+
+// Result is the result of Run.
+type Result struct {
+	// Requests is the number of requests served.
+	Requests int
+	// Duration is the time taken to serve all the requests.
+	Duration time.Duration
+	// UncompressedBytes is the size of the bodies written by the handler.
+	UncompressedBytes int64
+	// CompressedBytes is the size of the bodies written by the middleware.
+	CompressedBytes int64
+	// Encodings is the number of responses by Content-Encoding ("identity"
+	// for the uncompressed responses).
+	Encodings map[string]int
+	// Allocs and AllocBytes are the number and size of the heap
+	// allocations per request, including the (few) allocations of the
+	// harness itself.
+	Allocs, AllocBytes float64
+	// P50 and P99 are the median and the 99th percentile of the latency of
+	// the requests.
+	P50, P99 time.Duration
+}
+
+// Throughput returns the number of requests served per second.
+func (r Result) Throughput() float64 {
+	return float64(r.Requests) / r.Duration.Seconds()
+}
+
+// Ratio returns the compressed size of the responses relative to their
+// uncompressed size.
+func (r Result) Ratio() float64 {
+	if r.UncompressedBytes == 0 {
+		return 1
+	}
+	return float64(r.CompressedBytes) / float64(r.UncompressedBytes)
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%d requests in %v: %.0f req/s, ratio %.3f, %.1f allocs/req (%.0f B/req), p50 %v, p99 %v",
+		r.Requests, r.Duration.Round(time.Millisecond), r.Throughput(), r.Ratio(), r.Allocs, r.AllocBytes, r.P50, r.P99)
+}
+
+// Run serves the responses through the middleware, as configured by cfg, and
+// reports how it performed. The responses are written to a ResponseWriter
+// discarding them, so that only the cost of the middleware is measured.
+func Run(middleware func(http.Handler) http.Handler, responses []Response, cfg Config) (Result, error) {
+	if len(responses) == 0 {
+		return Result{}, errors.New("no responses")
+	}
+	if cfg.Requests <= 0 {
+		cfg.Requests = len(responses)
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	handlers := make([]http.Handler, len(responses))
+	requests := make([]*http.Request, len(responses))
+	for i, resp := range responses {
+		handlers[i] = middleware(handler(resp))
+		requests[i] = request(resp)
+	}
+
+	var (
+		next      atomic.Int64
+		wg        sync.WaitGroup
+		workers   = make([]*worker, cfg.Concurrency)
+		before    runtime.MemStats
+		after     runtime.MemStats
+		latencies = make([]time.Duration, 0, cfg.Requests)
+	)
+	for i := range workers {
+		workers[i] = &worker{
+			w:         discardWriter{h: http.Header{}},
+			encodings: map[string]int{},
+			latencies: make([]time.Duration, 0, cfg.Requests/cfg.Concurrency+1),
+		}
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for _, wk := range workers {
+		wg.Add(1)
+		go func(wk *worker) {
+			defer wg.Done()
+			for {
+				n := int(next.Add(1)) - 1
+				if n >= cfg.Requests {
+					return
+				}
+				i := n % len(responses)
+				wk.serve(handlers[i], requests[i])
+				wk.in += int64(len(responses[i].Body))
+			}
+		}(wk)
+	}
+	wg.Wait()
+	res := Result{Requests: cfg.Requests, Duration: time.Since(start), Encodings: map[string]int{}}
+	runtime.ReadMemStats(&after)
+	res.Allocs = float64(after.Mallocs-before.Mallocs) / float64(cfg.Requests)
+	res.AllocBytes = float64(after.TotalAlloc-before.TotalAlloc) / float64(cfg.Requests)
+
+	for _, wk := range workers {
+		res.UncompressedBytes += wk.in
+		res.CompressedBytes += wk.w.n
+		for enc, n := range wk.encodings {
+			res.Encodings[enc] += n
+		}
+		latencies = append(latencies, wk.latencies...)
+	}
+	slices.Sort(latencies)
+	res.P50 = latencies[len(latencies)/2]
+	res.P99 = latencies[(len(latencies)*99)/100]
+	return res, nil
+}
+
+// LoadDir returns the responses whose bodies are the regular files in dir
+// (and in its subdirectories), with the Content-Type determined by their
+// extension, if known, or else by their content.
+func LoadDir(dir string) ([]Response, error) {
+	var responses []Response
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		ct := mime.TypeByExtension(filepath.Ext(p))
+		if ct == "" {
+			ct = http.DetectContentType(b)
+		}
+		rel, _ := filepath.Rel(dir, p)
+		responses = append(responses, Response{
+			Target: "/" + filepath.ToSlash(rel),
+			Header: http.Header{"Content-Type": {ct}},
+			Body:   b,
+		})
+		return nil
+	})
+	if err == nil && len(responses) == 0 {
+		err = fmt.Errorf("no files in %s", dir)
+	}
+	return responses, err
+}
+
+func handler(resp Response) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		for k, v := range resp.Header {
+			// Clipped, so that appending to the values does not modify
+			// resp.Header.
+			h[k] = v[:len(v):len(v)]
+		}
+		if resp.Status != 0 {
+			w.WriteHeader(resp.Status)
+		}
+		w.Write(resp.Body)
+	})
+}
+
+// request returns the request of resp. The same request is served
+// concurrently, as the middleware does not modify it.
+func request(resp Response) *http.Request {
+	method, target := resp.Method, resp.Target
+	if method == "" {
+		method = http.MethodGet
+	}
+	if target == "" {
+		target = "/"
+	}
+	r := httptest.NewRequest(method, target, nil)
+	ae := resp.AcceptEncoding
+	if ae == "" {
+		ae = DefaultAcceptEncoding
+	}
+	r.Header.Set("Accept-Encoding", ae)
+	return r
+}
+
+// worker serves the requests of a goroutine of Run.
+type worker struct {
+	w         discardWriter
+	in        int64
+	encodings map[string]int
+	latencies []time.Duration
+}
+
+func (wk *worker) serve(h http.Handler, r *http.Request) {
+	clear(wk.w.h)
+	start := time.Now()
+	h.ServeHTTP(&wk.w, r)
+	wk.latencies = append(wk.latencies, time.Since(start))
+	enc := wk.w.h.Get("Content-Encoding")
+	if enc == "" {
+		enc = "identity"
+	}
+	wk.encodings[enc]++
+}
+
+// discardWriter is a ResponseWriter counting and discarding the body.
+type discardWriter struct {
+	h http.Header
+	n int64
+}
+
+func (w *discardWriter) Header() http.Header { return w.h }
+
+func (w *discardWriter) WriteHeader(int) {}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	w.n += int64(len(b))
+	return len(b), nil
+}
+
+func (w *discardWriter) Flush() {}
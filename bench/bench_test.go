@@ -0,0 +1,66 @@
+package bench_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/bench"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	skipMinimal(t)
+
+	compress, err := httpcompression.DefaultAdapter(httpcompression.ContentTypes([]string{"image/png"}, true))
+	if !assert.NoError(t, err) {
+		return
+	}
+	body := []byte(strings.Repeat("hello world ", 1000))
+	responses := []bench.Response{
+		{Header: http.Header{"Content-Type": {"text/plain"}}, Body: body},
+		{Header: http.Header{"Content-Type": {"text/plain"}}, Body: body, AcceptEncoding: "gzip"},
+		{Header: http.Header{"Content-Type": {"image/png"}}, Body: body},
+		{Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte("small"), Status: http.StatusNotFound},
+	}
+	res, err := bench.Run(compress, responses, bench.Config{Requests: 100, Concurrency: 4})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 100, res.Requests)
+	assert.Equal(t, map[string]int{"zstd": 25, "gzip": 25, "identity": 50}, res.Encodings)
+	assert.EqualValues(t, 25*(3*len(body)+len("small")), res.UncompressedBytes)
+	assert.Less(t, res.Ratio(), 0.4, "two thirds of the bytes are compressed")
+	assert.Greater(t, res.Ratio(), 0.33, "a third of the bytes are not compressed")
+	assert.Positive(t, res.Throughput())
+	assert.Positive(t, res.Allocs)
+	assert.LessOrEqual(t, res.P50, res.P99)
+	assert.Contains(t, res.String(), "100 requests")
+
+	_, err = bench.Run(compress, nil, bench.Config{})
+	assert.Error(t, err)
+}
+
+func TestLoadDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"a":1}`), 0o644))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "b"), []byte("<html></html>"), 0o644))
+	responses, err := bench.LoadDir(dir)
+	if !assert.NoError(t, err) || !assert.Len(t, responses, 2) {
+		return
+	}
+	assert.Equal(t, "/a.json", responses[0].Target)
+	assert.Equal(t, "application/json", responses[0].Header.Get("Content-Type"))
+	assert.Equal(t, "/sub/b", responses[1].Target)
+	assert.Equal(t, "text/html; charset=utf-8", responses[1].Header.Get("Content-Type"))
+
+	_, err = bench.LoadDir(t.TempDir())
+	assert.Error(t, err)
+}
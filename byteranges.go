@@ -0,0 +1,33 @@
+package httpcompression
+
+import "mime"
+
+const multipartByteRanges = "multipart/byteranges"
+
+// CompressByteRanges is an option that compresses the multipart/byteranges
+// responses (the partial responses to requests with multiple ranges) as a
+// whole, i.e. the multipart container including the boundaries and the
+// headers of each part, whose Content-Range keep referring to the
+// uncompressed representation. By default they are never compressed, like
+// the other partial responses, as compressing the parts individually would
+// break the bookkeeping of their boundaries and lengths; compressing the
+// whole container is only correct for the clients that decode the
+// Content-Encoding before parsing the parts, so it must be enabled
+// explicitly. The responses are still subject to the ContentTypes filtering,
+// that must then allow multipart/byteranges.
+func CompressByteRanges() Option {
+	return func(c *config) error {
+		c.byteRanges = true
+		return nil
+	}
+}
+
+// isByteRanges reports whether ct is the Content-Type of a multipart/byteranges
+// response.
+func isByteRanges(ct string) bool {
+	if ct == "" {
+		return false
+	}
+	mt, _, _ := mime.ParseMediaType(ct)
+	return mt == multipartByteRanges
+}
@@ -0,0 +1,335 @@
+package httpcompression
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	lastModified  = "Last-Modified"
+	setCookie     = "Set-Cookie"
+	cacheEntryOvh = 64 // approximate per-entry memory overhead, in bytes
+)
+
+// CacheKey identifies a compressed variant of a response.
+type CacheKey struct {
+	// URL is the host and the request URI of the request.
+	URL string
+	// Encoding is the Content-Encoding of the compressed variant. For the
+	// dictionary encodings (see Dictionaries) it is followed by a colon and
+	// the base64-encoded hash of the dictionary.
+	Encoding string
+	// Validator is the strong ETag of the response or, if the response has
+	// no ETag, its Last-Modified header.
+	Validator string
+}
+
+// String returns a string representation of the key, that can be used as the
+// key in stores that only support string keys. Keys are different if and only
+// if their string representations are different.
+func (k CacheKey) String() string {
+	// Header values and request URIs can not contain newlines.
+	return k.Encoding + "\n" + k.Validator + "\n" + k.URL
+}
+
+func (k CacheKey) size() int {
+	return len(k.URL) + len(k.Encoding) + len(k.Validator)
+}
+
+// Cache is a store of compressed response variants, used by the VariantCache
+// option. MemoryCache and DiskCache are the built-in implementations; other
+// stores (e.g. ristretto, groupcache or Redis) can be used by implementing
+// this interface.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the variant for key, if present. The returned slice is
+	// not modified by the caller.
+	Get(key CacheKey) ([]byte, bool)
+	// Set stores the variant value for key. If ttl is positive, the
+	// variant should not be returned by Get after ttl. The value is not
+	// modified by the caller after Set returns. Implementations are free
+	// to not store the variant, e.g. if it is too large.
+	Set(key CacheKey, value []byte, ttl time.Duration)
+}
+
+var (
+	_ Cache = &MemoryCache{}
+	_ Cache = &DiskCache{}
+)
+
+// VariantCache is an option that enables caching of the compressed variants
+// of the responses, so that responses that are generated dynamically but
+// that rarely change are compressed once instead of for each request.
+//
+// Only responses to GET requests with status 200 and with a validator (a
+// strong ETag or a Last-Modified header) are cached. The validator is part of
+// the cache key, so the generated response must be identical for all the
+// requests with the same URL and the same validator. Responses that set
+// cookies, or that vary on headers other than Accept-Encoding, are not cached.
+//
+// The handler is still invoked for each request: when a compressed variant
+// for the response is found in the cache it is sent to the client, and the
+// body written by the handler is discarded without being compressed.
+//
+// Compressed variants larger than maxEntrySize bytes are not cached; ttl
+// controls how long variants are kept in the cache (zero means forever).
+// The same cache should not be shared by adapters with different compression
+// settings.
+func VariantCache(c Cache, ttl time.Duration, maxEntrySize int) Option {
+	return named("VariantCache", func(cfg *config) error {
+		if c == nil {
+			return fmt.Errorf("variant cache can not be nil")
+		}
+		if ttl < 0 {
+			return fmt.Errorf("variant cache TTL can not be negative: %v", ttl)
+		}
+		if maxEntrySize <= 0 {
+			return fmt.Errorf("variant cache maximum entry size must be positive: %d", maxEntrySize)
+		}
+		cfg.cache = &cacheConfig{cache: c, ttl: ttl, maxEntrySize: maxEntrySize}
+		return nil
+	})
+}
+
+type cacheConfig struct {
+	cache        Cache
+	ttl          time.Duration
+	maxEntrySize int
+}
+
+// cacheURL returns the URL part of the cache key for the request, or the
+// empty string if the response to the request can not be cached.
+func cacheURL(r *http.Request) string {
+	if r.Method != http.MethodGet {
+		return ""
+	}
+	return r.Host + r.URL.RequestURI()
+}
+
+// cacheValidator returns the validator of the response to be used in the
+// cache key, and false if the response can not be cached. Long-lived
+// responses (see CompressOnce) can be cached even without a validator.
+func cacheValidator(h http.Header, code int, longLived bool) (string, bool) {
+	if code != 0 && code != http.StatusOK {
+		return "", false
+	}
+	if len(h[setCookie]) > 0 {
+		return "", false
+	}
+	for _, v := range h.Values(vary) {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" && !strings.EqualFold(f, acceptEncoding) {
+				return "", false
+			}
+		}
+	}
+	if et := h.Get(etag); et != "" {
+		// Weak ETags do not guarantee byte-for-byte equality.
+		return et, longLived || !strings.HasPrefix(et, "W/")
+	}
+	if lm := h.Get(lastModified); lm != "" {
+		return lm, true
+	}
+	return "", longLived
+}
+
+// MemoryCache is an in-memory LRU cache of compressed response variants,
+// bounded by the total size of the cached variants. It can be used with the
+// VariantCache option.
+// It is safe for concurrent use.
+type MemoryCache struct {
+	maxBytes int64
+	disk     *DiskCache // optional disk tier
+	maxEntry int        // variants larger than this are stored only in the disk tier
+
+	mu    sync.Mutex
+	lru   *list.List // of *memoryCacheEntry, most recently used first
+	items map[CacheKey]*list.Element
+	bytes int64
+	stats CacheStats
+}
+
+type memoryCacheEntry struct {
+	key     CacheKey
+	value   []byte
+	expires time.Time // zero if the entry does not expire
+}
+
+func (e *memoryCacheEntry) size() int64 {
+	return int64(e.key.size() + len(e.value) + cacheEntryOvh)
+}
+
+// CacheStats are the statistics of a cache.
+type CacheStats struct {
+	Hits        uint64 // Number of lookups that found a variant.
+	Misses      uint64 // Number of lookups that did not find a variant.
+	Sets        uint64 // Number of variants added to the cache.
+	Evictions   uint64 // Number of variants evicted because the cache was full.
+	Expirations uint64 // Number of variants removed because they were expired.
+	Entries     int    // Number of variants in the cache.
+	Bytes       int64  // Approximate size of the variants in the cache.
+}
+
+// HitRate returns the fraction of lookups that found a variant.
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// NewMemoryCache returns a MemoryCache holding at most maxBytes bytes of
+// compressed variants.
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    map[CacheKey]*list.Element{},
+	}
+}
+
+// NewTieredMemoryCache returns a MemoryCache holding at most maxBytes bytes
+// of compressed variants in memory, that uses disk as a spillover tier:
+// variants larger than maxMemoryEntrySize bytes are stored only in disk, and
+// variants evicted from memory are moved to disk.
+// The statistics of the returned cache include the lookups served by disk;
+// the statistics of the disk tier alone are available from disk.
+func NewTieredMemoryCache(maxBytes int64, disk *DiskCache, maxMemoryEntrySize int) *MemoryCache {
+	c := NewMemoryCache(maxBytes)
+	c.disk = disk
+	c.maxEntry = maxMemoryEntrySize
+	return c
+}
+
+// Get returns the variant for key, if present in the cache and not expired.
+// The returned slice must not be modified.
+func (c *MemoryCache) Get(key CacheKey) ([]byte, bool) {
+	c.mu.Lock()
+	el, ok := c.items[key]
+	if ok {
+		e := el.Value.(*memoryCacheEntry)
+		if e.expires.IsZero() || time.Now().Before(e.expires) {
+			c.lru.MoveToFront(el)
+			c.stats.Hits++
+			c.mu.Unlock()
+			return e.value, true
+		}
+		c.remove(el)
+		c.stats.Expirations++
+	}
+	c.mu.Unlock()
+
+	var (
+		b   []byte
+		hit bool
+	)
+	if c.disk != nil {
+		b, hit = c.disk.Get(key)
+	}
+	c.mu.Lock()
+	if hit {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+	c.mu.Unlock()
+	return b, hit
+}
+
+// Set adds the variant value for key to the cache, evicting the least
+// recently used variants if needed. If ttl is positive the variant expires
+// after ttl. The value must not be modified after calling Set.
+func (c *MemoryCache) Set(key CacheKey, value []byte, ttl time.Duration) {
+	e := &memoryCacheEntry{key: key, value: value}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+	if c.disk != nil && (len(value) > c.maxEntry || e.size() > c.maxBytes) {
+		c.mu.Lock()
+		if el, ok := c.items[key]; ok {
+			c.remove(el)
+		}
+		c.stats.Sets++
+		c.mu.Unlock()
+		c.disk.set(key, value, e.expires)
+		return
+	}
+	if e.size() > c.maxBytes {
+		return
+	}
+
+	var evicted []*memoryCacheEntry
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	for c.bytes+e.size() > c.maxBytes {
+		evicted = append(evicted, c.remove(c.lru.Back()))
+		c.stats.Evictions++
+	}
+	c.items[key] = c.lru.PushFront(e)
+	c.bytes += e.size()
+	c.stats.Sets++
+	c.mu.Unlock()
+
+	if c.disk != nil {
+		now := time.Now()
+		for _, e := range evicted {
+			if e.expires.IsZero() || now.Before(e.expires) {
+				c.disk.set(e.key, e.value, e.expires)
+			}
+		}
+	}
+}
+
+func (c *MemoryCache) remove(el *list.Element) *memoryCacheEntry {
+	e := c.lru.Remove(el).(*memoryCacheEntry)
+	delete(c.items, e.key)
+	c.bytes -= e.size()
+	return e
+}
+
+// Stats returns the statistics of the cache.
+func (c *MemoryCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Entries = len(c.items)
+	s.Bytes = c.bytes
+	return s
+}
+
+// cacheRecorder records the output of a compressor, to add it to the cache
+// once the response is complete.
+type cacheRecorder struct {
+	w    http.ResponseWriter
+	buf  []byte
+	max  int
+	full bool // the output exceeded max, or it was not written completely
+}
+
+func (r *cacheRecorder) Write(b []byte) (int, error) {
+	if !r.full {
+		if len(r.buf)+len(b) > r.max {
+			r.full, r.buf = true, nil
+		} else {
+			r.buf = append(r.buf, b...)
+		}
+	}
+	n, err := r.w.Write(b)
+	if err != nil {
+		r.full, r.buf = true, nil
+	}
+	return n, err
+}
+
+// discardWriter discards the writes of the handler when the compressed
+// variant has been served from the cache.
+type discardWriter struct{}
+
+func (discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (discardWriter) Close() error                { return nil }
@@ -0,0 +1,235 @@
+package httpcompression
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	diskCachePrefix = "httpcompression-"
+	diskCacheExt    = ".variant"
+	diskCacheTmpExt = ".tmp"
+)
+
+// DiskCache is a cache of compressed response variants stored as files in a
+// directory, bounded by the total size of the stored variants. It is meant to
+// be used as the disk tier of a MemoryCache (see NewTieredMemoryCache), so
+// that large variants do not need to be compressed again when they do not fit
+// in memory.
+//
+// The index of the cache is kept in memory, so the cache is empty when it is
+// created: variants are written to temporary files that are atomically
+// renamed once complete, and files left over by a previous process (e.g.
+// after a crash) are removed by NewDiskCache.
+// It is safe for concurrent use.
+type DiskCache struct {
+	dir      string
+	temp     bool // dir was created by NewDiskCache
+	maxBytes int64
+
+	mu    sync.Mutex
+	lru   *list.List // of *diskCacheEntry, most recently used first
+	items map[CacheKey]*list.Element
+	bytes int64
+	seq   uint64
+	stats CacheStats
+}
+
+type diskCacheEntry struct {
+	key     CacheKey
+	file    string
+	size    int64
+	expires time.Time // zero if the entry does not expire
+}
+
+// NewDiskCache returns a DiskCache storing at most maxBytes bytes of
+// compressed variants in dir. If dir is empty, a new temporary directory is
+// created, and it is removed by Close.
+// The directory must be dedicated to the cache: existing cache files in dir
+// are removed.
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("disk cache maximum size must be positive: %d", maxBytes)
+	}
+	c := &DiskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    map[CacheKey]*list.Element{},
+	}
+	if dir == "" {
+		d, err := os.MkdirTemp("", diskCachePrefix)
+		if err != nil {
+			return nil, fmt.Errorf("disk cache: %w", err)
+		}
+		c.dir, c.temp = d, true
+		return c, nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("disk cache: %w", err)
+	}
+	if err := c.removeFiles(); err != nil {
+		return nil, fmt.Errorf("disk cache: %w", err)
+	}
+	return c, nil
+}
+
+// removeFiles removes all the cache files in the cache directory.
+func (c *DiskCache) removeFiles() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || !strings.HasPrefix(name, diskCachePrefix) {
+			continue
+		}
+		if strings.HasSuffix(name, diskCacheExt) || strings.HasSuffix(name, diskCacheTmpExt) {
+			if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Get returns the variant for key, if present in the cache and not expired.
+func (c *DiskCache) Get(key CacheKey) ([]byte, bool) {
+	c.mu.Lock()
+	el, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		c.mu.Unlock()
+		return nil, false
+	}
+	e := el.Value.(*diskCacheEntry)
+	if !e.expires.IsZero() && !time.Now().Before(e.expires) {
+		c.remove(el)
+		c.stats.Expirations++
+		c.stats.Misses++
+		c.mu.Unlock()
+		os.Remove(e.file)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	c.mu.Unlock()
+
+	b, err := os.ReadFile(e.file)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil || int64(len(b)) != e.size {
+		// The entry has been evicted concurrently, or the file has been
+		// tampered with.
+		if el, ok := c.items[key]; ok && el.Value == e {
+			c.remove(el)
+			os.Remove(e.file)
+		}
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	return b, true
+}
+
+// Set adds the variant value for key to the cache, evicting the least
+// recently used variants if needed. If ttl is positive the variant expires
+// after ttl.
+func (c *DiskCache) Set(key CacheKey, value []byte, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	c.set(key, value, expires)
+}
+
+func (c *DiskCache) set(key CacheKey, value []byte, expires time.Time) {
+	size := int64(len(value))
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	c.seq++
+	file := filepath.Join(c.dir, fmt.Sprintf("%s%016x%s", diskCachePrefix, c.seq, diskCacheExt))
+	c.mu.Unlock()
+	if err := writeFileAtomic(c.dir, file, value); err != nil {
+		return
+	}
+
+	var evicted []string
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		evicted = append(evicted, el.Value.(*diskCacheEntry).file)
+		c.remove(el)
+	}
+	for c.bytes+size > c.maxBytes {
+		el := c.lru.Back()
+		evicted = append(evicted, el.Value.(*diskCacheEntry).file)
+		c.remove(el)
+		c.stats.Evictions++
+	}
+	c.items[key] = c.lru.PushFront(&diskCacheEntry{key: key, file: file, size: size, expires: expires})
+	c.bytes += size
+	c.stats.Sets++
+	c.mu.Unlock()
+
+	for _, f := range evicted {
+		os.Remove(f)
+	}
+}
+
+// writeFileAtomic writes b to file, via a temporary file in dir, so that
+// file is either complete or missing.
+func writeFileAtomic(dir, file string, b []byte) error {
+	f, err := os.CreateTemp(dir, diskCachePrefix+"*"+diskCacheTmpExt)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (c *DiskCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*diskCacheEntry)
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
+
+// Stats returns the statistics of the cache.
+func (c *DiskCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Entries = len(c.items)
+	s.Bytes = c.bytes
+	return s
+}
+
+// Close removes all the variants from the cache, and the cache directory if
+// it was created by NewDiskCache. The cache must not be used after Close.
+func (c *DiskCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.items = map[CacheKey]*list.Element{}
+	c.bytes = 0
+	if c.temp {
+		return os.RemoveAll(c.dir)
+	}
+	return c.removeFiles()
+}
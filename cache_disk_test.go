@@ -0,0 +1,116 @@
+package httpcompression
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskCache(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	// Leftovers of a previous process are removed.
+	leftover := filepath.Join(dir, diskCachePrefix+"1234"+diskCacheTmpExt)
+	other := filepath.Join(dir, "other.txt")
+	assert.NoError(t, os.WriteFile(leftover, []byte("x"), 0o600))
+	assert.NoError(t, os.WriteFile(other, []byte("x"), 0o600))
+
+	c, err := NewDiskCache(dir, 30)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = os.Stat(leftover)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(other)
+	assert.NoError(t, err)
+
+	value := []byte("0123456789")
+	for _, k := range []string{"a", "b", "c"} {
+		c.Set(CacheKey{URL: k}, value, 0)
+	}
+	b, ok := c.Get(CacheKey{URL: "a"})
+	assert.True(t, ok)
+	assert.Equal(t, value, b)
+	c.Set(CacheKey{URL: "d"}, value, 0) // evicts b
+	_, ok = c.Get(CacheKey{URL: "b"})
+	assert.False(t, ok)
+
+	s := c.Stats()
+	assert.EqualValues(t, 1, s.Evictions)
+	assert.Equal(t, 3, s.Entries)
+	assert.EqualValues(t, 30, s.Bytes)
+	files, _ := filepath.Glob(filepath.Join(dir, diskCachePrefix+"*"))
+	assert.Len(t, files, 3)
+
+	c.Set(CacheKey{URL: "e"}, value, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	_, ok = c.Get(CacheKey{URL: "e"})
+	assert.False(t, ok)
+
+	assert.NoError(t, c.Close())
+	files, _ = filepath.Glob(filepath.Join(dir, diskCachePrefix+"*"))
+	assert.Empty(t, files)
+	_, err = os.Stat(other)
+	assert.NoError(t, err)
+}
+
+func TestDiskCacheTempDir(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewDiskCache("", 1<<20)
+	if !assert.NoError(t, err) {
+		return
+	}
+	c.Set(CacheKey{URL: "a"}, []byte("value"), 0)
+	_, err = os.Stat(c.dir)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Close())
+	_, err = os.Stat(c.dir)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = NewDiskCache("", 0)
+	assert.Error(t, err)
+}
+
+func TestTieredMemoryCache(t *testing.T) {
+	t.Parallel()
+
+	disk, err := NewDiskCache(t.TempDir(), 1<<20)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer disk.Close()
+
+	value := []byte("0123456789")
+	entrySize := int64(len("k") + len(value) + cacheEntryOvh)
+	c := NewTieredMemoryCache(2*entrySize, disk, 100)
+
+	// Large variants go directly to disk.
+	large := make([]byte, 1000)
+	c.Set(CacheKey{URL: "large"}, large, 0)
+	assert.Equal(t, 0, c.Stats().Entries)
+	assert.Equal(t, 1, disk.Stats().Entries)
+
+	// Variants evicted from memory are moved to disk.
+	for _, k := range []string{"a", "b", "c"} {
+		c.Set(CacheKey{URL: k}, value, 0)
+	}
+	assert.Equal(t, 2, c.Stats().Entries)
+	assert.Equal(t, 2, disk.Stats().Entries)
+
+	for _, k := range []string{"large", "a", "b", "c"} {
+		_, ok := c.Get(CacheKey{URL: k})
+		assert.True(t, ok, k)
+	}
+	_, ok := c.Get(CacheKey{URL: "missing"})
+	assert.False(t, ok)
+
+	s := c.Stats()
+	assert.EqualValues(t, 4, s.Hits)
+	assert.EqualValues(t, 1, s.Misses)
+	assert.EqualValues(t, 2, disk.Stats().Hits)
+}
@@ -0,0 +1,224 @@
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingProvider struct {
+	CompressorProvider
+	n int32
+}
+
+func (p *countingProvider) Get(w io.Writer) io.WriteCloser {
+	atomic.AddInt32(&p.n, 1)
+	return p.CompressorProvider.Get(w)
+}
+
+func newCachingHandler(t *testing.T, cache Cache, maxEntrySize int, header http.Header, code int) (http.Handler, *countingProvider) {
+	t.Helper()
+
+	gz, err := NewDefaultGzipCompressor(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := &countingProvider{CompressorProvider: gz}
+	mw, err := Adapter(GzipCompressor(cp), VariantCache(cache, time.Hour, maxEntrySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range header {
+			w.Header()[http.CanonicalHeaderKey(k)] = v
+		}
+		if code != 0 {
+			w.WriteHeader(code)
+		}
+		io.WriteString(w, testBody)
+	})), cp
+}
+
+func TestVariantCache(t *testing.T) {
+	t.Parallel()
+
+	cache := NewMemoryCache(1 << 20)
+	h, cp := newCachingHandler(t, cache, 1<<20, http.Header{etag: {`"v1"`}}, 0)
+
+	var bodies []string
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/page?x=1", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+		b, err := decodeGzip(res.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, testBody, string(b))
+		bodies = append(bodies, res.Body.String())
+	}
+	assert.Equal(t, bodies[0], bodies[1])
+	assert.Equal(t, bodies[0], bodies[2])
+	assert.EqualValues(t, 1, atomic.LoadInt32(&cp.n))
+
+	s := cache.Stats()
+	assert.EqualValues(t, 2, s.Hits)
+	assert.EqualValues(t, 1, s.Misses)
+	assert.EqualValues(t, 1, s.Sets)
+	assert.Equal(t, 1, s.Entries)
+	assert.InDelta(t, 2.0/3, s.HitRate(), 0.001)
+
+	// A different URL is a different variant.
+	req := httptest.NewRequest("GET", "/page?x=2", nil)
+	req.Header.Set(acceptEncoding, "gzip")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&cp.n))
+}
+
+func TestVariantCacheNotCacheable(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		method string
+		header http.Header
+		code   int
+		max    int
+	}{
+		{"no validator", "GET", http.Header{}, 0, 1 << 20},
+		{"weak etag", "GET", http.Header{etag: {`W/"v1"`}}, 0, 1 << 20},
+		{"vary", "GET", http.Header{etag: {`"v1"`}, vary: {"Cookie"}}, 0, 1 << 20},
+		{"cookie", "GET", http.Header{etag: {`"v1"`}, setCookie: {"a=b"}}, 0, 1 << 20},
+		{"status", "GET", http.Header{etag: {`"v1"`}}, http.StatusNotFound, 1 << 20},
+		{"method", "POST", http.Header{etag: {`"v1"`}}, 0, 1 << 20},
+		{"too large", "GET", http.Header{etag: {`"v1"`}}, 0, 10},
+	}
+	for _, c := range cases {
+		cache := NewMemoryCache(1 << 20)
+		h, cp := newCachingHandler(t, cache, c.max, c.header, c.code)
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest(c.method, "/", nil)
+			req.Header.Set(acceptEncoding, "gzip")
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+			assert.Equal(t, "gzip", res.Header().Get(contentEncoding), c.name)
+		}
+		assert.EqualValues(t, 2, atomic.LoadInt32(&cp.n), c.name)
+		assert.Equal(t, 0, cache.Stats().Entries, c.name)
+	}
+}
+
+func TestVariantCacheLastModified(t *testing.T) {
+	t.Parallel()
+
+	cache := NewMemoryCache(1 << 20)
+	h, cp := newCachingHandler(t, cache, 1<<20, http.Header{lastModified: {"Wed, 21 Oct 2015 07:28:00 GMT"}, vary: {"Accept-Encoding"}}, 0)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&cp.n))
+}
+
+func TestVariantCacheInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	_, err := Adapter(VariantCache(nil, 0, 1))
+	assert.Error(t, err)
+	_, err = Adapter(VariantCache(NewMemoryCache(1), -1, 1))
+	assert.Error(t, err)
+	_, err = Adapter(VariantCache(NewMemoryCache(1), 0, 0))
+	assert.Error(t, err)
+}
+
+func TestMemoryCache(t *testing.T) {
+	t.Parallel()
+
+	entrySize := int64(len("k") + len("0123456789") + cacheEntryOvh)
+	c := NewMemoryCache(3 * entrySize)
+	value := []byte("0123456789")
+	for _, k := range []string{"a", "b", "c"} {
+		c.Set(CacheKey{URL: k}, value, 0)
+	}
+	_, ok := c.Get(CacheKey{URL: "a"}) // a is now the most recently used
+	assert.True(t, ok)
+	c.Set(CacheKey{URL: "d"}, value, 0) // evicts b
+	_, ok = c.Get(CacheKey{URL: "b"})
+	assert.False(t, ok)
+	for _, k := range []string{"a", "c", "d"} {
+		_, ok = c.Get(CacheKey{URL: k})
+		assert.True(t, ok, k)
+	}
+
+	s := c.Stats()
+	assert.EqualValues(t, 1, s.Evictions)
+	assert.Equal(t, 3, s.Entries)
+	assert.Equal(t, 3*entrySize, s.Bytes)
+
+	// Entries larger than the cache are not added.
+	c.Set(CacheKey{URL: "e"}, []byte(strings.Repeat("x", int(3*entrySize))), 0)
+	_, ok = c.Get(CacheKey{URL: "e"})
+	assert.False(t, ok)
+
+	// Expired entries are not returned.
+	c.Set(CacheKey{URL: "f"}, value, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	_, ok = c.Get(CacheKey{URL: "f"})
+	assert.False(t, ok)
+	assert.EqualValues(t, 1, c.Stats().Expirations)
+}
+
+type mapCache struct {
+	mu sync.Mutex
+	m  map[string][]byte
+}
+
+func (c *mapCache) Get(key CacheKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.m[key.String()]
+	return b, ok
+}
+
+func (c *mapCache) Set(key CacheKey, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[key.String()] = value
+}
+
+func TestVariantCacheCustom(t *testing.T) {
+	t.Parallel()
+
+	cache := &mapCache{m: map[string][]byte{}}
+	h, cp := newCachingHandler(t, cache, 1<<20, http.Header{etag: {`"v1"`}}, 0)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "http://example.com/page", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		b, err := decodeGzip(res.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, testBody, string(b))
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&cp.n))
+	assert.Contains(t, cache.m, CacheKey{URL: "example.com/page", Encoding: "gzip", Validator: `"v1"`}.String())
+}
+
+func TestCacheKeyString(t *testing.T) {
+	t.Parallel()
+
+	a := CacheKey{URL: "example.com/a", Encoding: "gzip", Validator: `"v1"`}
+	b := CacheKey{URL: "example.com/a", Encoding: "br", Validator: `"v1"`}
+	c := CacheKey{URL: "example.com/a", Encoding: "gzip", Validator: `"v2"`}
+	assert.NotEqual(t, a.String(), b.String())
+	assert.NotEqual(t, a.String(), c.String())
+	assert.Equal(t, a.String(), CacheKey{URL: "example.com/a", Encoding: "gzip", Validator: `"v1"`}.String())
+}
@@ -0,0 +1,45 @@
+package httpcompression
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+)
+
+// Canary is an option that uses the options of the middleware plus opts
+// (e.g. a new compression level or encoding) for a random percentage of the
+// requests, between 0 and 100, to roll out new options gradually. Like for
+// Route, the canary is checked after the routes specified before it, and it
+// can not be used in a route.
+//
+// The requests served with the canary options are reported by
+// CanaryFromRequest, so that the WriterHooks collecting the metrics can
+// compare them with the other requests. The percentage can be increased, or
+// the canary rolled back, by reloading the options (see Middleware.Reload).
+func Canary(percent float64, opts ...Option) Option {
+	return named("Canary", func(c *config) error {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("canary percentage must be between 0 and 100: %v", percent)
+		}
+		ropts := make([]Option, len(opts), len(opts)+1)
+		copy(ropts, opts)
+		ropts = append(ropts, func(c *config) error {
+			c.canary = true
+			return nil
+		})
+		c.routes = append(c.routes, route{match: func(*http.Request) bool {
+			return rand.Float64()*100 < percent
+		}, opts: ropts})
+		return nil
+	})
+}
+
+type canaryKey struct{}
+
+// CanaryFromRequest reports whether the request r, as seen by the handler
+// wrapped by the middleware and by its WriterHooks, is served with the
+// options of a Canary.
+func CanaryFromRequest(r *http.Request) bool {
+	ok, _ := r.Context().Value(canaryKey{}).(bool)
+	return ok
+}
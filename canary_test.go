@@ -0,0 +1,55 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanary(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	var canaries, mismatches atomic.Int64
+	hook := ResponseWriterHook(WriterHook{Closed: func(r *http.Request, enc string, err error) {
+		if CanaryFromRequest(r) {
+			canaries.Add(1)
+		}
+		if CanaryFromRequest(r) != (enc == "br") {
+			mismatches.Add(1)
+		}
+	}})
+	m, err := DefaultMiddleware(hook, Canary(20, Prefer(PreferClient)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(testBody))
+	}))
+	serve := func(n int) {
+		for i := 0; i < n; i++ {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(acceptEncoding, "br, zstd;q=0.5")
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	}
+	serve(1000)
+	assert.Zero(t, mismatches.Load())
+	assert.InDelta(t, 200, canaries.Load(), 80)
+
+	// Roll back.
+	canaries.Store(0)
+	assert.NoError(t, m.Reload(hook))
+	serve(100)
+	assert.Zero(t, canaries.Load())
+	assert.Zero(t, mismatches.Load())
+
+	_, err = Adapter(Canary(101))
+	assert.Error(t, err)
+	_, err = Adapter(Route(MatchPathPrefix("/"), Canary(10)))
+	assert.Error(t, err)
+}
@@ -0,0 +1,100 @@
+package httpcompression
+
+import (
+	"mime"
+)
+
+// The capabilities that CompressorProviders can declare (see CapabilityReporter).
+const (
+	// CapabilityFlush is the capability of the providers whose compressors
+	// implement Flusher, so that they can compress streaming responses.
+	CapabilityFlush = "flush"
+	// CapabilityDictionaries is the capability of the providers supporting
+	// compression dictionaries (see DictionaryCompressorProvider).
+	CapabilityDictionaries = "dictionaries"
+	// CapabilityDeterministic is the capability of the providers whose
+	// output only depends on the input and on their settings (see
+	// Deterministic).
+	CapabilityDeterministic = "deterministic"
+	// CapabilityConcurrent is the capability of the providers whose
+	// compressors use multiple goroutines (e.g. pgzip).
+	CapabilityConcurrent = "concurrent"
+)
+
+// CapabilityReporter is an optional interface that can be implemented by
+// CompressorProviders to declare their capabilities, so that the middleware
+// does not assume that all the providers have the same ones:
+//
+//   - the providers without CapabilityFlush are not used for the streaming
+//     responses, i.e. the text/event-stream responses and the responses
+//     flushed by the handler before the encoding is chosen;
+//   - the providers without CapabilityDeterministic are disabled when the
+//     Deterministic option is used.
+//
+// Capabilities must list all the capabilities of the provider, among the
+// Capability* constants; the providers not implementing CapabilityReporter
+// are assumed to support flushing and to be deterministic. The declared
+// capabilities are also reported by Describe.
+type CapabilityReporter interface {
+	Capabilities() []string
+}
+
+// hasCapability reports whether the provider p has the capability cap.
+func hasCapability(p CompressorProvider, cap string) bool {
+	cr, ok := p.(CapabilityReporter)
+	if !ok {
+		return cap == CapabilityFlush || cap == CapabilityDeterministic
+	}
+	for _, c := range cr.Capabilities() {
+		if c == cap {
+			return true
+		}
+	}
+	return false
+}
+
+// capabilities returns the capabilities declared by p, if any.
+func capabilities(p CompressorProvider) []string {
+	if cr, ok := p.(CapabilityReporter); ok {
+		return cr.Capabilities()
+	}
+	return nil
+}
+
+// isStreaming reports whether ct is the Content-Type of a streaming response.
+func isStreaming(ct string) bool {
+	if ct == "" {
+		return false
+	}
+	mt, _, _ := mime.ParseMediaType(ct)
+	return mt == "text/event-stream"
+}
+
+// flushable returns the encodings whose providers support flushing.
+func (c *config) flushable(encs []string) []string {
+	for i, enc := range encs {
+		if !hasCapability(c.compressor[enc].comp, CapabilityFlush) {
+			s := append([]string(nil), encs[:i]...)
+			for _, enc := range encs[i+1:] {
+				if hasCapability(c.compressor[enc].comp, CapabilityFlush) {
+					s = append(s, enc)
+				}
+			}
+			return s
+		}
+	}
+	return encs
+}
+
+// dropNondeterministic disables the providers that are not deterministic, if
+// the Deterministic option is used.
+func (c *config) dropNondeterministic() {
+	if !c.deterministic {
+		return
+	}
+	for enc, cc := range c.compressor {
+		if !hasCapability(cc.comp, CapabilityDeterministic) {
+			delete(c.compressor, enc)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CAFxX/httpcompression/contrib/ulikunitz/xz"
+	"github.com/stretchr/testify/assert"
+	pxz "github.com/ulikunitz/xz"
+)
+
+// capableProvider is a provider declaring caps.
+type capableProvider struct {
+	CompressorProvider
+	caps []string
+}
+
+func (p capableProvider) Capabilities() []string {
+	return p.caps
+}
+
+func TestCapabilities(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	x, err := xz.New(pxz.WriterConfig{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	a, err := DefaultAdapter(Compressor(xz.Encoding, 100, x))
+	if !assert.NoError(t, err) {
+		return
+	}
+	body := strings.Repeat(testBody, 2)
+	cases := []struct {
+		name  string
+		ct    string
+		flush bool
+		enc   string
+	}{
+		{"plain", "text/plain", false, "xz"},
+		{"event stream", "text/event-stream; charset=utf-8", false, "zstd"},
+		{"flushed", "text/plain", true, "zstd"},
+	}
+	for _, c := range cases {
+		h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(contentType, c.ct)
+			if c.flush {
+				w.(http.Flusher).Flush()
+			}
+			w.Write([]byte(body))
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "xz, zstd, gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, c.enc, res.Header().Get(contentEncoding), c.name)
+	}
+
+	gz, err := NewDefaultGzipCompressor(6)
+	if !assert.NoError(t, err) {
+		return
+	}
+	rep, err := Describe(GzipCompressor(capableProvider{gz, []string{CapabilityFlush}}), Deterministic())
+	assert.NoError(t, err)
+	assert.Empty(t, rep.Encodings)
+	rep, err = Describe(GzipCompressor(capableProvider{gz, []string{CapabilityFlush, CapabilityDeterministic}}), Deterministic())
+	assert.NoError(t, err)
+	if assert.Len(t, rep.Encodings, 1) {
+		assert.Equal(t, []string{CapabilityFlush, CapabilityDeterministic}, rep.Encodings[0].Capabilities)
+	}
+}
@@ -0,0 +1,157 @@
+package httpcompression
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// CaptureFunc returns the writers that receive a copy of the uncompressed
+// and of the compressed stream of the response to r, compressed with
+// contentEncoding (see DebugCapture). Either writer can be nil. The writers
+// are closed once the response has been completed.
+type CaptureFunc func(r *http.Request, contentEncoding string) (uncompressed, compressed io.WriteCloser, err error)
+
+// DebugCapture is an option that captures the uncompressed and compressed
+// streams of the compressed responses to the requests for which match
+// returns true (all the requests if match is nil; see also CaptureHeader and
+// CaptureSample), sending a copy of them to the writers returned by
+// capture (see also CaptureDir), so that reports of corrupted responses
+// can be reproduced offline. The capture does not change the responses:
+// errors returned by capture or by its writers only stop the capture.
+// Responses that are not compressed, or that are served from the cache,
+// are not captured.
+//
+// DebugCapture is meant for troubleshooting: capturing the responses is
+// expensive, and they may contain sensitive data.
+func DebugCapture(match func(r *http.Request) bool, capture CaptureFunc) Option {
+	if capture == nil {
+		return errorOption("DebugCapture", errors.New("nil capture function"))
+	}
+	if match == nil {
+		match = func(*http.Request) bool { return true }
+	}
+	return func(c *config) error {
+		c.capture = &captureConfig{match: match, capture: capture}
+		return nil
+	}
+}
+
+// CaptureHeader returns a function, for DebugCapture, matching the requests
+// that have the given header (e.g. a header added by a client reproducing a
+// bug report).
+func CaptureHeader(name string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		return len(r.Header.Values(name)) > 0
+	}
+}
+
+// CaptureSample returns a function, for DebugCapture, matching a random
+// fraction of the requests.
+func CaptureSample(fraction float64) func(r *http.Request) bool {
+	return func(*http.Request) bool {
+		return rand.Float64() < fraction
+	}
+}
+
+var captureSeq atomic.Uint64
+
+// CaptureDir returns a CaptureFunc, for DebugCapture, writing the streams of
+// each captured response to a pair of files in dir: the uncompressed stream
+// to the file with the ".identity" extension, and the compressed one to the
+// file with the Content-Encoding as extension (e.g. ".gzip"). The files of
+// each response have the same, unique, name.
+func CaptureDir(dir string) CaptureFunc {
+	return func(r *http.Request, contentEncoding string) (io.WriteCloser, io.WriteCloser, error) {
+		name := filepath.Join(dir, fmt.Sprintf("%d-%d", time.Now().UnixNano(), captureSeq.Add(1)))
+		in, err := os.Create(name + "." + identity)
+		if err != nil {
+			return nil, nil, err
+		}
+		out, err := os.Create(name + "." + filepath.Base(contentEncoding))
+		if err != nil {
+			in.Close()
+			return nil, nil, err
+		}
+		return in, out, nil
+	}
+}
+
+type captureConfig struct {
+	match   func(r *http.Request) bool
+	capture CaptureFunc
+}
+
+// captureWriter is a compressor whose input and output are captured.
+type captureWriter struct {
+	io.WriteCloser              // the compressor
+	in, out        *captureCopy // the copies of the input and of the output of the compressor
+}
+
+// start starts capturing the response to r, compressed with enc and written
+// to parent. It returns nil if the response can not be captured. The
+// compressor must write to the out copy of the returned captureWriter, and
+// be then set as its WriteCloser.
+func (c *captureConfig) start(r *http.Request, enc string, parent io.Writer) *captureWriter {
+	uncompressed, compressed, err := c.capture(r, enc)
+	if err != nil {
+		return nil
+	}
+	return &captureWriter{
+		in:  &captureCopy{w: uncompressed},
+		out: &captureCopy{parent: parent, w: compressed},
+	}
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.in.copy(b)
+	return w.WriteCloser.Write(b)
+}
+
+func (w *captureWriter) Flush() error {
+	if f, ok := w.WriteCloser.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (w *captureWriter) Close() error {
+	err := w.WriteCloser.Close()
+	w.in.close()
+	w.out.close()
+	return err
+}
+
+// captureCopy receives a copy of a stream. It stops copying after the first
+// error of its writer.
+type captureCopy struct {
+	parent io.Writer // the writer of the stream, for the output of the compressor
+	w      io.WriteCloser
+}
+
+func (c *captureCopy) Write(b []byte) (int, error) {
+	c.copy(b)
+	return c.parent.Write(b)
+}
+
+func (c *captureCopy) copy(b []byte) {
+	if c.w == nil {
+		return
+	}
+	if err := writeAll(c.w, b); err != nil {
+		c.close()
+	}
+}
+
+func (c *captureCopy) close() {
+	if c.w != nil {
+		c.w.Close()
+		c.w = nil
+	}
+}
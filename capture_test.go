@@ -0,0 +1,77 @@
+package httpcompression
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugCapture(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	a, err := DefaultAdapter(
+		DebugCapture(CaptureHeader("X-Capture"), CaptureDir(dir)),
+		GzipCompressionLevel(6),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	body := strings.Repeat(testBody, 10)
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		io.WriteString(w, body)
+	}))
+	serve := func(capture bool) []byte {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		if capture {
+			req.Header.Set("X-Capture", "1")
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+		return res.Body.Bytes()
+	}
+
+	serve(false)
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Empty(t, files)
+
+	compressed := serve(true)
+	files, _ = filepath.Glob(filepath.Join(dir, "*.identity"))
+	if !assert.Len(t, files, 1) {
+		return
+	}
+	in, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(in))
+	out, err := os.ReadFile(strings.TrimSuffix(files[0], ".identity") + ".gzip")
+	assert.NoError(t, err)
+	assert.Equal(t, compressed, out)
+
+	// Errors of the capture do not affect the response.
+	a, err = DefaultAdapter(DebugCapture(nil, func(*http.Request, string) (io.WriteCloser, io.WriteCloser, error) {
+		return nopWriteCloser{writerFunc(func([]byte) (int, error) { return 0, errTestCompressor })}, nil, nil
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h = a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		io.WriteString(w, body)
+	}))
+	d, err := decodeGzip(bytes.NewReader(serve(false)))
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(d))
+
+	_, err = Adapter(DebugCapture(nil, nil))
+	assert.Error(t, err)
+}
@@ -0,0 +1,97 @@
+package httpcompression
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrCloseTimeout is the error of the responses whose compressor did not
+// complete its Close within the timeout set with CloseTimeout.
+var ErrCloseTimeout = errors.New("httpcompression: the compressor did not close in time")
+
+// errAbandoned is returned to the compressors writing after they have been
+// abandoned (see CloseTimeout).
+var errAbandoned = errors.New("httpcompression: write of an abandoned compressor")
+
+// CloseTimeout is an option that limits to timeout the time spent closing
+// the compressor of each response, so that a compressor that hangs (e.g. in
+// a native call of a cgo provider) can not block the goroutine serving the
+// request forever. If the Close of the compressor does not return in time,
+// the compressor is abandoned: the middleware stops waiting for it, its
+// following writes are discarded, the ResponseWriter of the handler is not
+// returned to its pool, and the error of the response is ErrCloseTimeout, as
+// reported to ErrorHandler.
+// The response is then completed as it is, and the clients fail to decode
+// its truncated body.
+//
+// The timeout only applies to the compressor: the writes to the client are
+// bounded by the WriteTimeout of the http.Server.
+func CloseTimeout(timeout time.Duration) Option {
+	return named("CloseTimeout", func(c *config) error {
+		if timeout <= 0 {
+			return fmt.Errorf("close timeout must be positive: %v", timeout)
+		}
+		c.closeTimeout = timeout
+		return nil
+	})
+}
+
+// closeGuard is the parent of a compressor that can be abandoned, if its
+// Close hangs (see CloseTimeout).
+type closeGuard struct {
+	mu        sync.Mutex
+	w         io.Writer
+	abandoned bool
+}
+
+func (g *closeGuard) Write(b []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.abandoned {
+		return 0, errAbandoned
+	}
+	return g.w.Write(b)
+}
+
+// abandon discards the following writes. If the compressor is writing to
+// the client, it waits for the write to complete.
+func (g *closeGuard) abandon() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.abandoned = true
+}
+
+// closeCompressor closes the compressor cw, abandoning it if it does not
+// return within the CloseTimeout.
+func (w *compressWriter) closeCompressor(cw io.Closer) error {
+	if w.guard == nil {
+		return cw.Close()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cw.Close()
+	}()
+	t := time.NewTimer(w.config.closeTimeout)
+	defer t.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-t.C:
+		w.guard.abandon()
+		return ErrCloseTimeout
+	}
+}
+
+// abandoned reports whether the compressor of the response was abandoned
+// (see CloseTimeout).
+func (w *compressWriter) abandoned() bool {
+	if w.guard == nil {
+		return false
+	}
+	w.guard.mu.Lock()
+	defer w.guard.mu.Unlock()
+	return w.guard.abandoned
+}
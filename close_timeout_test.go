@@ -0,0 +1,104 @@
+package httpcompression
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// hangingProvider is a provider whose compressors block in Close until
+// release is closed, and then write to their parent.
+type hangingProvider struct {
+	release chan struct{}
+}
+
+func (p *hangingProvider) Get(w io.Writer) io.WriteCloser {
+	return &hangingWriter{w: w, release: p.release}
+}
+
+type hangingWriter struct {
+	w       io.Writer
+	release chan struct{}
+	err     error
+}
+
+func (w *hangingWriter) Write(b []byte) (int, error) {
+	return w.w.Write(b)
+}
+
+func (w *hangingWriter) Close() error {
+	<-w.release
+	_, w.err = w.w.Write([]byte("late"))
+	return w.err
+}
+
+func TestCloseTimeout(t *testing.T) {
+	t.Parallel()
+
+	p := &hangingProvider{release: make(chan struct{})}
+	var handled atomic.Value
+	a, err := Adapter(
+		Compressor("hang", 0, p),
+		CloseTimeout(10*time.Millisecond),
+		ErrorHandler(func(r *http.Request, err error) { handled.Store(err) }),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		io.WriteString(w, testBody)
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, "hang")
+	res := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(res, req)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the response did not complete")
+	}
+	assert.Equal(t, "hang", res.Header().Get(contentEncoding))
+	assert.Equal(t, testBody, res.Body.String())
+	err, _ = handled.Load().(error)
+	assert.True(t, errors.Is(err, ErrCloseTimeout), err)
+
+	// The abandoned compressor can not write to the response anymore.
+	close(p.release)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, testBody, res.Body.String())
+
+	_, err = Adapter(CloseTimeout(0))
+	assert.Error(t, err)
+}
+
+func TestCloseTimeoutNotExpired(t *testing.T) {
+	t.Parallel()
+
+	a, err := DefaultAdapter(CloseTimeout(time.Minute))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		io.WriteString(w, testBody)
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, "gzip")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+	b, err := decodeGzip(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, testBody, string(b))
+}
@@ -0,0 +1,170 @@
+// Command breachcheck probes an endpoint for BREACH-like vulnerabilities,
+// i.e. for compressed responses whose size leaks a secret (e.g. a CSRF
+// token) contained in them, when they also reflect attacker-controlled data.
+//
+// Usage:
+//
+//	breachcheck [flags] url
+//
+// The endpoint must reflect the value of the query parameter specified with
+// -param in its responses, and -prefix must be the text preceding the secret
+// in the responses (e.g. `name="csrf" value="`). For each character of the
+// alphabet, the command requests the URL reflecting the prefix followed by
+// the character, using the "two tries" method to cancel the effect of the
+// Huffman coding: if the character matching the first character of the
+// secret consistently yields smaller responses than the others, the
+// compressed size leaks the secret, and the command exits with status 1.
+//
+// Responses that are not compressed are not vulnerable: they are reported
+// as such, so that the mitigations of the httpcompression middleware (e.g.
+// SecretURLs, MinSize or ContentTypes) can be verified. The -H flag adds a
+// header (e.g. the cookie of an authenticated session) to the requests, and
+// can be repeated.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// padding separates the guess from the prefix in the second try: it must
+// not be part of the secret.
+const padding = "{}~{}~{}~{}~"
+
+type headers []string
+
+func (h *headers) String() string { return strings.Join(*h, ", ") }
+
+func (h *headers) Set(s string) error {
+	if !strings.Contains(s, ":") {
+		return fmt.Errorf("invalid header %q: missing colon", s)
+	}
+	*h = append(*h, s)
+	return nil
+}
+
+// guess is the result of the probes of a character.
+type guess struct {
+	c     string
+	delta float64 // average size difference between the two tries
+}
+
+func main() {
+	var (
+		hdrs     headers
+		param    = flag.String("param", "q", "query parameter reflected in the responses")
+		prefix   = flag.String("prefix", "", "text preceding the secret in the responses")
+		alphabet = flag.String("alphabet", "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ", "characters the secret may contain")
+		encoding = flag.String("encoding", "gzip", "Accept-Encoding of the requests")
+		samples  = flag.Int("n", 4, "number of samples per character")
+		margin   = flag.Float64("margin", 0.5, "minimum average advantage, in bytes, of the best character to report a leak")
+	)
+	flag.Var(&hdrs, "H", "add the `header` (\"Name: value\") to the requests (can be repeated)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] url\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *prefix == "" || *alphabet == "" || *samples < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	p := &prober{
+		client:   &http.Client{Transport: &http.Transport{DisableCompression: true}},
+		param:    *param,
+		encoding: *encoding,
+		headers:  hdrs,
+	}
+	target, err := url.Parse(flag.Arg(0))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	p.target = target
+
+	_, enc, err := p.probe(*prefix)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if enc == "" {
+		fmt.Printf("%s: the response is not compressed: not vulnerable\n", target)
+		return
+	}
+	fmt.Printf("%s: the response is compressed with %s\n", target, enc)
+
+	var guesses []guess
+	for _, c := range strings.Split(*alphabet, "") {
+		g := guess{c: c}
+		for i := 0; i < *samples; i++ {
+			near, _, err := p.probe(*prefix + c + padding)
+			if err != nil {
+				fatalf("%v", err)
+			}
+			far, _, err := p.probe(*prefix + padding + c)
+			if err != nil {
+				fatalf("%v", err)
+			}
+			g.delta += float64(far - near)
+		}
+		g.delta /= float64(*samples)
+		guesses = append(guesses, g)
+	}
+	sort.SliceStable(guesses, func(i, j int) bool { return guesses[i].delta > guesses[j].delta })
+	for _, g := range guesses[:min(5, len(guesses))] {
+		fmt.Printf("  %q: %+.2f bytes\n", g.c, g.delta)
+	}
+	if len(guesses) > 1 && guesses[0].delta-guesses[1].delta >= *margin {
+		fmt.Printf("%s: LEAK: the compressed size reveals that the secret starts with %q\n", target, guesses[0].c)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: no leak detected\n", target)
+}
+
+type prober struct {
+	client   *http.Client
+	target   *url.URL
+	param    string
+	encoding string
+	headers  headers
+}
+
+// probe requests the target reflecting payload, and returns the size of the
+// response body as received and its Content-Encoding.
+func (p *prober) probe(payload string) (int64, string, error) {
+	u := *p.target
+	q := u.Query()
+	q.Set(p.param, payload)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, "", err
+	}
+	for _, h := range p.headers {
+		name, value, _ := strings.Cut(h, ":")
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	req.Header.Set("Accept-Encoding", p.encoding)
+	res, err := p.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+	n, err := io.Copy(io.Discard, res.Body)
+	if err != nil {
+		return 0, "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("%s: %s", u.String(), res.Status)
+	}
+	return n, res.Header.Get("Content-Encoding"), nil
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "breachcheck: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,230 @@
+// Command compbench measures the compression ratio, speed and CPU usage of
+// the compressors used by the httpcompression middleware, at different
+// levels, on a corpus of representative response bodies, and suggests the
+// options to use.
+//
+// Usage:
+//
+//	compbench [flags] dir
+//
+// Each regular file in dir (and its subdirectories) is a response body. For
+// each encoding the suggested level is the one with the best compression
+// ratio whose speed is at least -min-speed MB/s: use a lower -min-speed to
+// choose levels for precompressed or cached responses (see the
+// httpcompression.CompressOnce option), that are compressed only once.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/andybalholm/brotli"
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+
+	kpzstd "github.com/klauspost/compress/zstd"
+)
+
+// candidate is a compressor configuration to be measured.
+type candidate struct {
+	enc    string
+	level  int
+	comp   httpcompression.CompressorProvider
+	option string // Go expression of the corresponding option
+	note   string // how to create the values used in option, if needed
+}
+
+type result struct {
+	candidate
+	ratio float64       // compressed size / uncompressed size
+	speed float64       // MB/s of uncompressed data
+	cpu   time.Duration // CPU time per MB of uncompressed data, if available
+}
+
+func candidates(encodings []string) ([]candidate, error) {
+	var cs []candidate
+	for _, enc := range encodings {
+		switch enc {
+		case "gzip":
+			for level := gzip.BestSpeed; level <= gzip.BestCompression; level++ {
+				c, err := httpcompression.NewDefaultGzipCompressor(level)
+				if err != nil {
+					return nil, err
+				}
+				cs = append(cs, candidate{enc, level, c, fmt.Sprintf("httpcompression.GzipCompressionLevel(%d)", level), ""})
+			}
+		case "br":
+			for level := 0; level <= 11; level++ {
+				c, err := brotli.New(brotli.Options{Quality: level})
+				if err != nil {
+					return nil, err
+				}
+				cs = append(cs, candidate{enc, level, c, fmt.Sprintf("httpcompression.BrotliCompressionLevel(%d)", level), ""})
+			}
+		case "zstd":
+			// The zstd encoder supports only these levels; other levels
+			// are mapped to the closest one.
+			for _, level := range []int{1, 3, 7, 11} {
+				c, err := zstd.New(kpzstd.WithEncoderLevel(kpzstd.EncoderLevelFromZstd(level)))
+				if err != nil {
+					return nil, err
+				}
+				cs = append(cs, candidate{enc, level, c, "httpcompression.ZstandardCompressor(zstdComp)",
+					fmt.Sprintf("zstdComp, _ := zstd.New(kpzstd.WithEncoderLevel(kpzstd.EncoderLevelFromZstd(%d)))", level)})
+			}
+		default:
+			return nil, fmt.Errorf("unsupported encoding: %q", enc)
+		}
+	}
+	return cs, nil
+}
+
+// measure compresses the corpus with c repeatedly, for at least d.
+func measure(c candidate, corpus [][]byte, d time.Duration) (result, error) {
+	var (
+		buf        bytes.Buffer
+		in, out    int64
+		start      = time.Now()
+		startCPU   = cpuTime()
+		iterations int
+	)
+	for iterations == 0 || time.Since(start) < d {
+		for _, body := range corpus {
+			buf.Reset()
+			w := c.comp.Get(&buf)
+			if _, err := w.Write(body); err != nil {
+				return result{}, err
+			}
+			if err := w.Close(); err != nil {
+				return result{}, err
+			}
+			in += int64(len(body))
+			out += int64(buf.Len())
+		}
+		iterations++
+	}
+	elapsed, cpu := time.Since(start), cpuTime()-startCPU
+	mb := float64(in) / (1 << 20)
+	return result{
+		candidate: c,
+		ratio:     float64(out) / float64(in),
+		speed:     mb / elapsed.Seconds(),
+		cpu:       time.Duration(float64(cpu) / mb),
+	}, nil
+}
+
+func readCorpus(dir string) ([][]byte, error) {
+	var corpus [][]byte
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err == nil && len(b) > 0 {
+			corpus = append(corpus, b)
+		}
+		return err
+	})
+	if err == nil && len(corpus) == 0 {
+		err = fmt.Errorf("no files in %s", dir)
+	}
+	return corpus, err
+}
+
+func main() {
+	var (
+		encodings = flag.String("encodings", "gzip,br,zstd", "comma-separated list of the encodings to measure")
+		benchtime = flag.Duration("benchtime", 200*time.Millisecond, "minimum time spent measuring each level")
+		minSpeed  = flag.Float64("min-speed", 50, "minimum speed, in MB/s, of the suggested levels")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] dir\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	corpus, err := readCorpus(flag.Arg(0))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	cs, err := candidates(strings.Split(*encodings, ","))
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "encoding\tlevel\tratio\tMB/s\tCPU/MB\t")
+	best := map[string]result{}
+	var order []string
+	for _, c := range cs {
+		r, err := measure(c, corpus, *benchtime)
+		if err != nil {
+			fatalf("%s level %d: %v", c.enc, c.level, err)
+		}
+		cpu := "-"
+		if r.cpu > 0 {
+			cpu = r.cpu.Round(time.Microsecond).String()
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.3f\t%.1f\t%s\t\n", r.enc, r.level, r.ratio, r.speed, cpu)
+		if b, ok := best[r.enc]; !ok {
+			order = append(order, r.enc)
+			best[r.enc] = r
+		} else if better(r, b, *minSpeed) {
+			best[r.enc] = r
+		}
+	}
+	tw.Flush()
+	printSnippet(os.Stdout, order, best, *minSpeed)
+}
+
+// better returns true if r is a better suggestion than b: the best ratio
+// among the results at least as fast as minSpeed or, if none is, the fastest.
+func better(r, b result, minSpeed float64) bool {
+	switch {
+	case r.speed >= minSpeed && b.speed >= minSpeed:
+		return r.ratio < b.ratio
+	case r.speed < minSpeed && b.speed < minSpeed:
+		return r.speed > b.speed
+	default:
+		return r.speed >= minSpeed
+	}
+}
+
+func printSnippet(w io.Writer, order []string, best map[string]result, minSpeed float64) {
+	fmt.Fprintf(w, "\nSuggested options (best ratio with at least %.0f MB/s):\n\n", minSpeed)
+	fmt.Fprintln(w, "httpcompression.DefaultAdapter(")
+	for _, enc := range order {
+		r := best[enc]
+		var notes []string
+		if r.note != "" {
+			notes = append(notes, r.note)
+		}
+		if r.speed < minSpeed {
+			notes = append(notes, fmt.Sprintf("no level reaches %.0f MB/s", minSpeed))
+		}
+		comment := ""
+		if len(notes) > 0 {
+			comment = " // " + strings.Join(notes, "; ")
+		}
+		fmt.Fprintf(w, "\t%s,%s\n", r.option, comment)
+	}
+	fmt.Fprintln(w, ")")
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "compbench: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,141 @@
+// Command precompress generates the precompressed variants (".gz", ".br" and
+// ".zst" files) of the files in a directory tree, that are served by
+// httpcompression.FileServer.
+//
+// It uses the same compressors used by the httpcompression middleware, so
+// that variants generated at build time and variants generated at runtime
+// (see httpcompression.StartPrecompress) are consistent.
+//
+// Usage:
+//
+//	precompress [flags] dir
+//
+// Variants are generated only if missing or older than the original file,
+// and only if smaller than it. With -check no variant is written: the missing
+// or stale variants are reported, and the command exits with status 1 if
+// there is any.
+//
+// With -zstd-seekable the zstd variants are generated in the zstd seekable
+// format, so that httpcompression.FileServer can serve ranges of their
+// decompressed content even if the original files are removed.
+//
+// The -include and -exclude flags can be repeated; the patterns use the
+// path.Match syntax and are matched against both the slash-separated path
+// relative to dir and the file name.
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/andybalholm/brotli"
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+
+	kpzstd "github.com/klauspost/compress/zstd"
+)
+
+type patterns []string
+
+func (p *patterns) String() string { return strings.Join(*p, ",") }
+
+func (p *patterns) Set(s string) error {
+	if _, err := path.Match(s, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", s, err)
+	}
+	*p = append(*p, s)
+	return nil
+}
+
+// match returns true if any of the patterns matches name or its base name.
+func (p patterns) match(name string) bool {
+	for _, pattern := range p {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	var (
+		include, exclude patterns
+		encodings        = flag.String("encodings", "gzip,br,zstd", "comma-separated list of the encodings of the variants to generate")
+		gzipLevel        = flag.Int("gzip-level", gzip.DefaultCompression, "gzip compression level")
+		brotliLevel      = flag.Int("brotli-level", brotli.DefaultCompression, "brotli compression level")
+		zstdLevel        = flag.Int("zstd-level", 3, "zstd compression level")
+		zstdSeekable     = flag.Int("zstd-seekable", 0, "if not zero, generate the zstd variants in the seekable format, with frames of `size` bytes")
+		minSize          = flag.Int("min-size", httpcompression.DefaultMinSize, "minimum size of the files to precompress")
+		concurrency      = flag.Int("j", 0, "maximum number of variants generated concurrently (0 means the number of CPUs)")
+		check            = flag.Bool("check", false, "only check that the variants are up to date, without writing them")
+	)
+	flag.Var(&include, "include", "precompress only the files matching `pattern` (can be repeated)")
+	flag.Var(&exclude, "exclude", "do not precompress the files matching `pattern` (can be repeated)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] dir\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := flag.Arg(0)
+
+	opts := []httpcompression.Option{httpcompression.MinSize(*minSize)}
+	for _, enc := range strings.Split(*encodings, ",") {
+		switch strings.TrimSpace(enc) {
+		case "gzip":
+			opts = append(opts, httpcompression.GzipCompressionLevel(*gzipLevel))
+		case "br":
+			opts = append(opts, httpcompression.BrotliCompressionLevel(*brotliLevel))
+		case "zstd":
+			level := kpzstd.WithEncoderLevel(kpzstd.EncoderLevelFromZstd(*zstdLevel))
+			var (
+				c   httpcompression.CompressorProvider
+				err error
+			)
+			if *zstdSeekable != 0 {
+				c, err = zstd.NewSeekable(*zstdSeekable, level)
+			} else {
+				c, err = zstd.New(level)
+			}
+			if err != nil {
+				fatalf("zstd: %v", err)
+			}
+			opts = append(opts, httpcompression.ZstandardCompressor(c))
+		default:
+			fatalf("unsupported encoding: %q", enc)
+		}
+	}
+
+	cfg := httpcompression.PrecompressConfig{
+		Concurrency: *concurrency,
+		Check:       *check,
+		Match: func(name string) bool {
+			return (len(include) == 0 || include.match(name)) && !exclude.match(name)
+		},
+	}
+	stats, err := httpcompression.Precompress(context.Background(), os.DirFS(dir), dir, cfg, opts...)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if *check {
+		fmt.Printf("%d files: %d variants up to date, %d not worth compressing\n", stats.Files, stats.UpToDate, stats.Skipped)
+	} else {
+		fmt.Printf("%d files: %d variants generated, %d up to date, %d not worth compressing\n", stats.Files, stats.Created, stats.UpToDate, stats.Skipped)
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "precompress: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,328 @@
+// Command replay reports what the httpcompression middleware would have done
+// with a recorded sample of production traffic: the encodings it would have
+// chosen, the bytes it would have saved, and an estimate of the CPU time it
+// would have spent compressing the responses.
+//
+// Usage:
+//
+//	replay [flags] file...
+//
+// Each file is either a HAR file (e.g. exported from the developer tools of
+// a browser, or by a proxy), or, if its name ends in .jsonl, a capture with
+// one JSON object per line:
+//
+//	{"method": "GET", "url": "/api/users", "acceptEncoding": "gzip, br",
+//	 "status": 200, "header": {"Content-Type": ["application/json"]},
+//	 "body": "...", "bodyBase64": "..."}
+//
+// where body is the uncompressed body, or bodyBase64 its base64 encoding.
+// The entries of the HAR files whose content was not recorded are skipped.
+//
+// The middleware uses the default options, plus the options of the JSON
+// httpcompression.Config in the file specified with -config, if any, so that
+// different configurations can be compared on the same traffic.
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/bench"
+)
+
+// entry is a recorded request and response.
+type entry struct {
+	response bench.Response
+	path     string // the path of the request, without the query
+	recorded int64  // the size of the body as transferred, if known, or -1
+}
+
+// har is the subset of the HAR 1.2 format used by replay.
+type har struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method  string      `json:"method"`
+				URL     string      `json:"url"`
+				Headers []harHeader `json:"headers"`
+			} `json:"request"`
+			Response struct {
+				Status  int         `json:"status"`
+				Headers []harHeader `json:"headers"`
+				Content struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+				BodySize int64 `json:"bodySize"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// capture is an entry of the JSONL format.
+type capture struct {
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	AcceptEncoding string      `json:"acceptEncoding"`
+	Status         int         `json:"status"`
+	Header         http.Header `json:"header"`
+	Body           string      `json:"body"`
+	BodyBase64     []byte      `json:"bodyBase64"`
+}
+
+// skippedHeaders are the headers of the recorded responses that do not apply
+// to their uncompressed bodies.
+var skippedHeaders = map[string]bool{
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+}
+
+func readHAR(name string) (entries []entry, skipped int, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	var h har
+	if err := json.NewDecoder(f).Decode(&h); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", name, err)
+	}
+	for _, e := range h.Log.Entries {
+		c := e.Response.Content
+		if c.Text == "" {
+			skipped++
+			continue
+		}
+		body := []byte(c.Text)
+		if c.Encoding == "base64" {
+			if body, err = base64.StdEncoding.DecodeString(c.Text); err != nil {
+				return nil, 0, fmt.Errorf("%s: %s: %w", name, e.Request.URL, err)
+			}
+		}
+		resp := bench.Response{Method: e.Request.Method, Status: e.Response.Status, Header: http.Header{}, Body: body}
+		for _, hdr := range e.Request.Headers {
+			if strings.EqualFold(hdr.Name, "Accept-Encoding") {
+				resp.AcceptEncoding = hdr.Value
+			}
+		}
+		for _, hdr := range e.Response.Headers {
+			if k := http.CanonicalHeaderKey(hdr.Name); !skippedHeaders[k] && !strings.HasPrefix(k, ":") {
+				resp.Header.Add(k, hdr.Value)
+			}
+		}
+		if resp.Header.Get("Content-Type") == "" && c.MimeType != "" {
+			resp.Header.Set("Content-Type", c.MimeType)
+		}
+		entries = append(entries, newEntry(resp, e.Request.URL, e.Response.BodySize))
+	}
+	return entries, skipped, nil
+}
+
+func readJSONL(name string) ([]entry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []entry
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 64<<20)
+	for line := 1; s.Scan(); line++ {
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		var c capture
+		if err := json.Unmarshal(s.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		body := []byte(c.Body)
+		if c.BodyBase64 != nil {
+			body = c.BodyBase64
+		}
+		header := http.Header{}
+		for k, v := range c.Header {
+			if k = http.CanonicalHeaderKey(k); !skippedHeaders[k] {
+				header[k] = v
+			}
+		}
+		resp := bench.Response{Method: c.Method, AcceptEncoding: c.AcceptEncoding, Status: c.Status, Header: header, Body: body}
+		entries = append(entries, newEntry(resp, c.URL, -1))
+	}
+	return entries, s.Err()
+}
+
+func newEntry(resp bench.Response, rawURL string, recorded int64) entry {
+	e := entry{response: resp, path: "/", recorded: recorded}
+	if u, err := url.Parse(rawURL); err == nil {
+		if u.Path != "" {
+			e.path = u.EscapedPath()
+		}
+		e.response.Target = e.path
+		if u.RawQuery != "" {
+			e.response.Target += "?" + u.RawQuery
+		}
+	}
+	if resp.AcceptEncoding == "" {
+		// The request did not accept any encoding.
+		e.response.AcceptEncoding = "identity"
+	}
+	return e
+}
+
+func options(configFile string) ([]httpcompression.Option, error) {
+	if configFile == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	var cfg httpcompression.Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", configFile, err)
+	}
+	return httpcompression.FromConfig(cfg)
+}
+
+func main() {
+	var (
+		configFile  = flag.String("config", "", "JSON httpcompression.Config file with the options to evaluate")
+		concurrency = flag.Int("concurrency", 1, "number of responses compressed concurrently")
+		top         = flag.Int("top", 10, "number of paths reported, by decreasing compression time")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var (
+		entries []entry
+		skipped int
+	)
+	for _, name := range flag.Args() {
+		var (
+			es  []entry
+			n   int
+			err error
+		)
+		if strings.HasSuffix(name, ".jsonl") {
+			es, err = readJSONL(name)
+		} else {
+			es, n, err = readHAR(name)
+		}
+		if err != nil {
+			fatalf("%v", err)
+		}
+		entries, skipped = append(entries, es...), skipped+n
+	}
+	if len(entries) == 0 {
+		fatalf("no responses with a recorded body (%d skipped)", skipped)
+	}
+
+	opts, err := options(*configFile)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	paths := map[string]string{} // target -> path
+	responses := make([]bench.Response, len(entries))
+	var recorded, recordedSize int64
+	for i, e := range entries {
+		responses[i] = e.response
+		paths[e.response.Target] = e.path
+		if e.recorded >= 0 {
+			recorded++
+			recordedSize += e.recorded
+		}
+	}
+	costs := httpcompression.NewCostTracker(func(r *http.Request) string {
+		return paths[r.URL.RequestURI()]
+	})
+	compress, err := httpcompression.DefaultAdapter(append(opts, httpcompression.TrackCosts(costs))...)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	res, err := bench.Run(compress, responses, bench.Config{Concurrency: *concurrency})
+	if err != nil {
+		fatalf("%v", err)
+	}
+	report(res, costs.Stats(), *top)
+	if skipped > 0 {
+		fmt.Printf("skipped %d entries without a recorded body\n", skipped)
+	}
+	if recorded == int64(len(entries)) && recordedSize > 0 {
+		fmt.Printf("recorded transfer size: %d bytes (%+.1f%% with the evaluated options)\n",
+			recordedSize, 100*(float64(res.CompressedBytes)/float64(recordedSize)-1))
+	}
+}
+
+func report(res bench.Result, costs map[string]httpcompression.CostStats, top int) {
+	var cost time.Duration
+	for _, c := range costs {
+		cost += c.CompressionTime
+	}
+	saved := res.UncompressedBytes - res.CompressedBytes
+	fmt.Printf("responses:          %d\n", res.Requests)
+	fmt.Printf("uncompressed bytes: %d\n", res.UncompressedBytes)
+	fmt.Printf("compressed bytes:   %d (ratio %.3f)\n", res.CompressedBytes, res.Ratio())
+	fmt.Printf("saved bytes:        %d (%.1f%%)\n", saved, 100*float64(saved)/float64(max(res.UncompressedBytes, 1)))
+	fmt.Printf("compression time:   %v (%v/MB)\n", cost.Round(time.Microsecond),
+		time.Duration(float64(cost)/(float64(res.UncompressedBytes)/(1<<20))).Round(time.Microsecond))
+	fmt.Println()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "encoding\tresponses\t")
+	encs := make([]string, 0, len(res.Encodings))
+	for enc := range res.Encodings {
+		encs = append(encs, enc)
+	}
+	sort.Slice(encs, func(i, j int) bool { return res.Encodings[encs[i]] > res.Encodings[encs[j]] })
+	for _, enc := range encs {
+		fmt.Fprintf(tw, "%s\t%d\t\n", enc, res.Encodings[enc])
+	}
+	tw.Flush()
+	fmt.Println()
+
+	patterns := make([]string, 0, len(costs))
+	for p := range costs {
+		patterns = append(patterns, p)
+	}
+	sort.Slice(patterns, func(i, j int) bool { return costs[patterns[i]].CompressionTime > costs[patterns[j]].CompressionTime })
+	if len(patterns) > top {
+		patterns = patterns[:top]
+	}
+	fmt.Fprintln(tw, "path\tcompressed\tsaved bytes\tratio\ttime\t")
+	for _, p := range patterns {
+		c := costs[p]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.3f\t%v\t\n", p, c.Responses, int64(c.UncompressedBytes)-int64(c.CompressedBytes),
+			float64(c.CompressedBytes)/float64(max(c.UncompressedBytes, 1)), c.CompressionTime.Round(time.Microsecond))
+	}
+	tw.Flush()
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "replay: "+format+"\n", args...)
+	os.Exit(1)
+}
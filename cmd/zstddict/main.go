@@ -0,0 +1,70 @@
+// Command zstddict trains a zstd dictionary from a corpus of representative
+// response bodies, to be used with httpcompression.ZstandardDictionaryCompressor.
+//
+// Usage:
+//
+//	zstddict [flags] dir
+//
+// Each regular file in dir (and its subdirectories) is a sample. The
+// dictionary is written to the file specified with -o, and its ID and the
+// corresponding Content-Encoding are printed.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+)
+
+func main() {
+	var (
+		out  = flag.String("o", "dictionary.zstd", "output `file`")
+		size = flag.Int("size", 32<<10, "maximum size of the dictionary, in bytes")
+		id   = flag.Uint("id", 0, "dictionary ID (0 means random)")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] dir\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var samples [][]byte
+	err := filepath.WalkDir(flag.Arg(0), func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err == nil && len(b) > 0 {
+			samples = append(samples, b)
+		}
+		return err
+	})
+	if err != nil {
+		fatalf("%v", err)
+	}
+	dict, err := zstd.Train(samples, *size, uint32(*id))
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if err := os.WriteFile(*out, dict, 0o644); err != nil {
+		fatalf("%v", err)
+	}
+	dictID, err := zstd.DictionaryID(dict)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	fmt.Printf("%s: %d bytes, %d samples, ID %d, Content-Encoding %q\n", *out, len(dict), len(samples), dictID, zstd.DictionaryEncoding(dictID))
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "zstddict: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,69 @@
+package httpcompression
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cacheControl = "Cache-Control"
+
+// CompressOnce is an option that enables the compress-once mode for
+// long-lived responses, i.e. responses that have a "Cache-Control: immutable"
+// header, or a max-age (or s-maxage) of at least minMaxAge.
+//
+// Long-lived responses are compressed with the CompressorProvider in
+// providers matching the selected Content-Encoding (if any; otherwise the
+// normal compressor is used), that is normally configured to use a higher
+// compression level than the normal compressor, and they are stored in the
+// variant cache: the higher CPU cost of compression is amortized over the
+// following requests for the same response. Long-lived responses are stored
+// in the cache even if they have no validator, as their URL is assumed to
+// identify their content.
+//
+// CompressOnce requires the VariantCache option.
+func CompressOnce(minMaxAge time.Duration, providers map[string]CompressorProvider) Option {
+	return named("CompressOnce", func(c *config) error {
+		if minMaxAge <= 0 {
+			return fmt.Errorf("compress-once minimum max-age must be positive: %v", minMaxAge)
+		}
+		comps := make(map[string]CompressorProvider, len(providers))
+		for enc, p := range providers {
+			if enc == "" || p == nil {
+				return fmt.Errorf("invalid compress-once compressor for encoding %q", enc)
+			}
+			comps[enc] = p
+		}
+		c.once = &onceConfig{minMaxAge: minMaxAge, comps: comps}
+		return nil
+	})
+}
+
+type onceConfig struct {
+	minMaxAge time.Duration
+	comps     map[string]CompressorProvider
+}
+
+// longLived returns true if the response headers h mark the response as
+// immutable, or as cacheable for at least minMaxAge.
+func longLived(h http.Header, minMaxAge time.Duration) bool {
+	longLived := false
+	for _, v := range h.Values(cacheControl) {
+		for _, d := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+			switch strings.ToLower(name) {
+			case "immutable":
+				longLived = true
+			case "max-age", "s-maxage":
+				if secs, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64); err == nil && time.Duration(secs) >= minMaxAge/time.Second {
+					longLived = true
+				}
+			case "no-store", "no-cache", "private":
+				return false
+			}
+		}
+	}
+	return longLived
+}
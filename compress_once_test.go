@@ -0,0 +1,98 @@
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressOnce(t *testing.T) {
+	t.Parallel()
+
+	normal, _ := NewDefaultGzipCompressor(1)
+	best, _ := NewDefaultGzipCompressor(9)
+	np := &countingProvider{CompressorProvider: normal}
+	bp := &countingProvider{CompressorProvider: best}
+	cache := NewMemoryCache(1 << 20)
+	mw, err := Adapter(
+		GzipCompressor(np),
+		VariantCache(cache, time.Hour, 1<<20),
+		CompressOnce(24*time.Hour, map[string]CompressorProvider{"gzip": bp}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(cacheControl, r.URL.Query().Get("cc"))
+		io.WriteString(w, testBody)
+	}))
+	get := func(cc string) {
+		req := httptest.NewRequest("GET", "/?cc="+cc, nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, "gzip", res.Header().Get(contentEncoding), cc)
+		b, err := decodeGzip(res.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, testBody, string(b), cc)
+	}
+
+	// Long-lived responses are compressed once with the compress-once compressor.
+	for _, cc := range []string{"public,%20max-age=31536000,%20immutable", "max-age=86400", "s-maxage=100000"} {
+		get(cc)
+		get(cc)
+	}
+	assert.EqualValues(t, 3, atomic.LoadInt32(&bp.n))
+	assert.EqualValues(t, 0, atomic.LoadInt32(&np.n))
+
+	// Other responses (without validators) are compressed normally for each request.
+	for _, cc := range []string{"", "max-age=60", "no-store,%20immutable", "private,%20max-age=86400"} {
+		get(cc)
+		get(cc)
+	}
+	assert.EqualValues(t, 3, atomic.LoadInt32(&bp.n))
+	assert.EqualValues(t, 8, atomic.LoadInt32(&np.n))
+}
+
+func TestCompressOnceRequiresCache(t *testing.T) {
+	t.Parallel()
+
+	_, err := Adapter(GzipCompressionLevel(1), CompressOnce(time.Hour, nil))
+	assert.Error(t, err)
+	_, err = Adapter(GzipCompressionLevel(1), VariantCache(NewMemoryCache(1), 0, 1), CompressOnce(0, nil))
+	assert.Error(t, err)
+	_, err = Adapter(GzipCompressionLevel(1), VariantCache(NewMemoryCache(1), 0, 1), CompressOnce(time.Hour, map[string]CompressorProvider{"gzip": nil}))
+	assert.Error(t, err)
+	_, err = Adapter(GzipCompressionLevel(1), VariantCache(NewMemoryCache(1), 0, 1), CompressOnce(time.Hour, nil))
+	assert.NoError(t, err)
+}
+
+func TestLongLived(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		cc        []string
+		longLived bool
+	}{
+		{nil, false},
+		{[]string{"immutable"}, true},
+		{[]string{"public", "max-age=3600"}, true},
+		{[]string{"max-age=3599"}, false},
+		{[]string{`max-age="3600"`}, true},
+		{[]string{"MAX-AGE=3600"}, true},
+		{[]string{"max-age=abc"}, false},
+		{[]string{"no-cache, max-age=3600"}, false},
+	}
+	for _, c := range cases {
+		h := http.Header{}
+		for _, v := range c.cc {
+			h.Add(cacheControl, v)
+		}
+		assert.Equal(t, c.longLived, longLived(h, time.Hour), "%q", c.cc)
+	}
+}
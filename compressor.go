@@ -1,6 +1,8 @@
 package httpcompression
 
 import (
+	"context"
+	"fmt"
 	"io"
 )
 
@@ -25,6 +27,40 @@ type Flusher interface {
 	Flush() error
 }
 
+// ContextCompressorProvider is an optional interface that can be implemented by the
+// CompressorProviders that need the context of the request to get a compressor, e.g. to honor
+// its cancellation, to record tracing spans, or to give up if a compressor can not be acquired
+// in time. The middleware calls GetContext instead of Get, with the context of the request, right
+// before it starts the compressed response: if GetContext returns an error, the response is sent
+// uncompressed. The returned compressor follows the same rules of the ones returned by Get.
+type ContextCompressorProvider interface {
+	CompressorProvider
+	GetContext(ctx context.Context, parent io.Writer) (compressor io.WriteCloser, err error)
+}
+
+// deferredWriter is the parent of a compressor obtained before its parent
+// is known: it discards the output until w is set.
+type deferredWriter struct {
+	w io.Writer
+}
+
+func (d *deferredWriter) Write(b []byte) (int, error) {
+	return d.w.Write(b)
+}
+
+// getContext gets a compressor from p, writing to the returned deferredWriter.
+func getContext(ctx context.Context, p ContextCompressorProvider) (io.WriteCloser, *deferredWriter, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	d := &deferredWriter{w: io.Discard}
+	zw, err := p.GetContext(ctx, d)
+	if err != nil {
+		return nil, nil, err
+	}
+	return zw, d, nil
+}
+
 // Compressor returns an Option that sets the CompressorProvider for a specific Content-Encoding.
 // If multiple CompressorProviders are set for the same Content-Encoding, the last one is used.
 // If compressor is nil, it disables the specified Content-Encoding.
@@ -34,10 +70,67 @@ type Flusher interface {
 func Compressor(contentEncoding string, priority int, compressor CompressorProvider) Option {
 	return func(c *config) error {
 		if compressor == nil {
-			delete(c.compressor, contentEncoding)
+			c.disable(contentEncoding)
 			return nil
 		}
-		c.compressor[contentEncoding] = comp{compressor, priority}
+		c.compressor[contentEncoding] = comp{comp: compressor, priority: priority}
+		delete(c.disabled, contentEncoding)
+		return nil
+	}
+}
+
+// DisableEncoding is an option that disables the specified Content-Encodings,
+// e.g. to remove some of the compressors configured by DefaultAdapter:
+//
+//	compress, err := httpcompression.DefaultAdapter(httpcompression.DisableEncoding("zstd", "deflate"))
+//
+// It can also disable the dictionary encodings (see DictionaryCompressor).
+// Disabling an encoding that is not configured has no effect on the
+// compression, but FileServer does not serve its precompressed variants.
+func DisableEncoding(contentEncodings ...string) Option {
+	return func(c *config) error {
+		for _, enc := range contentEncodings {
+			c.disable(enc)
+			if c.dict != nil {
+				delete(c.dict.comps, enc)
+			}
+		}
 		return nil
 	}
 }
+
+// disable removes the compressor for contentEncoding, and records that it
+// was disabled, so that FileServer does not serve its precompressed variants.
+func (c *config) disable(contentEncoding string) {
+	delete(c.compressor, contentEncoding)
+	if c.disabled == nil {
+		c.disabled = map[string]bool{}
+	}
+	c.disabled[contentEncoding] = true
+}
+
+// Priority is an option that changes the priority of the compressor for the
+// specified Content-Encoding (see Compressor), e.g. to prefer zstd to
+// brotli:
+//
+//	compress, err := httpcompression.DefaultAdapter(httpcompression.Priority("zstd", 0))
+//
+// It also applies to the dictionary encodings (see DictionaryCompressor). An
+// error is returned if no compressor is configured for the encoding.
+func Priority(contentEncoding string, priority int) Option {
+	return named("Priority", func(c *config) error {
+		if cc, ok := c.compressor[contentEncoding]; ok {
+			cc.priority = priority
+			c.compressor[contentEncoding] = cc
+			return nil
+		}
+		if c.dict != nil {
+			if dc, ok := c.dict.comps[contentEncoding]; ok {
+				dc.priority = priority
+				c.dict.comps[contentEncoding] = dc
+				return nil
+			}
+		}
+		return fmt.Errorf("no compressor configured for encoding: %q", contentEncoding)
+	})
+}
@@ -0,0 +1,73 @@
+package httpcompression
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ctxKey struct{}
+
+// contextProvider fails to get a compressor for the requests whose context
+// has the ctxKey value.
+type contextProvider struct {
+	CompressorProvider
+	gets, ctxGets atomic.Int32
+}
+
+func (p *contextProvider) Get(w io.Writer) io.WriteCloser {
+	p.gets.Add(1)
+	return p.CompressorProvider.Get(w)
+}
+
+func (p *contextProvider) GetContext(ctx context.Context, w io.Writer) (io.WriteCloser, error) {
+	p.ctxGets.Add(1)
+	if ctx.Value(ctxKey{}) != nil {
+		return nil, errors.New("no compressor available")
+	}
+	return p.CompressorProvider.Get(w), nil
+}
+
+func TestContextCompressorProvider(t *testing.T) {
+	t.Parallel()
+
+	gz, err := NewDefaultGzipCompressor(6)
+	if !assert.NoError(t, err) {
+		return
+	}
+	p := &contextProvider{CompressorProvider: gz}
+	a, err := Adapter(GzipCompressor(p))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(testBody))
+	}))
+	for _, fail := range []bool{false, true} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		if fail {
+			req = req.WithContext(context.WithValue(req.Context(), ctxKey{}, true))
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+
+		enc := "gzip"
+		if fail {
+			enc = ""
+		}
+		assert.Equal(t, enc, res.Header().Get(contentEncoding))
+		b, err := decodeBody(res.Body, enc)
+		assert.NoError(t, err)
+		assert.Equal(t, testBody, string(b))
+	}
+	assert.Equal(t, int32(2), p.ctxGets.Load())
+	assert.Equal(t, int32(0), p.gets.Load())
+}
@@ -0,0 +1,144 @@
+package httpcompression
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+)
+
+const identity = "identity"
+
+// Variant is a representation of a content, served by ServeContent.
+type Variant struct {
+	// Encoding is the Content-Encoding of the variant. It is empty for the
+	// identity (uncompressed) variant.
+	Encoding string
+	// Content is the content of the variant.
+	Content io.ReadSeeker
+	// ETag is the strong ETag of the variant, used for conditional requests.
+	// Each variant should have a different ETag. Optional.
+	ETag string
+	// Ranges enables Range requests for a compressed variant. This must
+	// be true only if the compressed data is the same for all requests
+	// (e.g. for a precompressed file, or for a seekable compressed variant).
+	// Range requests are always served for the identity variant.
+	Ranges bool
+}
+
+// ServeContent is like http.ServeContent, but it serves the variant of the
+// content that is accepted by the client (according to the Accept-Encoding
+// header of the request), among variants in order of preference.
+//
+// Like http.ServeContent, it handles If-Match, If-Unmodified-Since,
+// If-None-Match, If-Modified-Since and If-Range requests, using the ETag of
+// the selected variant and modtime. Range requests are served for the
+// identity variant and for the variants that enable them; for the other
+// variants the Range header is ignored and the full variant is served.
+//
+// The Content-Type is determined by name or, if not possible and if an
+// identity variant is provided, by sniffing the identity variant. If the
+// client accepts none of the variants, the response is 406 Not Acceptable,
+// with a problem details document listing the encodings of the variants (see
+// RejectNotAcceptable).
+func ServeContent(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, variants []Variant) {
+	addVaryHeader(w.Header(), acceptEncoding)
+
+	accept := parseEncodings(r.Header.Values(acceptEncoding))
+	var selected *Variant
+	for i, v := range variants {
+		if acceptable(accept, v.Encoding) {
+			selected = &variants[i]
+			break
+		}
+	}
+	if selected == nil {
+		encs := make([]string, 0, len(variants))
+		for _, v := range variants {
+			if v.Encoding == "" {
+				encs = append(encs, identity)
+			} else {
+				encs = append(encs, v.Encoding)
+			}
+		}
+		writeNotAcceptable(w, encs)
+		return
+	}
+
+	h := w.Header()
+	if selected.ETag != "" {
+		h.Set(etag, selected.ETag)
+	}
+	if selected.Encoding == "" {
+		http.ServeContent(w, r, name, modtime, selected.Content)
+		return
+	}
+
+	if _, ok := h[contentType]; !ok {
+		// http.ServeContent would sniff the compressed data.
+		h.Set(contentType, contentTypeOf(name, variants))
+	}
+	h.Set(contentEncoding, selected.Encoding)
+	if !selected.Ranges {
+		r2 := *r
+		r2.Header = r.Header.Clone()
+		r2.Header.Del(_range)
+		r2.Header.Del(ifRange)
+		r, w = &r2, noRangesWriter{w}
+	}
+	http.ServeContent(w, r, name, modtime, selected.Content)
+}
+
+// acceptable returns true if the encoding enc ("" for identity) is
+// acceptable according to accept.
+func acceptable(accept codings, enc string) bool {
+	if enc == "" {
+		enc = identity
+	}
+	if q, ok := accept[enc]; ok {
+		return q > 0
+	}
+	if q, ok := accept["*"]; ok {
+		return q > 0
+	}
+	// The identity encoding is always acceptable, unless explicitly excluded.
+	return enc == identity
+}
+
+// contentTypeOf returns the Content-Type of the content name, determined by
+// its extension or, if the extension is unknown, by sniffing the identity
+// variant, if any.
+func contentTypeOf(name string, variants []Variant) string {
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct
+	}
+	for _, v := range variants {
+		if v.Encoding != "" {
+			continue
+		}
+		var buf [512]byte
+		n, _ := io.ReadFull(v.Content, buf[:])
+		if _, err := v.Content.Seek(0, io.SeekStart); err != nil {
+			break
+		}
+		return http.DetectContentType(buf[:n])
+	}
+	return "application/octet-stream"
+}
+
+// noRangesWriter advertises that Range requests are not supported.
+type noRangesWriter struct {
+	http.ResponseWriter
+}
+
+func (w noRangesWriter) WriteHeader(code int) {
+	if w.Header().Get(acceptRanges) != "" {
+		w.Header().Set(acceptRanges, "none")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w noRangesWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,105 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testVariants(ranges bool) []Variant {
+	return []Variant{
+		{Encoding: "br", Content: strings.NewReader("brotli variant"), ETag: `"v1-br"`, Ranges: ranges},
+		{Encoding: "gzip", Content: strings.NewReader("gzip variant"), ETag: `"v1-gzip"`},
+		{Content: strings.NewReader("identity variant"), ETag: `"v1"`},
+	}
+}
+
+func serveTestContent(name string, variants []Variant, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/"+name, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res := httptest.NewRecorder()
+	ServeContent(res, req, name, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), variants)
+	return res
+}
+
+func TestServeContent(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		accept   string
+		status   int
+		encoding string
+		body     string
+	}{
+		{"", 200, "", "identity variant"},
+		{"gzip", 200, "gzip", "gzip variant"},
+		{"gzip, br", 200, "br", "brotli variant"},
+		{"br;q=0, gzip", 200, "gzip", "gzip variant"},
+		{"*", 200, "br", "brotli variant"},
+		{"zstd", 200, "", "identity variant"},
+		{"zstd, identity;q=0", 406, "", ""},
+		{"zstd, *;q=0", 406, "", ""},
+	}
+	for _, c := range cases {
+		res := serveTestContent("app.js", testVariants(false), http.Header{"Accept-Encoding": {c.accept}})
+		assert.Equal(t, c.status, res.Code, c.accept)
+		if c.status != 200 {
+			assert.Equal(t, "application/problem+json", res.Header().Get(contentType), c.accept)
+			assert.Contains(t, res.Body.String(), `"supportedEncodings":["br","gzip","identity"]`, c.accept)
+			continue
+		}
+		assert.Equal(t, c.encoding, res.Header().Get(contentEncoding), c.accept)
+		assert.Equal(t, "text/javascript; charset=utf-8", res.Header().Get(contentType), c.accept)
+		assert.Equal(t, acceptEncoding, res.Header().Get(vary), c.accept)
+		assert.Equal(t, c.body, res.Body.String(), c.accept)
+	}
+}
+
+func TestServeContentConditional(t *testing.T) {
+	t.Parallel()
+
+	res := serveTestContent("app.js", testVariants(false), http.Header{"Accept-Encoding": {"gzip"}, "If-None-Match": {`"v1-gzip"`}})
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	res = serveTestContent("app.js", testVariants(false), http.Header{"Accept-Encoding": {"br"}, "If-None-Match": {`"v1-gzip"`}})
+	assert.Equal(t, http.StatusOK, res.Code)
+	res = serveTestContent("app.js", testVariants(false), http.Header{"Accept-Encoding": {"gzip"}, "If-Modified-Since": {"Wed, 01 Jan 2020 00:00:00 GMT"}})
+	assert.Equal(t, http.StatusNotModified, res.Code)
+}
+
+func TestServeContentRange(t *testing.T) {
+	t.Parallel()
+
+	// Identity variant: ranges are served.
+	res := serveTestContent("app.js", testVariants(false), http.Header{"Range": {"bytes=0-7"}})
+	assert.Equal(t, http.StatusPartialContent, res.Code)
+	assert.Equal(t, "identity", res.Body.String())
+
+	// Compressed variant without ranges: the full variant is served.
+	res = serveTestContent("app.js", testVariants(false), http.Header{"Accept-Encoding": {"gzip"}, "Range": {"bytes=0-3"}})
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "gzip variant", res.Body.String())
+	assert.Equal(t, "none", res.Header().Get(acceptRanges))
+
+	// Compressed variant with ranges.
+	res = serveTestContent("app.js", testVariants(true), http.Header{"Accept-Encoding": {"br"}, "Range": {"bytes=0-5"}})
+	assert.Equal(t, http.StatusPartialContent, res.Code)
+	assert.Equal(t, "brotli", res.Body.String())
+	assert.Equal(t, "br", res.Header().Get(contentEncoding))
+}
+
+func TestServeContentSniff(t *testing.T) {
+	t.Parallel()
+
+	variants := []Variant{
+		{Encoding: "gzip", Content: strings.NewReader("\x1f\x8b")},
+		{Content: strings.NewReader("<html><body>hello</body></html>")},
+	}
+	res := serveTestContent("page", variants, http.Header{"Accept-Encoding": {"gzip"}})
+	assert.Equal(t, "text/html; charset=utf-8", res.Header().Get(contentType))
+}
@@ -29,18 +29,45 @@ import "mime"
 //
 // By default, responses are compressed regardless of Content-Type.
 func ContentTypes(types []string, blacklist bool) Option {
-	return func(c *config) error {
-		c.contentTypes = []parsedContentType{}
-		for _, v := range types {
-			mediaType, params, err := mime.ParseMediaType(v)
-			if err != nil {
-				return err
-			}
-			c.contentTypes = append(c.contentTypes, parsedContentType{mediaType, params})
+	return named("ContentTypes", func(c *config) error {
+		contentTypes, err := parseContentTypes(types)
+		if err != nil {
+			return err
 		}
+		c.contentTypes = contentTypes
 		c.blacklist = blacklist
 		return nil
+	})
+}
+
+// AlwaysCompressContentTypes is an option that lists content types (e.g.
+// "image/svg+xml" or "application/wasm") whose responses are compressed
+// regardless of their size, i.e. even if they are smaller than MinSize (or
+// than the minimum sizes set with EncodingMinSize). It applies only to the
+// responses whose Content-Type header is set by the handler before the
+// first write, and that are not excluded by ContentTypes. Content types are
+// matched as in ContentTypes.
+func AlwaysCompressContentTypes(types ...string) Option {
+	return named("AlwaysCompressContentTypes", func(c *config) error {
+		contentTypes, err := parseContentTypes(types)
+		if err != nil {
+			return err
+		}
+		c.always = contentTypes
+		return nil
+	})
+}
+
+func parseContentTypes(types []string) ([]parsedContentType, error) {
+	contentTypes := []parsedContentType{}
+	for _, v := range types {
+		mediaType, params, err := mime.ParseMediaType(v)
+		if err != nil {
+			return nil, err
+		}
+		contentTypes = append(contentTypes, parsedContentType{mediaType, params})
 	}
+	return contentTypes, nil
 }
 
 // Parsed representation of one of the inputs to ContentTypes.
@@ -75,3 +102,31 @@ func (pct *parsedContentType) equalsSlow(mediaType string, params map[string]str
 	}
 	return true
 }
+
+// compressedContentTypes are common content types whose content is already
+// compressed, so that compressing it again is a waste of time.
+var compressedContentTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"image/avif",
+	"font/woff",
+	"font/woff2",
+	"video/mp4",
+	"video/webm",
+	"audio/mpeg",
+	"audio/ogg",
+	"application/zip",
+	"application/gzip",
+	"application/zstd",
+}
+
+// metricsContentTypes are the content types of the text exposition formats of
+// the Prometheus metrics endpoints. The protobuf format, negotiated by the
+// scrapers that support native histograms, is not included: it is already
+// compact, and it is usually scraped uncompressed.
+var metricsContentTypes = []string{
+	"text/plain",
+	"application/openmetrics-text",
+}
@@ -40,6 +40,7 @@ func New(opts Options) (c *compressor, err error) {
 func (c *compressor) Get(w io.Writer) io.WriteCloser {
 	if gw, ok := c.pool.Get().(*writer); ok {
 		gw.Reset(w)
+		gw.closed = false
 		return gw
 	}
 	gw := brotli.NewWriterOptions(w, c.opts)
@@ -51,10 +52,15 @@ func (c *compressor) Get(w io.Writer) io.WriteCloser {
 
 type writer struct {
 	*brotli.Writer
-	c *compressor
+	c      *compressor
+	closed bool
 }
 
 func (w *writer) Close() error {
+	if w.closed {
+		return nil // already closed (and recycled)
+	}
+	w.closed = true
 	err := w.Writer.Close()
 	w.Reset(nil)
 	w.c.pool.Put(w)
@@ -14,3 +14,9 @@ func TestZstdRace(t *testing.T) {
 	c, _ := brotli.New(brotli.Options{})
 	internal.RaceTestCompressionProvider(c, 100)
 }
+
+func TestDictionaryRace(t *testing.T) {
+	t.Parallel()
+	c, _ := brotli.NewWithDictionary([]byte("hello world, this is a dictionary"), 5)
+	internal.RaceTestCompressionProvider(c, 100)
+}
@@ -7,11 +7,15 @@ import (
 
 	"github.com/CAFxX/httpcompression"
 	"github.com/CAFxX/httpcompression/contrib/andybalholm/brotli"
+	"github.com/CAFxX/httpcompression/providertest"
 
 	_brotli "github.com/andybalholm/brotli"
 )
 
-var _ httpcompression.CompressorProvider = &brotli.Compressor{}
+var (
+	_ httpcompression.CompressorProvider = &brotli.Compressor{}
+	_ httpcompression.CompressorProvider = &brotli.DictCompressor{}
+)
 
 func TestBrotli(t *testing.T) {
 	t.Parallel()
@@ -36,3 +40,57 @@ func TestBrotli(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestBrotliDictionary(t *testing.T) {
+	t.Parallel()
+
+	dict := []byte(`{"users":[{"id":1,"name":"Alice","email":"alice@example.com","roles":["admin","editor"]}]}`)
+	s := []byte(`{"users":[{"id":2,"name":"Bob","email":"bob@example.com","roles":["admin","editor"]}]}`)
+
+	c, err := brotli.NewWithDictionary(dict, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outputs [][]byte
+	for i := 0; i < 2; i++ { // the second time the writer is reused
+		b := &bytes.Buffer{}
+		w := c.Get(b)
+		w.Write(s)
+		w.Close()
+		outputs = append(outputs, b.Bytes())
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Fatal("reused writer produced a different output")
+	}
+
+	p, _ := brotli.New(brotli.Options{Quality: 5})
+	b := &bytes.Buffer{}
+	w := p.Get(b)
+	w.Write(s)
+	w.Close()
+	if len(outputs[0]) >= b.Len()/2 {
+		t.Fatalf("dictionary did not improve compression: %d, %d without dictionary", len(outputs[0]), b.Len())
+	}
+
+	if _, err := brotli.NewWithDictionary(nil, 5); err == nil {
+		t.Fatal("expected error for empty dictionary")
+	}
+	if _, err := brotli.NewWithDictionary(dict, 12); err == nil {
+		t.Fatal("expected error for invalid level")
+	}
+	if enc := brotli.DictionaryEncoding([]byte("dictionary")); enc != "b_177ca70f" {
+		t.Fatalf("dictionary encoding: got %q", enc)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	providertest.Run(t, "br", func() (httpcompression.CompressorProvider, error) {
+		c, err := brotli.New(brotli.Options{Quality: brotli.DefaultCompression})
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
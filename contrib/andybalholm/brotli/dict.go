@@ -0,0 +1,131 @@
+package brotli
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/andybalholm/brotli/matchfinder"
+)
+
+// maxDictionaryDistance is the maximum backward distance of the streams
+// written by the dictionary compressor (window of 24 bits).
+const maxDictionaryDistance = 1<<24 - 16
+
+type dictCompressor struct {
+	pool  sync.Pool
+	dict  []byte
+	level int
+}
+
+// NewWithDictionary returns a compressor that uses dict as a raw shared
+// dictionary: the compressed streams can be decompressed only by decoders
+// that have the same dictionary attached (e.g. the dcb Content-Encoding
+// of the Compression Dictionary Transport, or BrotliDecoderAttachDictionary
+// with BROTLI_SHARED_DICTIONARY_RAW in the reference implementation).
+// Levels higher than 7 are treated as 7. The dictionary is indexed again
+// for each compressed stream, so large dictionaries increase the cost of
+// compressing small responses. dict must not be modified.
+func NewWithDictionary(dict []byte, level int) (c *dictCompressor, err error) {
+	if len(dict) == 0 || len(dict) > maxDictionaryDistance-1<<16 {
+		return nil, fmt.Errorf("brotli: invalid dictionary size: %d", len(dict))
+	}
+	if level < brotli.BestSpeed || level > brotli.BestCompression {
+		return nil, fmt.Errorf("brotli: invalid compression level: %d", level)
+	}
+	return &dictCompressor{dict: dict, level: level}, nil
+}
+
+func (c *dictCompressor) Get(w io.Writer) io.WriteCloser {
+	if dw, ok := c.pool.Get().(*dictWriter); ok {
+		dw.Reset(w)
+		dw.closed = false
+		return dw
+	}
+	mf := &dictMatchFinder{M4: newM4(c.level, len(c.dict)), dict: c.dict}
+	mf.Reset()
+	return &dictWriter{
+		Writer: &matchfinder.Writer{
+			Dest:        w,
+			MatchFinder: mf,
+			Encoder:     &brotli.Encoder{},
+			BlockSize:   1 << 16,
+		},
+		c: c,
+	}
+}
+
+// newM4 returns a match finder for the level, with the same parameters used
+// by brotli.NewWriterV2, and able to find matches in the dictionary.
+func newM4(level, dictSize int) *matchfinder.M4 {
+	hashLen := 6
+	if level >= 6 {
+		hashLen = 5
+	}
+	chainLen := 64
+	switch {
+	case level <= 2:
+		chainLen = 0
+	case level == 3:
+		chainLen = 1
+	case level == 4:
+		chainLen = 2
+	case level == 5:
+		chainLen = 4
+	case level == 6:
+		chainLen = 8
+	}
+	maxDistance := 1 << 20
+	if d := dictSize + 1<<16; d > maxDistance {
+		maxDistance = d
+	}
+	return &matchfinder.M4{
+		MaxDistance:     maxDistance,
+		ChainLength:     chainLen,
+		HashLen:         hashLen,
+		DistanceBitCost: 57,
+	}
+}
+
+// dictMatchFinder is a match finder whose history starts with the
+// dictionary: the matches in the dictionary have distances larger than the
+// current position in the stream, that decoders resolve in the attached
+// dictionary.
+type dictMatchFinder struct {
+	*matchfinder.M4
+	dict []byte
+}
+
+func (m *dictMatchFinder) Reset() {
+	m.M4.Reset()
+	m.M4.FindMatches(nil, m.dict)
+}
+
+type dictWriter struct {
+	*matchfinder.Writer
+	c      *dictCompressor
+	closed bool
+}
+
+func (w *dictWriter) Close() error {
+	if w.closed {
+		return nil // already closed (and recycled)
+	}
+	w.closed = true
+	err := w.Writer.Close()
+	// The writer is reset, indexing the dictionary again, when it is reused.
+	w.Dest = nil
+	w.c.pool.Put(w)
+	return err
+}
+
+// DictionaryEncoding returns the Content-Encoding for responses compressed
+// with the dictionary dict, for clients that know the dictionary in advance:
+// "b_" followed by the first 4 bytes of the SHA-256 hash of the dictionary,
+// in hexadecimal.
+func DictionaryEncoding(dict []byte) string {
+	h := sha256.Sum256(dict)
+	return fmt.Sprintf("b_%x", h[:4])
+}
@@ -1,3 +1,5 @@
 package brotli
 
 type Compressor = compressor
+
+type DictCompressor = dictCompressor
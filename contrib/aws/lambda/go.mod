@@ -0,0 +1,13 @@
+module github.com/CAFxX/httpcompression/contrib/aws/lambda
+
+go 1.26
+
+require github.com/CAFxX/httpcompression v0.0.8
+
+require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	github.com/aws/aws-lambda-go v1.55.1
+	github.com/klauspost/compress v1.17.9 // indirect
+)
+
+replace github.com/CAFxX/httpcompression => ../../..
@@ -0,0 +1,204 @@
+// Package lambda applies httpcompression to the responses of AWS Lambda
+// functions invoked via API Gateway (REST, proxy integration) or via an
+// Application Load Balancer.
+//
+// The response body is passed through the same negotiation and
+// CompressorProviders used by the net/http middleware; when it ends up
+// compressed, the body is base64-encoded and IsBase64Encoded is set, as
+// required by API Gateway and ALB for binary bodies.
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Compressor compresses Lambda proxy responses.
+type Compressor struct {
+	e *httpcompression.Engine
+}
+
+// New returns a Compressor configured like httpcompression.Adapter.
+func New(opts ...httpcompression.Option) (*Compressor, error) {
+	e, err := httpcompression.NewEngine(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Compressor{e: e}, nil
+}
+
+// NewDefault returns a Compressor configured like httpcompression.DefaultAdapter.
+func NewDefault(opts ...httpcompression.Option) (*Compressor, error) {
+	e, err := httpcompression.NewDefaultEngine(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Compressor{e: e}, nil
+}
+
+// APIGatewayProxyResponse compresses resp, if supported by the client that sent req.
+func (c *Compressor) APIGatewayProxyResponse(req events.APIGatewayProxyRequest, resp events.APIGatewayProxyResponse) (events.APIGatewayProxyResponse, error) {
+	out, err := c.compress(req.HTTPMethod, req.Path, req.Headers, req.MultiValueHeaders, response{
+		status:          resp.StatusCode,
+		headers:         resp.Headers,
+		multiHeaders:    resp.MultiValueHeaders,
+		body:            resp.Body,
+		isBase64Encoded: resp.IsBase64Encoded,
+	})
+	if err != nil {
+		return resp, err
+	}
+	resp.StatusCode = out.status
+	resp.Headers, resp.MultiValueHeaders = out.headers, out.multiHeaders
+	resp.Body, resp.IsBase64Encoded = out.body, out.isBase64Encoded
+	return resp, nil
+}
+
+// ALBTargetGroupResponse compresses resp, if supported by the client that sent req.
+// If the target group does not have multi-value headers enabled (req has no
+// MultiValueHeaders), the headers of the response are all in Headers.
+func (c *Compressor) ALBTargetGroupResponse(req events.ALBTargetGroupRequest, resp events.ALBTargetGroupResponse) (events.ALBTargetGroupResponse, error) {
+	out, err := c.compress(req.HTTPMethod, req.Path, req.Headers, req.MultiValueHeaders, response{
+		status:          resp.StatusCode,
+		headers:         resp.Headers,
+		multiHeaders:    resp.MultiValueHeaders,
+		body:            resp.Body,
+		isBase64Encoded: resp.IsBase64Encoded,
+		singleValue:     req.MultiValueHeaders == nil,
+	})
+	if err != nil {
+		return resp, err
+	}
+	resp.StatusCode = out.status
+	resp.Headers, resp.MultiValueHeaders = out.headers, out.multiHeaders
+	resp.Body, resp.IsBase64Encoded = out.body, out.isBase64Encoded
+	return resp, nil
+}
+
+// APIGatewayProxyHandler wraps a Lambda handler so that its responses are compressed.
+func (c *Compressor) APIGatewayProxyHandler(h func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)) func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return func(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		resp, err := h(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		return c.APIGatewayProxyResponse(req, resp)
+	}
+}
+
+// ALBTargetGroupHandler wraps a Lambda handler so that its responses are compressed.
+func (c *Compressor) ALBTargetGroupHandler(h func(context.Context, events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error)) func(context.Context, events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+	return func(ctx context.Context, req events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+		resp, err := h(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		return c.ALBTargetGroupResponse(req, resp)
+	}
+}
+
+const setCookie = "Set-Cookie"
+
+type response struct {
+	status          int
+	headers         map[string]string
+	multiHeaders    map[string][]string
+	body            string
+	isBase64Encoded bool
+	singleValue     bool // only single-value headers are accepted (an ALB target group without multi-value headers)
+}
+
+func (c *Compressor) compress(method, path string, reqHeaders map[string]string, reqMultiHeaders map[string][]string, resp response) (response, error) {
+	req, err := http.NewRequest(method, path, nil)
+	if err != nil {
+		return resp, err
+	}
+	for k, v := range reqHeaders {
+		req.Header.Set(k, v)
+	}
+	for k, vv := range reqMultiHeaders {
+		req.Header.Del(k)
+		for _, v := range vv {
+			req.Header.Add(k, v)
+		}
+	}
+
+	body := []byte(resp.body)
+	if resp.isBase64Encoded {
+		body, err = base64.StdEncoding.DecodeString(resp.body)
+		if err != nil {
+			return resp, err
+		}
+	}
+
+	var (
+		status int
+		header http.Header
+		buf    bytes.Buffer
+	)
+	w := c.e.Start(req, httpcompression.Output{
+		WriteHeader: func(s int, h http.Header) { status, header = s, h },
+		Body:        &buf,
+	})
+	for k, v := range resp.headers {
+		w.Header().Set(k, v)
+	}
+	for k, vv := range resp.multiHeaders {
+		w.Header().Del(k)
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	origEncoding := w.Header().Get("Content-Encoding")
+	if resp.status != 0 {
+		w.WriteHeader(resp.status)
+	}
+	if _, err := w.Write(body); err != nil {
+		w.Close()
+		return resp, err
+	}
+	if err := w.Close(); err != nil {
+		return resp, err
+	}
+
+	out := response{status: status}
+	// Preserve the header representation used by the handler: a target group
+	// with multi-value headers enabled only accepts multiValueHeaders.
+	if resp.multiHeaders != nil && !resp.singleValue {
+		out.multiHeaders = map[string][]string(header)
+	} else {
+		// The values of the headers that can be combined (e.g. the Vary set
+		// by the handler and the one added by the middleware) are joined;
+		// the cookies can not be, so they are sent as multi-value headers,
+		// that API Gateway merges with the single-value ones. A target group
+		// without multi-value headers only accepts headers, so only the last
+		// cookie is sent, as the target group does with repeated headers.
+		out.headers = make(map[string]string, len(header))
+		for k, vv := range header {
+			switch {
+			case len(vv) > 1 && k == setCookie && resp.singleValue:
+				out.headers[k] = vv[len(vv)-1]
+			case len(vv) > 1 && k == setCookie:
+				if out.multiHeaders == nil {
+					out.multiHeaders = map[string][]string{}
+				}
+				out.multiHeaders[k] = vv
+			case len(vv) > 0:
+				out.headers[k] = strings.Join(vv, ", ")
+			}
+		}
+	}
+	if enc := header.Get("Content-Encoding"); enc != "" && enc != origEncoding {
+		out.body = base64.StdEncoding.EncodeToString(buf.Bytes())
+		out.isBase64Encoded = true
+	} else {
+		out.body, out.isBase64Encoded = resp.body, resp.isBase64Encoded
+	}
+	return out, nil
+}
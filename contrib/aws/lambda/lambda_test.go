@@ -0,0 +1,149 @@
+package lambda
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestAPIGatewayProxyResponse(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat("hello world! ", 100)
+
+	c, err := NewDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := events.APIGatewayProxyRequest{
+		HTTPMethod: "GET",
+		Path:       "/",
+		Headers:    map[string]string{"accept-encoding": "gzip"},
+	}
+	resp, err := c.APIGatewayProxyResponse(req, events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    map[string]string{"Content-Type": "text/plain"},
+		Body:       body,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Headers["Content-Encoding"] != "gzip" || !resp.IsBase64Encoded {
+		t.Fatalf("response not compressed: %+v", resp.Headers)
+	}
+	b, err := base64.StdEncoding.DecodeString(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != body {
+		t.Fatalf("decoded body mismatch")
+	}
+
+	req.Headers = nil
+	resp, err = c.APIGatewayProxyResponse(req, events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       body,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Headers["Content-Encoding"] != "" || resp.IsBase64Encoded || resp.Body != body {
+		t.Fatalf("response unexpectedly compressed: %+v", resp.Headers)
+	}
+}
+
+func TestALBTargetGroupResponseMultiValue(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.ALBTargetGroupResponse(events.ALBTargetGroupRequest{
+		HTTPMethod:        "GET",
+		Path:              "/",
+		MultiValueHeaders: map[string][]string{"accept-encoding": {"br"}},
+	}, events.ALBTargetGroupResponse{
+		StatusCode:        404,
+		MultiValueHeaders: map[string][]string{"Content-Type": {"text/plain"}},
+		Body:              strings.Repeat("not found ", 100),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 404 || resp.Headers != nil || resp.MultiValueHeaders["Content-Encoding"][0] != "br" || !resp.IsBase64Encoded {
+		t.Fatalf("unexpected response: %d %+v", resp.StatusCode, resp.MultiValueHeaders)
+	}
+}
+
+func TestALBTargetGroupResponseSingleValueCookies(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.ALBTargetGroupResponse(events.ALBTargetGroupRequest{
+		HTTPMethod: "GET",
+		Path:       "/",
+		Headers:    map[string]string{"accept-encoding": "gzip"},
+	}, events.ALBTargetGroupResponse{
+		StatusCode:        200,
+		Headers:           map[string]string{"Content-Type": "text/plain"},
+		MultiValueHeaders: map[string][]string{"Set-Cookie": {"a=1", "b=2"}},
+		Body:              strings.Repeat("hello world! ", 100),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.MultiValueHeaders != nil {
+		t.Fatalf("unexpected multi-value headers: %+v", resp.MultiValueHeaders)
+	}
+	if resp.Headers["Content-Encoding"] != "gzip" || resp.Headers["Content-Type"] != "text/plain" {
+		t.Fatalf("response not compressed: %+v", resp.Headers)
+	}
+	if cookie := resp.Headers["Set-Cookie"]; cookie != "b=2" {
+		t.Fatalf("unexpected Set-Cookie: %q", cookie)
+	}
+}
+
+func TestAPIGatewayProxyResponseVary(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.APIGatewayProxyResponse(events.APIGatewayProxyRequest{
+		HTTPMethod: "GET",
+		Path:       "/",
+		Headers:    map[string]string{"accept-encoding": "gzip"},
+	}, events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    map[string]string{"Content-Type": "text/plain", "Vary": "Origin"},
+		Body:       strings.Repeat("hello world! ", 100),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Headers["Content-Encoding"] != "gzip" {
+		t.Fatalf("response not compressed: %+v", resp.Headers)
+	}
+	if vary := resp.Headers["Vary"]; vary != "Origin, Accept-Encoding" {
+		t.Fatalf("unexpected Vary: %q", vary)
+	}
+}
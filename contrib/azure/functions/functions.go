@@ -0,0 +1,52 @@
+// Package functions provides a middleware that compresses the responses of
+// Azure Functions custom handlers using httpcompression.
+//
+// Custom handlers are plain HTTP servers, started by the Functions host,
+// listening on the port specified by the FUNCTIONS_CUSTOMHANDLER_PORT
+// environment variable. The responses can be compressed only for the
+// functions whose requests are forwarded as-is to the custom handler, i.e.
+// with "enableForwardingHttpRequest": true in the "customHandler" section
+// of host.json: otherwise the host passes the requests and the responses
+// in JSON payloads, whose bodies are text, and compresses (or not) the
+// responses itself.
+package functions
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/CAFxX/httpcompression"
+)
+
+// PortEnv is the environment variable holding the port on which the custom
+// handler must listen.
+const PortEnv = "FUNCTIONS_CUSTOMHANDLER_PORT"
+
+// DefaultPort is the port used if PortEnv is not set (e.g. when the custom
+// handler is run outside of the Functions host).
+const DefaultPort = "8080"
+
+// Adapter returns a middleware to be used to wrap the handler of the custom
+// handler. By default it is configured like httpcompression.DefaultAdapter.
+func Adapter(opts ...httpcompression.Option) (func(http.Handler) http.Handler, error) {
+	return httpcompression.DefaultAdapter(opts...)
+}
+
+// Addr returns the address on which the custom handler must listen.
+func Addr() string {
+	port := os.Getenv(PortEnv)
+	if port == "" {
+		port = DefaultPort
+	}
+	return ":" + port
+}
+
+// ListenAndServe serves h, wrapped by the middleware configured with opts
+// (see Adapter), on Addr. It returns only if serving fails.
+func ListenAndServe(h http.Handler, opts ...httpcompression.Option) error {
+	mw, err := Adapter(opts...)
+	if err != nil {
+		return err
+	}
+	return http.ListenAndServe(Addr(), mw(h))
+}
@@ -0,0 +1,41 @@
+package functions_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CAFxX/httpcompression/contrib/azure/functions"
+)
+
+func TestAddr(t *testing.T) {
+	t.Setenv(functions.PortEnv, "")
+	if addr := functions.Addr(); addr != ":"+functions.DefaultPort {
+		t.Errorf("unexpected address: %q", addr)
+	}
+	t.Setenv(functions.PortEnv, "34567")
+	if addr := functions.Addr(); addr != ":34567" {
+		t.Errorf("unexpected address: %q", addr)
+	}
+}
+
+func TestAdapter(t *testing.T) {
+	t.Parallel()
+
+	mw, err := functions.Adapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(strings.Repeat(`{"hello":"world"}`, 50)))
+	}))
+	req := httptest.NewRequest("GET", "/api/hello", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if ce := rec.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Errorf("unexpected Content-Encoding: %q", ce)
+	}
+}
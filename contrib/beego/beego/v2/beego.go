@@ -0,0 +1,47 @@
+// Package beego provides a Beego filter chain that compresses responses using
+// httpcompression.
+//
+// Register it with web.InsertFilterChain (or HttpServer.InsertFilterChain).
+// Beego's own gzip support (EnableGzip) should be disabled when using it.
+package beego
+
+import (
+	"net/http"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/beego/beego/v2/server/web"
+	"github.com/beego/beego/v2/server/web/context"
+)
+
+func Adapter(opts ...httpcompression.Option) (web.FilterChain, error) {
+	mw, err := httpcompression.Adapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(mw), nil
+}
+
+func DefaultAdapter(opts ...httpcompression.Option) (web.FilterChain, error) {
+	mw, err := httpcompression.DefaultAdapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(mw), nil
+}
+
+// wrap installs the compressing writer below Beego's context.Response, so that
+// Beego keeps tracking the response status as usual, and so that
+// context.Response.Flush flushes the compressor before the connection.
+func wrap(mw func(http.Handler) http.Handler) web.FilterChain {
+	return func(next web.FilterFunc) web.FilterFunc {
+		return func(ctx *context.Context) {
+			orig := ctx.ResponseWriter.ResponseWriter
+			mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctx.ResponseWriter.ResponseWriter = w
+				defer func() { ctx.ResponseWriter.ResponseWriter = orig }()
+				ctx.Request = r
+				next(ctx)
+			})).ServeHTTP(orig, ctx.Request)
+		}
+	}
+}
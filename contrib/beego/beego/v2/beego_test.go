@@ -0,0 +1,47 @@
+package beego
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/beego/beego/v2/server/web"
+	"github.com/beego/beego/v2/server/web/context"
+)
+
+func TestAdapter(t *testing.T) {
+	body := strings.Repeat("hello world! ", 100)
+
+	mw, err := DefaultAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := web.NewHttpSever()
+	app.InsertFilterChain("/*", mw)
+	app.Get("/", func(ctx *context.Context) {
+		ctx.Output.Header("Content-Type", "text/plain")
+		ctx.WriteString(body)
+	})
+	app.Handlers.Init()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	app.Handlers.ServeHTTP(rec, req)
+	if ce := rec.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("unexpected Content-Encoding: %q", ce)
+	}
+	r, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != body {
+		t.Fatalf("decoded body mismatch")
+	}
+}
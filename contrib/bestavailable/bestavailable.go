@@ -0,0 +1,35 @@
+// Package bestavailable provides options configuring the best compressor
+// implementations available in the build: the implementations are selected
+// by build tags, so the same code can be built everywhere without
+// build-specific wiring.
+package bestavailable
+
+import (
+	"github.com/CAFxX/httpcompression"
+)
+
+// DefaultZstdLevel is the zstd compression level used by Zstd if level is 0.
+const DefaultZstdLevel = 3
+
+// Zstd returns an option setting the zstd compressor, with the given
+// compression level (from 1 to 22, as in the reference zstd implementation,
+// or 0 for DefaultZstdLevel): cgo builds use the C implementation
+// (contrib/valyala/gozstd), the other builds the Go implementation
+// (contrib/klauspost/zstd). ZstdImplementation reports which one is used.
+// The window of the compressor does not exceed the 8MB recommended by RFC
+// 8878 (see httpcompression.ZstandardMaxWindow).
+func Zstd(level int) httpcompression.Option {
+	if level == 0 {
+		level = DefaultZstdLevel
+	}
+	if level < 1 || level > 22 {
+		// Fails, reporting the invalid level.
+		return httpcompression.ZstandardCompressionLevel(level)
+	}
+	c, err := newZstd(level)
+	if err != nil {
+		// Falls back to the Go implementation.
+		return httpcompression.ZstandardCompressionLevel(level)
+	}
+	return httpcompression.ZstandardCompressor(c)
+}
@@ -0,0 +1,51 @@
+package bestavailable_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/bestavailable"
+	kpzstd "github.com/klauspost/compress/zstd"
+)
+
+func TestZstd(t *testing.T) {
+	t.Parallel()
+
+	if _, err := httpcompression.Adapter(bestavailable.Zstd(23)); err == nil {
+		t.Fatal("no error for an invalid level")
+	}
+
+	body := strings.Repeat("hello world! ", 1000)
+	for _, level := range []int{0, 1, 19, 22} {
+		a, err := httpcompression.Adapter(bestavailable.Zstd(level))
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, body)
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "zstd")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if enc := res.Header().Get("Content-Encoding"); enc != "zstd" {
+			t.Fatalf("level %d (%s): unexpected Content-Encoding %q", level, bestavailable.ZstdImplementation, enc)
+		}
+		r, err := kpzstd.NewReader(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(d) != body {
+			t.Fatalf("level %d: decoded body mismatch", level)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build cgo
+// +build cgo
+
+package bestavailable
+
+import (
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/valyala/gozstd"
+	vzstd "github.com/valyala/gozstd"
+)
+
+// ZstdImplementation is the zstd implementation used by Zstd.
+const ZstdImplementation = "github.com/valyala/gozstd"
+
+func newZstd(level int) (httpcompression.CompressorProvider, error) {
+	p := vzstd.WriterParams{CompressionLevel: level}
+	if level > 19 {
+		// The ultra levels use windows larger than 8MB.
+		p.WindowLog = 23
+	}
+	return gozstd.New(p)
+}
@@ -0,0 +1,17 @@
+//go:build !cgo
+// +build !cgo
+
+package bestavailable
+
+import (
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	kpzstd "github.com/klauspost/compress/zstd"
+)
+
+// ZstdImplementation is the zstd implementation used by Zstd.
+const ZstdImplementation = "github.com/klauspost/compress/zstd"
+
+func newZstd(level int) (httpcompression.CompressorProvider, error) {
+	return zstd.New(kpzstd.WithEncoderLevel(kpzstd.EncoderLevelFromZstd(level)))
+}
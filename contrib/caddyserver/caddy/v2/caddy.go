@@ -0,0 +1,207 @@
+// Package caddy provides a Caddy HTTP handler module ("http.handlers.httpcompression")
+// that compresses responses using httpcompression, as an alternative to Caddy's
+// built-in encode handler.
+//
+// Caddyfile syntax:
+//
+//	httpcompression [<matcher>] {
+//	    zstd    [<level>]
+//	    br      [<level>]
+//	    gzip    [<level>]
+//	    deflate [<level>]
+//	    minimum_length <length>
+//	    content_types <types...>
+//	    exclude_content_types <types...>
+//	    prefer server|client
+//	}
+//
+// If no encoding is listed, the defaults of httpcompression.DefaultAdapter are used.
+// The directive is ordered before the standard encode directive.
+package caddy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	kpzstd "github.com/klauspost/compress/zstd"
+)
+
+func init() {
+	caddy.RegisterModule(Handler{})
+	httpcaddyfile.RegisterHandlerDirective("httpcompression", parseCaddyfile)
+	httpcaddyfile.RegisterDirectiveOrder("httpcompression", httpcaddyfile.Before, "encode")
+}
+
+// Handler is a Caddy middleware that compresses responses using httpcompression.
+type Handler struct {
+	// Levels contains the compression level to use for each of the enabled
+	// encodings ("zstd", "br", "gzip", "deflate"). Encodings not listed are
+	// disabled. If empty, the defaults of httpcompression.DefaultAdapter are used.
+	Levels map[string]int `json:"levels,omitempty"`
+
+	// MinLength is the minimum size of the responses to be compressed.
+	// If nil, httpcompression.DefaultMinSize is used.
+	MinLength *int `json:"minimum_length,omitempty"`
+
+	// ContentTypes is the list of content types to be compressed. If empty,
+	// responses are compressed regardless of their content type.
+	ContentTypes []string `json:"content_types,omitempty"`
+
+	// ExcludeContentTypes, if true, makes ContentTypes the list of content
+	// types that should not be compressed.
+	ExcludeContentTypes bool `json:"exclude_content_types,omitempty"`
+
+	// Prefer is either "server" (the default) or "client".
+	// See httpcompression.PreferType.
+	Prefer string `json:"prefer,omitempty"`
+
+	mw func(http.Handler) http.Handler
+}
+
+// CaddyModule returns the Caddy module information.
+func (Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.httpcompression",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+// Options returns the httpcompression options corresponding to the configuration.
+func (h *Handler) Options() ([]httpcompression.Option, error) {
+	var opts []httpcompression.Option
+	for enc, level := range h.Levels {
+		switch enc {
+		case "zstd":
+			c, err := zstd.New(kpzstd.WithEncoderLevel(kpzstd.EncoderLevelFromZstd(level)))
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, httpcompression.ZstandardCompressor(c))
+		case "br":
+			opts = append(opts, httpcompression.BrotliCompressionLevel(level))
+		case "gzip":
+			opts = append(opts, httpcompression.GzipCompressionLevel(level))
+		case "deflate":
+			opts = append(opts, httpcompression.DeflateCompressionLevel(level))
+		default:
+			return nil, fmt.Errorf("unknown encoding: %q", enc)
+		}
+	}
+	minSize := httpcompression.DefaultMinSize
+	if h.MinLength != nil {
+		minSize = *h.MinLength
+	}
+	opts = append(opts, httpcompression.MinSize(minSize))
+	if len(h.ContentTypes) > 0 {
+		opts = append(opts, httpcompression.ContentTypes(h.ContentTypes, h.ExcludeContentTypes))
+	}
+	switch h.Prefer {
+	case "", "server":
+		opts = append(opts, httpcompression.Prefer(httpcompression.PreferServer))
+	case "client":
+		opts = append(opts, httpcompression.Prefer(httpcompression.PreferClient))
+	default:
+		return nil, fmt.Errorf("unknown prefer value: %q", h.Prefer)
+	}
+	return opts, nil
+}
+
+// Provision sets up the handler.
+func (h *Handler) Provision(_ caddy.Context) error {
+	opts, err := h.Options()
+	if err != nil {
+		return err
+	}
+	if len(h.Levels) == 0 {
+		h.mw, err = httpcompression.DefaultAdapter(opts...)
+	} else {
+		h.mw, err = httpcompression.Adapter(opts...)
+	}
+	return err
+}
+
+// ServeHTTP implements caddyhttp.MiddlewareHandler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	var err error
+	h.mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err = next.ServeHTTP(w, r)
+	})).ServeHTTP(w, r)
+	return err
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens.
+// See the package documentation for the syntax.
+func (h *Handler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // consume directive name
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+	for d.NextBlock(0) {
+		switch v := d.Val(); v {
+		case "zstd", "br", "gzip", "deflate":
+			level := defaultLevels[v]
+			if d.NextArg() {
+				l, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.Errf("parsing %s level: %v", v, err)
+				}
+				level = l
+			}
+			if h.Levels == nil {
+				h.Levels = map[string]int{}
+			}
+			h.Levels[v] = level
+		case "minimum_length":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			n, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return d.Errf("parsing minimum_length: %v", err)
+			}
+			h.MinLength = &n
+		case "content_types", "exclude_content_types":
+			h.ContentTypes = d.RemainingArgs()
+			if len(h.ContentTypes) == 0 {
+				return d.ArgErr()
+			}
+			h.ExcludeContentTypes = v == "exclude_content_types"
+		case "prefer":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			h.Prefer = d.Val()
+		default:
+			return d.Errf("unrecognized subdirective: %s", v)
+		}
+	}
+	return nil
+}
+
+// defaultLevels are the levels used when an encoding is listed without an
+// explicit level in the Caddyfile.
+var defaultLevels = map[string]int{
+	"zstd":    3,
+	"br":      3,
+	"gzip":    6,
+	"deflate": 6,
+}
+
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	m := new(Handler)
+	err := m.UnmarshalCaddyfile(h.Dispenser)
+	return m, err
+}
+
+var (
+	_ caddy.Provisioner           = (*Handler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Handler)(nil)
+	_ caddyfile.Unmarshaler       = (*Handler)(nil)
+)
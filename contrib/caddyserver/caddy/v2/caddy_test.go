@@ -0,0 +1,54 @@
+package caddy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestCaddyfile(t *testing.T) {
+	t.Parallel()
+
+	d := caddyfile.NewTestDispenser(`
+	httpcompression {
+		br 5
+		gzip
+		minimum_length 10
+		content_types text/plain
+		prefer client
+	}`)
+	h := &Handler{}
+	if err := h.UnmarshalCaddyfile(d); err != nil {
+		t.Fatal(err)
+	}
+	if h.Levels["br"] != 5 || h.Levels["gzip"] != 6 || len(h.Levels) != 2 {
+		t.Fatalf("unexpected levels: %v", h.Levels)
+	}
+	if h.MinLength == nil || *h.MinLength != 10 || h.Prefer != "client" || h.ContentTypes[0] != "text/plain" {
+		t.Fatalf("unexpected config: %+v", h)
+	}
+	if err := h.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Content-Type", "text/plain")
+		_, err := io.WriteString(w, strings.Repeat("hello world! ", 10))
+		return err
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0.5, br, zstd")
+	rec := httptest.NewRecorder()
+	if err := h.ServeHTTP(rec, req, next); err != nil {
+		t.Fatal(err)
+	}
+	if ce := rec.Header().Get("Content-Encoding"); ce != "br" {
+		t.Fatalf("unexpected Content-Encoding: %q", ce)
+	}
+}
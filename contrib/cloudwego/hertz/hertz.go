@@ -0,0 +1,124 @@
+// Package hertz provides a Hertz middleware that compresses responses using
+// httpcompression.
+//
+// Hertz does not use net/http: handlers write the response into a buffered
+// protocol.Response. The middleware therefore lets the rest of the chain
+// run, and then writes the buffered response through an
+// httpcompression.Engine, so that negotiation, MinSize, content-type
+// filtering and the configured CompressorProviders behave exactly like for
+// net/http.
+// Streaming response bodies (e.g. set via SetBodyStream) are not compressed.
+package hertz
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+)
+
+func Adapter(opts ...httpcompression.Option) (app.HandlerFunc, error) {
+	e, err := httpcompression.NewEngine(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(e), nil
+}
+
+func DefaultAdapter(opts ...httpcompression.Option) (app.HandlerFunc, error) {
+	e, err := httpcompression.NewDefaultEngine(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(e), nil
+}
+
+func wrap(e *httpcompression.Engine) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		c.Next(ctx)
+
+		if c.Response.IsBodyStream() {
+			return
+		}
+
+		req, err := http.NewRequestWithContext(ctx, string(c.Request.Method()), c.Request.URI().String(), nil)
+		if err != nil {
+			return
+		}
+		c.Request.Header.VisitAll(func(k, v []byte) {
+			req.Header.Add(string(k), string(v))
+		})
+		req.Proto = c.Request.Header.GetProtocol()
+		req.ProtoMajor, req.ProtoMinor, _ = http.ParseHTTPVersion(req.Proto)
+		req.RemoteAddr = c.RemoteAddr().String()
+
+		status := c.Response.StatusCode()
+		body := append([]byte(nil), c.Response.Body()...)
+		c.Response.ResetBody()
+
+		snapshot := responseHeader(&c.Response)
+		w := e.Start(req, httpcompression.Output{
+			WriteHeader: func(status int, h http.Header) {
+				writeHeader(&c.Response, snapshot, h, status)
+			},
+			Body: c.Response.BodyWriter(),
+		})
+		for k, v := range snapshot {
+			w.Header()[k] = append([]string(nil), v...)
+		}
+		w.WriteHeader(status)
+		_, err = w.Write(body)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// responseHeader returns the headers of resp.
+func responseHeader(resp *protocol.Response) http.Header {
+	h := http.Header{}
+	resp.Header.VisitAll(func(k, v []byte) {
+		h.Add(string(k), string(v))
+	})
+	return h
+}
+
+// writeHeader writes to resp the status code and the headers h of the
+// response, replacing the ones it had when they were snapshot.
+func writeHeader(resp *protocol.Response, snapshot, h http.Header, code int) {
+	// Only apply the differences, so that headers that need special handling
+	// in Hertz (e.g. cookies) are left untouched.
+	for k := range snapshot {
+		if _, ok := h[k]; !ok {
+			resp.Header.Del(k)
+		}
+	}
+	for k, v := range h {
+		if strings.EqualFold(k, "Set-Cookie") || equal(v, snapshot[k]) {
+			continue
+		}
+		resp.Header.Del(k)
+		for _, vv := range v {
+			resp.Header.Add(k, vv)
+		}
+	}
+	resp.SetStatusCode(code)
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
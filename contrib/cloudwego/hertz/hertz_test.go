@@ -0,0 +1,65 @@
+package hertz
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func TestAdapter(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat("hello world! ", 100)
+
+	mw, err := DefaultAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := route.NewEngine(config.NewOptions(nil))
+	e.Use(mw)
+	e.GET("/", func(ctx context.Context, c *app.RequestContext) {
+		c.SetCookie("a", "b", 0, "/", "", 0, false, false)
+		c.Data(200, "text/plain", []byte(body))
+	})
+
+	res := ut.PerformRequest(e, "GET", "/", nil, ut.Header{Key: "Accept-Encoding", Value: "gzip"}).Result()
+	if ce := string(res.Header.Peek("Content-Encoding")); ce != "gzip" {
+		t.Fatalf("unexpected Content-Encoding: %q", ce)
+	}
+	if v := string(res.Header.Peek("Vary")); v != "Accept-Encoding" {
+		t.Fatalf("unexpected Vary: %q", v)
+	}
+	if ct := string(res.Header.ContentType()); ct != "text/plain" {
+		t.Fatalf("unexpected Content-Type: %q", ct)
+	}
+	if c := string(res.Header.Peek("Set-Cookie")); !strings.HasPrefix(c, "a=b") {
+		t.Fatalf("unexpected Set-Cookie: %q", c)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(res.Body()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != body {
+		t.Fatalf("decoded body mismatch")
+	}
+
+	res = ut.PerformRequest(e, "GET", "/", nil).Result()
+	if ce := string(res.Header.Peek("Content-Encoding")); ce != "" {
+		t.Fatalf("unexpected Content-Encoding: %q", ce)
+	}
+	if string(res.Body()) != body {
+		t.Fatalf("body mismatch")
+	}
+}
@@ -0,0 +1,3 @@
+package flate
+
+type Compressor = compressor
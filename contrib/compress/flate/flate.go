@@ -0,0 +1,73 @@
+// Package flate provides a CompressorProvider for raw DEFLATE streams (RFC
+// 1951), without the zlib or gzip framing. It is not meant to compress HTTP
+// responses, but the protocols using raw DEFLATE, like the permessage-deflate
+// WebSocket extension (see the websocket package).
+package flate
+
+import (
+	"compress/flate"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/CAFxX/httpcompression/contrib/internal/utils"
+)
+
+const DefaultCompression = flate.DefaultCompression
+
+type Options struct {
+	Level      int
+	Dictionary []byte
+}
+
+type compressor struct {
+	pool sync.Pool
+	opt  Options
+}
+
+func New(opt Options) (*compressor, error) {
+	tw, err := flate.NewWriterDict(io.Discard, opt.Level, opt.Dictionary)
+	if err != nil {
+		return nil, err
+	}
+	err = utils.CheckWriter(tw)
+	if err != nil {
+		return nil, fmt.Errorf("flate: writer initialization: %w", err)
+	}
+
+	c := &compressor{opt: opt}
+	return c, nil
+}
+
+func (c *compressor) Get(w io.Writer) io.WriteCloser {
+	if fw, ok := c.pool.Get().(*flateWriter); ok {
+		fw.Reset(w)
+		fw.closed = false
+		return fw
+	}
+	fw, err := flate.NewWriterDict(w, c.opt.Level, c.opt.Dictionary)
+	if err != nil {
+		return utils.ErrorWriteCloser{Err: err}
+	}
+	return &flateWriter{
+		Writer: fw,
+		c:      c,
+	}
+}
+
+type flateWriter struct {
+	*flate.Writer
+	c      *compressor
+	closed bool
+}
+
+func (w *flateWriter) Close() error {
+	if w.closed {
+		return nil // already closed (and recycled)
+	}
+	w.closed = true
+	err := w.Writer.Close()
+	w.Reset(nil)
+	w.c.pool.Put(w)
+	return err
+}
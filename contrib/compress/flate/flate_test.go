@@ -0,0 +1,53 @@
+package flate_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	stdflate "compress/flate"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/compress/flate"
+	"github.com/CAFxX/httpcompression/providertest"
+)
+
+var _ httpcompression.CompressorProvider = &flate.Compressor{}
+
+func TestFlate(t *testing.T) {
+	t.Parallel()
+
+	s := []byte("hello world!")
+
+	c, err := flate.New(flate.Options{Dictionary: s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &bytes.Buffer{}
+	w := c.Get(b)
+	w.Write(s)
+	w.Close()
+
+	d, err := ioutil.ReadAll(stdflate.NewReaderDict(b, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s, d) {
+		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
+	}
+}
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	providertest.RunWithDecoder(t, func() (httpcompression.CompressorProvider, error) {
+		c, err := flate.New(flate.Options{Level: flate.DefaultCompression})
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}, func(r io.Reader) (io.ReadCloser, error) {
+		return stdflate.NewReader(r), nil
+	})
+}
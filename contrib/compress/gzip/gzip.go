@@ -1,6 +1,7 @@
 package gzip
 
 import (
+	"compress/flate"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -16,6 +17,12 @@ const (
 
 type Options struct {
 	Level int
+	// Rsyncable resets the compressor at content-defined boundaries, like
+	// gzip --rsyncable, so that the unchanged parts of different versions
+	// of a response are compressed to the same bytes, that can be
+	// deduplicated by delta-transfer systems and CDNs. It slightly reduces
+	// the compression ratio.
+	Rsyncable bool
 }
 
 type compressor struct {
@@ -40,25 +47,63 @@ func New(opt Options) (*compressor, error) {
 func (c *compressor) Get(w io.Writer) io.WriteCloser {
 	if gw, ok := c.pool.Get().(*gzipWriter); ok {
 		gw.Reset(w)
+		gw.closed = false
 		return gw
 	}
-	gw, err := gzip.NewWriterLevel(w, c.opt.Level)
+	gw, err := c.newWriter(w)
 	if err != nil {
 		return utils.ErrorWriteCloser{Err: err}
 	}
 	return &gzipWriter{
-		Writer: gw,
-		c:      c,
+		w: gw,
+		c: c,
 	}
 }
 
+func (c *compressor) newWriter(w io.Writer) (resetWriter, error) {
+	if !c.opt.Rsyncable {
+		return gzip.NewWriterLevel(w, c.opt.Level)
+	}
+	fw, err := flate.NewWriter(w, c.opt.Level)
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewRsyncableGzipWriter(w, fw, c.opt.Level), nil
+}
+
+// resetWriter is implemented by *gzip.Writer and *utils.RsyncableGzipWriter.
+type resetWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// gzipWriter does not embed the resetWriter, as the Yaegi interpreter
+// (see contrib/traefik) does not support the structs embedding interfaces.
 type gzipWriter struct {
-	*gzip.Writer
-	c *compressor
+	w      resetWriter
+	c      *compressor
+	closed bool
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+func (w *gzipWriter) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *gzipWriter) Reset(dst io.Writer) {
+	w.w.Reset(dst)
 }
 
 func (w *gzipWriter) Close() error {
-	err := w.Writer.Close()
+	if w.closed {
+		return nil // already closed (and recycled)
+	}
+	w.closed = true
+	err := w.w.Close()
 	w.Reset(nil)
 	w.c.pool.Put(w)
 	return err
@@ -3,10 +3,13 @@ package gzip_test
 import (
 	"bytes"
 	"io/ioutil"
+	"math/rand"
+	"strings"
 	"testing"
 
 	"github.com/CAFxX/httpcompression"
 	"github.com/CAFxX/httpcompression/contrib/compress/gzip"
+	"github.com/CAFxX/httpcompression/providertest"
 
 	kpgzip "github.com/klauspost/compress/gzip"
 )
@@ -39,3 +42,78 @@ func TestGzip(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	providertest.Run(t, "gzip", func() (httpcompression.CompressorProvider, error) {
+		c, err := gzip.New(gzip.Options{Level: gzip.DefaultCompression})
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+func TestConformanceRsyncable(t *testing.T) {
+	t.Parallel()
+
+	providertest.Run(t, "gzip", func() (httpcompression.CompressorProvider, error) {
+		c, err := gzip.New(gzip.Options{Level: gzip.DefaultCompression, Rsyncable: true})
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+func TestRsyncable(t *testing.T) {
+	t.Parallel()
+
+	rnd := rand.New(rand.NewSource(1))
+	words := strings.Fields("lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor")
+	var body []byte
+	for len(body) < 1<<20 {
+		body = append(body, words[rnd.Intn(len(words))]...)
+		body = append(body, ' ')
+	}
+	modified := append([]byte("a few more bytes at the beginning "), body...)
+
+	c, err := gzip.New(gzip.Options{Level: gzip.DefaultCompression, Rsyncable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compress := func(s []byte) []byte {
+		b := &bytes.Buffer{}
+		w := c.Get(b)
+		w.Write(s[:1000])
+		w.Write(s[1000:])
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := kpgzip.NewReader(bytes.NewReader(b.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(s, d) {
+			t.Fatal("decoded data mismatch")
+		}
+		return b.Bytes()
+	}
+
+	a, b := compress(body), compress(modified)
+	// Apart from the trailer (with the checksum of the whole data), the
+	// compressed data must be the same after the first boundary.
+	a, b = a[:len(a)-8], b[:len(b)-8]
+	common := 0
+	for common < len(a) && common < len(b) && a[len(a)-1-common] == b[len(b)-1-common] {
+		common++
+	}
+	if common < len(a)*9/10 {
+		t.Fatalf("common compressed suffix too short: %d of %d bytes", common, len(a))
+	}
+}
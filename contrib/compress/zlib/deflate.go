@@ -41,6 +41,7 @@ func New(opt Options) (*compressor, error) {
 func (c *compressor) Get(w io.Writer) io.WriteCloser {
 	if gw, ok := c.pool.Get().(*deflateWriter); ok {
 		gw.Reset(w)
+		gw.closed = false
 		return gw
 	}
 	gw, err := zlib.NewWriterLevelDict(w, c.opt.Level, c.opt.Dictionary)
@@ -55,10 +56,15 @@ func (c *compressor) Get(w io.Writer) io.WriteCloser {
 
 type deflateWriter struct {
 	*zlib.Writer
-	c *compressor
+	c      *compressor
+	closed bool
 }
 
 func (w *deflateWriter) Close() error {
+	if w.closed {
+		return nil // already closed (and recycled)
+	}
+	w.closed = true
 	err := w.Writer.Close()
 	w.Reset(nil)
 	w.c.pool.Put(w)
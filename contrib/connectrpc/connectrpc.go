@@ -0,0 +1,193 @@
+// Package connectrpc provides connect-go compression options built on the
+// httpcompression CompressorProviders, so that Connect handlers and clients
+// negotiate and use the same compressor implementations (and levels) as the
+// HTTP middleware.
+package connectrpc
+
+import (
+	"compress/gzip"
+	"io"
+
+	"connectrpc.com/connect"
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/andybalholm/brotli"
+	cgzip "github.com/CAFxX/httpcompression/contrib/compress/gzip"
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	ibrotli "github.com/andybalholm/brotli"
+	kpzstd "github.com/klauspost/compress/zstd"
+)
+
+// Compression describes a compression algorithm that can be registered
+// with Connect handlers and clients.
+type Compression struct {
+	name            string
+	provider        httpcompression.CompressorProvider
+	newDecompressor func() connect.Decompressor
+}
+
+// New returns a Compression with the specified name that uses provider to
+// compress messages and the Decompressors returned by newDecompressor to
+// decompress them.
+func New(name string, provider httpcompression.CompressorProvider, newDecompressor func() connect.Decompressor) Compression {
+	return Compression{
+		name:            name,
+		provider:        provider,
+		newDecompressor: newDecompressor,
+	}
+}
+
+// Gzip returns a Compression for the "gzip" encoding that uses the same
+// implementation used by httpcompression.GzipCompressionLevel.
+func Gzip(level int) (Compression, error) {
+	p, err := httpcompression.NewDefaultGzipCompressor(level)
+	if err != nil {
+		return Compression{}, err
+	}
+	return New(cgzip.Encoding, p, func() connect.Decompressor { return &gzipDecompressor{} }), nil
+}
+
+// Brotli returns a Compression for the "br" encoding that uses the same
+// implementation used by httpcompression.BrotliCompressionLevel.
+func Brotli(level int) (Compression, error) {
+	p, err := brotli.New(brotli.Options{Quality: level})
+	if err != nil {
+		return Compression{}, err
+	}
+	return New(brotli.Encoding, p, func() connect.Decompressor { return &brotliDecompressor{ibrotli.NewReader(nil)} }), nil
+}
+
+// Zstd returns a Compression for the "zstd" encoding that uses the same
+// implementation used by default by httpcompression.DefaultAdapter.
+func Zstd(opts ...kpzstd.EOption) (Compression, error) {
+	p, err := zstd.New(opts...)
+	if err != nil {
+		return Compression{}, err
+	}
+	return New(zstd.Encoding, p, func() connect.Decompressor { return &zstdDecompressor{} }), nil
+}
+
+// Name returns the name of the encoding.
+func (c Compression) Name() string {
+	return c.name
+}
+
+// HandlerOption returns a connect.HandlerOption that registers the compression
+// algorithm with a Connect handler.
+func (c Compression) HandlerOption() connect.HandlerOption {
+	return connect.WithCompression(c.name, c.newDecompressor, c.newCompressor)
+}
+
+// ClientOption returns a connect.ClientOption that registers the compression
+// algorithm with a Connect client. To also compress requests, additionally use
+// connect.WithSendCompression(c.Name()).
+func (c Compression) ClientOption() connect.ClientOption {
+	return connect.WithAcceptCompression(c.name, c.newDecompressor, c.newCompressor)
+}
+
+func (c Compression) newCompressor() connect.Compressor {
+	return &compressor{provider: c.provider}
+}
+
+// compressor adapts a CompressorProvider to connect.Compressor. Connect pools
+// and resets its compressors, so a new compressor is obtained from the provider
+// for every stream and handed back to the provider on Close.
+type compressor struct {
+	provider httpcompression.CompressorProvider
+	sink     io.Writer
+	w        io.WriteCloser
+}
+
+func (c *compressor) Write(p []byte) (int, error) {
+	if c.w == nil {
+		c.w = c.provider.Get(c.sink)
+	}
+	return c.w.Write(p)
+}
+
+func (c *compressor) Close() error {
+	if c.w == nil {
+		// Nothing was written, but we still have to emit a valid (empty) stream.
+		c.w = c.provider.Get(c.sink)
+	}
+	err := c.w.Close()
+	c.w = nil
+	return err
+}
+
+func (c *compressor) Reset(w io.Writer) {
+	if c.w != nil {
+		_ = c.w.Close()
+		c.w = nil
+	}
+	c.sink = w
+}
+
+type gzipDecompressor struct {
+	r *gzip.Reader
+}
+
+func (d *gzipDecompressor) Read(p []byte) (int, error) {
+	if d.r == nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return d.r.Read(p)
+}
+
+func (d *gzipDecompressor) Close() error {
+	if d.r == nil {
+		return nil
+	}
+	return d.r.Close()
+}
+
+func (d *gzipDecompressor) Reset(r io.Reader) error {
+	if d.r == nil {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		d.r = gr
+		return nil
+	}
+	return d.r.Reset(r)
+}
+
+type brotliDecompressor struct {
+	*ibrotli.Reader
+}
+
+func (d *brotliDecompressor) Close() error {
+	return nil
+}
+
+type zstdDecompressor struct {
+	d *kpzstd.Decoder
+}
+
+func (d *zstdDecompressor) Read(p []byte) (int, error) {
+	if d.d == nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return d.d.Read(p)
+}
+
+func (d *zstdDecompressor) Close() error {
+	// Do not call Decoder.Close, as that would make the decoder unusable:
+	// connect recycles Decompressors via Reset.
+	if d.d == nil {
+		return nil
+	}
+	return d.d.Reset(nil)
+}
+
+func (d *zstdDecompressor) Reset(r io.Reader) error {
+	if d.d == nil {
+		zd, err := kpzstd.NewReader(r, kpzstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+		d.d = zd
+		return nil
+	}
+	return d.d.Reset(r)
+}
@@ -0,0 +1,50 @@
+package connectrpc
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	s := []byte("hello world! hello world! hello world!")
+
+	gz, err := Gzip(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	br, err := Brotli(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zs, err := Zstd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []Compression{gz, br, zs} {
+		comp, decomp := c.newCompressor(), c.newDecompressor()
+		for i := 0; i < 3; i++ { // connect recycles compressors via Reset
+			b := &bytes.Buffer{}
+			comp.Reset(b)
+			comp.Write(s)
+			if err := comp.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := decomp.Reset(b); err != nil {
+				t.Fatal(err)
+			}
+			d, err := io.ReadAll(decomp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decomp.Close()
+			if !bytes.Equal(s, d) {
+				t.Fatalf("%s: decoded string mismatch\ngot: %q\nexp: %q", c.Name(), string(d), string(s))
+			}
+		}
+	}
+}
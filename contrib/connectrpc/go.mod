@@ -0,0 +1,14 @@
+module github.com/CAFxX/httpcompression/contrib/connectrpc
+
+go 1.25.0
+
+require (
+	connectrpc.com/connect v1.21.0
+	github.com/CAFxX/httpcompression v0.0.8
+	github.com/andybalholm/brotli v1.1.1
+	github.com/klauspost/compress v1.17.9
+)
+
+require google.golang.org/protobuf v1.36.11 // indirect
+
+replace github.com/CAFxX/httpcompression => ../..
@@ -0,0 +1,38 @@
+// Package kratos provides a Kratos HTTP server filter that compresses responses
+// using httpcompression.
+//
+// Kratos' default response and error encoders set the Content-Type before
+// writing the marshaled body in a single Write, so the compression decision
+// (MinSize, ContentTypes) is taken on the complete response body.
+package kratos
+
+import (
+	"github.com/CAFxX/httpcompression"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+func Adapter(opts ...httpcompression.Option) (http.FilterFunc, error) {
+	mw, err := httpcompression.Adapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return mw, nil
+}
+
+func DefaultAdapter(opts ...httpcompression.Option) (http.FilterFunc, error) {
+	mw, err := httpcompression.DefaultAdapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return mw, nil
+}
+
+// ServerOption is like DefaultAdapter, but it returns the filter wrapped in a
+// http.ServerOption that can be passed directly to http.NewServer.
+func ServerOption(opts ...httpcompression.Option) (http.ServerOption, error) {
+	f, err := DefaultAdapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return http.Filter(f), nil
+}
@@ -0,0 +1,45 @@
+package kratos
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+func TestServerOption(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat("hello world! ", 100)
+
+	opt, err := ServerOption()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := http.NewServer(opt)
+	srv.Route("/").GET("/", func(ctx http.Context) error {
+		return ctx.String(200, body)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if ce := rec.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("unexpected Content-Encoding: %q", ce)
+	}
+	r, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != body {
+		t.Fatalf("decoded body mismatch")
+	}
+}
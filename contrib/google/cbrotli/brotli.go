@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 package cbrotli
 
 import (
@@ -37,6 +40,16 @@ func (c *compressor) Get(w io.Writer) io.WriteCloser {
 	return cw
 }
 
+// EncodeAll appends to dst the brotli stream of src, compressed at once (see
+// httpcompression.Encoder).
+func (c *compressor) EncodeAll(src, dst []byte) ([]byte, error) {
+	b, err := cbrotli.Encode(src, c.opts)
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, b...), nil
+}
+
 type writer struct {
 	*cbrotli.Writer
 }
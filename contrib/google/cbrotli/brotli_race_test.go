@@ -1,5 +1,5 @@
-//go:build race
-// +build race
+//go:build race && cgo
+// +build race,cgo
 
 package cbrotli_test
 
@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 package cbrotli_test
 
 import (
@@ -10,6 +13,7 @@ import (
 
 	"github.com/CAFxX/httpcompression"
 	"github.com/CAFxX/httpcompression/contrib/google/cbrotli"
+	"github.com/CAFxX/httpcompression/providertest"
 	gcbrotli "github.com/google/brotli/go/cbrotli"
 )
 
@@ -78,3 +82,90 @@ func TestBrotliFinalize(t *testing.T) {
 		t.Fatalf("writer: %q, finalizer writer: %q", writer, fw)
 	}
 }
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	providertest.Run(t, "br", func() (httpcompression.CompressorProvider, error) {
+		c, err := cbrotli.New(gcbrotli.WriterOptions{Quality: 5})
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+func TestLargeWindow(t *testing.T) {
+	t.Parallel()
+
+	if _, err := cbrotli.NewLargeWindow(cbrotli.LargeWindowOptions{LGWin: cbrotli.MaxLargeWindowLGWin + 1}); err == nil {
+		t.Fatal("no error for an invalid LGWin")
+	}
+
+	s := bytes.Repeat([]byte("hello world! "), 1000)
+	c, err := cbrotli.NewLargeWindow(cbrotli.LargeWindowOptions{Quality: 5, LGWin: cbrotli.MaxLargeWindowLGWin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &bytes.Buffer{}
+	w := c.Get(b)
+	w.Write(s)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := gcbrotli.Decode(b.Bytes()); err == nil {
+		t.Fatal("large-window stream decoded by a standard decoder")
+	}
+	r, err := cbrotli.NewLargeWindowReader(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	d, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s, d) {
+		t.Fatal("decoded data mismatch")
+	}
+}
+
+func TestLargeWindowConformance(t *testing.T) {
+	t.Parallel()
+
+	providertest.RunWithDecoder(t, func() (httpcompression.CompressorProvider, error) {
+		c, err := cbrotli.NewLargeWindow(cbrotli.LargeWindowOptions{Quality: 5})
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}, cbrotli.NewLargeWindowReader)
+}
+
+func TestEncodeAll(t *testing.T) {
+	t.Parallel()
+
+	s := []byte("hello world!")
+
+	c, err := cbrotli.New(gcbrotli.WriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.EncodeAll(s, []byte("prefix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte("prefix")) {
+		t.Fatalf("dst not extended: %q", b)
+	}
+	d, err := gcbrotli.Decode(b[len("prefix"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s, d) {
+		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
+	}
+
+	var _ httpcompression.Encoder = &cbrotli.Compressor{}
+}
@@ -0,0 +1,297 @@
+package cbrotli
+
+/*
+#cgo LDFLAGS: -lbrotlicommon -lbrotlidec -lbrotlienc
+
+#include <stddef.h>
+#include <stdint.h>
+
+#include <brotli/decode.h>
+#include <brotli/encode.h>
+
+static BrotliEncoderState* NewLargeWindowEncoder(uint32_t quality, uint32_t lgwin) {
+  BrotliEncoderState* s = BrotliEncoderCreateInstance(0, 0, 0);
+  if (!s) {
+    return 0;
+  }
+  if (!BrotliEncoderSetParameter(s, BROTLI_PARAM_LARGE_WINDOW, 1) ||
+      !BrotliEncoderSetParameter(s, BROTLI_PARAM_QUALITY, quality) ||
+      !BrotliEncoderSetParameter(s, BROTLI_PARAM_LGWIN, lgwin)) {
+    BrotliEncoderDestroyInstance(s);
+    return 0;
+  }
+  return s;
+}
+
+static int LargeWindowCompressStream(BrotliEncoderState* s,
+    BrotliEncoderOperation op, const uint8_t* data, size_t data_size,
+    size_t* bytes_consumed, const uint8_t** output, size_t* output_size,
+    int* has_more) {
+  size_t available_in = data_size;
+  size_t available_out = 0;
+  int success = BrotliEncoderCompressStream(s, op,
+      &available_in, &data, &available_out, 0, 0) ? 1 : 0;
+  *bytes_consumed = data_size - available_in;
+  *output = 0;
+  *output_size = 0;
+  if (success) {
+    *output = BrotliEncoderTakeOutput(s, output_size);
+  }
+  *has_more = BrotliEncoderHasMoreOutput(s) ? 1 : 0;
+  return success;
+}
+
+static BrotliDecoderState* NewLargeWindowDecoder(void) {
+  BrotliDecoderState* s = BrotliDecoderCreateInstance(0, 0, 0);
+  if (!s) {
+    return 0;
+  }
+  if (!BrotliDecoderSetParameter(s, BROTLI_DECODER_PARAM_LARGE_WINDOW, 1)) {
+    BrotliDecoderDestroyInstance(s);
+    return 0;
+  }
+  return s;
+}
+
+static BrotliDecoderResult LargeWindowDecompressStream(BrotliDecoderState* s,
+    uint8_t* out, size_t out_len, const uint8_t* in, size_t in_len,
+    size_t* bytes_written, size_t* bytes_consumed) {
+  size_t in_remaining = in_len;
+  size_t out_remaining = out_len;
+  BrotliDecoderResult result = BrotliDecoderDecompressStream(
+      s, &in_remaining, &in, &out_remaining, &out, 0);
+  *bytes_written = out_len - out_remaining;
+  *bytes_consumed = in_len - in_remaining;
+  return result;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"unsafe"
+
+	"github.com/CAFxX/httpcompression/contrib/internal/utils"
+)
+
+const (
+	// LargeWindowEncoding is the content-coding used for the large-window
+	// brotli streams produced by NewLargeWindow. Large-window streams can
+	// not be decoded by standard brotli decoders, so they must not be
+	// served as "br": there is no registered content-coding for them, so
+	// clients have to explicitly signal their support with this token in
+	// Accept-Encoding.
+	LargeWindowEncoding = "br-large"
+
+	// MinLargeWindowLGWin and MaxLargeWindowLGWin are the limits of the
+	// LGWin of LargeWindowOptions.
+	MinLargeWindowLGWin = 10
+	MaxLargeWindowLGWin = 30
+
+	// DefaultLargeWindowLGWin is the LGWin used if LargeWindowOptions.LGWin
+	// is zero (a 64MB window).
+	DefaultLargeWindowLGWin = 26
+)
+
+var (
+	errLargeWindowInit   = errors.New("cbrotli: large-window initialization failed")
+	errLargeWindowEncode = errors.New("cbrotli: large-window encode error")
+	errLargeWindowClosed = errors.New("cbrotli: large-window Writer is closed")
+)
+
+// LargeWindowOptions configures the compressor returned by NewLargeWindow.
+type LargeWindowOptions struct {
+	// Quality controls the compression-speed vs compression-density
+	// trade-offs. Range is 0 to 11.
+	Quality int
+	// LGWin is the base 2 logarithm of the maximum size of the sliding
+	// window, from MinLargeWindowLGWin to MaxLargeWindowLGWin. It caps the
+	// memory needed by the clients to decode the responses. 0 means
+	// DefaultLargeWindowLGWin.
+	LGWin int
+}
+
+type largeWindowCompressor struct {
+	opts LargeWindowOptions
+}
+
+// NewLargeWindow returns a compressor producing brotli streams in the
+// large-window mode, that allows windows larger than the 16MB of standard
+// brotli, improving the compression ratio of very large responses. The
+// compressor must be registered for LargeWindowEncoding (e.g. with
+// httpcompression.Compressor), so that standard brotli clients keep
+// receiving standard "br" responses from the other brotli compressor, if
+// any.
+func NewLargeWindow(opts LargeWindowOptions) (c *largeWindowCompressor, err error) {
+	if opts.LGWin == 0 {
+		opts.LGWin = DefaultLargeWindowLGWin
+	}
+	if opts.LGWin < MinLargeWindowLGWin || opts.LGWin > MaxLargeWindowLGWin {
+		return nil, fmt.Errorf("cbrotli: invalid large-window LGWin: %d", opts.LGWin)
+	}
+	if opts.Quality < 0 || opts.Quality > 11 {
+		return nil, fmt.Errorf("cbrotli: invalid quality: %d", opts.Quality)
+	}
+	c = &largeWindowCompressor{opts: opts}
+	if err := utils.CheckWriter(c.Get(io.Discard)); err != nil {
+		return nil, fmt.Errorf("cbrotli: large-window writer initialization: %w", err)
+	}
+	return c, nil
+}
+
+func (c *largeWindowCompressor) Get(w io.Writer) io.WriteCloser {
+	state := C.NewLargeWindowEncoder(C.uint32_t(c.opts.Quality), C.uint32_t(c.opts.LGWin))
+	if state == nil {
+		return utils.ErrorWriteCloser{Err: errLargeWindowInit}
+	}
+	lw := &largeWindowWriter{dst: w, state: state}
+	runtime.SetFinalizer(lw, (*largeWindowWriter).free)
+	return lw
+}
+
+type largeWindowWriter struct {
+	dst   io.Writer
+	state *C.BrotliEncoderState
+}
+
+func (w *largeWindowWriter) writeChunk(p []byte, op C.BrotliEncoderOperation) (n int, err error) {
+	if w.state == nil {
+		return 0, errLargeWindowClosed
+	}
+	for {
+		var data *C.uint8_t
+		if len(p) != 0 {
+			data = (*C.uint8_t)(&p[0])
+		}
+		var consumed, size C.size_t
+		var output *C.uint8_t
+		var hasMore C.int
+		if C.LargeWindowCompressStream(w.state, op, data, C.size_t(len(p)), &consumed, &output, &size, &hasMore) == 0 {
+			return n, errLargeWindowEncode
+		}
+		p = p[int(consumed):]
+		n += int(consumed)
+		if size != 0 {
+			if _, err := w.dst.Write(unsafe.Slice((*byte)(output), int(size))); err != nil {
+				return n, err
+			}
+		}
+		if len(p) == 0 && hasMore == 0 {
+			return n, nil
+		}
+	}
+}
+
+func (w *largeWindowWriter) Write(p []byte) (int, error) {
+	return w.writeChunk(p, C.BROTLI_OPERATION_PROCESS)
+}
+
+func (w *largeWindowWriter) Flush() error {
+	_, err := w.writeChunk(nil, C.BROTLI_OPERATION_FLUSH)
+	return err
+}
+
+// Close completes the stream and frees the C resources.
+func (w *largeWindowWriter) Close() error {
+	if w.state == nil {
+		return nil // already closed
+	}
+	runtime.SetFinalizer(w, nil)
+	_, err := w.writeChunk(nil, C.BROTLI_OPERATION_FINISH)
+	w.free()
+	return err
+}
+
+// free frees the C resources of a writer that was not closed.
+func (w *largeWindowWriter) free() {
+	C.BrotliEncoderDestroyInstance(w.state)
+	w.state = nil
+}
+
+// NewLargeWindowReader returns a reader decompressing a brotli stream,
+// standard or in the large-window mode (see NewLargeWindow), read from r.
+// The reader must be closed to free the C resources.
+func NewLargeWindowReader(r io.Reader) (io.ReadCloser, error) {
+	state := C.NewLargeWindowDecoder()
+	if state == nil {
+		return nil, errLargeWindowInit
+	}
+	lr := &largeWindowReader{src: r, state: state, buf: make([]byte, 32<<10)}
+	runtime.SetFinalizer(lr, (*largeWindowReader).Close)
+	return lr, nil
+}
+
+type largeWindowReader struct {
+	src   io.Reader
+	state *C.BrotliDecoderState
+	buf   []byte
+	in    []byte // data read from src, not yet decoded
+	done  bool
+}
+
+func (r *largeWindowReader) Read(p []byte) (int, error) {
+	if r.state == nil {
+		return 0, errLargeWindowClosed
+	}
+	if r.done {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		var data *C.uint8_t
+		if len(r.in) != 0 {
+			data = (*C.uint8_t)(&r.in[0])
+		}
+		var written, consumed C.size_t
+		res := C.LargeWindowDecompressStream(r.state, (*C.uint8_t)(&p[0]), C.size_t(len(p)), data, C.size_t(len(r.in)), &written, &consumed)
+		r.in = r.in[int(consumed):]
+		n := int(written)
+		switch res {
+		case C.BROTLI_DECODER_RESULT_SUCCESS:
+			r.done = true
+			if len(r.in) > 0 {
+				return n, errors.New("cbrotli: excessive input")
+			}
+			if n == 0 {
+				return 0, io.EOF
+			}
+			return n, nil
+		case C.BROTLI_DECODER_RESULT_ERROR:
+			code := C.BrotliDecoderGetErrorCode(r.state)
+			return n, fmt.Errorf("cbrotli: %s", C.GoString(C.BrotliDecoderErrorString(code)))
+		case C.BROTLI_DECODER_RESULT_NEEDS_MORE_OUTPUT:
+			return n, nil
+		}
+		// BROTLI_DECODER_RESULT_NEEDS_MORE_INPUT
+		if n > 0 {
+			return n, nil
+		}
+		m, err := r.src.Read(r.buf)
+		if m == 0 {
+			if err == io.EOF {
+				return 0, io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		r.in = r.buf[:m]
+	}
+}
+
+// Close frees the C resources. It does not close the underlying reader.
+func (r *largeWindowReader) Close() error {
+	if r.state == nil {
+		return nil
+	}
+	runtime.SetFinalizer(r, nil)
+	C.BrotliDecoderDestroyInstance(r.state)
+	r.state = nil
+	return nil
+}
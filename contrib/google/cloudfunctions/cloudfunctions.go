@@ -0,0 +1,37 @@
+// Package cloudfunctions provides a middleware that compresses the
+// responses of Google Cloud Functions HTTP functions using httpcompression.
+//
+// HTTP functions registered with the Functions Framework (e.g. with
+// functions.HTTP) are plain net/http handler functions, so no dependency on
+// the Functions Framework itself is needed:
+//
+//	func init() {
+//		functions.HTTP("hello", cloudfunctions.MustHTTP(hello))
+//	}
+package cloudfunctions
+
+import (
+	"net/http"
+
+	"github.com/CAFxX/httpcompression"
+)
+
+// HTTP returns fn wrapped by the middleware configured with opts. By
+// default the middleware is configured like httpcompression.DefaultAdapter.
+func HTTP(fn http.HandlerFunc, opts ...httpcompression.Option) (http.HandlerFunc, error) {
+	mw, err := httpcompression.DefaultAdapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return mw(fn).ServeHTTP, nil
+}
+
+// MustHTTP is like HTTP, but it panics if the options are invalid, for
+// registering the functions in init.
+func MustHTTP(fn http.HandlerFunc, opts ...httpcompression.Option) http.HandlerFunc {
+	h, err := HTTP(fn, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
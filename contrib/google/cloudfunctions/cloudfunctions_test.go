@@ -0,0 +1,32 @@
+package cloudfunctions_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/google/cloudfunctions"
+)
+
+func TestHTTP(t *testing.T) {
+	t.Parallel()
+	skipMinimal(t)
+
+	fn := cloudfunctions.MustHTTP(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(strings.Repeat("hello world! ", 100)))
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	rec := httptest.NewRecorder()
+	fn(rec, req)
+	if ce := rec.Header().Get("Content-Encoding"); ce != "br" {
+		t.Errorf("unexpected Content-Encoding: %q", ce)
+	}
+
+	if _, err := cloudfunctions.HTTP(fn, httpcompression.MinSize(-1)); err == nil {
+		t.Error("invalid options accepted")
+	}
+}
@@ -0,0 +1,80 @@
+// Package grpcgateway provides a middleware that compresses the responses of
+// grpc-gateway reverse proxies using httpcompression.
+//
+// The grpc-gateway runtime.ServeMux is a plain net/http handler, so no
+// dependency on grpc-gateway itself is needed: the JSON (or HTTPBody)
+// responses it translates from the gRPC responses are compressed like any
+// other response. The gRPC and gRPC-Web requests that are often served by
+// the same server (e.g. by a handler routing them to a grpc.Server, or to a
+// gRPC-Web wrapper), instead, must not be transformed: their bodies are
+// sequences of length-prefixed frames, whose messages are compressed by gRPC
+// itself (see the grpc contrib), followed by the trailers that the gRPC-Web
+// clients parse from the body. The middleware passes them untouched to the
+// handler.
+package grpcgateway
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/CAFxX/httpcompression"
+)
+
+const (
+	ContentTypeGRPC        = "application/grpc"
+	ContentTypeGRPCWeb     = "application/grpc-web"
+	ContentTypeGRPCWebText = "application/grpc-web-text"
+)
+
+// grpcContentTypes are the gRPC and gRPC-Web Content-Types of the responses
+// that are not compressed, with the subtype suffixes used by the gRPC
+// implementations.
+var grpcContentTypes = []string{
+	ContentTypeGRPC, ContentTypeGRPC + "+proto", ContentTypeGRPC + "+json",
+	ContentTypeGRPCWeb, ContentTypeGRPCWeb + "+proto", ContentTypeGRPCWeb + "+json",
+	ContentTypeGRPCWebText, ContentTypeGRPCWebText + "+proto",
+}
+
+// Adapter returns a middleware to be used to wrap grpc-gateway handlers (or
+// the handlers serving both the grpc-gateway and the gRPC or gRPC-Web
+// requests). The responses to gRPC and gRPC-Web requests (see IsGRPC) are
+// never compressed, and neither are the responses with a gRPC or gRPC-Web
+// Content-Type, unless opts include httpcompression.ContentTypes.
+func Adapter(opts ...httpcompression.Option) (func(http.Handler) http.Handler, error) {
+	return adapter(httpcompression.Adapter, opts)
+}
+
+// DefaultAdapter is like Adapter, but it uses httpcompression.DefaultAdapter.
+func DefaultAdapter(opts ...httpcompression.Option) (func(http.Handler) http.Handler, error) {
+	return adapter(httpcompression.DefaultAdapter, opts)
+}
+
+func adapter(newAdapter func(...httpcompression.Option) (func(http.Handler) http.Handler, error), opts []httpcompression.Option) (func(http.Handler) http.Handler, error) {
+	opts = append([]httpcompression.Option{
+		httpcompression.ContentTypes(grpcContentTypes, true),
+	}, opts...)
+	mw, err := newAdapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return func(h http.Handler) http.Handler {
+		ch := mw(h)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if IsGRPC(r) {
+				h.ServeHTTP(w, r)
+			} else {
+				ch.ServeHTTP(w, r)
+			}
+		})
+	}, nil
+}
+
+// IsGRPC reports whether r is a gRPC or gRPC-Web request, i.e. whether its
+// Content-Type is application/grpc or application/grpc-web(-text), with any
+// subtype suffix (e.g. application/grpc-web+proto).
+func IsGRPC(r *http.Request) bool {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	base, _, _ := strings.Cut(mt, "+")
+	return base == ContentTypeGRPC || base == ContentTypeGRPCWeb || base == ContentTypeGRPCWebText
+}
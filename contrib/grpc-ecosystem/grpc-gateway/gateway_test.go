@@ -0,0 +1,69 @@
+package grpcgateway_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	grpcgateway "github.com/CAFxX/httpcompression/contrib/grpc-ecosystem/grpc-gateway"
+)
+
+func TestAdapter(t *testing.T) {
+	t.Parallel()
+
+	mw, err := grpcgateway.DefaultAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ct := r.Header.Get("Content-Type")
+		if ct == "" {
+			ct = "application/json"
+		}
+		w.Header().Set("Content-Type", ct)
+		w.Write([]byte(strings.Repeat("a", 500)))
+	}))
+
+	cases := []struct {
+		contentType string
+		expected    string
+	}{
+		{"", "gzip"},
+		{"application/json", "gzip"},
+		{"application/grpc", ""},
+		{"application/grpc+proto", ""},
+		{"application/grpc-web", ""},
+		{"application/grpc-web+json", ""},
+		{"application/grpc-web-text; charset=utf-8", ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("POST", "/v1/pkg.Service/Method", nil)
+		if c.contentType != "" {
+			req.Header.Set("Content-Type", c.contentType)
+		}
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if ce := rec.Header().Get("Content-Encoding"); ce != c.expected {
+			t.Errorf("%q: unexpected Content-Encoding: %q", c.contentType, ce)
+		}
+		if c.expected == "" && rec.Header().Get("Vary") != "" {
+			t.Errorf("%q: unexpected Vary: %q", c.contentType, rec.Header().Get("Vary"))
+		}
+	}
+
+	// A gRPC-Web response to a request without a gRPC Content-Type (e.g. a
+	// misrouted request) is not compressed either.
+	h = mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", grpcgateway.ContentTypeGRPCWeb+"+proto")
+		w.Write([]byte(strings.Repeat("a", 500)))
+	}))
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if ce := rec.Header().Get("Content-Encoding"); ce != "" {
+		t.Errorf("unexpected Content-Encoding: %q", ce)
+	}
+}
@@ -0,0 +1,16 @@
+module github.com/CAFxX/httpcompression/contrib/grpc
+
+go 1.25.0
+
+require (
+	github.com/CAFxX/httpcompression v0.0.8
+	github.com/klauspost/compress v1.17.9
+	google.golang.org/grpc v1.84.0
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+)
+
+replace github.com/CAFxX/httpcompression => ../..
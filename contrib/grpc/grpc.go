@@ -0,0 +1,141 @@
+// Package grpc adapts httpcompression CompressorProviders to the gRPC
+// encoding.Compressor interface, so that the same (pooled) compressor
+// implementations and levels used for HTTP responses can also be used
+// for gRPC message compression.
+package grpc
+
+import (
+	"compress/gzip"
+	"io"
+	"sync"
+
+	"github.com/CAFxX/httpcompression"
+	cgzip "github.com/CAFxX/httpcompression/contrib/compress/gzip"
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	kpzstd "github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+// Decompressor returns a reader that decompresses the data read from r.
+// If the returned io.Reader is also an io.Closer, gRPC will call Close
+// exactly once when it is done reading.
+type Decompressor func(r io.Reader) (io.Reader, error)
+
+type compressor struct {
+	name       string
+	provider   httpcompression.CompressorProvider
+	decompress Decompressor
+}
+
+var _ encoding.Compressor = &compressor{}
+
+// New returns a gRPC encoding.Compressor with the specified name that uses
+// provider to compress messages and decompress to decompress them.
+func New(name string, provider httpcompression.CompressorProvider, decompress Decompressor) encoding.Compressor {
+	return &compressor{
+		name:       name,
+		provider:   provider,
+		decompress: decompress,
+	}
+}
+
+// Register is like New, but it also registers the returned compressor with gRPC.
+// Per the gRPC documentation, Register must only be called during initialization
+// (i.e. in an init() function). If a compressor with the same name has already
+// been registered, it is replaced.
+func Register(name string, provider httpcompression.CompressorProvider, decompress Decompressor) encoding.Compressor {
+	c := New(name, provider, decompress)
+	encoding.RegisterCompressor(c)
+	return c
+}
+
+func (c *compressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return c.provider.Get(w), nil
+}
+
+func (c *compressor) Decompress(r io.Reader) (io.Reader, error) {
+	return c.decompress(r)
+}
+
+func (c *compressor) Name() string {
+	return c.name
+}
+
+// Gzip returns a gRPC compressor for the "gzip" encoding that uses the same
+// implementation used by httpcompression.GzipCompressionLevel.
+func Gzip(level int) (encoding.Compressor, error) {
+	p, err := httpcompression.NewDefaultGzipCompressor(level)
+	if err != nil {
+		return nil, err
+	}
+	return New(cgzip.Encoding, p, GzipDecompressor), nil
+}
+
+// Zstd returns a gRPC compressor for the "zstd" encoding that uses the same
+// implementation used by default by httpcompression.DefaultAdapter.
+func Zstd(opts ...kpzstd.EOption) (encoding.Compressor, error) {
+	p, err := zstd.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return New(zstd.Encoding, p, ZstdDecompressor), nil
+}
+
+var gzipReaderPool sync.Pool
+
+// GzipDecompressor is a Decompressor for gzip streams. Readers are pooled and
+// recycled when gRPC closes them.
+func GzipDecompressor(r io.Reader) (io.Reader, error) {
+	if gr, ok := gzipReaderPool.Get().(*gzipReader); ok {
+		if err := gr.Reset(r); err != nil {
+			gzipReaderPool.Put(gr)
+			return nil, err
+		}
+		return gr, nil
+	}
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &gzipReader{gr}, nil
+}
+
+type gzipReader struct {
+	*gzip.Reader
+}
+
+func (r *gzipReader) Close() error {
+	err := r.Reader.Close()
+	gzipReaderPool.Put(r)
+	return err
+}
+
+var zstdDecoderPool sync.Pool
+
+// ZstdDecompressor is a Decompressor for zstd streams. Decoders are pooled and
+// recycled when gRPC closes them.
+func ZstdDecompressor(r io.Reader) (io.Reader, error) {
+	if zr, ok := zstdDecoderPool.Get().(*zstdReader); ok {
+		if err := zr.Reset(r); err != nil {
+			zstdDecoderPool.Put(zr)
+			return nil, err
+		}
+		return zr, nil
+	}
+	zr, err := kpzstd.NewReader(r, kpzstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdReader{zr}, nil
+}
+
+type zstdReader struct {
+	*kpzstd.Decoder
+}
+
+func (r *zstdReader) Close() error {
+	// Do not call Decoder.Close, as that would make the decoder unusable.
+	_ = r.Decoder.Reset(nil)
+	zstdDecoderPool.Put(r)
+	return nil
+}
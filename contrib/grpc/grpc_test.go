@@ -0,0 +1,52 @@
+package grpc_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/CAFxX/httpcompression/contrib/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	s := []byte("hello world! hello world! hello world!")
+
+	gz, err := grpc.Gzip(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zs, err := grpc.Zstd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []encoding.Compressor{gz, zs} {
+		for i := 0; i < 3; i++ { // exercise the pools
+			b := &bytes.Buffer{}
+			w, err := c.Compress(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(s)
+			w.Close()
+
+			r, err := c.Decompress(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rc, ok := r.(io.Closer); ok {
+				rc.Close()
+			}
+			if !bytes.Equal(s, d) {
+				t.Fatalf("%s: decoded string mismatch\ngot: %q\nexp: %q", c.Name(), string(d), string(s))
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// RsyncWindow is the size of the window of the rolling checksum used by
+// RsyncableGzipWriter to find the boundaries of the chunks (the same used by
+// gzip --rsyncable). It is also the minimum size of the chunks.
+const RsyncWindow = 4096
+
+// FlateWriter is a DEFLATE compressor, like *flate.Writer.
+type FlateWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// RsyncableGzipWriter is a gzip writer that, like gzip --rsyncable, resets
+// the compressor at content-defined boundaries: the boundaries are found
+// with a rolling checksum of the last RsyncWindow bytes of uncompressed
+// data, and at each boundary the compressor is flushed and its history is
+// discarded, so that the compressed data after the boundary does not depend
+// on the data before it. The same chunks of data in different streams are
+// therefore compressed to the same bytes (once the streams are in sync),
+// that can be deduplicated by delta-transfer systems, at the cost of a
+// slightly lower compression ratio.
+type RsyncableGzipWriter struct {
+	fw     FlateWriter // compresses to w
+	w      io.Writer
+	xfl    byte
+	header bool // the header has been written
+	crc    uint32
+	size   uint32
+
+	window [RsyncWindow]byte
+	pos    int    // position of the next byte in window
+	filled int    // number of bytes in window
+	sum    uint32 // sum of the bytes in window
+	chunk  int    // size of the current chunk
+	err    error
+}
+
+// NewRsyncableGzipWriter returns a RsyncableGzipWriter writing to w, that
+// compresses the data with fw (that must be writing to w as well). The level
+// is used only to set the XFL field of the gzip header, like compress/gzip.
+func NewRsyncableGzipWriter(w io.Writer, fw FlateWriter, level int) *RsyncableGzipWriter {
+	z := &RsyncableGzipWriter{fw: fw, w: w}
+	switch level {
+	case 9: // best compression
+		z.xfl = 2
+	case 1: // best speed
+		z.xfl = 4
+	}
+	return z
+}
+
+// Reset discards the state of z, and makes it write to w.
+func (z *RsyncableGzipWriter) Reset(w io.Writer) {
+	*z = RsyncableGzipWriter{fw: z.fw, w: w, xfl: z.xfl}
+	z.fw.Reset(w)
+}
+
+func (z *RsyncableGzipWriter) writeHeader() error {
+	if z.header {
+		return nil
+	}
+	z.header = true
+	// ID1, ID2, CM (deflate), FLG, MTIME (4 bytes), XFL, OS (unknown): the
+	// same header written by compress/gzip with an empty gzip.Header.
+	h := [10]byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, z.xfl, 255}
+	_, err := z.w.Write(h[:])
+	return err
+}
+
+func (z *RsyncableGzipWriter) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.err = z.writeHeader(); z.err != nil {
+		return 0, z.err
+	}
+	n := len(p)
+	start := 0
+	for i, b := range p {
+		if z.filled == RsyncWindow {
+			z.sum -= uint32(z.window[z.pos])
+		} else {
+			z.filled++
+		}
+		z.window[z.pos] = b
+		z.sum += uint32(b)
+		z.pos = (z.pos + 1) % RsyncWindow
+		z.chunk++
+		if z.chunk >= RsyncWindow && z.filled == RsyncWindow && z.sum%RsyncWindow == 0 {
+			if z.err = z.write(p[start : i+1]); z.err != nil {
+				return 0, z.err
+			}
+			start = i + 1
+			if z.err = z.fw.Flush(); z.err != nil {
+				return 0, z.err
+			}
+			// The new compressor state continues the same DEFLATE stream, as
+			// the flush ended the last block on a byte boundary.
+			z.fw.Reset(z.w)
+			z.chunk = 0
+		}
+	}
+	if z.err = z.write(p[start:]); z.err != nil {
+		return 0, z.err
+	}
+	return n, nil
+}
+
+func (z *RsyncableGzipWriter) write(p []byte) error {
+	if len(p) == 0 {
+		return nil
+	}
+	z.crc = crc32.Update(z.crc, crc32.IEEETable, p)
+	z.size += uint32(len(p))
+	_, err := z.fw.Write(p)
+	return err
+}
+
+// Flush flushes the compressor.
+func (z *RsyncableGzipWriter) Flush() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.err = z.writeHeader(); z.err != nil {
+		return z.err
+	}
+	z.err = z.fw.Flush()
+	return z.err
+}
+
+// Close completes the gzip stream. It does not close the underlying writer.
+func (z *RsyncableGzipWriter) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.err = z.writeHeader(); z.err != nil {
+		return z.err
+	}
+	if z.err = z.fw.Close(); z.err != nil {
+		return z.err
+	}
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[:4], z.crc)
+	binary.LittleEndian.PutUint32(trailer[4:], z.size)
+	_, z.err = z.w.Write(trailer[:])
+	return z.err
+}
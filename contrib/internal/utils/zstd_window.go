@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const zstdMagic = 0xFD2FB528
+
+// ZstdWindowSize returns the window size advertised in the header of the
+// zstd frame at the beginning of frame. For single-segment frames, that
+// have no Window_Descriptor, it is the content size of the frame.
+func ZstdWindowSize(frame []byte) (int, error) {
+	if len(frame) < 5 || binary.LittleEndian.Uint32(frame) != zstdMagic {
+		return 0, errors.New("zstd: not a zstd frame")
+	}
+	fhd := frame[4]
+	if fhd&0x20 == 0 {
+		if len(frame) < 6 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		wd := frame[5]
+		base := 1 << (10 + wd>>3)
+		return base + base/8*int(wd&7), nil
+	}
+	// Single segment: Frame_Content_Size follows the Dictionary_ID.
+	off := 5 + [4]int{0, 1, 2, 4}[fhd&3]
+	switch fhd >> 6 {
+	case 0:
+		if len(frame) < off+1 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return int(frame[off]), nil
+	case 1:
+		if len(frame) < off+2 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return int(binary.LittleEndian.Uint16(frame[off:])) + 256, nil
+	case 2:
+		if len(frame) < off+4 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return int(binary.LittleEndian.Uint32(frame[off:])), nil
+	default:
+		if len(frame) < off+8 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return int(binary.LittleEndian.Uint64(frame[off:])), nil
+	}
+}
+
+// ProbeZstdWindowSize returns the window size advertised by the streams of
+// the zstd compressors returned by newWriter, that must implement Flush.
+// The window size is read from a stream flushed before being closed, as the
+// compressors can use smaller windows if all the data is known when the
+// frame header is written.
+func ProbeZstdWindowSize(newWriter func(io.Writer) io.WriteCloser) (int, error) {
+	var b bytes.Buffer
+	w := newWriter(&b)
+	f, ok := w.(interface{ Flush() error })
+	if !ok {
+		w.Close()
+		return 0, fmt.Errorf("zstd: the writer does not implement Flush")
+	}
+	_, err := w.Write([]byte{0})
+	if err == nil {
+		err = f.Flush()
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return ZstdWindowSize(b.Bytes())
+}
@@ -0,0 +1,55 @@
+// Package iris provides an Iris middleware that compresses responses using
+// httpcompression.
+//
+// The returned handlers can be registered on the application or on a
+// Party via Use/UseRouter/Done like any other Iris middleware.
+package iris
+
+import (
+	"net/http"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/kataras/iris/v12/context"
+)
+
+func Adapter(opts ...httpcompression.Option) (context.Handler, error) {
+	mw, err := httpcompression.Adapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(mw), nil
+}
+
+func DefaultAdapter(opts ...httpcompression.Option) (context.Handler, error) {
+	mw, err := httpcompression.DefaultAdapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(mw), nil
+}
+
+// wrap runs the rest of the Iris handler chain with the compressing writer
+// installed *below* the Iris response writer: the Iris writer (or recorder)
+// keeps tracking status and written bytes as usual, while the bytes it emits
+// go through the compressor.
+func wrap(mw func(http.Handler) http.Handler) context.Handler {
+	return func(ctx *context.Context) {
+		rw := ctx.ResponseWriter()
+		orig := rw.Naive()
+		mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw.SetWriter(w)
+			defer rw.SetWriter(orig)
+			// Send the status code, if needed, while the compressing writer is
+			// still installed, as Iris would otherwise do so only after the
+			// compressing writer has been closed.
+			defer func() {
+				if rw.Written() == context.NoWritten {
+					w.WriteHeader(rw.StatusCode())
+					rw.SetWritten(context.StatusCodeWritten)
+				}
+			}()
+			ctx.ResetRequest(r)
+			ctx.Next()
+		})).ServeHTTP(orig, ctx.Request())
+	}
+}
@@ -0,0 +1,65 @@
+package iris
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kataras/iris/v12"
+)
+
+func TestAdapter(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat("hello world! ", 100)
+
+	mw, err := DefaultAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := iris.New()
+	app.Use(mw)
+	app.Get("/", func(ctx iris.Context) {
+		ctx.ContentType("text/plain")
+		ctx.WriteString(body)
+	})
+	app.Get("/empty", func(ctx iris.Context) {
+		ctx.StatusCode(http.StatusNoContent)
+	})
+	if err := app.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	if ce := rec.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("unexpected Content-Encoding: %q", ce)
+	}
+	r, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != body {
+		t.Fatalf("decoded body mismatch")
+	}
+
+	req = httptest.NewRequest("GET", "/empty", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	if ce := rec.Header().Get("Content-Encoding"); ce != "" {
+		t.Fatalf("unexpected Content-Encoding: %q", ce)
+	}
+}
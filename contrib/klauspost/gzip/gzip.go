@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/CAFxX/httpcompression/contrib/internal/utils"
+	"github.com/klauspost/compress/flate"
 	"github.com/klauspost/compress/gzip"
 )
 
@@ -21,6 +22,12 @@ type compressor struct {
 
 type Options struct {
 	Level int
+	// Rsyncable resets the compressor at content-defined boundaries, like
+	// gzip --rsyncable, so that the unchanged parts of different versions
+	// of a response are compressed to the same bytes, that can be
+	// deduplicated by delta-transfer systems and CDNs. It slightly reduces
+	// the compression ratio.
+	Rsyncable bool
 }
 
 func New(opts Options) (c *compressor, err error) {
@@ -45,25 +52,49 @@ func New(opts Options) (c *compressor, err error) {
 func (c *compressor) Get(w io.Writer) io.WriteCloser {
 	if gw, ok := c.pool.Get().(*writer); ok {
 		gw.Reset(w)
+		gw.closed = false
 		return gw
 	}
-	gw, err := gzip.NewWriterLevel(w, c.opts.Level)
+	gw, err := c.newWriter(w)
 	if err != nil {
 		return utils.ErrorWriteCloser{Err: err}
 	}
 	return &writer{
-		Writer: gw,
-		c:      c,
+		resetWriter: gw,
+		c:           c,
 	}
 }
 
+func (c *compressor) newWriter(w io.Writer) (resetWriter, error) {
+	if !c.opts.Rsyncable {
+		return gzip.NewWriterLevel(w, c.opts.Level)
+	}
+	fw, err := flate.NewWriter(w, c.opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewRsyncableGzipWriter(w, fw, c.opts.Level), nil
+}
+
+// resetWriter is implemented by *gzip.Writer and *utils.RsyncableGzipWriter.
+type resetWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
 type writer struct {
-	*gzip.Writer
-	c *compressor
+	resetWriter
+	c      *compressor
+	closed bool
 }
 
 func (w *writer) Close() error {
-	err := w.Writer.Close()
+	if w.closed {
+		return nil // already closed (and recycled)
+	}
+	w.closed = true
+	err := w.resetWriter.Close()
 	w.Reset(nil)
 	w.c.pool.Put(w)
 	return err
@@ -9,6 +9,7 @@ import (
 
 	"github.com/CAFxX/httpcompression"
 	"github.com/CAFxX/httpcompression/contrib/klauspost/gzip"
+	"github.com/CAFxX/httpcompression/providertest"
 )
 
 var _ httpcompression.CompressorProvider = &gzip.Compressor{}
@@ -39,3 +40,27 @@ func TestGzip(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	providertest.Run(t, "gzip", func() (httpcompression.CompressorProvider, error) {
+		c, err := gzip.New(gzip.Options{Level: gzip.DefaultCompression})
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+func TestConformanceRsyncable(t *testing.T) {
+	t.Parallel()
+
+	providertest.Run(t, "gzip", func() (httpcompression.CompressorProvider, error) {
+		c, err := gzip.New(gzip.Options{Level: gzip.DefaultCompression, Rsyncable: true})
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
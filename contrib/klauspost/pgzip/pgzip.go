@@ -51,6 +51,7 @@ func New(opts Options) (c *compressor, err error) {
 func (c *compressor) Get(w io.Writer) io.WriteCloser {
 	if gw, ok := c.pool.Get().(*writer); ok {
 		gw.Reset(w)
+		gw.closed = false
 		return gw
 	}
 	gw, err := pgzip.NewWriterLevel(w, c.opts.Level)
@@ -67,12 +68,23 @@ func (c *compressor) Get(w io.Writer) io.WriteCloser {
 	}
 }
 
+// Capabilities returns the capabilities of the compressor (see
+// httpcompression.CapabilityReporter).
+func (c *compressor) Capabilities() []string {
+	return []string{"flush", "deterministic", "concurrent"}
+}
+
 type writer struct {
 	*pgzip.Writer
-	c *compressor
+	c      *compressor
+	closed bool
 }
 
 func (w *writer) Close() error {
+	if w.closed {
+		return nil // already closed (and recycled)
+	}
+	w.closed = true
 	err := w.Writer.Close()
 	w.Reset(nil)
 	w.c.pool.Put(w)
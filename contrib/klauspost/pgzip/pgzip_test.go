@@ -10,9 +10,13 @@ import (
 
 	"github.com/CAFxX/httpcompression"
 	"github.com/CAFxX/httpcompression/contrib/klauspost/pgzip"
+	"github.com/CAFxX/httpcompression/providertest"
 )
 
-var _ httpcompression.CompressorProvider = &pgzip.Compressor{}
+var (
+	_ httpcompression.CompressorProvider = &pgzip.Compressor{}
+	_ httpcompression.CapabilityReporter = &pgzip.Compressor{}
+)
 
 func TestPgzip(t *testing.T) {
 	t.Parallel()
@@ -40,3 +44,15 @@ func TestPgzip(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	providertest.Run(t, "gzip", func() (httpcompression.CompressorProvider, error) {
+		c, err := pgzip.New(pgzip.Options{Level: pgzip.DefaultCompression, BlockSize: 1 << 20, Blocks: runtime.GOMAXPROCS(0)})
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
@@ -46,6 +46,7 @@ func New(opts Options) (c *compressor, err error) {
 func (c *compressor) Get(w io.Writer) io.WriteCloser {
 	if gw, ok := c.pool.Get().(*writer); ok {
 		gw.Reset(w)
+		gw.closed = false
 		return gw
 	}
 	gw, err := zlib.NewWriterLevelDict(w, c.opts.Level, c.opts.Dictionary)
@@ -60,10 +61,15 @@ func (c *compressor) Get(w io.Writer) io.WriteCloser {
 
 type writer struct {
 	*zlib.Writer
-	c *compressor
+	c      *compressor
+	closed bool
 }
 
 func (w *writer) Close() error {
+	if w.closed {
+		return nil // already closed (and recycled)
+	}
+	w.closed = true
 	err := w.Writer.Close()
 	w.Reset(nil)
 	w.c.pool.Put(w)
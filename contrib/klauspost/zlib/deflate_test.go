@@ -9,6 +9,7 @@ import (
 
 	"github.com/CAFxX/httpcompression"
 	"github.com/CAFxX/httpcompression/contrib/klauspost/zlib"
+	"github.com/CAFxX/httpcompression/providertest"
 )
 
 var _ httpcompression.CompressorProvider = &zlib.Compressor{}
@@ -39,3 +40,15 @@ func TestDeflate(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	providertest.Run(t, "deflate", func() (httpcompression.CompressorProvider, error) {
+		c, err := zlib.New(zlib.Options{Level: zlib.DefaultCompression})
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
@@ -0,0 +1,50 @@
+package zstd
+
+import (
+	"fmt"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+// NewWithDictionary is like New, but the returned compressor uses dict, a
+// dictionary in the format produced by "zstd --train" or by Train.
+// The compressed responses can be decompressed only by clients that know the
+// dictionary: they are normally sent with the Content-Encoding returned by
+// DictionaryEncoding.
+func NewWithDictionary(dict []byte, opts ...zstd.EOption) (c *compressor, err error) {
+	if _, err := DictionaryID(dict); err != nil {
+		return nil, err
+	}
+	return New(append([]zstd.EOption{zstd.WithEncoderDict(dict)}, opts...)...)
+}
+
+// DictionaryID returns the ID of the zstd dictionary dict.
+func DictionaryID(dict []byte) (uint32, error) {
+	d, err := zstd.InspectDictionary(dict)
+	if err != nil {
+		return 0, fmt.Errorf("zstd: invalid dictionary: %w", err)
+	}
+	return d.ID(), nil
+}
+
+// DictionaryEncoding returns the Content-Encoding for responses compressed
+// with the dictionary with the specified ID: "z_" followed by the ID in
+// hexadecimal.
+func DictionaryEncoding(id uint32) string {
+	return fmt.Sprintf("z_%08x", id)
+}
+
+// Train builds a zstd dictionary of at most maxSize bytes from samples, a set
+// of representative response bodies (e.g. the JSON responses of an API).
+// If id is zero, a random ID is assigned to the dictionary.
+func Train(samples [][]byte, maxSize int, id uint32) ([]byte, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("zstd: no samples to train the dictionary")
+	}
+	return dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: maxSize,
+		HashBytes:   6,
+		ZstdDictID:  id,
+	})
+}
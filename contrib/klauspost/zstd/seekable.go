@@ -0,0 +1,359 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// The zstd seekable format splits the data in independent zstd frames, and
+// appends a seek table (in a skippable frame, ignored by regular zstd
+// decoders) with the compressed and decompressed size of each frame, so
+// that any range of the decompressed data can be read decompressing only
+// the frames containing it. See
+// https://github.com/facebook/zstd/blob/dev/contrib/seekable_format/zstd_seekable_compression_format.md
+const (
+	seekableSkippableMagic = 0x184D2A5E
+	seekableMagic          = 0x8F92EAB1
+	seekTableFooterSize    = 9
+	seekTableEntrySize     = 8
+	skippableHeaderSize    = 8
+	maxSeekableFrames      = 1 << 27
+	maxSeekableFrameSize   = 1 << 30
+
+	// DefaultSeekableFrameSize is the default size of the decompressed data
+	// of each frame of the streams produced by NewSeekable.
+	DefaultSeekableFrameSize = 1 << 20
+)
+
+// ErrNotSeekable is returned by NewSeekableReader if the data is not in the
+// zstd seekable format.
+var ErrNotSeekable = errors.New("zstd: not in the seekable format")
+
+type seekableCompressor struct {
+	enc       *zstd.Encoder // only used with EncodeAll, that is safe for concurrent use
+	frameSize int
+	pool      sync.Pool
+}
+
+// NewSeekable returns a compressor producing streams in the zstd seekable
+// format, with frames of frameSize bytes of decompressed data (if zero,
+// DefaultSeekableFrameSize is used). The streams can be decompressed by
+// any zstd decoder, so they can be served with the "zstd" Content-Encoding;
+// in addition, NewSeekableReader can read any range of the decompressed data
+// decompressing only the frames containing it, e.g. to serve Range requests
+// for the decompressed content of large precompressed files (see
+// httpcompression.FileServer). Smaller frames allow to read small ranges
+// more efficiently, but reduce the compression ratio.
+//
+// Flush ends the current frame, so that the data written so far can be
+// decompressed.
+func NewSeekable(frameSize int, opts ...zstd.EOption) (c *seekableCompressor, err error) {
+	if frameSize == 0 {
+		frameSize = DefaultSeekableFrameSize
+	}
+	if frameSize < 0 || frameSize > maxSeekableFrameSize {
+		return nil, fmt.Errorf("zstd: invalid seekable frame size: %d", frameSize)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			c, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &seekableCompressor{enc: enc, frameSize: frameSize}, nil
+}
+
+// WindowSize returns the window size advertised in the streams of the
+// compressor (see httpcompression.WindowSizer): as the frames are compressed
+// independently, it is at most the frame size.
+func (c *seekableCompressor) WindowSize() int {
+	return c.frameSize
+}
+
+func (c *seekableCompressor) Get(w io.Writer) io.WriteCloser {
+	if sw, ok := c.pool.Get().(*seekableWriter); ok {
+		sw.w = w
+		sw.closed = false
+		return sw
+	}
+	return &seekableWriter{c: c, w: w}
+}
+
+type seekableWriter struct {
+	c       *seekableCompressor
+	w       io.Writer
+	buf     []byte // decompressed data of the current frame
+	out     []byte // compressed data of the current frame
+	entries []byte // seek table entries of the frames written so far
+	err     error
+	closed  bool
+}
+
+func (w *seekableWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	for len(b) > 0 {
+		if w.err != nil {
+			return 0, w.err
+		}
+		m := min(w.c.frameSize-len(w.buf), len(b))
+		w.buf, b = append(w.buf, b[:m]...), b[m:]
+		if len(w.buf) == w.c.frameSize {
+			w.writeFrame()
+		}
+	}
+	return n, w.err
+}
+
+// Flush ends the current frame.
+func (w *seekableWriter) Flush() error {
+	if len(w.buf) > 0 {
+		w.writeFrame()
+	}
+	return w.err
+}
+
+func (w *seekableWriter) writeFrame() {
+	if w.err != nil {
+		return
+	}
+	if len(w.entries)/seekTableEntrySize >= maxSeekableFrames {
+		w.err = fmt.Errorf("zstd: too many seekable frames")
+		return
+	}
+	w.out = w.c.enc.EncodeAll(w.buf, w.out[:0])
+	w.entries = binary.LittleEndian.AppendUint32(w.entries, uint32(len(w.out)))
+	w.entries = binary.LittleEndian.AppendUint32(w.entries, uint32(len(w.buf)))
+	w.buf = w.buf[:0]
+	w.write(w.out)
+}
+
+func (w *seekableWriter) write(b []byte) {
+	n, err := w.w.Write(b)
+	if err == nil && n < len(b) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		w.err = err
+	}
+}
+
+func (w *seekableWriter) Close() error {
+	if w.closed {
+		return nil // already closed (and recycled)
+	}
+	w.closed = true
+	if len(w.buf) > 0 || len(w.entries) == 0 {
+		// An empty stream still needs a frame to be a valid zstd stream.
+		w.writeFrame()
+	}
+	if w.err == nil {
+		nframes := len(w.entries) / seekTableEntrySize
+		table := make([]byte, 0, skippableHeaderSize+len(w.entries)+seekTableFooterSize)
+		table = binary.LittleEndian.AppendUint32(table, seekableSkippableMagic)
+		table = binary.LittleEndian.AppendUint32(table, uint32(len(w.entries)+seekTableFooterSize))
+		table = append(table, w.entries...)
+		table = binary.LittleEndian.AppendUint32(table, uint32(nframes))
+		table = append(table, 0) // Seek_Table_Descriptor: no checksums
+		table = binary.LittleEndian.AppendUint32(table, seekableMagic)
+		w.write(table)
+	}
+	err := w.err
+	w.w, w.err = nil, nil
+	w.buf, w.out, w.entries = w.buf[:0], w.out[:0], w.entries[:0]
+	w.c.pool.Put(w)
+	return err
+}
+
+type seekableFrame struct {
+	off, doff   int64 // offsets of the frame in the compressed and decompressed data
+	size, dsize int64 // compressed and decompressed sizes of the frame
+}
+
+// SeekableReader reads the decompressed data of a stream in the zstd
+// seekable format (see NewSeekable), decompressing only the frames
+// containing the data being read. It implements io.ReaderAt, that is safe
+// for concurrent use, and io.ReadSeeker, that is not.
+type SeekableReader struct {
+	r      io.ReaderAt
+	frames []seekableFrame
+	size   int64
+	dec    *zstd.Decoder
+	off    int64 // offset of Read
+
+	mu    sync.Mutex
+	cur   int    // index of the frame in data, or -1
+	data  []byte // decompressed data of the last frame read
+	cdata []byte
+}
+
+var (
+	_ io.ReaderAt   = &SeekableReader{}
+	_ io.ReadSeeker = &SeekableReader{}
+)
+
+// NewSeekableReader returns a SeekableReader reading the stream in the zstd
+// seekable format in r, whose size is size. It reads only the seek table
+// of the stream: ErrNotSeekable is returned if the stream does not end
+// with a valid seek table. The returned reader must be closed when it is
+// not needed anymore.
+func NewSeekableReader(r io.ReaderAt, size int64) (*SeekableReader, error) {
+	if size < skippableHeaderSize+seekTableFooterSize {
+		return nil, ErrNotSeekable
+	}
+	var footer [seekTableFooterSize]byte
+	if err := readAt(r, footer[:], size-seekTableFooterSize); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != seekableMagic || footer[4]&0x7c != 0 {
+		return nil, ErrNotSeekable
+	}
+	nframes := int64(binary.LittleEndian.Uint32(footer[:4]))
+	entrySize := int64(seekTableEntrySize)
+	if footer[4]&0x80 != 0 {
+		entrySize += 4 // checksums
+	}
+	tableSize := skippableHeaderSize + nframes*entrySize + seekTableFooterSize
+	if nframes > maxSeekableFrames || tableSize > size {
+		return nil, ErrNotSeekable
+	}
+	table := make([]byte, tableSize-seekTableFooterSize)
+	if err := readAt(r, table, size-tableSize); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(table) != seekableSkippableMagic || int64(binary.LittleEndian.Uint32(table[4:])) != tableSize-skippableHeaderSize {
+		return nil, ErrNotSeekable
+	}
+	frames := make([]seekableFrame, nframes)
+	var off, doff int64
+	for i := range frames {
+		e := table[skippableHeaderSize+int64(i)*entrySize:]
+		f := seekableFrame{
+			off:   off,
+			doff:  doff,
+			size:  int64(binary.LittleEndian.Uint32(e)),
+			dsize: int64(binary.LittleEndian.Uint32(e[4:])),
+		}
+		off, doff = off+f.size, doff+f.dsize
+		frames[i] = f
+	}
+	if off != size-tableSize {
+		return nil, ErrNotSeekable
+	}
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &SeekableReader{r: r, frames: frames, size: doff, dec: dec, cur: -1}, nil
+}
+
+// readAt reads len(p) bytes at off. Unlike io.ReaderAt, it does not return
+// io.EOF if the read ends at the end of the data.
+func readAt(r io.ReaderAt, p []byte, off int64) error {
+	n, err := r.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Size returns the size of the decompressed data.
+func (r *SeekableReader) Size() int64 {
+	return r.size
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *SeekableReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("zstd: negative offset")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for n < len(p) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+		// The first frame ending after off.
+		i := sort.Search(len(r.frames), func(i int) bool {
+			return r.frames[i].doff+r.frames[i].dsize > off
+		})
+		if err := r.load(i); err != nil {
+			return n, err
+		}
+		m := copy(p[n:], r.data[off-r.frames[i].doff:])
+		n, off = n+m, off+int64(m)
+	}
+	return n, nil
+}
+
+// load decompresses the frame i, if it is not the last frame read.
+func (r *SeekableReader) load(i int) error {
+	if r.cur == i {
+		return nil
+	}
+	f := r.frames[i]
+	r.cur = -1
+	if int64(cap(r.cdata)) < f.size {
+		r.cdata = make([]byte, f.size)
+	}
+	r.cdata = r.cdata[:f.size]
+	if err := readAt(r.r, r.cdata, f.off); err != nil {
+		return err
+	}
+	data, err := r.dec.DecodeAll(r.cdata, r.data[:0])
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != f.dsize {
+		return fmt.Errorf("zstd: seekable frame %d: decompressed %d bytes, expected %d", i, len(data), f.dsize)
+	}
+	r.data, r.cur = data, i
+	return nil
+}
+
+// Read implements io.Reader.
+func (r *SeekableReader) Read(p []byte) (int, error) {
+	if r.off >= r.size {
+		return 0, io.EOF
+	}
+	n, err := r.ReadAt(p[:min(int64(len(p)), r.size-r.off)], r.off)
+	r.off += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (r *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("zstd: invalid whence: %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("zstd: negative position")
+	}
+	r.off = offset
+	return offset, nil
+}
+
+// Close releases the resources used by the reader. It does not close the
+// underlying reader.
+func (r *SeekableReader) Close() error {
+	r.dec.Close()
+	return nil
+}
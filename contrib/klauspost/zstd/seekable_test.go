@@ -0,0 +1,96 @@
+package zstd_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/CAFxX/httpcompression/providertest"
+	kpzstd "github.com/klauspost/compress/zstd"
+)
+
+func TestSeekable(t *testing.T) {
+	t.Parallel()
+
+	data := make([]byte, 100000)
+	rnd := rand.New(rand.NewSource(0))
+	for i := range data {
+		data[i] = "abcdefgh"[rnd.Intn(8)]
+	}
+	c, err := zstd.NewSeekable(4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &bytes.Buffer{}
+	w := c.Get(b)
+	w.Write(data[:1000])
+	w.(httpcompression.Flusher).Flush()
+	w.Write(data[1000:])
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stream is a regular zstd stream.
+	dec, err := kpzstd.NewReader(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	d, err := io.ReadAll(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, d) {
+		t.Fatal("decoded data mismatch")
+	}
+
+	r, err := zstd.NewSeekableReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("size: got %d, exp %d", r.Size(), len(data))
+	}
+	for i := 0; i < 100; i++ {
+		off := rnd.Intn(len(data))
+		p := make([]byte, rnd.Intn(10000))
+		n, err := r.ReadAt(p, int64(off))
+		exp := min(len(p), len(data)-off)
+		if n != exp || (err != nil && (err != io.EOF || n == len(p))) {
+			t.Fatalf("ReadAt(%d bytes, %d): got %d, %v", len(p), off, n, err)
+		}
+		if !bytes.Equal(p[:n], data[off:off+n]) {
+			t.Fatalf("ReadAt(%d bytes, %d): data mismatch", len(p), off)
+		}
+	}
+	if _, err := r.Seek(50000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	d, err = io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data[50000:], d) {
+		t.Fatal("Read after Seek: data mismatch")
+	}
+
+	if _, err := zstd.NewSeekableReader(bytes.NewReader(d), int64(len(d))); err != zstd.ErrNotSeekable {
+		t.Fatalf("not seekable: got %v", err)
+	}
+}
+
+func TestSeekableConformance(t *testing.T) {
+	t.Parallel()
+
+	providertest.Run(t, "zstd", func() (httpcompression.CompressorProvider, error) {
+		c, err := zstd.NewSeekable(16 << 10)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
@@ -12,11 +12,17 @@ import (
 const (
 	Encoding           = "zstd"
 	DefaultCompression = zstd.SpeedDefault
+
+	// DefaultCheckpointFrameSize is the default size of the decompressed
+	// data of each frame of the streams produced by NewCheckpointing.
+	DefaultCheckpointFrameSize = 1 << 20
 )
 
 type compressor struct {
-	pool sync.Pool
-	opts []zstd.EOption
+	pool      sync.Pool
+	opts      []zstd.EOption
+	window    int
+	frameSize int // the size of the frames, if checkpointing (see NewCheckpointing)
 }
 
 func New(opts ...zstd.EOption) (c *compressor, err error) {
@@ -35,14 +41,76 @@ func New(opts ...zstd.EOption) (c *compressor, err error) {
 	if err := utils.CheckWriter(tw); err != nil {
 		return nil, fmt.Errorf("zstd: writer initialization: %w", err)
 	}
+	window, err := utils.ProbeZstdWindowSize(func(w io.Writer) io.WriteCloser {
+		tw.Reset(w)
+		return tw
+	})
+	if err != nil {
+		return nil, fmt.Errorf("zstd: window size: %w", err)
+	}
+
+	c = &compressor{opts: opts, window: window}
+	return c, nil
+}
 
-	c = &compressor{opts: opts}
+// NewCheckpointing is like New, but the streams of the returned compressor
+// are made of frames of frameSize bytes of decompressed data (if zero,
+// DefaultCheckpointFrameSize is used): each frame is ended as soon as its
+// data has been written, and the following data is compressed in a new
+// frame, without referring to the data of the previous ones. Long streaming
+// responses can so be checkpointed: the complete frames of a partially
+// transferred response can be decompressed on their own, and caches can
+// store the prefixes of the responses ending at a frame boundary, to resume
+// them. Smaller frames make the checkpoints more frequent, but reduce the
+// compression ratio.
+func NewCheckpointing(frameSize int, opts ...zstd.EOption) (*compressor, error) {
+	if frameSize == 0 {
+		frameSize = DefaultCheckpointFrameSize
+	}
+	if frameSize < 0 {
+		return nil, fmt.Errorf("zstd: invalid checkpoint frame size: %d", frameSize)
+	}
+	c, err := New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.frameSize = frameSize
 	return c, nil
 }
 
+// WindowSize returns the window size advertised in the streams of the
+// compressor (see httpcompression.WindowSizer).
+func (c *compressor) WindowSize() int {
+	return c.window
+}
+
+// EncodeAll appends to dst the zstd frame of src, compressed at once with a
+// pooled encoder (see httpcompression.Encoder).
+func (c *compressor) EncodeAll(src, dst []byte) ([]byte, error) {
+	gw, ok := c.pool.Get().(*zstdWriter)
+	if !ok {
+		enc, err := zstd.NewWriter(nil, c.opts...)
+		if err != nil {
+			return nil, err
+		}
+		gw = &zstdWriter{Encoder: enc, c: c, closed: true}
+	}
+	if c.frameSize == 0 {
+		dst = gw.Encoder.EncodeAll(src, dst)
+	}
+	for c.frameSize > 0 && len(src) > 0 {
+		n := min(len(src), c.frameSize)
+		dst, src = gw.Encoder.EncodeAll(src[:n], dst), src[n:]
+	}
+	c.pool.Put(gw)
+	return dst, nil
+}
+
 func (c *compressor) Get(w io.Writer) io.WriteCloser {
 	if gw, ok := c.pool.Get().(*zstdWriter); ok {
 		gw.Reset(w)
+		gw.parent, gw.closed = w, false
+		gw.written, gw.ended = 0, false
 		return gw
 	}
 	gw, err := zstd.NewWriter(w, c.opts...)
@@ -52,17 +120,108 @@ func (c *compressor) Get(w io.Writer) io.WriteCloser {
 	return &zstdWriter{
 		Encoder: gw,
 		c:       c,
+		parent:  w,
 	}
 }
 
+// Close drops the pooled encoders, so that their memory can be reclaimed
+// (see httpcompression.Middleware.Shutdown). The compressor can still be used
+// after Close, but it allocates new encoders.
+func (c *compressor) Close() error {
+	for c.pool.Get() != nil {
+	}
+	return nil
+}
+
 type zstdWriter struct {
 	*zstd.Encoder
-	c *compressor
+	c       *compressor
+	parent  io.Writer
+	closed  bool
+	leveled bool // the level has been changed by SetLevel
+	written int  // the data written to the current frame, if checkpointing
+	ended   bool // the current frame has been ended, and the next one not started yet
+}
+
+func (w *zstdWriter) Write(b []byte) (int, error) {
+	if w.c.frameSize == 0 {
+		return w.Encoder.Write(b)
+	}
+	n := 0
+	for len(b) > 0 {
+		if w.ended {
+			w.Encoder.Reset(w.parent)
+			w.written, w.ended = 0, false
+		}
+		m, err := w.Encoder.Write(b[:min(len(b), w.c.frameSize-w.written)])
+		n, b, w.written = n+m, b[m:], w.written+m
+		if err != nil {
+			return n, err
+		}
+		if w.written == w.c.frameSize {
+			// End the frame right away, so that it can be decompressed
+			// before the following data is written.
+			w.ended = true
+			if err := w.Encoder.Close(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom writes the data of r, ending the frames like Write.
+func (w *zstdWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.c.frameSize == 0 {
+		return w.Encoder.ReadFrom(r)
+	}
+	return io.Copy(struct{ io.Writer }{w}, r)
+}
+
+func (w *zstdWriter) Flush() error {
+	if w.ended {
+		return nil
+	}
+	return w.Encoder.Flush()
 }
 
 func (w *zstdWriter) Close() error {
-	err := w.Encoder.Close()
+	if w.closed {
+		return nil // already closed (and recycled)
+	}
+	w.closed = true
+	var err error
+	if !w.ended {
+		err = w.Encoder.Close()
+	}
 	w.Reset(nil)
-	w.c.pool.Put(w)
+	w.parent = nil
+	if !w.leveled {
+		w.c.pool.Put(w)
+	}
 	return err
 }
+
+// SetLevel changes the compression level (from 1 to 22, like the levels of
+// the zstd command) of the data written from now on (see
+// httpcompression.LevelSetter): the current frame is ended, and the
+// following data is compressed in a new frame, as a zstd stream can be made
+// of multiple frames.
+func (w *zstdWriter) SetLevel(level int) error {
+	if level < 1 || level > 22 {
+		return fmt.Errorf("zstd: invalid compression level: %d", level)
+	}
+	if !w.ended {
+		if err := w.Encoder.Close(); err != nil {
+			return err
+		}
+	}
+	opts := append(append([]zstd.EOption(nil), w.c.opts...), zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	enc, err := zstd.NewWriter(w.parent, opts...)
+	if err != nil {
+		return err
+	}
+	w.Encoder, w.leveled = enc, true
+	w.written, w.ended = 0, false
+	return nil
+}
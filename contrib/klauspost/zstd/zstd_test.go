@@ -2,11 +2,13 @@ package zstd_test
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"testing"
 
 	"github.com/CAFxX/httpcompression"
 	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/CAFxX/httpcompression/providertest"
 	kpzstd "github.com/klauspost/compress/zstd"
 )
 
@@ -38,3 +40,262 @@ func TestZstd(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestDictionary(t *testing.T) {
+	t.Parallel()
+
+	var samples [][]byte
+	for i := 0; i < 1000; i++ {
+		samples = append(samples, []byte(fmt.Sprintf(`{"id":%d,"name":"user %d","email":"user%d@example.com","active":%v,"roles":["reader","writer"]}`, i, i, i, i%3 == 0)))
+	}
+	dict, err := zstd.Train(samples, 4096, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := zstd.DictionaryID(dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1234 {
+		t.Fatalf("dictionary id: got %d, exp 1234", id)
+	}
+	if enc := zstd.DictionaryEncoding(id); enc != "z_000004d2" {
+		t.Fatalf("dictionary encoding: got %q", enc)
+	}
+
+	c, err := zstd.NewWithDictionary(dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := []byte(`{"id":5000,"name":"user 5000","email":"user5000@example.com","active":true,"roles":["reader","writer"]}`)
+	b := &bytes.Buffer{}
+	w := c.Get(b)
+	w.Write(s)
+	w.Close()
+
+	plain, _ := zstd.New()
+	pb := &bytes.Buffer{}
+	w = plain.Get(pb)
+	w.Write(s)
+	w.Close()
+	if b.Len() >= pb.Len() {
+		t.Fatalf("dictionary did not improve compression: %d >= %d", b.Len(), pb.Len())
+	}
+
+	r, err := kpzstd.NewReader(b, kpzstd.WithDecoderDicts(dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s, d) {
+		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(d), string(s))
+	}
+
+	if _, err := zstd.NewWithDictionary([]byte("not a dictionary")); err == nil {
+		t.Fatal("expected error for invalid dictionary")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	providertest.Run(t, "zstd", func() (httpcompression.CompressorProvider, error) {
+		c, err := zstd.New()
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+func TestWindowSize(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		opts []kpzstd.EOption
+		exp  int
+	}{
+		{nil, 8 << 20},
+		{[]kpzstd.EOption{kpzstd.WithEncoderLevel(kpzstd.SpeedFastest)}, 4 << 20},
+		{[]kpzstd.EOption{kpzstd.WithWindowSize(32 << 20)}, 32 << 20},
+	} {
+		c, err := zstd.New(tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ws := c.WindowSize(); ws != tc.exp {
+			t.Errorf("window size: got %d, exp %d", ws, tc.exp)
+		}
+	}
+
+	var _ httpcompression.WindowSizer = &zstd.Compressor{}
+}
+
+func TestEncodeAll(t *testing.T) {
+	t.Parallel()
+
+	s := []byte("hello world!")
+
+	c, err := zstd.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The pooled encoders are shared between the streams and EncodeAll.
+	w := c.Get(ioutil.Discard)
+	w.Write(s)
+	w.Close()
+	for i := 0; i < 2; i++ {
+		b, err := c.EncodeAll(s, []byte("prefix"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(b, []byte("prefix")) {
+			t.Fatalf("dst not extended: %q", b)
+		}
+		r, err := kpzstd.NewReader(bytes.NewReader(b[len("prefix"):]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(s, d) {
+			t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
+		}
+	}
+
+	var _ httpcompression.Encoder = &zstd.Compressor{}
+}
+
+func TestClose(t *testing.T) {
+	t.Parallel()
+
+	c, err := zstd.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		b := &bytes.Buffer{}
+		w := c.Get(b)
+		w.Write([]byte("hello world!"))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := kpzstd.NewReader(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(d) != "hello world!" {
+			t.Fatalf("decoded string mismatch: %q", d)
+		}
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	t.Parallel()
+
+	c, err := zstd.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := bytes.Repeat([]byte("hello world! "), 1000)
+	b := &bytes.Buffer{}
+	w := c.Get(b)
+	w.Write(s)
+	ls, ok := w.(httpcompression.LevelSetter)
+	if !ok {
+		t.Fatal("the compressor does not implement LevelSetter")
+	}
+	if err := ls.SetLevel(19); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(s)
+	if err := ls.SetLevel(0); err == nil {
+		t.Fatal("invalid level accepted")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := kpzstd.NewReader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := append(append([]byte(nil), s...), s...); !bytes.Equal(exp, d) {
+		t.Fatalf("decoded string mismatch: got %d bytes, exp %d", len(d), len(exp))
+	}
+}
+
+func TestCheckpointing(t *testing.T) {
+	t.Parallel()
+
+	const frameSize = 4096
+	c, err := zstd.NewCheckpointing(frameSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := bytes.Repeat([]byte("hello world! "), 1000)
+	decode := func(b []byte) []byte {
+		r, err := kpzstd.NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		d, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	for i := 0; i < 2; i++ {
+		b := &bytes.Buffer{}
+		w := c.Get(b)
+		if _, err := w.Write(s[:3*frameSize+100]); err != nil {
+			t.Fatal(err)
+		}
+		// The complete frames can be decompressed before the stream is closed.
+		if d := decode(b.Bytes()); !bytes.Equal(d, s[:3*frameSize]) {
+			t.Fatalf("decoded prefix mismatch: got %d bytes, exp %d", len(d), 3*frameSize)
+		}
+		if _, err := w.Write(s[3*frameSize+100:]); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.(httpcompression.Flusher).Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if d := decode(b.Bytes()); !bytes.Equal(d, s) {
+			t.Fatalf("decoded string mismatch: got %d bytes, exp %d", len(d), len(s))
+		}
+	}
+
+	// The streams compressed at once are split in frames too.
+	dst, err := c.EncodeAll(s[:2*frameSize], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := decode(dst); !bytes.Equal(d, s[:2*frameSize]) {
+		t.Fatalf("decoded string mismatch: got %d bytes, exp %d", len(d), 2*frameSize)
+	}
+
+	if _, err := zstd.NewCheckpointing(-1); err == nil {
+		t.Fatal("invalid frame size accepted")
+	}
+}
@@ -43,6 +43,7 @@ func New(opts ...lz4.Option) (c *compressor, err error) {
 func (c *compressor) Get(w io.Writer) io.WriteCloser {
 	if gw, ok := c.pool.Get().(*writer); ok {
 		gw.Reset(w)
+		gw.closed = false
 		return gw
 	}
 	gw := lz4.NewWriter(w)
@@ -58,10 +59,15 @@ func (c *compressor) Get(w io.Writer) io.WriteCloser {
 
 type writer struct {
 	*lz4.Writer
-	c *compressor
+	c      *compressor
+	closed bool
 }
 
 func (w *writer) Close() error {
+	if w.closed {
+		return nil // already closed (and recycled)
+	}
+	w.closed = true
 	err := w.Writer.Close()
 	w.Reset(nil)
 	w.c.pool.Put(w)
@@ -2,11 +2,13 @@ package lz4_test
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	"testing"
 
 	"github.com/CAFxX/httpcompression"
 	"github.com/CAFxX/httpcompression/contrib/pierrec/lz4"
+	"github.com/CAFxX/httpcompression/providertest"
 	plz4 "github.com/pierrec/lz4/v4"
 )
 
@@ -35,3 +37,17 @@ func TestLz4(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	providertest.RunWithDecoder(t, func() (httpcompression.CompressorProvider, error) {
+		c, err := lz4.New()
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}, func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(plz4.NewReader(r)), nil
+	})
+}
@@ -0,0 +1,20 @@
+module github.com/CAFxX/httpcompression/contrib/quic-go/quic-go/http3
+
+go 1.26.0
+
+require (
+	github.com/CAFxX/httpcompression v0.0.8
+	github.com/quic-go/quic-go v0.63.0
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/quic-go/qpack v0.6.0 // indirect
+	golang.org/x/crypto v0.54.0 // indirect
+	golang.org/x/net v0.56.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+)
+
+replace github.com/CAFxX/httpcompression => ../../../..
@@ -0,0 +1,96 @@
+// Package http3 makes httpcompression usable with HTTP/3 servers based on
+// github.com/quic-go/quic-go/http3.
+//
+// The http3.ResponseWriter passed to HTTP/3 handlers does not implement
+// http.CloseNotifier or http.Hijacker, and it exposes HTTP/3-specific
+// interfaces (http3.Settingser and http3.HTTPStreamer) that would be hidden
+// by the compressing ResponseWriter installed by httpcompression.
+//
+// The adapters in this package:
+//   - pass through requests whose stream may be taken over by the handler
+//     (CONNECT requests, including extended CONNECT used by WebTransport and
+//     MASQUE), as their response bodies must never be compressed;
+//   - preserve http3.Settingser on the ResponseWriter passed to the handler;
+//   - rely on httpcompression's support for http.ResponseController to
+//     reach SetReadDeadline and SetWriteDeadline of the http3.ResponseWriter.
+//
+// http3.HTTPStreamer is deliberately not exposed on compressed responses:
+// taking over the stream would bypass the compressor.
+package http3
+
+import (
+	"net/http"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// Adapter returns a HTTP/3-aware middleware. See httpcompression.Adapter
+// for the supported options.
+func Adapter(opts ...httpcompression.Option) (func(http.Handler) http.Handler, error) {
+	a, err := httpcompression.Adapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(a), nil
+}
+
+// DefaultAdapter is like Adapter, but it includes the defaults of
+// httpcompression.DefaultAdapter.
+func DefaultAdapter(opts ...httpcompression.Option) (func(http.Handler) http.Handler, error) {
+	a, err := httpcompression.DefaultAdapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(a), nil
+}
+
+func wrap(a func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		compressed := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); ok {
+				if s, ok := u.Unwrap().(http3.Settingser); ok {
+					w = &responseWriter{w, s}
+				}
+			}
+			next.ServeHTTP(w, r)
+		}))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodConnect {
+				next.ServeHTTP(w, r)
+				return
+			}
+			compressed.ServeHTTP(w, r)
+		})
+	}
+}
+
+// responseWriter wraps the compressing ResponseWriter to expose the
+// http3.Settingser interface of the http3.ResponseWriter.
+type responseWriter struct {
+	http.ResponseWriter
+	settings http3.Settingser
+}
+
+var (
+	_ http.Flusher     = &responseWriter{}
+	_ http3.Settingser = &responseWriter{}
+)
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) ReceivedSettings() <-chan struct{} {
+	return w.settings.ReceivedSettings()
+}
+
+func (w *responseWriter) Settings() *http3.Settings {
+	return w.settings.Settings()
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
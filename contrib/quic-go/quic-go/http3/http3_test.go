@@ -0,0 +1,196 @@
+package http3_test
+
+import (
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	chttp3 "github.com/CAFxX/httpcompression/contrib/quic-go/quic-go/http3"
+	"github.com/quic-go/quic-go/http3"
+)
+
+var body = strings.Repeat("hello world ", 100)
+
+// serve starts a HTTP/3 server on localhost and returns its URL and a client.
+func serve(t *testing.T, h http.Handler) (string, *http.Client) {
+	t.Helper()
+
+	// Borrow the certificate of the httptest TLS server.
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	certs := ts.TLS.Certificates
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	ts.Close()
+
+	ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http3.Server{
+		Handler:   h,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: certs}),
+	}
+	go srv.Serve(ln)
+	tr := &http3.Transport{
+		TLSClientConfig:    &tls.Config{RootCAs: pool},
+		DisableCompression: true,
+	}
+	t.Cleanup(func() {
+		tr.Close()
+		srv.Close()
+		ln.Close()
+	})
+	return "https://" + ln.LocalAddr().String() + "/", &http.Client{Transport: tr}
+}
+
+func get(t *testing.T, c *http.Client, url string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+
+	mw, err := chttp3.DefaultAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, c := serve(t, mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, body)
+	})))
+
+	res := get(t, c, url)
+	if ce := res.Header.Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("unexpected Content-Encoding: %q", ce)
+	}
+	gr, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != body {
+		t.Error("unexpected body")
+	}
+}
+
+func TestFlush(t *testing.T) {
+	t.Parallel()
+
+	mw, err := chttp3.DefaultAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	flushed := make(chan struct{})
+	url, c := serve(t, mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, body)
+		w.(http.Flusher).Flush()
+		// Wait until the client received the first chunk.
+		select {
+		case <-flushed:
+		case <-time.After(5 * time.Second):
+		}
+		io.WriteString(w, body)
+	})))
+
+	res := get(t, c, url)
+	if ce := res.Header.Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("unexpected Content-Encoding: %q", ce)
+	}
+	gr, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(body))
+	if _, err := io.ReadFull(gr, buf); err != nil {
+		t.Fatal(err)
+	}
+	close(flushed)
+	rest, err := io.ReadAll(gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf)+string(rest) != body+body {
+		t.Error("unexpected body")
+	}
+}
+
+func TestResponseWriterInterfaces(t *testing.T) {
+	t.Parallel()
+
+	mw, err := chttp3.DefaultAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan string, 4)
+	url, c := serve(t, mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(errs)
+		if _, ok := w.(http3.Settingser); !ok {
+			errs <- "http3.Settingser not implemented"
+		}
+		if _, ok := w.(http3.HTTPStreamer); ok {
+			errs <- "http3.HTTPStreamer must not be exposed on compressed responses"
+		}
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Now().Add(time.Minute)); err != nil {
+			errs <- "SetWriteDeadline: " + err.Error()
+		}
+		if err := rc.SetReadDeadline(time.Now().Add(time.Minute)); err != nil {
+			errs <- "SetReadDeadline: " + err.Error()
+		}
+		io.WriteString(w, body)
+	})))
+
+	res := get(t, c, url)
+	if ce := res.Header.Get("Content-Encoding"); ce != "gzip" {
+		t.Errorf("unexpected Content-Encoding: %q", ce)
+	}
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestConnectBypass(t *testing.T) {
+	t.Parallel()
+
+	mw, err := chttp3.DefaultAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	req := httptest.NewRequest("CONNECT", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if ce := rec.Header().Get("Content-Encoding"); ce != "" {
+		t.Errorf("unexpected Content-Encoding: %q", ce)
+	}
+	if rec.Body.String() != body {
+		t.Error("unexpected body")
+	}
+}
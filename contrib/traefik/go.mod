@@ -0,0 +1,15 @@
+module github.com/CAFxX/httpcompression/contrib/traefik
+
+go 1.22
+
+require (
+	github.com/CAFxX/httpcompression v0.0.8
+	github.com/traefik/yaegi v0.16.1
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+)
+
+replace github.com/CAFxX/httpcompression => ../..
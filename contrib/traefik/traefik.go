@@ -0,0 +1,82 @@
+// yaegi:tags httpcompression_minimal
+
+// Package traefik is a Traefik middleware plugin that compresses responses
+// using httpcompression.
+//
+// Traefik runs plugins in the Yaegi interpreter, which cannot load packages
+// that use cgo or unsafe. The yaegi:tags directive above makes Yaegi build
+// httpcompression with the httpcompression_minimal tag, so that only the
+// standard library gzip and deflate compressors are used.
+package traefik
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/CAFxX/httpcompression"
+)
+
+// Config is the plugin configuration, as specified in the Traefik dynamic
+// configuration.
+type Config struct {
+	// MinSize is the minimum size of the responses to be compressed.
+	MinSize int `json:"minSize,omitempty"`
+	// GzipLevel is the gzip compression level (-1 for the default level).
+	GzipLevel int `json:"gzipLevel,omitempty"`
+	// DeflateLevel is the deflate compression level (-1 for the default level).
+	DeflateLevel int `json:"deflateLevel,omitempty"`
+	// ContentTypes, if not empty, is the list of content types to compress.
+	ContentTypes []string `json:"contentTypes,omitempty"`
+	// ExcludeContentTypes inverts the meaning of ContentTypes: the listed
+	// content types are never compressed.
+	ExcludeContentTypes bool `json:"excludeContentTypes,omitempty"`
+	// Prefer is either "server" (the default) or "client".
+	Prefer string `json:"prefer,omitempty"`
+}
+
+// CreateConfig returns the default plugin configuration.
+func CreateConfig() *Config {
+	return &Config{
+		MinSize:      httpcompression.DefaultMinSize,
+		GzipLevel:    -1,
+		DeflateLevel: -1,
+		Prefer:       "server",
+	}
+}
+
+// New returns the plugin middleware wrapping next.
+func New(ctx context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
+	opts, err := options(config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	a, err := httpcompression.Adapter(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return a(next), nil
+}
+
+func options(config *Config) ([]httpcompression.Option, error) {
+	if config == nil {
+		config = CreateConfig()
+	}
+	opts := []httpcompression.Option{
+		httpcompression.MinSize(config.MinSize),
+		httpcompression.GzipCompressionLevel(config.GzipLevel),
+		httpcompression.DeflateCompressionLevel(config.DeflateLevel),
+	}
+	if len(config.ContentTypes) > 0 {
+		opts = append(opts, httpcompression.ContentTypes(config.ContentTypes, config.ExcludeContentTypes))
+	}
+	switch config.Prefer {
+	case "", "server":
+		opts = append(opts, httpcompression.Prefer(httpcompression.PreferServer))
+	case "client":
+		opts = append(opts, httpcompression.Prefer(httpcompression.PreferClient))
+	default:
+		return nil, fmt.Errorf("unknown prefer value: %q", config.Prefer)
+	}
+	return opts, nil
+}
@@ -0,0 +1,100 @@
+package traefik_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CAFxX/httpcompression/contrib/traefik"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	h, err := traefik.New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 1000)))
+	}), traefik.CreateConfig(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if ce := rec.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Errorf("unexpected Content-Encoding: %q", ce)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	c := traefik.CreateConfig()
+	c.Prefer = "nobody"
+	if _, err := traefik.New(context.Background(), http.NotFoundHandler(), c, "test"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+// TestYaegi loads the plugin in the Yaegi interpreter, like Traefik does.
+func TestYaegi(t *testing.T) {
+	t.Parallel()
+
+	root, err := filepath.Abs("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gopath := t.TempDir()
+	dir := filepath.Join(gopath, "src", "github.com", "CAFxX")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(dir, "httpcompression")); err != nil {
+		t.Fatal(err)
+	}
+
+	i := interp.New(interp.Options{GoPath: gopath})
+	if err := i.Use(stdlib.Symbols); err != nil {
+		t.Fatal(err)
+	}
+	_, err = i.Eval(`
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/CAFxX/httpcompression/contrib/traefik"
+)
+
+func run() string {
+	h, err := traefik.New(context.Background(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 1000)))
+	}), traefik.CreateConfig(), "test")
+	if err != nil {
+		return err.Error()
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Header().Get("Content-Encoding")
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := i.Eval("run()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ce := v.String(); ce != "gzip" {
+		t.Errorf("unexpected Content-Encoding: %q", ce)
+	}
+}
@@ -0,0 +1,70 @@
+// Package twirp provides a middleware that compresses the responses of Twirp
+// services using httpcompression.
+//
+// Twirp servers are plain net/http handlers, so no dependency on Twirp itself
+// is needed. Twirp responses use the same Content-Type as the corresponding
+// request (application/protobuf or application/json), so the middleware
+// can apply different settings to protobuf and JSON payloads before the
+// response is written.
+package twirp
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/CAFxX/httpcompression"
+)
+
+const (
+	ContentTypeProtobuf = "application/protobuf"
+	ContentTypeJSON     = "application/json"
+
+	// DefaultProtobufMinSize is the default minimum size of protobuf responses
+	// to be compressed. Protobuf payloads are much denser than their JSON
+	// equivalent, so small protobuf responses rarely benefit from compression.
+	DefaultProtobufMinSize = 1024
+)
+
+// Adapter returns a middleware to be used to wrap Twirp servers.
+// By default only Twirp payloads (protobuf and JSON) are compressed; use
+// httpcompression.ContentTypes in opts to override this.
+// Protobuf responses smaller than protobufMinSize bytes are not compressed;
+// to use the same minimum size for both protobuf and JSON responses, set
+// protobufMinSize to 0.
+func Adapter(protobufMinSize int, opts ...httpcompression.Option) (func(http.Handler) http.Handler, error) {
+	return adapter(httpcompression.Adapter, protobufMinSize, opts)
+}
+
+// DefaultAdapter is like Adapter, but it uses httpcompression.DefaultAdapter
+// and DefaultProtobufMinSize.
+func DefaultAdapter(opts ...httpcompression.Option) (func(http.Handler) http.Handler, error) {
+	return adapter(httpcompression.DefaultAdapter, DefaultProtobufMinSize, opts)
+}
+
+func adapter(newAdapter func(...httpcompression.Option) (func(http.Handler) http.Handler, error), protobufMinSize int, opts []httpcompression.Option) (func(http.Handler) http.Handler, error) {
+	opts = append([]httpcompression.Option{
+		httpcompression.ContentTypes([]string{ContentTypeProtobuf, ContentTypeJSON}, false),
+	}, opts...)
+	json, err := newAdapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if protobufMinSize == 0 {
+		return json, nil
+	}
+	opts = append(opts, httpcompression.MinSize(protobufMinSize))
+	protobuf, err := newAdapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return func(h http.Handler) http.Handler {
+		jh, ph := json(h), protobuf(h)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == ContentTypeProtobuf {
+				ph.ServeHTTP(w, r)
+			} else {
+				jh.ServeHTTP(w, r)
+			}
+		})
+	}, nil
+}
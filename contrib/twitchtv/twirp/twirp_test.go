@@ -0,0 +1,42 @@
+package twirp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CAFxX/httpcompression/contrib/twitchtv/twirp"
+)
+
+func TestAdapter(t *testing.T) {
+	t.Parallel()
+
+	mw, err := twirp.DefaultAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		w.Write([]byte(strings.Repeat("a", 500)))
+	}))
+
+	cases := []struct {
+		contentType string
+		expected    string
+	}{
+		{twirp.ContentTypeJSON, "gzip"},
+		{twirp.ContentTypeProtobuf, ""},
+		{"text/plain", ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("POST", "/twirp/pkg.Service/Method", nil)
+		req.Header.Set("Content-Type", c.contentType)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if ce := rec.Header().Get("Content-Encoding"); ce != c.expected {
+			t.Errorf("%s: unexpected Content-Encoding: %q", c.contentType, ce)
+		}
+	}
+}
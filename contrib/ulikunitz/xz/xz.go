@@ -40,6 +40,13 @@ func (c *compressor) Get(w io.Writer) io.WriteCloser {
 	return &xzWriter{gw}
 }
 
+// Capabilities returns the capabilities of the compressor (see
+// httpcompression.CapabilityReporter): the xz writers can not be flushed, so
+// they are not used for streaming responses.
+func (c *compressor) Capabilities() []string {
+	return []string{"deterministic"}
+}
+
 type xzWriter struct {
 	*xz.Writer
 }
@@ -7,10 +7,14 @@ import (
 
 	"github.com/CAFxX/httpcompression"
 	"github.com/CAFxX/httpcompression/contrib/ulikunitz/xz"
+	"github.com/CAFxX/httpcompression/providertest"
 	pxz "github.com/ulikunitz/xz"
 )
 
-var _ httpcompression.CompressorProvider = &xz.Compressor{}
+var (
+	_ httpcompression.CompressorProvider = &xz.Compressor{}
+	_ httpcompression.CapabilityReporter = &xz.Compressor{}
+)
 
 func TestXz(t *testing.T) {
 	t.Parallel()
@@ -38,3 +42,21 @@ func TestXz(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	providertest.RunWithDecoder(t, func() (httpcompression.CompressorProvider, error) {
+		c, err := xz.New(pxz.WriterConfig{})
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}, func(r io.Reader) (io.ReadCloser, error) {
+		xr, err := pxz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	})
+}
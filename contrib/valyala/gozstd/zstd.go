@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 package gozstd
 
 import (
@@ -14,8 +17,9 @@ const (
 )
 
 type compressor struct {
-	pool sync.Pool
-	opts gozstd.WriterParams
+	pool   sync.Pool
+	opts   gozstd.WriterParams
+	window int
 }
 
 func New(opts gozstd.WriterParams) (c *compressor, err error) {
@@ -29,14 +33,28 @@ func New(opts gozstd.WriterParams) (c *compressor, err error) {
 	if err := utils.CheckWriter(tw); err != nil {
 		return nil, fmt.Errorf("gozstd: writer initialization: %w", err)
 	}
+	window, err := utils.ProbeZstdWindowSize(func(w io.Writer) io.WriteCloser {
+		tw.ResetWriterParams(w, &opts)
+		return tw
+	})
+	if err != nil {
+		return nil, fmt.Errorf("gozstd: window size: %w", err)
+	}
 
-	c = &compressor{opts: opts}
+	c = &compressor{opts: opts, window: window}
 	return c, nil
 }
 
+// WindowSize returns the window size advertised in the streams of the
+// compressor (see httpcompression.WindowSizer).
+func (c *compressor) WindowSize() int {
+	return c.window
+}
+
 func (c *compressor) Get(w io.Writer) io.WriteCloser {
 	if gw, ok := c.pool.Get().(*zstdWriter); ok {
 		gw.ResetWriterParams(w, &c.opts)
+		gw.closed = false
 		return gw
 	}
 	gw := gozstd.NewWriterParams(w, &c.opts)
@@ -46,12 +64,30 @@ func (c *compressor) Get(w io.Writer) io.WriteCloser {
 	}
 }
 
+// Close releases the native memory of the pooled writers (see
+// httpcompression.Middleware.Shutdown). The compressor can still be used
+// after Close, but it allocates new writers.
+func (c *compressor) Close() error {
+	for {
+		gw, ok := c.pool.Get().(*zstdWriter)
+		if !ok {
+			return nil
+		}
+		gw.Release()
+	}
+}
+
 type zstdWriter struct {
 	*gozstd.Writer
-	c *compressor
+	c      *compressor
+	closed bool
 }
 
 func (w *zstdWriter) Close() error {
+	if w.closed {
+		return nil // already closed (and recycled)
+	}
+	w.closed = true
 	err := w.Writer.Close()
 	w.ResetWriterParams(nil, &w.c.opts) // drop reference to parent writer
 	w.c.pool.Put(w)
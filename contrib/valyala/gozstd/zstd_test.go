@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 package gozstd_test
 
 import (
@@ -7,6 +10,7 @@ import (
 
 	"github.com/CAFxX/httpcompression"
 	"github.com/CAFxX/httpcompression/contrib/valyala/gozstd"
+	"github.com/CAFxX/httpcompression/providertest"
 	vzstd "github.com/valyala/gozstd"
 )
 
@@ -38,3 +42,56 @@ func TestZstd(t *testing.T) {
 		t.Fatalf("decoded string mismatch\ngot: %q\nexp: %q", string(s), string(d))
 	}
 }
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	providertest.Run(t, "zstd", func() (httpcompression.CompressorProvider, error) {
+		c, err := gozstd.New(vzstd.WriterParams{CompressionLevel: 3})
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
+
+func TestWindowSize(t *testing.T) {
+	t.Parallel()
+
+	c, err := gozstd.New(vzstd.WriterParams{CompressionLevel: 3, WindowLog: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws := c.WindowSize(); ws != 16<<20 {
+		t.Errorf("window size: got %d, exp %d", ws, 16<<20)
+	}
+
+	var _ httpcompression.WindowSizer = &gozstd.Compressor{}
+}
+
+func TestClose(t *testing.T) {
+	t.Parallel()
+
+	c, err := gozstd.New(vzstd.WriterParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		b := &bytes.Buffer{}
+		w := c.Get(b)
+		w.Write([]byte("hello world!"))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+		d, err := ioutil.ReadAll(vzstd.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(d) != "hello world!" {
+			t.Fatalf("decoded string mismatch: %q", d)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package gozero provides a go-zero rest.Middleware that compresses responses
+// using httpcompression.
+//
+// Register it on a rest.Server via Server.Use, or per route via rest.WithMiddlewares.
+package gozero
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/zeromicro/go-zero/core/metric"
+	"github.com/zeromicro/go-zero/rest"
+)
+
+func Adapter(opts ...httpcompression.Option) (rest.Middleware, error) {
+	mw, err := httpcompression.Adapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(mw), nil
+}
+
+func DefaultAdapter(opts ...httpcompression.Option) (rest.Middleware, error) {
+	mw, err := httpcompression.DefaultAdapter(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(mw), nil
+}
+
+func wrap(mw func(http.Handler) http.Handler) rest.Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return mw(next).ServeHTTP
+	}
+}
+
+// Metrics wraps a middleware returned by Adapter or DefaultAdapter so that
+// the number of responses and the number of bytes sent to clients are
+// recorded, labeled by Content-Encoding ("identity" for uncompressed
+// responses), using go-zero's metric package. The metrics are only exported
+// if go-zero's prometheus support is enabled.
+//
+// Metrics must be called only once per namespace, as the metrics are
+// registered when it's called.
+func Metrics(namespace string, mw rest.Middleware) rest.Middleware {
+	return metrics(namespace, mw, nil)
+}
+
+// MetricsByRoute is like Metrics, but the metrics are also labeled by the
+// route of each request, as returned by route: route must normalize the
+// requests to their route patterns (e.g. "/users/:id" instead of the path
+// "/users/42"), so that the number of label values stays bounded. The
+// requests for which route returns the empty string, and those of the
+// routes after the first 1024, are labeled "other".
+func MetricsByRoute(namespace string, mw rest.Middleware, route func(r *http.Request) string) rest.Middleware {
+	if route == nil {
+		route = func(*http.Request) string { return "" }
+	}
+	return metrics(namespace, mw, route)
+}
+
+func metrics(namespace string, mw rest.Middleware, route func(r *http.Request) string) rest.Middleware {
+	labels, by := []string{"encoding"}, "content encoding"
+	if route != nil {
+		labels, by = append(labels, "route"), "content encoding and route"
+	}
+	responses := metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "http_compression",
+		Name:      "responses_total",
+		Help:      "http server responses count, by " + by + ".",
+		Labels:    labels,
+	})
+	bytes := metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "http_compression",
+		Name:      "sent_bytes_total",
+		Help:      "http server response body bytes sent, by " + by + ".",
+		Labels:    labels,
+	})
+	routes := &routeLabels{seen: map[string]struct{}{}}
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		h := mw(next)
+		return func(w http.ResponseWriter, r *http.Request) {
+			values := make([]string, 1, 2)
+			if route != nil {
+				// The route is computed before the handler, as it may
+				// modify the request.
+				values = append(values, routes.label(route(r)))
+			}
+			// The counting writer is installed below the compression middleware,
+			// so that it counts the bytes after compression.
+			cw := &countingWriter{ResponseWriter: w}
+			h(cw, r)
+			enc := w.Header().Get("Content-Encoding")
+			if enc == "" {
+				enc = "identity"
+			}
+			values[0] = enc
+			responses.Inc(values...)
+			bytes.Add(float64(cw.n), values...)
+		}
+	}
+}
+
+const (
+	// maxRouteLabels is the maximum number of route label values used by
+	// MetricsByRoute.
+	maxRouteLabels = 1024
+	otherRoute     = "other"
+)
+
+// routeLabels bounds the values of the route label.
+type routeLabels struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+func (l *routeLabels) label(route string) string {
+	if route == "" {
+		return otherRoute
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.seen[route]; !ok {
+		if len(l.seen) >= maxRouteLabels {
+			return otherRoute
+		}
+		l.seen[route] = struct{}{}
+	}
+	return route
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *countingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach the underlying ResponseWriter.
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,93 @@
+package gozero
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdapter(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat("hello world! ", 100)
+
+	mw, err := DefaultAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Metrics("test", mw)(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, body)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	if ce := rec.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("unexpected Content-Encoding: %q", ce)
+	}
+	r, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != body {
+		t.Fatalf("decoded body mismatch")
+	}
+}
+
+func TestMetricsByRoute(t *testing.T) {
+	t.Parallel()
+
+	mw, err := DefaultAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var routes []string
+	h := MetricsByRoute("test_routes", mw, func(r *http.Request) string {
+		route := ""
+		if strings.HasPrefix(r.URL.Path, "/users/") {
+			route = "/users/:id"
+		}
+		routes = append(routes, route)
+		return route
+	})(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "hello world!")
+	})
+	for _, path := range []string{"/users/1", "/users/2", "/"} {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Body.String() != "hello world!" {
+			t.Fatalf("unexpected body: %q", rec.Body.String())
+		}
+	}
+	if len(routes) != 3 || routes[0] != "/users/:id" || routes[1] != "/users/:id" || routes[2] != "" {
+		t.Fatalf("unexpected routes: %q", routes)
+	}
+
+	// The number of route labels is bounded.
+	l := &routeLabels{seen: map[string]struct{}{}}
+	if got := l.label(""); got != otherRoute {
+		t.Fatalf("unexpected label of the empty route: %q", got)
+	}
+	for i := 0; i < maxRouteLabels; i++ {
+		if got := l.label(fmt.Sprint("/r", i)); got != fmt.Sprint("/r", i) {
+			t.Fatalf("unexpected label: %q", got)
+		}
+	}
+	if got := l.label("/overflow"); got != otherRoute {
+		t.Fatalf("unexpected label of the overflowing route: %q", got)
+	}
+	if got := l.label("/r0"); got != "/r0" {
+		t.Fatalf("unexpected label of a known route: %q", got)
+	}
+}
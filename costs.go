@@ -0,0 +1,171 @@
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// costMaxPatterns is the maximum number of patterns tracked by a
+// CostTracker.
+const costMaxPatterns = 4096
+
+// CostTracker accumulates the cost of compressing the responses of each
+// route pattern, to attribute the compression cost to the teams owning the
+// routes and to find out where caching the responses, or lowering the
+// compression levels, is most useful. See TrackCosts.
+// A CostTracker is safe for concurrent use.
+type CostTracker struct {
+	pattern func(r *http.Request) string
+
+	mu    sync.Mutex
+	costs map[string]*routeCost
+}
+
+// CostStats is the cost of compressing the responses of a pattern (see
+// CostTracker).
+type CostStats struct {
+	// Responses is the number of compressed responses.
+	Responses uint64 `json:"responses"`
+	// UncompressedBytes is the size of the compressed responses before
+	// compression.
+	UncompressedBytes uint64 `json:"uncompressedBytes"`
+	// CompressedBytes is the size of the compressed responses.
+	CompressedBytes uint64 `json:"compressedBytes"`
+	// CompressionTime is the time spent compressing the responses, not
+	// including the time spent writing them to the clients. It
+	// approximates the CPU time, unless the compressors use multiple
+	// goroutines (see CapabilityConcurrent) or the CPUs are saturated.
+	CompressionTime time.Duration `json:"compressionTime"`
+}
+
+// NewCostTracker returns a CostTracker accumulating the costs by the pattern
+// of each request, as returned by pattern (e.g. the pattern of the route
+// matched by the request; if pattern is nil the path of the request is
+// used). Up to 4096 patterns are tracked, plus the empty pattern, where the
+// costs of the additional patterns, and of the requests for which pattern
+// returns the empty string, are accumulated.
+func NewCostTracker(pattern func(r *http.Request) string) *CostTracker {
+	if pattern == nil {
+		pattern = func(r *http.Request) string {
+			return r.URL.Path
+		}
+	}
+	return &CostTracker{pattern: pattern, costs: map[string]*routeCost{}}
+}
+
+// TrackCosts is an option that accumulates in t the cost of compressing the
+// responses. The same CostTracker can be used by multiple middlewares, and
+// by their routes. The costs are also reported by Middleware.AdminHandler.
+func TrackCosts(t *CostTracker) Option {
+	return func(c *config) error {
+		c.costs = t
+		return nil
+	}
+}
+
+// Stats returns the costs accumulated so far, by pattern.
+func (t *CostTracker) Stats() map[string]CostStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := make(map[string]CostStats, len(t.costs))
+	for p, c := range t.costs {
+		s[p] = CostStats{
+			Responses:         c.responses.Load(),
+			UncompressedBytes: c.in.Load(),
+			CompressedBytes:   c.out.Load(),
+			CompressionTime:   time.Duration(c.time.Load()),
+		}
+	}
+	return s
+}
+
+// get returns the costs of the pattern p.
+func (t *CostTracker) get(p string) *routeCost {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.costs[p]
+	if !ok {
+		if len(t.costs) >= costMaxPatterns {
+			p = ""
+			c = t.costs[p]
+		}
+		if c == nil {
+			c = &routeCost{}
+			t.costs[p] = c
+		}
+	}
+	return c
+}
+
+// routeCost accumulates the costs of a pattern.
+type routeCost struct {
+	responses atomic.Uint64
+	in, out   atomic.Uint64
+	time      atomic.Int64 // nanoseconds
+}
+
+// costWriter measures the cost of a compressor, writing to a costParent.
+type costWriter struct {
+	io.WriteCloser            // the compressor
+	cost           *routeCost // where the cost is accumulated, if the costs are tracked
+	in, out        int64
+	total, output  time.Duration // the time spent in the compressor, and in writing its output
+}
+
+func (w *costWriter) Write(b []byte) (int, error) {
+	start := time.Now()
+	n, err := w.WriteCloser.Write(b)
+	w.total += time.Since(start)
+	w.in += int64(n)
+	return n, err
+}
+
+func (w *costWriter) Flush() error {
+	f, ok := w.WriteCloser.(Flusher)
+	if !ok {
+		return nil
+	}
+	start := time.Now()
+	err := f.Flush()
+	w.total += time.Since(start)
+	return err
+}
+
+func (w *costWriter) Close() error {
+	start := time.Now()
+	err := w.WriteCloser.Close()
+	w.total += time.Since(start)
+	if w.cost != nil {
+		w.cost.responses.Add(1)
+		w.cost.in.Add(uint64(w.in))
+		w.cost.out.Add(uint64(w.out))
+		w.cost.time.Add(int64(w.duration()))
+	}
+	return err
+}
+
+// duration returns the time spent compressing, not including the time spent
+// writing the output.
+func (w *costWriter) duration() time.Duration {
+	if w.total < w.output {
+		return 0
+	}
+	return w.total - w.output
+}
+
+// costParent is the writer of the output of the compressor of a costWriter.
+type costParent struct {
+	w  io.Writer
+	cw *costWriter
+}
+
+func (p *costParent) Write(b []byte) (int, error) {
+	start := time.Now()
+	n, err := p.w.Write(b)
+	p.cw.output += time.Since(start)
+	p.cw.out += int64(n)
+	return n, err
+}
@@ -0,0 +1,71 @@
+package httpcompression
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackCosts(t *testing.T) {
+	t.Parallel()
+
+	costs := NewCostTracker(func(r *http.Request) string {
+		team, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		return team
+	})
+	m, err := DefaultMiddleware(TrackCosts(costs))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		if r.URL.Path == "/small/" {
+			w.Write([]byte("small"))
+			return
+		}
+		w.Write([]byte(testBody))
+		if r.URL.Path == "/stream/" {
+			w.(http.Flusher).Flush()
+			w.Write([]byte(testBody))
+		}
+	}))
+	for _, path := range []string{"/search/a", "/search/b", "/stream/", "/small/"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+	}
+
+	s := costs.Stats()
+	assert.EqualValues(t, 2, s["search"].Responses)
+	assert.EqualValues(t, 2*len(testBody), s["search"].UncompressedBytes)
+	assert.NotZero(t, s["search"].CompressedBytes)
+	assert.Less(t, s["search"].CompressedBytes, s["search"].UncompressedBytes)
+	assert.Positive(t, s["search"].CompressionTime)
+	assert.EqualValues(t, 1, s["stream"].Responses)
+	assert.EqualValues(t, 2*len(testBody), s["stream"].UncompressedBytes)
+	assert.NotContains(t, s, "small", "the uncompressed responses have no cost")
+
+	res := httptest.NewRecorder()
+	m.AdminHandler(false).ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+	var rep AdminReport
+	if assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &rep)) {
+		assert.Equal(t, s, rep.Costs)
+	}
+}
+
+func TestCostTrackerMaxPatterns(t *testing.T) {
+	t.Parallel()
+
+	costs := NewCostTracker(nil)
+	for i := 0; i < costMaxPatterns+10; i++ {
+		costs.get(fmt.Sprint("/", i))
+	}
+	assert.Len(t, costs.Stats(), costMaxPatterns+1)
+	assert.Contains(t, costs.Stats(), "")
+}
@@ -0,0 +1,144 @@
+//go:build !httpcompression_minimal
+// +build !httpcompression_minimal
+
+package httpcompression
+
+import (
+	"compress/gzip"
+	"fmt"
+	"net/http"
+
+	"github.com/CAFxX/httpcompression/contrib/andybalholm/brotli"
+	"github.com/CAFxX/httpcompression/contrib/compress/zlib"
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+
+	kpzstd "github.com/klauspost/compress/zstd"
+)
+
+// DefaultAdapter is like Adapter, but it includes sane defaults for general usage.
+// Currently the defaults enable gzip and brotli compression, and set a minimum body size
+// of 200 bytes.
+// The provided opts override the defaults.
+// The defaults are not guaranteed to remain constant over time: if you want to avoid this
+// use Adapter directly.
+func DefaultAdapter(opts ...Option) (func(http.Handler) http.Handler, error) {
+	opts = append(defaultOptions(), opts...)
+	return Adapter(opts...)
+}
+
+// defaultOptions returns the options used by DefaultAdapter.
+func defaultOptions() []Option {
+	return []Option{
+		DeflateCompressionLevel(zlib.DefaultCompression),
+		GzipCompressionLevel(gzip.DefaultCompression),
+		BrotliCompressionLevel(brotli.DefaultCompression),
+		defaultZstandardCompressor(),
+		DictionaryCompressor(DictionaryZstandardEncoding, -50, zstdDictionaryCompressor),
+		DictionaryCompressor(DictionaryBrotliEncoding, -100, brotliDictionaryCompressor),
+		MinSize(DefaultMinSize),
+	}
+}
+
+// BrotliCompressionLevel is an option that controls the Brotli compression
+// level to be used when compressing payloads.
+// The default is 3 (the same default used in the reference brotli C
+// implementation).
+func BrotliCompressionLevel(level int) Option {
+	c, err := brotli.New(brotli.Options{Quality: level})
+	if err != nil {
+		return errorOption("BrotliCompressionLevel", err)
+	}
+	return withLevel(BrotliCompressor(c), brotliEncoding, level)
+}
+
+// ZstandardCompressionLevel is an option that controls the Zstandard
+// compression level (from 1 to 22, as in the reference zstd implementation)
+// to be used when compressing payloads.
+func ZstandardCompressionLevel(level int) Option {
+	if level < 1 || level > 22 {
+		return errorOption("ZstandardCompressionLevel", fmt.Errorf("invalid zstd compression level: %d", level))
+	}
+	c, err := zstd.New(kpzstd.WithEncoderLevel(kpzstd.EncoderLevelFromZstd(level)))
+	if err != nil {
+		return errorOption("ZstandardCompressionLevel", err)
+	}
+	return withLevel(ZstandardCompressor(c), zstandardEncoding, level)
+}
+
+func defaultZstandardCompressor() Option {
+	zstdComp, err := zstd.New()
+	if err != nil {
+		return errorOption("", fmt.Errorf("initializing zstd compressor: %w", err))
+	}
+	return withLevel(ZstandardCompressor(zstdComp), zstandardEncoding, 3) // zstd.SpeedDefault
+}
+
+// zstdDictionaryCompressor is the DictionaryCompressorProvider for the dcz
+// encoding used by DefaultAdapter.
+func zstdDictionaryCompressor(dict []byte) (CompressorProvider, error) {
+	return zstd.New(kpzstd.WithEncoderDictRaw(0, dict))
+}
+
+// brotliDictionaryCompressor is the DictionaryCompressorProvider for the dcb
+// encoding used by DefaultAdapter.
+func brotliDictionaryCompressor(dict []byte) (CompressorProvider, error) {
+	return brotli.NewWithDictionary(dict, brotli.DefaultCompression)
+}
+
+// ZstandardDictionaryCompressor is an option that adds a zstd compressor
+// using dict, a dictionary in the format produced by "zstd --train" or by
+// zstd.Train (for example trained on a sample of the JSON responses of an
+// API). As only clients that know the dictionary can decompress the
+// responses, they are sent with a custom Content-Encoding (see
+// zstd.DictionaryEncoding) that must be listed by the clients in their
+// Accept-Encoding header; the compressor has a higher priority than the
+// zstd compressor.
+// If contentTypes is not empty, the dictionary is used only for responses
+// with one of the specified content types. To use different dictionaries
+// for different routes, use ServeMux.
+func ZstandardDictionaryCompressor(dict []byte, contentTypes ...string) Option {
+	id, err := zstd.DictionaryID(dict)
+	if err != nil {
+		return errorOption("ZstandardDictionaryCompressor", err)
+	}
+	c, err := zstd.NewWithDictionary(dict)
+	if err != nil {
+		return errorOption("ZstandardDictionaryCompressor", err)
+	}
+	cts, err := parseContentTypes(contentTypes)
+	if err != nil {
+		return errorOption("ZstandardDictionaryCompressor", err)
+	}
+	enc := zstd.DictionaryEncoding(id)
+	return func(cfg *config) error {
+		cfg.compressor[enc] = comp{comp: c, priority: -40, contentTypes: cts}
+		return nil
+	}
+}
+
+// BrotliDictionaryCompressor is an option that adds a brotli compressor using
+// dict as a shared dictionary, at the specified level (up to 7). As only
+// clients that know the dictionary can decompress the responses, they are
+// sent with a custom Content-Encoding (see brotli.DictionaryEncoding) that
+// must be listed by the clients in their Accept-Encoding header; the
+// compressor has a higher priority than the brotli compressor.
+// If contentTypes is not empty, the dictionary is used only for responses
+// with one of the specified content types. To use different dictionaries
+// for different routes, use ServeMux.
+// For clients that support the Compression Dictionary Transport use the
+// Dictionaries option instead.
+func BrotliDictionaryCompressor(dict []byte, level int, contentTypes ...string) Option {
+	c, err := brotli.NewWithDictionary(dict, level)
+	if err != nil {
+		return errorOption("BrotliDictionaryCompressor", err)
+	}
+	cts, err := parseContentTypes(contentTypes)
+	if err != nil {
+		return errorOption("BrotliDictionaryCompressor", err)
+	}
+	enc := brotli.DictionaryEncoding(dict)
+	return func(cfg *config) error {
+		cfg.compressor[enc] = comp{comp: c, priority: -90, contentTypes: cts}
+		return nil
+	}
+}
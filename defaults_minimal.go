@@ -0,0 +1,75 @@
+//go:build httpcompression_minimal
+// +build httpcompression_minimal
+
+package httpcompression
+
+import (
+	"compress/gzip"
+	"errors"
+	"net/http"
+
+	"github.com/CAFxX/httpcompression/contrib/compress/zlib"
+)
+
+// The httpcompression_minimal build tag produces a variant of the package that
+// depends only on the standard library: no cgo, no unsafe, no third-party
+// compressors. This is the variant to use in restricted environments, e.g.
+// when running under the Yaegi interpreter as a Traefik plugin.
+//
+// In this variant DefaultAdapter only enables gzip and deflate, and
+// BrotliCompressionLevel always fails. Custom providers can still be added
+// with BrotliCompressor, ZstandardCompressor or Compressor.
+
+var errMinimalBuild = errors.New("not available in httpcompression_minimal builds")
+
+// DefaultAdapter is like Adapter, but it includes sane defaults for general usage.
+// In httpcompression_minimal builds the defaults enable gzip and deflate
+// compression, and set a minimum body size of 200 bytes.
+// The provided opts override the defaults.
+// The defaults are not guaranteed to remain constant over time: if you want to avoid this
+// use Adapter directly.
+func DefaultAdapter(opts ...Option) (func(http.Handler) http.Handler, error) {
+	opts = append(defaultOptions(), opts...)
+	return Adapter(opts...)
+}
+
+// defaultOptions returns the options used by DefaultAdapter.
+func defaultOptions() []Option {
+	return []Option{
+		DeflateCompressionLevel(zlib.DefaultCompression),
+		GzipCompressionLevel(gzip.DefaultCompression),
+		MinSize(DefaultMinSize),
+	}
+}
+
+// BrotliCompressionLevel is not available in httpcompression_minimal builds:
+// the returned option always fails. Use BrotliCompressor with a pure-Go
+// provider instead.
+func BrotliCompressionLevel(level int) Option {
+	return errorOption("BrotliCompressionLevel", errMinimalBuild)
+}
+
+// ZstandardCompressionLevel is not available in httpcompression_minimal
+// builds: the returned option always fails. Use ZstandardCompressor with a
+// pure-Go provider instead.
+func ZstandardCompressionLevel(level int) Option {
+	return errorOption("ZstandardCompressionLevel", errMinimalBuild)
+}
+
+// ZstandardDictionaryCompressor is not available in httpcompression_minimal
+// builds: the returned option always fails.
+func ZstandardDictionaryCompressor(dict []byte, contentTypes ...string) Option {
+	return errorOption("ZstandardDictionaryCompressor", errMinimalBuild)
+}
+
+// zstdDictionaryCompressor is not available in httpcompression_minimal
+// builds: it always fails.
+func zstdDictionaryCompressor(dict []byte) (CompressorProvider, error) {
+	return nil, errMinimalBuild
+}
+
+// BrotliDictionaryCompressor is not available in httpcompression_minimal
+// builds: the returned option always fails.
+func BrotliDictionaryCompressor(dict []byte, level int, contentTypes ...string) Option {
+	return errorOption("BrotliDictionaryCompressor", errMinimalBuild)
+}
@@ -0,0 +1,174 @@
+package httpcompression
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+)
+
+// ConfigReport is the effective configuration resulting from a set of
+// options, as returned by Describe.
+type ConfigReport struct {
+	// Encodings are the configured compressors, by decreasing priority.
+	Encodings []EncodingReport `json:"encodings"`
+	// DictionaryEncodings are the configured dictionary encodings (see
+	// DictionaryCompressor), by decreasing priority.
+	DictionaryEncodings []EncodingReport `json:"dictionaryEncodings,omitempty"`
+	// MinSize is the minimum size of the responses to compress.
+	MinSize int `json:"minSize"`
+	// ContentTypes are the only content types to compress, if not empty.
+	ContentTypes []string `json:"contentTypes,omitempty"`
+	// ExcludedContentTypes are the content types not to compress.
+	ExcludedContentTypes []string `json:"excludedContentTypes,omitempty"`
+	// Prefer is "server" or "client" (see Prefer).
+	Prefer string `json:"prefer"`
+	// Dictionaries is the number of dictionaries configured with the
+	// Dictionaries option.
+	Dictionaries int `json:"dictionaries,omitempty"`
+	// Cache reports whether VariantCache is used.
+	Cache bool `json:"cache,omitempty"`
+	// Routes is the number of routes configured with the Route option.
+	Routes int `json:"routes,omitempty"`
+	// Deterministic reports whether the Deterministic option is used.
+	Deterministic bool `json:"deterministic,omitempty"`
+	// LearnEncodings reports whether the LearnEncodings option is used.
+	LearnEncodings bool `json:"learnEncodings,omitempty"`
+	// DebugCapture reports whether the DebugCapture option is used.
+	DebugCapture bool `json:"debugCapture,omitempty"`
+	// OneShotMaxSize is the size set with the OneShotMaxSize option.
+	OneShotMaxSize int `json:"oneShotMaxSize,omitempty"`
+}
+
+// EncodingReport describes a compressor (see ConfigReport).
+type EncodingReport struct {
+	// Encoding is the Content-Encoding of the compressor.
+	Encoding string `json:"encoding"`
+	// Priority is the priority of the compressor.
+	Priority int `json:"priority"`
+	// Level is the compression level, if known (i.e. if the compressor was
+	// configured with one of the *CompressionLevel options).
+	Level *int `json:"level,omitempty"`
+	// MinSize is the minimum size of the responses compressed with the
+	// encoding, if it is different from the MinSize of the configuration
+	// (see EncodingMinSize).
+	MinSize *int `json:"minSize,omitempty"`
+	// Provider is the Go type of the CompressorProvider.
+	Provider string `json:"provider,omitempty"`
+	// ContentTypes are the only content types for which the compressor is
+	// used, if not empty.
+	ContentTypes []string `json:"contentTypes,omitempty"`
+	// Capabilities are the capabilities declared by the provider, if it
+	// implements CapabilityReporter.
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// Describe returns the configuration resulting from opts, without building
+// a middleware, e.g. to validate and print the configuration of a
+// deployment. To describe the configuration of DefaultAdapter, include its
+// defaults with DefaultOptions.
+// An error will be returned if invalid options are given.
+func Describe(opts ...Option) (ConfigReport, error) {
+	c, err := newConfig(opts...)
+	if err != nil {
+		return ConfigReport{}, err
+	}
+	return c.report(), nil
+}
+
+// DefaultOptions returns the defaults of DefaultAdapter, e.g. to pass them to
+// Describe.
+func DefaultOptions() []Option {
+	return defaultOptions()
+}
+
+func (c *config) report() ConfigReport {
+	r := ConfigReport{
+		MinSize: c.minSize,
+		Prefer:  "server",
+		Cache:   c.cache != nil,
+		Routes:  len(c.routes),
+
+		Deterministic:  c.deterministic,
+		LearnEncodings: c.learn != nil,
+		DebugCapture:   c.capture != nil,
+		OneShotMaxSize: c.oneShot,
+	}
+	if c.prefer == PreferClient {
+		r.Prefer = "client"
+	}
+	for enc, cc := range c.compressor {
+		r.Encodings = append(r.Encodings, EncodingReport{
+			Encoding:     enc,
+			Priority:     cc.priority,
+			Level:        cc.level,
+			MinSize:      c.encodingMinSizeReport(enc),
+			Provider:     fmt.Sprintf("%T", cc.comp),
+			ContentTypes: formatContentTypes(cc.contentTypes),
+			Capabilities: capabilities(cc.comp),
+		})
+	}
+	sortEncodingReports(r.Encodings)
+	if c.dict != nil {
+		r.Dictionaries = len(c.dict.dicts)
+		for enc, dc := range c.dict.comps {
+			r.DictionaryEncodings = append(r.DictionaryEncodings, EncodingReport{Encoding: enc, Priority: dc.priority, MinSize: c.encodingMinSizeReport(enc)})
+		}
+		sortEncodingReports(r.DictionaryEncodings)
+	}
+	if c.blacklist {
+		r.ExcludedContentTypes = formatContentTypes(c.contentTypes)
+	} else {
+		r.ContentTypes = formatContentTypes(c.contentTypes)
+	}
+	return r
+}
+
+func (c *config) encodingMinSizeReport(enc string) *int {
+	if size, ok := c.encMinSize[enc]; ok {
+		return &size
+	}
+	return nil
+}
+
+func sortEncodingReports(encs []EncodingReport) {
+	sort.Slice(encs, func(i, j int) bool {
+		if encs[i].Priority != encs[j].Priority {
+			return encs[i].Priority > encs[j].Priority
+		}
+		return encs[i].Encoding < encs[j].Encoding
+	})
+}
+
+func formatContentTypes(cts []parsedContentType) []string {
+	var s []string
+	for _, ct := range cts {
+		s = append(s, mime.FormatMediaType(ct.mediaType, ct.params))
+	}
+	return s
+}
+
+// ListCompressors returns the compressors used by h, a handler returned by
+// a middleware of this package (e.g. by the middleware returned by Adapter,
+// or by Middleware.Wrap), by decreasing priority, e.g. so that health
+// endpoints can report which compressors are live. For handlers with
+// routes (see Route), the compressors used by the requests not matching
+// any route are returned. It returns false if h is not a handler returned
+// by a middleware of this package, or if the middleware has no compressors
+// configured (in which case the middleware returns the handler itself).
+func ListCompressors(h http.Handler) ([]EncodingReport, bool) {
+	switch h := h.(type) {
+	case *compressHandler:
+		return h.config.report().Encodings, true
+	case *reloadingHandler:
+		return h.m.Compressors(), true
+	}
+	return nil, false
+}
+
+// Compressors returns the compressors currently used by the middleware, by
+// decreasing priority.
+func (m *Middleware) Compressors() []EncodingReport {
+	c := m.current().config
+	return c.report().Encodings
+}
@@ -0,0 +1,88 @@
+package httpcompression
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribe(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	r, err := Describe(append(DefaultOptions(), GzipCompressionLevel(9), ContentTypes([]string{"text/html; charset=utf-8"}, true), Prefer(PreferClient))...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var encs []string
+	for _, e := range r.Encodings {
+		encs = append(encs, e.Encoding)
+	}
+	assert.Equal(t, []string{"zstd", "br", "gzip", "deflate"}, encs)
+	gzip := r.Encodings[2]
+	assert.Equal(t, -200, gzip.Priority)
+	if assert.NotNil(t, gzip.Level) {
+		assert.Equal(t, 9, *gzip.Level)
+	}
+	assert.Equal(t, "*gzip.compressor", gzip.Provider)
+	assert.Equal(t, []EncodingReport{{Encoding: "dcz", Priority: -50}, {Encoding: "dcb", Priority: -100}}, r.DictionaryEncodings)
+	assert.Equal(t, DefaultMinSize, r.MinSize)
+	assert.Equal(t, []string{"text/html; charset=utf-8"}, r.ExcludedContentTypes)
+	assert.Empty(t, r.ContentTypes)
+	assert.Equal(t, "client", r.Prefer)
+
+	_, err = json.Marshal(r)
+	assert.NoError(t, err)
+
+	r, err = Describe(GzipCompressor(&countingProvider{}))
+	if assert.NoError(t, err) && assert.Len(t, r.Encodings, 1) {
+		assert.Nil(t, r.Encodings[0].Level)
+	}
+
+	_, err = Describe(MinSize(-1))
+	assert.Error(t, err)
+}
+
+func TestListCompressors(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mw, err := Adapter(GzipCompressionLevel(5), BrotliCompressionLevel(3))
+	if !assert.NoError(t, err) {
+		return
+	}
+	encs, ok := ListCompressors(mw(handler))
+	if assert.True(t, ok) && assert.Len(t, encs, 2) {
+		assert.Equal(t, "br", encs[0].Encoding)
+		assert.Equal(t, "gzip", encs[1].Encoding)
+		assert.Equal(t, 5, *encs[1].Level)
+	}
+
+	mw, err = Adapter(GzipCompressionLevel(5), Route(MatchPathPrefix("/"), BrotliCompressionLevel(3)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	encs, ok = ListCompressors(mw(handler))
+	if assert.True(t, ok) && assert.Len(t, encs, 1) {
+		assert.Equal(t, "gzip", encs[0].Encoding)
+	}
+
+	m, err := NewMiddleware(GzipCompressionLevel(5))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := m.Wrap(handler)
+	assert.NoError(t, m.Reload(ZstandardCompressionLevel(3)))
+	encs, ok = ListCompressors(h)
+	if assert.True(t, ok) && assert.Len(t, encs, 1) {
+		assert.Equal(t, "zstd", encs[0].Encoding)
+	}
+	assert.Equal(t, encs, m.Compressors())
+
+	mw, _ = Adapter()
+	_, ok = ListCompressors(mw(handler))
+	assert.False(t, ok)
+}
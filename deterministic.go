@@ -0,0 +1,82 @@
+package httpcompression
+
+import "io"
+
+// deterministicBlockSize is the size of the writes to the compressors when
+// the Deterministic option is used.
+const deterministicBlockSize = 32 << 10
+
+// Deterministic is an option that makes the compressed responses depend
+// only on the uncompressed response body, the negotiated encoding and the
+// options of the middleware, e.g. for golden-file tests or to cache the
+// compressed variants by their content hash. Without it the compressed
+// output also depends on how the handler writes the response: flushes
+// (see http.Flusher) end the current compressed block, and some compressors
+// produce different output depending on the size of the writes.
+//
+// With Deterministic the body is passed to the compressors in fixed-size
+// blocks, and calls to Flush do not flush the compressors (so the data
+// written by streaming handlers is sent only when enough data to fill a
+// block has been written, or when the response ends).
+//
+// The compressors bundled in this module are deterministic for the same
+// settings (e.g. compression level) and the same version of the module
+// and of their dependencies: the gzip compressors write a header without
+// file name or modification time, and zstd, brotli and deflate do not
+// record any time or environment-dependent information; pgzip splits the
+// input in blocks of the configured size. The output is however not
+// guaranteed to be the same across versions of the compressors, so golden
+// files may have to be regenerated when the dependencies are updated.
+// Custom compressors must be deterministic themselves.
+func Deterministic() Option {
+	return func(c *config) error {
+		c.deterministic = true
+		return nil
+	}
+}
+
+// blockWriter passes the data written to it to the compressor w in blocks
+// of deterministicBlockSize bytes (see Deterministic). It does not
+// implement Flusher.
+type blockWriter struct {
+	w   io.WriteCloser
+	buf []byte
+}
+
+func newBlockWriter(w io.WriteCloser) *blockWriter {
+	return &blockWriter{w: w, buf: make([]byte, 0, deterministicBlockSize)}
+}
+
+func (w *blockWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	for len(b) > 0 {
+		m := copy(w.buf[len(w.buf):cap(w.buf)], b)
+		w.buf, b = w.buf[:len(w.buf)+m], b[m:]
+		if len(w.buf) == cap(w.buf) {
+			if err := w.writeBlock(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (w *blockWriter) writeBlock() error {
+	n, err := w.w.Write(w.buf)
+	if err == nil && n < len(w.buf) {
+		err = io.ErrShortWrite
+	}
+	w.buf = w.buf[:0]
+	return err
+}
+
+func (w *blockWriter) Close() error {
+	var err error
+	if len(w.buf) > 0 {
+		err = w.writeBlock()
+	}
+	if cerr := w.w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
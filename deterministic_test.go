@@ -0,0 +1,85 @@
+package httpcompression
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeterministic(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	body := []byte(strings.Repeat(testBody, 50))
+	serve := func(h http.Handler, enc string) []byte {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, enc)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, enc, res.Header().Get(contentEncoding))
+		return res.Body.Bytes()
+	}
+	// handler writes the body in random chunks, flushing after some of them.
+	handler := func(seed int64) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(contentType, "text/plain")
+			rnd := rand.New(rand.NewSource(seed))
+			for b := body; len(b) > 0; {
+				n := min(1+rnd.Intn(5000), len(b))
+				w.Write(b[:n])
+				b = b[n:]
+				if rnd.Intn(3) == 0 {
+					w.(http.Flusher).Flush()
+				}
+			}
+		})
+	}
+
+	det, err := DefaultAdapter(Deterministic())
+	if !assert.NoError(t, err) {
+		return
+	}
+	def, err := DefaultAdapter()
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, enc := range []string{"gzip", "deflate", "br", "zstd"} {
+		a, b := serve(det(handler(1)), enc), serve(det(handler(2)), enc)
+		assert.Equal(t, a, b, enc)
+		d, err := decodeBody(bytes.NewReader(a), enc)
+		assert.NoError(t, err, enc)
+		assert.Equal(t, body, d, enc)
+		assert.NotEqual(t, serve(def(handler(1)), enc), serve(def(handler(2)), enc), enc)
+	}
+}
+
+func TestBlockWriter(t *testing.T) {
+	t.Parallel()
+
+	var sizes []int
+	w := newBlockWriter(nopWriteCloser{writerFunc(func(b []byte) (int, error) {
+		sizes = append(sizes, len(b))
+		return len(b), nil
+	})})
+	for _, size := range []int{10, deterministicBlockSize, 2 * deterministicBlockSize, 5} {
+		n, err := w.Write(make([]byte, size))
+		assert.NoError(t, err)
+		assert.Equal(t, size, n)
+	}
+	assert.NoError(t, w.Close())
+	assert.Equal(t, []int{deterministicBlockSize, deterministicBlockSize, deterministicBlockSize, 15}, sizes)
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) { return f(b) }
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
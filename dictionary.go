@@ -0,0 +1,346 @@
+package httpcompression
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	availableDictionary = "Available-Dictionary"
+	dictionaryID        = "Dictionary-ID"
+)
+
+const (
+	// DictionaryBrotliEncoding is the Content-Encoding of responses compressed
+	// with brotli using a shared dictionary (Compression Dictionary Transport).
+	DictionaryBrotliEncoding = "dcb"
+	// DictionaryZstandardEncoding is the Content-Encoding of responses
+	// compressed with zstd using a shared dictionary (Compression Dictionary
+	// Transport).
+	DictionaryZstandardEncoding = "dcz"
+)
+
+// Headers of the dcb and dcz streams: a magic number followed by the SHA-256
+// hash of the dictionary.
+var (
+	dcbMagic = []byte{0xff, 0x44, 0x43, 0x42}
+	dczMagic = []byte{0x5e, 0x2a, 0x4d, 0x18, 0x20, 0x00, 0x00, 0x00}
+)
+
+// Dictionary is a shared compression dictionary, used to compress responses
+// for clients that advertise it in the Available-Dictionary header, as
+// specified by the Compression Dictionary Transport (RFC 9842).
+type Dictionary struct {
+	data []byte
+	hash [sha256.Size]byte
+	id   string
+}
+
+// NewDictionary returns a dictionary with the specified content. id is the
+// optional identifier sent by clients in the Dictionary-ID header: if it is
+// not empty, the dictionary is used only for requests with the same
+// Dictionary-ID. data must not be modified after calling NewDictionary.
+func NewDictionary(data []byte, id string) *Dictionary {
+	return &Dictionary{data: data, hash: sha256.Sum256(data), id: id}
+}
+
+// Data returns the content of the dictionary. It must not be modified.
+func (d *Dictionary) Data() []byte {
+	return d.data
+}
+
+// Hash returns the SHA-256 hash of the dictionary.
+func (d *Dictionary) Hash() [sha256.Size]byte {
+	return d.hash
+}
+
+// ID returns the identifier of the dictionary.
+func (d *Dictionary) ID() string {
+	return d.id
+}
+
+// DictionaryCompressorProvider returns a CompressorProvider that compresses
+// using dict as a raw shared dictionary. The returned CompressorProvider must
+// produce a plain (e.g. brotli or zstd) stream: the header of the dcb and dcz
+// encodings is added by the middleware.
+type DictionaryCompressorProvider func(dict []byte) (CompressorProvider, error)
+
+// DictionaryCompressor is an option that sets the DictionaryCompressorProvider
+// for a dictionary Content-Encoding: DictionaryBrotliEncoding ("dcb") or
+// DictionaryZstandardEncoding ("dcz"). If p is nil, it disables the specified
+// Content-Encoding. Priority is used, like in Compressor, to choose between
+// the dictionary encodings supported by the client. Responses are always
+// compressed with a dictionary encoding, if possible, instead of the other
+// encodings.
+func DictionaryCompressor(contentEncoding string, priority int, p DictionaryCompressorProvider) Option {
+	return named("DictionaryCompressor", func(c *config) error {
+		if contentEncoding != DictionaryBrotliEncoding && contentEncoding != DictionaryZstandardEncoding {
+			return fmt.Errorf("unsupported dictionary encoding: %q", contentEncoding)
+		}
+		d := c.dictionaries()
+		if p == nil {
+			delete(d.comps, contentEncoding)
+			return nil
+		}
+		d.comps[contentEncoding] = dictComp{p, priority}
+		return nil
+	})
+}
+
+// Dictionaries is an option that adds dictionaries that can be used to
+// compress the responses, if the client advertises them in the
+// Available-Dictionary request header, with one of the dictionary encodings
+// configured with DictionaryCompressor (DefaultAdapter configures "dcz" and
+// "dcb").
+// Responses may then vary on the Available-Dictionary header, so it is added
+// to their Vary header.
+func Dictionaries(dicts ...*Dictionary) Option {
+	return named("Dictionaries", func(c *config) error {
+		d := c.dictionaries()
+		for _, dict := range dicts {
+			if dict == nil || len(dict.data) == 0 {
+				return fmt.Errorf("dictionaries can not be empty")
+			}
+			d.dicts[dict.hash] = dict
+		}
+		return nil
+	})
+}
+
+// DictionarySelector is an option that restricts, for each request, the
+// dictionaries that can be used to compress the response: sel returns the
+// ID of the dictionary to use for the request (the ID passed to
+// NewDictionary or the hex-encoded SHA-256 hash of the dictionary), or false
+// if no dictionary must be used. The dictionary is still used only if the
+// client advertises it in the Available-Dictionary header.
+// This allows e.g. multi-tenant APIs to use tenant-specific dictionaries.
+func DictionarySelector(sel func(r *http.Request) (dictID string, ok bool)) Option {
+	return func(c *config) error {
+		c.dictionaries().selector = sel
+		return nil
+	}
+}
+
+type dictConfig struct {
+	dicts map[[sha256.Size]byte]*Dictionary
+	comps map[string]dictComp
+
+	use        func(r *http.Request) (DictionaryUse, bool) // see UseAsDictionary
+	maxUseSize int
+	registry   *DictionaryStore // dictionaries learned from the responses marked by use
+
+	stores []*DictionaryStore // see DictionariesFrom; includes registry
+
+	selector func(r *http.Request) (dictID string, ok bool) // see DictionarySelector
+
+	providers *sync.Map // map[dictProviderKey]CompressorProvider
+}
+
+type dictComp struct {
+	provider DictionaryCompressorProvider
+	priority int
+}
+
+type dictProviderKey struct {
+	enc  string
+	hash [sha256.Size]byte
+}
+
+// dictionaries returns the dictionary configuration, creating it if needed.
+func (c *config) dictionaries() *dictConfig {
+	if c.dict == nil {
+		c.dict = &dictConfig{
+			dicts:     map[[sha256.Size]byte]*Dictionary{},
+			comps:     map[string]dictComp{},
+			providers: &sync.Map{},
+		}
+	}
+	return c.dict
+}
+
+func (d *dictConfig) clone() *dictConfig {
+	if d == nil {
+		return nil
+	}
+	c := &dictConfig{
+		dicts:      make(map[[sha256.Size]byte]*Dictionary, len(d.dicts)),
+		comps:      make(map[string]dictComp, len(d.comps)),
+		use:        d.use,
+		maxUseSize: d.maxUseSize,
+		registry:   d.registry,
+		stores:     append([]*DictionaryStore(nil), d.stores...),
+		selector:   d.selector,
+		providers:  d.providers, // providers only depend on the encoding and the dictionary
+	}
+	for k, v := range d.dicts {
+		c.dicts[k] = v
+	}
+	for k, v := range d.comps {
+		c.comps[k] = v
+	}
+	return c
+}
+
+func (d *dictConfig) enabled() bool {
+	return d != nil && (len(d.dicts) > 0 || len(d.stores) > 0) && len(d.comps) > 0
+}
+
+// dictChoice is the dictionary encoding chosen for a response.
+type dictChoice struct {
+	enc      string
+	comp     CompressorProvider
+	cacheEnc string // the Encoding of the cache key of the response
+}
+
+// negotiate returns the dictionary encoding to use for the request, or nil
+// if no dictionary encoding can be used.
+func (d *dictConfig) negotiate(r *http.Request, accept codings) *dictChoice {
+	hash, ok := parseAvailableDictionary(r.Header.Get(availableDictionary))
+	if !ok {
+		return nil
+	}
+	dict := d.lookup(hash)
+	if dict == nil || (dict.id != "" && parseSFString(r.Header.Get(dictionaryID)) != dict.id) {
+		return nil
+	}
+	if d.selector != nil {
+		id, ok := d.selector(r)
+		if !ok || (id != dict.id && id != hex.EncodeToString(hash[:])) {
+			return nil
+		}
+	}
+	var (
+		common []string
+		comps  = comps{}
+	)
+	for enc, dc := range d.comps {
+		if accept[enc] > 0 {
+			common = append(common, enc)
+			comps[enc] = comp{priority: dc.priority}
+		}
+	}
+	if len(common) == 0 {
+		return nil
+	}
+	// The dictionary encodings are always preferred, so the server
+	// preference is used to choose among them.
+	enc := preferredEncoding(accept, comps, common, PreferServer)
+	p, err := d.provider(enc, dict)
+	if err != nil {
+		return nil
+	}
+	return &dictChoice{
+		enc:      enc,
+		comp:     p,
+		cacheEnc: enc + ":" + base64.StdEncoding.EncodeToString(hash[:]),
+	}
+}
+
+// lookup returns the dictionary with the specified hash, or nil.
+func (d *dictConfig) lookup(hash [sha256.Size]byte) *Dictionary {
+	if dict := d.dicts[hash]; dict != nil {
+		return dict
+	}
+	now := time.Now()
+	for _, s := range d.stores {
+		if dict := s.get(hash, now); dict != nil {
+			return dict
+		}
+	}
+	return nil
+}
+
+// provider returns the CompressorProvider for the encoding enc and the
+// dictionary dict, creating it on first use.
+func (d *dictConfig) provider(enc string, dict *Dictionary) (CompressorProvider, error) {
+	key := dictProviderKey{enc, dict.hash}
+	if p, ok := d.providers.Load(key); ok {
+		return p.(CompressorProvider), nil
+	}
+	p, err := d.comps[enc].provider(dict.data)
+	if err != nil {
+		return nil, err
+	}
+	magic := dczMagic
+	if enc == DictionaryBrotliEncoding {
+		magic = dcbMagic
+	}
+	header := append(append([]byte(nil), magic...), dict.hash[:]...)
+	v, _ := d.providers.LoadOrStore(key, &dictProvider{p, header})
+	return v.(CompressorProvider), nil
+}
+
+// dictProvider wraps a CompressorProvider, writing the header of the
+// dictionary encoding before the compressed stream.
+type dictProvider struct {
+	CompressorProvider
+	header []byte
+}
+
+func (p *dictProvider) Get(w io.Writer) io.WriteCloser {
+	return p.CompressorProvider.Get(&prefixWriter{w: w, prefix: p.header})
+}
+
+// prefixWriter writes prefix before the first write.
+type prefixWriter struct {
+	w      io.Writer
+	prefix []byte
+}
+
+func (w *prefixWriter) Write(b []byte) (int, error) {
+	if w.prefix != nil {
+		if _, err := w.w.Write(w.prefix); err != nil {
+			return 0, err
+		}
+		w.prefix = nil
+	}
+	return w.w.Write(b)
+}
+
+// parseAvailableDictionary parses the value of the Available-Dictionary
+// header, a structured field byte sequence containing a SHA-256 hash.
+func parseAvailableDictionary(v string) (hash [sha256.Size]byte, ok bool) {
+	v = strings.TrimSpace(v)
+	if len(v) < 2 || v[0] != ':' || v[len(v)-1] != ':' {
+		return hash, false
+	}
+	b, err := base64.StdEncoding.DecodeString(v[1 : len(v)-1])
+	if err != nil || len(b) != sha256.Size {
+		return hash, false
+	}
+	copy(hash[:], b)
+	return hash, true
+}
+
+// parseSFString parses a structured field string, returning the empty
+// string if v is not a valid string.
+func parseSFString(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return ""
+	}
+	var s strings.Builder
+	for i := 1; i < len(v)-1; i++ {
+		c := v[i]
+		switch {
+		case c == '\\':
+			i++
+			if i == len(v)-1 || (v[i] != '"' && v[i] != '\\') {
+				return ""
+			}
+			s.WriteByte(v[i])
+		case c == '"' || c < 0x20 || c > 0x7e:
+			return ""
+		default:
+			s.WriteByte(c)
+		}
+	}
+	return s.String()
+}
@@ -0,0 +1,224 @@
+package httpcompression
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DictionaryStore holds a set of dictionaries, identified by their SHA-256
+// hash, that can be used to compress responses (see DictionariesFrom).
+// Dictionaries can be added, rotated and removed while the middleware is
+// serving requests, so that new dictionaries can be rolled out without
+// restarts. A DictionaryStore is safe for concurrent use.
+type DictionaryStore struct {
+	maxBytes int64 // 0 means unbounded
+
+	mu      sync.Mutex
+	bytes   int64
+	entries map[[sha256.Size]byte]*list.Element
+	order   *list.List // of *storedDict, least recently added first
+	current *Dictionary
+	caches  []*sync.Map // providers of the configurations using the store, to forget the providers of removed dictionaries
+}
+
+type storedDict struct {
+	dict    *Dictionary
+	expires time.Time // zero means never
+}
+
+// NewDictionaryStore returns an empty DictionaryStore.
+func NewDictionaryStore() *DictionaryStore {
+	return newDictionaryStore(0)
+}
+
+// newDictionaryStore returns an empty DictionaryStore that forgets the oldest
+// dictionaries when their total size exceeds maxBytes (if not 0).
+func newDictionaryStore(maxBytes int64) *DictionaryStore {
+	return &DictionaryStore{
+		maxBytes: maxBytes,
+		entries:  map[[sha256.Size]byte]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// Add adds d to the store. If ttl is positive, d is removed from the store
+// after ttl. If the store already holds a dictionary with the same content,
+// only its expiration is updated.
+func (s *DictionaryStore) Add(d *Dictionary, ttl time.Duration) {
+	s.add(d, expiration(ttl, time.Now()))
+}
+
+// Rotate adds d to the store, as Add, and makes it the current dictionary:
+// the other dictionaries in the store are removed after grace (unless they
+// expire earlier), so that clients have time to fetch d.
+func (s *DictionaryStore) Rotate(d *Dictionary, ttl, grace time.Duration) {
+	now := time.Now()
+	s.add(d, expiration(ttl, now))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = d
+	expires := now.Add(grace)
+	for e := s.order.Front(); e != nil; e = e.Next() {
+		sd := e.Value.(*storedDict)
+		if sd.dict.hash != d.hash && (sd.expires.IsZero() || sd.expires.After(expires)) {
+			sd.expires = expires
+		}
+	}
+}
+
+// Current returns the last dictionary passed to Rotate, if it is still in the
+// store, or nil.
+func (s *DictionaryStore) Current() *Dictionary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil || s.lookup(s.current.hash, time.Now()) == nil {
+		return nil
+	}
+	return s.current
+}
+
+// Get returns the dictionary with the specified SHA-256 hash, or nil if the
+// store does not hold it.
+func (s *DictionaryStore) Get(hash [sha256.Size]byte) *Dictionary {
+	return s.get(hash, time.Now())
+}
+
+// Remove removes the dictionary with the specified SHA-256 hash from the
+// store.
+func (s *DictionaryStore) Remove(hash [sha256.Size]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[hash]; ok {
+		s.remove(e)
+	}
+}
+
+// Dictionaries returns the dictionaries in the store, least recently added
+// first.
+func (s *DictionaryStore) Dictionaries() []*Dictionary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var dicts []*Dictionary
+	for e := s.order.Front(); e != nil; {
+		next := e.Next()
+		if sd := e.Value.(*storedDict); sd.expired(now) {
+			s.remove(e)
+		} else {
+			dicts = append(dicts, sd.dict)
+		}
+		e = next
+	}
+	return dicts
+}
+
+func (s *DictionaryStore) add(d *Dictionary, expires time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[d.hash]; ok {
+		// Same content: just update its lifetime.
+		e.Value.(*storedDict).expires = expires
+		s.order.MoveToBack(e)
+		return
+	}
+	s.entries[d.hash] = s.order.PushBack(&storedDict{d, expires})
+	s.bytes += int64(len(d.data))
+	for s.maxBytes > 0 && s.bytes > s.maxBytes {
+		s.remove(s.order.Front())
+	}
+}
+
+func (s *DictionaryStore) get(hash [sha256.Size]byte, now time.Time) *Dictionary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lookup(hash, now)
+}
+
+// lookup is like get, but s.mu must be held.
+func (s *DictionaryStore) lookup(hash [sha256.Size]byte, now time.Time) *Dictionary {
+	e, ok := s.entries[hash]
+	if !ok {
+		return nil
+	}
+	sd := e.Value.(*storedDict)
+	if sd.expired(now) {
+		s.remove(e)
+		return nil
+	}
+	return sd.dict
+}
+
+func (s *DictionaryStore) remove(e *list.Element) {
+	sd := s.order.Remove(e).(*storedDict)
+	delete(s.entries, sd.dict.hash)
+	s.bytes -= int64(len(sd.dict.data))
+	if s.current == sd.dict {
+		s.current = nil
+	}
+	for _, c := range s.caches {
+		for _, enc := range []string{DictionaryBrotliEncoding, DictionaryZstandardEncoding} {
+			c.Delete(dictProviderKey{enc, sd.dict.hash})
+		}
+	}
+}
+
+// register makes the store forget the providers in cache of the dictionaries
+// it removes.
+func (s *DictionaryStore) register(cache *sync.Map) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.caches {
+		if c == cache {
+			return
+		}
+	}
+	s.caches = append(s.caches, cache)
+}
+
+// unregister is the reverse of register, for the caches that are no longer
+// used (see Middleware).
+func (s *DictionaryStore) unregister(cache *sync.Map) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.caches {
+		if c == cache {
+			s.caches = append(s.caches[:i], s.caches[i+1:]...)
+			return
+		}
+	}
+}
+
+func (sd *storedDict) expired(now time.Time) bool {
+	return !sd.expires.IsZero() && now.After(sd.expires)
+}
+
+func expiration(ttl time.Duration, now time.Time) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+// DictionariesFrom is an option that adds the dictionaries held by s to the
+// dictionaries that can be used to compress the responses (see
+// Dictionaries). The store is consulted for each request, so changes to it
+// take effect immediately.
+func DictionariesFrom(s *DictionaryStore) Option {
+	return named("DictionariesFrom", func(c *config) error {
+		if s == nil {
+			return fmt.Errorf("dictionary store can not be nil")
+		}
+		c.dictionaries().addStore(s)
+		return nil
+	})
+}
+
+// addStore adds s to the stores consulted by d.
+func (d *dictConfig) addStore(s *DictionaryStore) {
+	s.register(d.providers)
+	d.stores = append(d.stores, s)
+}
@@ -0,0 +1,442 @@
+package httpcompression
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CAFxX/httpcompression/contrib/andybalholm/brotli"
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/stretchr/testify/assert"
+
+	kpzstd "github.com/klauspost/compress/zstd"
+)
+
+func availableDictionaryHeader(d *Dictionary) string {
+	h := d.Hash()
+	return ":" + base64.StdEncoding.EncodeToString(h[:]) + ":"
+}
+
+func decodeDCZ(t *testing.T, b []byte, dict []byte) string {
+	t.Helper()
+	hash := sha256.Sum256(dict)
+	if !assert.True(t, bytes.HasPrefix(b, append(append([]byte(nil), dczMagic...), hash[:]...))) {
+		return ""
+	}
+	zr, err := kpzstd.NewReader(bytes.NewReader(b[len(dczMagic)+sha256.Size:]), kpzstd.WithDecoderDictRaw(0, dict))
+	if !assert.Nil(t, err) {
+		return ""
+	}
+	defer zr.Close()
+	d, err := io.ReadAll(zr)
+	assert.Nil(t, err)
+	return string(d)
+}
+
+func TestDictionaries(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	dict := NewDictionary([]byte(testBody), "")
+	idDict := NewDictionary([]byte(strings.ToUpper(testBody)), "v1")
+	mw, err := DefaultAdapter(Dictionaries(dict, idDict))
+	assert.Nil(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		io.WriteString(w, strings.Replace(testBody, "aaa", "xyz", 1))
+	}))
+
+	cases := []struct {
+		name      string
+		accept    string
+		available string
+		id        string
+		enc       string
+	}{
+		{"dictionary", "gzip, br, zstd, dcz", availableDictionaryHeader(dict), "", "dcz"},
+		{"dictionary with id", "gzip, br, dcz", availableDictionaryHeader(idDict), `"v1"`, "dcz"},
+		{"only dcz", "dcz", availableDictionaryHeader(dict), "", "dcz"},
+		{"dcz not accepted", "gzip, br", availableDictionaryHeader(dict), "", "br"},
+		{"dcb", "gzip, dcb", availableDictionaryHeader(dict), "", "dcb"},
+		{"unknown dictionary", "gzip, dcz", ":" + base64.StdEncoding.EncodeToString(make([]byte, 32)) + ":", "", "gzip"},
+		{"invalid header", "gzip, dcz", "abc", "", "gzip"},
+		{"id mismatch", "gzip, dcz", availableDictionaryHeader(idDict), `"v2"`, "gzip"},
+		{"missing id", "gzip, dcz", availableDictionaryHeader(idDict), "", "gzip"},
+		{"no dictionary", "dcz", "", "", ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, c.accept)
+		if c.available != "" {
+			req.Header.Set(availableDictionary, c.available)
+		}
+		if c.id != "" {
+			req.Header.Set(dictionaryID, c.id)
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, c.enc, res.Header().Get(contentEncoding), c.name)
+		assert.Equal(t, []string{acceptEncoding, availableDictionary}, res.Header().Values(vary), c.name)
+		if c.enc == "dcz" {
+			d := dict
+			if c.id != "" {
+				d = idDict
+			}
+			assert.Equal(t, strings.Replace(testBody, "aaa", "xyz", 1), decodeDCZ(t, res.Body.Bytes(), d.Data()), c.name)
+		}
+	}
+}
+
+func TestDictionaryCompressorInvalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := Adapter(DictionaryCompressor("zstd", 0, zstdDictionaryCompressor))
+	assert.NotNil(t, err)
+	_, err = Adapter(Dictionaries(NewDictionary(nil, "")))
+	assert.NotNil(t, err)
+}
+
+func TestParseAvailableDictionary(t *testing.T) {
+	t.Parallel()
+
+	hash := sha256.Sum256([]byte("dictionary"))
+	enc := base64.StdEncoding.EncodeToString(hash[:])
+	cases := []struct {
+		value string
+		ok    bool
+	}{
+		{":" + enc + ":", true},
+		{" :" + enc + ": ", true},
+		{enc, false},
+		{":" + enc, false},
+		{":" + enc[:20] + ":", false},
+		{":!" + enc[1:] + ":", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		h, ok := parseAvailableDictionary(c.value)
+		assert.Equal(t, c.ok, ok, c.value)
+		if c.ok {
+			assert.Equal(t, hash, h, c.value)
+		}
+	}
+}
+
+func TestParseSFString(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		`"abc"`:      "abc",
+		` "a b" `:    "a b",
+		`"a\"b\\c"`:  `a"b\c`,
+		`"a\b"`:      "",
+		`abc`:        "",
+		`"abc`:       "",
+		`"a"b"`:      "",
+		"\"a\x01b\"": "",
+	}
+	for v, want := range cases {
+		assert.Equal(t, want, parseSFString(v), v)
+	}
+}
+
+func TestUseAsDictionary(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	use := func(r *http.Request) (DictionaryUse, bool) {
+		if !strings.HasSuffix(r.URL.Path, ".js") {
+			return DictionaryUse{}, false
+		}
+		return DictionaryUse{Match: "/app.*.js", MatchDest: []string{"script"}, ID: "app", TTL: time.Hour}, true
+	}
+	mw, err := DefaultAdapter(UseAsDictionary(use, 1<<20, 1<<20))
+	assert.Nil(t, err)
+	bodies := map[string]string{
+		"/app.v1.js":  testBody,
+		"/app.v2.js":  strings.Replace(testBody, "aaa", "xyz", 1),
+		"/missing.js": testBody + "missing",
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Header().Set(contentType, "text/javascript")
+		io.WriteString(w, body)
+	}))
+	get := func(path string, dict []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(acceptEncoding, "gzip, br, dcz")
+		if dict != nil {
+			req.Header.Set(availableDictionary, availableDictionaryHeader(NewDictionary(dict, "")))
+			req.Header.Set(dictionaryID, `"app"`)
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	res := get("/app.v1.js", nil)
+	assert.Equal(t, "br", res.Header().Get(contentEncoding))
+	assert.Equal(t, `match="/app.*.js", match-dest=("script"), id="app", ttl=3600`, res.Header().Get(useAsDictionary))
+
+	res = get("/app.v2.js", []byte(testBody))
+	assert.Equal(t, "dcz", res.Header().Get(contentEncoding))
+	assert.Equal(t, bodies["/app.v2.js"], decodeDCZ(t, res.Body.Bytes(), []byte(testBody)))
+	assert.NotEmpty(t, res.Header().Get(useAsDictionary))
+
+	// Responses with other statuses are not used as dictionaries.
+	res = get("/other.js", nil)
+	assert.Empty(t, res.Header().Get(useAsDictionary))
+	res = get("/app.v2.js", []byte(""))
+	assert.Equal(t, "br", res.Header().Get(contentEncoding))
+
+	// Nor are responses that are not marked as dictionaries.
+	res = get("/page.html", nil)
+	assert.Empty(t, res.Header().Get(useAsDictionary))
+}
+
+func TestUseAsDictionaryLimits(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	use := func(r *http.Request) (DictionaryUse, bool) {
+		return DictionaryUse{Match: "/*"}, true
+	}
+	mw, err := DefaultAdapter(UseAsDictionary(use, 2000, 2500))
+	assert.Nil(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Query().Get("body"))
+	}))
+	get := func(body string, dict string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/?body="+body, nil)
+		req.Header.Set(acceptEncoding, "gzip, dcz")
+		if dict != "" {
+			req.Header.Set(availableDictionary, availableDictionaryHeader(NewDictionary([]byte(dict), "")))
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	a, b, large := strings.Repeat("a", 1500), strings.Repeat("b", 1500), strings.Repeat("c", 2500)
+	assert.NotEmpty(t, get(a, "").Header().Get(useAsDictionary))
+	assert.Empty(t, get(large, "").Header().Get(useAsDictionary))
+	assert.Equal(t, "dcz", get(a, a).Header().Get(contentEncoding))
+	assert.Equal(t, "gzip", get(a, large).Header().Get(contentEncoding))
+
+	// Registering b evicts a.
+	get(b, "")
+	d := strings.Repeat("d", 300)
+	assert.Equal(t, "gzip", get(d, a).Header().Get(contentEncoding))
+	assert.Equal(t, "dcz", get(d, b).Header().Get(contentEncoding))
+}
+
+func TestDictionaryUseString(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, `match="/*"`, DictionaryUse{Match: "/*"}.String())
+	assert.Equal(t, `match="/a\"b", match-dest=("document" "frame"), id="x\\y", ttl=60`,
+		DictionaryUse{Match: `/a"b`, MatchDest: []string{"document", "frame"}, ID: `x\y`, TTL: time.Minute}.String())
+}
+
+func TestZstandardDictionaryCompressor(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	var samples [][]byte
+	for i := 0; i < 200; i++ {
+		samples = append(samples, []byte(fmt.Sprintf(`{"id":%d,"name":"user %d","email":"user%d@example.com"}`, i, i, i)))
+	}
+	dict, err := zstd.Train(samples, 2048, 42)
+	assert.Nil(t, err)
+	mw, err := DefaultAdapter(ZstandardDictionaryCompressor(dict, "application/json"), MinSize(0))
+	assert.Nil(t, err)
+
+	body := `{"id":1000,"name":"user 1000","email":"user1000@example.com"}`
+	for _, c := range []struct {
+		ct, accept, enc string
+	}{
+		{"application/json", "gzip, zstd, z_0000002a", "z_0000002a"},
+		{"application/json", "gzip, zstd", "zstd"},
+		{"text/plain", "gzip, zstd, z_0000002a", "zstd"},
+		{"text/plain", "z_0000002a", ""},
+	} {
+		h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(contentType, c.ct)
+			io.WriteString(w, body)
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, c.accept)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, c.enc, res.Header().Get(contentEncoding), c.ct+" "+c.accept)
+		if c.enc == "z_0000002a" {
+			zr, err := kpzstd.NewReader(res.Body, kpzstd.WithDecoderDicts(dict))
+			assert.Nil(t, err)
+			b, err := io.ReadAll(zr)
+			assert.Nil(t, err)
+			assert.Equal(t, body, string(b))
+		}
+	}
+
+	_, err = Adapter(ZstandardDictionaryCompressor([]byte("invalid")))
+	assert.NotNil(t, err)
+}
+
+func TestDictionaryBrotli(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	dict := NewDictionary([]byte(testBody), "")
+	mw, err := DefaultAdapter(Dictionaries(dict))
+	assert.Nil(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Replace(testBody, "aaa", "xyz", 1))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, "gzip, br, dcb")
+	req.Header.Set(availableDictionary, availableDictionaryHeader(dict))
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	assert.Equal(t, "dcb", res.Header().Get(contentEncoding))
+	hash := dict.Hash()
+	assert.True(t, bytes.HasPrefix(res.Body.Bytes(), append(append([]byte(nil), dcbMagic...), hash[:]...)))
+	assert.Less(t, res.Body.Len(), 100)
+}
+
+func TestBrotliDictionaryCompressor(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	dict := []byte(`{"id":1,"name":"user 1","email":"user1@example.com"}`)
+	mw, err := DefaultAdapter(BrotliDictionaryCompressor(dict, 5, "application/json"), MinSize(0))
+	assert.Nil(t, err)
+	enc := brotli.DictionaryEncoding(dict)
+	for _, c := range []struct {
+		ct, accept, enc string
+	}{
+		{"application/json", "gzip, br, " + enc, enc},
+		{"application/json", "gzip, br", "br"},
+		{"text/plain", "gzip, br, " + enc, "br"},
+	} {
+		h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(contentType, c.ct)
+			io.WriteString(w, `{"id":2,"name":"user 2","email":"user2@example.com"}`)
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, c.accept)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, c.enc, res.Header().Get(contentEncoding), c.ct+" "+c.accept)
+	}
+
+	_, err = Adapter(BrotliDictionaryCompressor(nil, 5))
+	assert.NotNil(t, err)
+}
+
+func TestDictionaryStore(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	v1 := NewDictionary([]byte(testBody), "")
+	v2 := NewDictionary([]byte(strings.Replace(testBody, "aaa", "xyz", 1)), "")
+	store := NewDictionaryStore()
+	mw, err := DefaultAdapter(DictionariesFrom(store))
+	assert.Nil(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testBody)
+	}))
+	get := func(dict *Dictionary) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip, dcz")
+		req.Header.Set(availableDictionary, availableDictionaryHeader(dict))
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Contains(t, res.Header().Values(vary), availableDictionary)
+		return res.Header().Get(contentEncoding)
+	}
+
+	assert.Equal(t, "gzip", get(v1))
+	store.Add(v1, 0)
+	assert.Equal(t, "dcz", get(v1))
+	assert.Nil(t, store.Current())
+
+	// After the rotation, v1 is still used until the end of the grace period.
+	store.Rotate(v2, 0, time.Hour)
+	assert.Equal(t, "dcz", get(v1))
+	assert.Equal(t, "dcz", get(v2))
+	assert.Equal(t, v2, store.Current())
+	assert.Equal(t, []*Dictionary{v1, v2}, store.Dictionaries())
+	store.Rotate(v1, 0, -time.Second)
+	assert.Equal(t, "gzip", get(v2))
+	assert.Equal(t, v1, store.Current())
+	assert.Equal(t, []*Dictionary{v1}, store.Dictionaries())
+
+	store.Remove(v1.Hash())
+	assert.Equal(t, "gzip", get(v1))
+	assert.Nil(t, store.Get(v1.Hash()))
+	assert.Nil(t, store.Current())
+
+	store.Add(v2, -time.Second) // no expiration
+	now := time.Now()
+	assert.Equal(t, v2, store.get(v2.Hash(), now.Add(365*24*time.Hour)))
+	store.add(v2, now.Add(time.Minute))
+	assert.Equal(t, v2, store.get(v2.Hash(), now))
+	assert.Nil(t, store.get(v2.Hash(), now.Add(2*time.Minute)))
+
+	_, err = Adapter(DictionariesFrom(nil))
+	assert.NotNil(t, err)
+}
+
+func TestDictionarySelector(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	acme := NewDictionary([]byte(testBody), "acme")
+	other := NewDictionary([]byte(strings.Replace(testBody, "aaa", "xyz", 1)), "")
+	otherHash := other.Hash()
+	sel := func(r *http.Request) (string, bool) {
+		switch r.Header.Get("X-Tenant") {
+		case "acme":
+			return "acme", true
+		case "other":
+			return hex.EncodeToString(otherHash[:]), true
+		}
+		return "", false
+	}
+	mw, err := DefaultAdapter(Dictionaries(acme, other), DictionarySelector(sel))
+	assert.Nil(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, testBody)
+	}))
+	for _, c := range []struct {
+		tenant string
+		dict   *Dictionary
+		enc    string
+	}{
+		{"acme", acme, "dcz"},
+		{"acme", other, "gzip"},
+		{"other", other, "dcz"},
+		{"other", acme, "gzip"},
+		{"", acme, "gzip"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip, dcz")
+		req.Header.Set(availableDictionary, availableDictionaryHeader(c.dict))
+		req.Header.Set(dictionaryID, sfString(c.dict.ID()))
+		req.Header.Set("X-Tenant", c.tenant)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, c.enc, res.Header().Get(contentEncoding), c.tenant+" "+c.dict.ID())
+	}
+}
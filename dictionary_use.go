@@ -0,0 +1,180 @@
+package httpcompression
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const useAsDictionary = "Use-As-Dictionary"
+
+// defaultDictionaryTTL is the default lifetime of dictionaries, both for
+// clients and for the server.
+const defaultDictionaryTTL = 14 * 24 * time.Hour
+
+// DictionaryUse describes how clients can use a response as a dictionary: it
+// is sent to clients in the Use-As-Dictionary response header.
+type DictionaryUse struct {
+	// Match is the URL pattern (https://urlpattern.spec.whatwg.org/) of the
+	// requests for which clients can use the dictionary. It is required.
+	Match string
+	// MatchDest optionally restricts the requests for which clients can use
+	// the dictionary to the specified destinations (e.g. "script").
+	MatchDest []string
+	// ID is the optional identifier of the dictionary, that clients send
+	// back in the Dictionary-ID request header.
+	ID string
+	// TTL is how long clients (and the server) can use the dictionary. If
+	// zero, the default of 14 days is used.
+	TTL time.Duration
+}
+
+// String returns the value of the Use-As-Dictionary header for u.
+func (u DictionaryUse) String() string {
+	var b strings.Builder
+	b.WriteString("match=")
+	b.WriteString(sfString(u.Match))
+	if len(u.MatchDest) > 0 {
+		b.WriteString(", match-dest=(")
+		for i, d := range u.MatchDest {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(sfString(d))
+		}
+		b.WriteByte(')')
+	}
+	if u.ID != "" {
+		b.WriteString(", id=")
+		b.WriteString(sfString(u.ID))
+	}
+	if u.TTL > 0 {
+		b.WriteString(", ttl=")
+		b.WriteString(strconv.FormatInt(int64(u.TTL/time.Second), 10))
+	}
+	return b.String()
+}
+
+// UseAsDictionary is an option that marks responses as dictionaries, for the
+// Compression Dictionary Transport (see Dictionaries). For each request
+// accepting a dictionary encoding, use is called: if it returns true, the
+// Use-As-Dictionary header is added to the response and, once the response
+// has been sent, its (uncompressed) body is remembered as a dictionary, so
+// that following requests advertising it in the Available-Dictionary header
+// can be compressed with it.
+//
+// Only complete responses with status 200 and not larger than maxSize bytes
+// are used as dictionaries; when the total size of the remembered
+// dictionaries exceeds maxBytes the oldest ones are forgotten. Dictionaries
+// are also forgotten after their TTL.
+func UseAsDictionary(use func(r *http.Request) (DictionaryUse, bool), maxSize, maxBytes int) Option {
+	return named("UseAsDictionary", func(c *config) error {
+		if use == nil {
+			return fmt.Errorf("use-as-dictionary function can not be nil")
+		}
+		if maxSize <= 0 || maxBytes < maxSize {
+			return fmt.Errorf("invalid use-as-dictionary sizes: maxSize %d, maxBytes %d", maxSize, maxBytes)
+		}
+		d := c.dictionaries()
+		d.use = use
+		d.maxUseSize = maxSize
+		d.registry = newDictionaryStore(int64(maxBytes))
+		d.addStore(d.registry)
+		return nil
+	})
+}
+
+// dictRecorder records the body of a response marked as a dictionary.
+type dictRecorder struct {
+	registry *DictionaryStore
+	use      DictionaryUse
+	max      int
+	buf      []byte
+	ok       bool // the response can be used as a dictionary
+	full     bool // the body exceeded max
+}
+
+// newDictRecorder returns the recorder for the response to r, or nil if the
+// response is not a dictionary.
+func (d *dictConfig) newDictRecorder(r *http.Request, accept codings) *dictRecorder {
+	if d == nil || d.use == nil {
+		return nil
+	}
+	if !d.acceptsDictionaryEncoding(accept) {
+		return nil
+	}
+	use, ok := d.use(r)
+	if !ok || use.Match == "" {
+		return nil
+	}
+	return &dictRecorder{registry: d.registry, use: use, max: d.maxUseSize}
+}
+
+func (d *dictConfig) acceptsDictionaryEncoding(accept codings) bool {
+	for enc := range d.comps {
+		if accept[enc] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// header is called before the response header is written: it adds the
+// Use-As-Dictionary header if the response can be used as a dictionary.
+func (r *dictRecorder) header(code int, h http.Header) {
+	if (code != 0 && code != http.StatusOK) || h.Get(contentEncoding) != "" {
+		return
+	}
+	if cl, err := strconv.Atoi(h.Get(contentLength)); err == nil && cl > r.max {
+		return
+	}
+	if r.full {
+		return
+	}
+	r.ok = true
+	h.Set(useAsDictionary, r.use.String())
+}
+
+func (r *dictRecorder) write(b []byte) {
+	if r.full {
+		return
+	}
+	if len(r.buf)+len(b) > r.max {
+		r.full, r.buf = true, nil
+		return
+	}
+	r.buf = append(r.buf, b...)
+}
+
+// done registers the recorded body as a dictionary. err is the error
+// returned by the compressWriter.
+func (r *dictRecorder) done(err error) {
+	if !r.ok || r.full || err != nil || len(r.buf) == 0 {
+		return
+	}
+	ttl := r.use.TTL
+	if ttl <= 0 {
+		ttl = defaultDictionaryTTL
+	}
+	r.registry.Add(NewDictionary(r.buf, r.use.ID), ttl)
+}
+
+// sfString serializes s as a structured field string.
+func sfString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		if c < 0x20 || c > 0x7e {
+			continue // not allowed in structured field strings
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
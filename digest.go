@@ -0,0 +1,91 @@
+package httpcompression
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+const (
+	contentDigest = "Content-Digest"
+	reprDigest    = "Repr-Digest"
+	trailer       = "Trailer"
+)
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// ContentDigest is an option that adds to the compressed responses a
+// Content-Digest (RFC 9530) of their compressed content, computed with the
+// specified algorithms ("sha-256", the default, and "sha-512"), so that
+// the clients checking the integrity of the responses can still do it.
+//
+// The Content-Digest and Repr-Digest headers set by the handler are always
+// removed from the compressed responses, whether ContentDigest is used or
+// not, as they are invalidated by the compression. As the digest of a
+// compressed stream is known only at its end, it is sent as a trailer,
+// announced in the Trailer header; the digest of the responses served from
+// the VariantCache is sent as a header instead.
+func ContentDigest(algorithms ...string) Option {
+	if len(algorithms) == 0 {
+		algorithms = []string{"sha-256"}
+	}
+	for _, alg := range algorithms {
+		if _, ok := digestAlgorithms[alg]; !ok {
+			return errorOption("ContentDigest", fmt.Errorf("unsupported digest algorithm: %q", alg))
+		}
+	}
+	algorithms = append([]string(nil), algorithms...)
+	return func(c *config) error {
+		c.digests = algorithms
+		return nil
+	}
+}
+
+// digestWriter computes the Content-Digest of the data written to it, and
+// passes them to w.
+type digestWriter struct {
+	w      io.Writer
+	algs   []string
+	hashes []hash.Hash
+}
+
+func newDigestWriter(algs []string) *digestWriter {
+	d := &digestWriter{algs: algs}
+	for _, alg := range algs {
+		d.hashes = append(d.hashes, digestAlgorithms[alg]())
+	}
+	return d
+}
+
+func (d *digestWriter) Write(b []byte) (int, error) {
+	n, err := d.w.Write(b)
+	for _, h := range d.hashes {
+		h.Write(b[:n])
+	}
+	return n, err
+}
+
+// value returns the value of the Content-Digest header (a structured
+// dictionary of byte sequences).
+func (d *digestWriter) value() string {
+	var s []string
+	for i, h := range d.hashes {
+		s = append(s, d.algs[i]+"=:"+base64.StdEncoding.EncodeToString(h.Sum(nil))+":")
+	}
+	return strings.Join(s, ", ")
+}
+
+// digestValue returns the value of the Content-Digest header of b.
+func digestValue(algs []string, b []byte) string {
+	d := newDigestWriter(algs)
+	d.w = io.Discard
+	d.Write(b)
+	return d.value()
+}
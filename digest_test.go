@@ -0,0 +1,62 @@
+package httpcompression
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentDigest(t *testing.T) {
+	t.Parallel()
+
+	sum := sha256.Sum256([]byte(testBody))
+	uncompressed := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Header().Set(contentDigest, uncompressed)
+		w.Header().Set(reprDigest, uncompressed)
+		io.WriteString(w, testBody)
+	})
+	serve := func(opts ...Option) *http.Response {
+		a, err := DefaultAdapter(opts...)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		a(handler).ServeHTTP(res, req)
+		return res.Result()
+	}
+
+	// The digests of the uncompressed content are removed.
+	res := serve()
+	assert.Equal(t, "gzip", res.Header.Get(contentEncoding))
+	assert.Empty(t, res.Header.Get(contentDigest))
+	assert.Empty(t, res.Header.Get(reprDigest))
+	assert.Empty(t, res.Trailer)
+
+	// ...and the digest of the compressed content is sent as a trailer.
+	res = serve(ContentDigest("sha-256", "sha-512"))
+	assert.Equal(t, "gzip", res.Header.Get(contentEncoding))
+	assert.Equal(t, []string{contentDigest}, res.Header.Values(trailer))
+	body, _ := io.ReadAll(res.Body)
+	sum = sha256.Sum256(body)
+	sum512 := sha512.Sum512(body)
+	assert.Equal(t, "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":, sha-512=:"+base64.StdEncoding.EncodeToString(sum512[:])+":", res.Trailer.Get(contentDigest))
+
+	// The digests of the uncompressed responses are kept.
+	res = serve(ContentDigest(), MinSize(len(testBody)+1))
+	assert.Empty(t, res.Header.Get(contentEncoding))
+	assert.Equal(t, uncompressed, res.Header.Get(contentDigest))
+	assert.Empty(t, res.Trailer)
+
+	_, err := Adapter(ContentDigest("md5"))
+	assert.Error(t, err)
+}
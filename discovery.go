@@ -0,0 +1,84 @@
+package httpcompression
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Discovery describes the content-codings supported by a server, as served
+// at the path of the EncodingDiscovery option.
+type Discovery struct {
+	// RequestEncodings are the content-codings accepted for the bodies of
+	// the requests.
+	RequestEncodings []string `json:"requestEncodings"`
+	// ResponseEncodings are the content-codings used to compress the
+	// responses, by decreasing priority.
+	ResponseEncodings []string `json:"responseEncodings"`
+}
+
+// EncodingDiscovery is an option that advertises to the clients the
+// content-codings accepted for the bodies of their requests (e.g. by a
+// decompressing middleware in front of the handlers), so that they can
+// compress the requests with one of them (e.g. with Transport):
+//
+//   - the responses to the OPTIONS requests get an Accept-Encoding header
+//     listing requestEncodings, as specified by RFC 7694;
+//   - if path is not empty, the GET requests for path are answered by the
+//     middleware, without calling the handler, with a JSON Discovery listing
+//     both requestEncodings and the encodings used for the responses.
+//
+// If requestEncodings is empty, only "identity" is advertised, i.e. the
+// request bodies must not be compressed.
+func EncodingDiscovery(path string, requestEncodings ...string) Option {
+	return named("EncodingDiscovery", func(c *config) error {
+		if path != "" && !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("discovery path must start with /: %q", path)
+		}
+		accept := append([]string(nil), requestEncodings...)
+		if len(accept) == 0 {
+			accept = []string{identity}
+		}
+		c.discovery = &discoveryConfig{path: path, accept: accept}
+		return nil
+	})
+}
+
+type discoveryConfig struct {
+	path   string
+	accept []string
+}
+
+// discover advertises the request encodings for r, and it reports whether
+// it served the response to r itself (see EncodingDiscovery).
+func (c *config) discover(w http.ResponseWriter, r *http.Request) bool {
+	d := c.discovery
+	switch {
+	case r.Method == http.MethodOptions:
+		w.Header().Set(acceptEncoding, strings.Join(d.accept, ", "))
+		return false
+	case d.path == "" || r.URL.Path != d.path || (r.Method != http.MethodGet && r.Method != http.MethodHead):
+		return false
+	}
+	disc := Discovery{RequestEncodings: d.accept, ResponseEncodings: c.responseEncodings()}
+	b, err := json.Marshal(disc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return true
+	}
+	w.Header().Set(contentType, "application/json")
+	w.Header().Set(acceptEncoding, strings.Join(d.accept, ", "))
+	w.Write(append(b, '\n'))
+	return true
+}
+
+// responseEncodings returns the encodings used to compress the responses, by
+// decreasing priority.
+func (c *config) responseEncodings() []string {
+	encs := []string{}
+	for _, e := range c.report().Encodings {
+		encs = append(encs, e.Encoding)
+	}
+	return encs
+}
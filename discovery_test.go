@@ -0,0 +1,57 @@
+package httpcompression
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodingDiscovery(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	a, err := DefaultAdapter(EncodingDiscovery("/.well-known/encodings", "zstd", "gzip"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var called int
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called++
+		w.Header().Set("Allow", "GET, POST, OPTIONS")
+	}))
+
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest("OPTIONS", "/upload", nil))
+	assert.Equal(t, 1, called)
+	assert.Equal(t, "zstd, gzip", res.Header().Get(acceptEncoding))
+	assert.Equal(t, "GET, POST, OPTIONS", res.Header().Get("Allow"))
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest("GET", "/upload", nil))
+	assert.Equal(t, 2, called)
+	assert.Equal(t, "", res.Header().Get(acceptEncoding))
+
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, httptest.NewRequest("GET", "/.well-known/encodings", nil))
+	assert.Equal(t, 2, called)
+	assert.Equal(t, "application/json", res.Header().Get(contentType))
+	var d Discovery
+	if assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &d)) {
+		assert.Equal(t, []string{"zstd", "gzip"}, d.RequestEncodings)
+		assert.Equal(t, []string{"zstd", "br", "gzip", "deflate"}, d.ResponseEncodings)
+	}
+
+	a, err = DefaultAdapter(EncodingDiscovery(""))
+	if !assert.NoError(t, err) {
+		return
+	}
+	res = httptest.NewRecorder()
+	a(http.NotFoundHandler()).ServeHTTP(res, httptest.NewRequest("OPTIONS", "*", nil))
+	assert.Equal(t, "identity", res.Header().Get(acceptEncoding))
+
+	_, err = DefaultAdapter(EncodingDiscovery("encodings"))
+	assert.Error(t, err)
+}
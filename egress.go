@@ -0,0 +1,169 @@
+package httpcompression
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// egressInterval is the interval over which EgressMeter measures the
+// bandwidth.
+const egressInterval = time.Second
+
+// EgressPolicy is the policy of the EgressAware option.
+type EgressPolicy struct {
+	// Rate returns the current egress bandwidth, in bytes per second: a
+	// gauge fed by the network metrics of the host or of the load balancer,
+	// or the Rate of an EgressMeter.
+	Rate func() float64
+	// Threshold is the bandwidth, in bytes per second, above which the
+	// responses are compressed (or compressed with Levels).
+	Threshold float64
+	// Levels are the compression levels used above Threshold, by encoding,
+	// with the meaning of the *CompressionLevel options (e.g.
+	// BrotliCompressionLevel). If empty, the responses are not compressed
+	// at all below Threshold; otherwise they are compressed as usual below
+	// Threshold, and with Levels above it.
+	Levels map[string]int
+}
+
+// EgressAware is an option that adapts the compression of the responses to
+// the egress bandwidth, as measured by p.Rate: when the bandwidth is cheap
+// and plentiful (e.g. for a service whose traffic stays within the same
+// network) compressing the responses costs CPU time for little gain, while
+// above p.Threshold the bandwidth is worth saving. Without p.Levels the
+// responses are compressed only above p.Threshold; with p.Levels, above
+// p.Threshold the responses are compressed with the higher levels, as for
+// the internet-bound traffic the savings outweigh the CPU time.
+//
+// Like for LevelOverrides, p.Levels can only be set for gzip, deflate, br
+// and zstd, and their compressors are created the first time they are used;
+// the levels set for single responses with LevelOverrides take precedence.
+func EgressAware(p EgressPolicy) Option {
+	return named("EgressAware", func(c *config) error {
+		if p.Rate == nil {
+			return errors.New("egress rate function can not be nil")
+		}
+		if p.Threshold <= 0 || math.IsNaN(p.Threshold) {
+			return errors.New("egress threshold must be positive")
+		}
+		levels := make(map[string]int, len(p.Levels))
+		for enc, l := range p.Levels {
+			levels[enc] = l
+		}
+		c.egress = &egressConfig{rate: p.Rate, threshold: p.Threshold, levels: levels}
+		return nil
+	})
+}
+
+type egressConfig struct {
+	rate      func() float64
+	threshold float64
+	levels    map[string]int
+	levelProviders
+}
+
+// high reports whether the egress bandwidth is above the threshold.
+func (e *egressConfig) high() bool {
+	return e.rate() >= e.threshold
+}
+
+// gates reports whether the responses must not be compressed at all because
+// the egress bandwidth is below the threshold.
+func (e *egressConfig) gates() bool {
+	return len(e.levels) == 0 && !e.high()
+}
+
+// provider returns the provider of enc to be used for the current egress
+// bandwidth, and its level, if it is not the configured one.
+func (e *egressConfig) provider(enc string) (CompressorProvider, int, bool) {
+	level, ok := e.levels[enc]
+	if !ok || !e.high() {
+		return nil, 0, false
+	}
+	p := e.levelProviders.provider(enc, level)
+	return p, level, p != nil
+}
+
+// EgressMeter measures the egress bandwidth of the connections accepted by
+// the listeners wrapped by Listener, e.g. for EgressAware: a meter can be
+// shared by all the listeners of the process, or each listener can have
+// its own. An EgressMeter is safe for concurrent use.
+type EgressMeter struct {
+	bytes    atomic.Uint64
+	rate     atomic.Uint64 // float64 bits of the rate in the last interval
+	next     atomic.Int64  // UnixNano of the next update of rate
+	interval time.Duration
+
+	mu        sync.Mutex // serializes the updates of rate
+	last      time.Time
+	lastBytes uint64
+}
+
+// NewEgressMeter returns an EgressMeter.
+func NewEgressMeter() *EgressMeter {
+	now := time.Now()
+	m := &EgressMeter{interval: egressInterval, last: now}
+	m.next.Store(now.Add(m.interval).UnixNano())
+	return m
+}
+
+// Listener returns a listener whose connections count the bytes they write
+// in m (for TLS listeners, wrap the listener before tls.NewListener, so that
+// the bytes sent on the wire are counted).
+func (m *EgressMeter) Listener(l net.Listener) net.Listener {
+	return &egressListener{Listener: l, m: m}
+}
+
+// Rate returns the egress bandwidth, in bytes per second, measured over the
+// last second.
+func (m *EgressMeter) Rate() float64 {
+	now := time.Now()
+	if now.UnixNano() < m.next.Load() {
+		return math.Float64frombits(m.rate.Load())
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elapsed := now.Sub(m.last); elapsed >= m.interval {
+		bytes := m.bytes.Load()
+		m.rate.Store(math.Float64bits(float64(bytes-m.lastBytes) / elapsed.Seconds()))
+		m.last, m.lastBytes = now, bytes
+		m.next.Store(now.Add(m.interval).UnixNano())
+	}
+	return math.Float64frombits(m.rate.Load())
+}
+
+type egressListener struct {
+	net.Listener
+	m *EgressMeter
+}
+
+func (l *egressListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &egressConn{Conn: conn, m: l.m}, nil
+}
+
+type egressConn struct {
+	net.Conn
+	m *EgressMeter
+}
+
+func (c *egressConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.m.bytes.Add(uint64(n))
+	return n, err
+}
+
+// ReadFrom keeps the optimizations of the connection (e.g. sendfile).
+func (c *egressConn) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.Copy(c.Conn, r)
+	c.m.bytes.Add(uint64(n))
+	return n, err
+}
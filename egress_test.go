@@ -0,0 +1,145 @@
+package httpcompression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEgressAware(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat(testBody, 20)
+	var rate atomic.Int64
+	gauge := func() float64 { return float64(rate.Load()) }
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		io.WriteString(w, body)
+	})
+	serve := func(h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+	// The gzip streams record the extremes of the levels in their header.
+	gzipLevel := func(res *httptest.ResponseRecorder) byte {
+		assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+		zr, err := gzip.NewReader(bytes.NewReader(res.Body.Bytes()))
+		if assert.NoError(t, err) {
+			b, err := io.ReadAll(zr)
+			assert.NoError(t, err)
+			assert.Equal(t, body, string(b))
+		}
+		if res.Body.Len() < 10 {
+			return 0
+		}
+		return res.Body.Bytes()[8] // XFL: 2 for the best compression, 4 for the fastest
+	}
+
+	// Compressing only above the threshold.
+	a, err := DefaultAdapter(EgressAware(EgressPolicy{Rate: gauge, Threshold: 1000}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(handler)
+	res := serve(h, httptest.NewRequest("GET", "/", nil))
+	assert.Empty(t, res.Header().Get(contentEncoding))
+	assert.Equal(t, body, res.Body.String())
+	rate.Store(1000)
+	gzipLevel(serve(h, httptest.NewRequest("GET", "/", nil)))
+	rate.Store(10)
+	res = serve(h, httptest.NewRequest("GET", "/", nil))
+	assert.Empty(t, res.Header().Get(contentEncoding))
+
+	// Compressing with higher levels above the threshold.
+	a, err = DefaultAdapter(
+		GzipCompressionLevel(1),
+		LevelOverrides(""),
+		EgressAware(EgressPolicy{Rate: gauge, Threshold: 1000, Levels: map[string]int{"gzip": 9}}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	h = a(handler)
+	assert.Equal(t, byte(4), gzipLevel(serve(h, httptest.NewRequest("GET", "/", nil))))
+	rate.Store(2000)
+	assert.Equal(t, byte(2), gzipLevel(serve(h, httptest.NewRequest("GET", "/", nil))))
+
+	// The levels set with LevelOverrides take precedence.
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(WithCompressionLevel(context.Background(), "gzip", 1))
+	assert.Equal(t, byte(4), gzipLevel(serve(h, req)))
+
+	_, err = DefaultAdapter(EgressAware(EgressPolicy{Threshold: 1000}))
+	assert.Error(t, err)
+	_, err = DefaultAdapter(EgressAware(EgressPolicy{Rate: gauge}))
+	assert.Error(t, err)
+	_, err = DefaultAdapter(EgressAware(EgressPolicy{Rate: gauge, Threshold: math.NaN()}))
+	assert.Error(t, err)
+}
+
+func TestEgressMeter(t *testing.T) {
+	t.Parallel()
+
+	m := NewEgressMeter()
+	m.interval = 20 * time.Millisecond
+	m.next.Store(time.Now().Add(m.interval).UnixNano())
+
+	server, client := net.Pipe()
+	defer client.Close()
+	l := m.Listener(&pipeListener{conns: []net.Conn{server}})
+	conn, err := l.Accept()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	go io.Copy(io.Discard, client)
+
+	assert.Equal(t, float64(0), m.Rate())
+	_, err = conn.Write(make([]byte, 1000))
+	assert.NoError(t, err)
+	_, err = conn.(io.ReaderFrom).ReadFrom(bytes.NewReader(make([]byte, 1000)))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2000), m.bytes.Load())
+
+	// The rate is only updated once per interval.
+	assert.Equal(t, float64(0), m.Rate())
+	time.Sleep(2 * m.interval)
+	r := m.Rate()
+	assert.Greater(t, r, float64(0))
+	assert.LessOrEqual(t, r, 2000/(2*m.interval).Seconds())
+	assert.Equal(t, r, m.Rate())
+
+	time.Sleep(2 * m.interval)
+	assert.Equal(t, float64(0), m.Rate())
+
+	_, err = l.Accept()
+	assert.Error(t, err)
+}
+
+// pipeListener is a net.Listener accepting the connections in conns.
+type pipeListener struct {
+	net.Listener
+	conns []net.Conn
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	if len(l.conns) == 0 {
+		return nil, net.ErrClosed
+	}
+	conn := l.conns[0]
+	l.conns = l.conns[1:]
+	return conn, nil
+}
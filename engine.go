@@ -0,0 +1,138 @@
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+)
+
+// Engine is the compression engine of the middleware, for the servers and
+// frameworks that are not based on net/http (e.g. fasthttp, or serverless
+// platforms passing the responses as values), so that their adapters do
+// not need to reimplement it: the negotiation, the buffering up to MinSize,
+// the Content-Type filtering and the pooling work exactly as in the
+// middleware returned by Adapter with the same options, but each response
+// is written to an Output, i.e. an io.Writer and a callback receiving its
+// headers.
+type Engine struct {
+	c config
+	p *pools
+}
+
+// NewEngine returns an Engine configured like Adapter(opts...).
+func NewEngine(opts ...Option) (*Engine, error) {
+	c, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{c: c, p: &pools{}}, nil
+}
+
+// NewDefaultEngine returns an Engine configured like DefaultAdapter(opts...).
+func NewDefaultEngine(opts ...Option) (*Engine, error) {
+	return NewEngine(append(defaultOptions(), opts...)...)
+}
+
+// Output is the destination of a response started by Engine.Start.
+type Output struct {
+	// WriteHeader is called once, before the body is written (or when the
+	// response is closed, if it has no body), with the status code and the
+	// final headers of the response (e.g. including Content-Encoding).
+	WriteHeader func(status int, h http.Header)
+	// Body receives the body of the response, compressed if needed.
+	Body io.Writer
+	// Flush, if not nil, flushes the body (see http.Flusher).
+	Flush func() error
+}
+
+// EngineWriter is the http.ResponseWriter of a response started by
+// Engine.Start. It implements http.Flusher, and it must be closed once the
+// response is complete.
+type EngineWriter struct {
+	http.ResponseWriter
+	r   *http.Request
+	out *outputWriter
+	end func() error
+}
+
+// Start starts the response to r, whose headers and body must be written
+// to the returned EngineWriter, that writes them to out.
+func (e *Engine) Start(r *http.Request, out Output) *EngineWriter {
+	c := e.c.route(r)
+	ow := &outputWriter{out: out, h: http.Header{}}
+	w, r, end := c.start(ow, r, e.p)
+	return &EngineWriter{ResponseWriter: w, r: r, out: ow, end: end}
+}
+
+// Request returns the request of the response, as it would be passed by
+// the middleware to the handler (e.g. for EncodingFromRequest).
+func (w *EngineWriter) Request() *http.Request {
+	return w.r
+}
+
+// Flush implements http.Flusher.
+func (w *EngineWriter) Flush() {
+	_ = w.FlushError()
+}
+
+// FlushError is like Flush, but it returns the error of the compressor or of
+// Output.Flush, if any.
+func (w *EngineWriter) FlushError() error {
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the ResponseWriter of the middleware.
+func (w *EngineWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close completes the response, writing the data still buffered, and
+// returns the error of the compressor, if any. The EngineWriter must not be
+// used after it has been closed.
+func (w *EngineWriter) Close() error {
+	if w.end == nil {
+		return nil // already closed
+	}
+	err := w.end()
+	w.end = nil
+	w.out.start(http.StatusOK)
+	return err
+}
+
+// outputWriter is the http.ResponseWriter writing to an Output.
+type outputWriter struct {
+	out     Output
+	h       http.Header
+	started bool
+}
+
+func (w *outputWriter) start(status int) {
+	if !w.started {
+		w.started = true
+		if w.out.WriteHeader != nil {
+			w.out.WriteHeader(status, w.h)
+		}
+	}
+}
+
+func (w *outputWriter) Header() http.Header {
+	return w.h
+}
+
+func (w *outputWriter) WriteHeader(code int) {
+	if code >= http.StatusOK {
+		w.start(code)
+	}
+}
+
+func (w *outputWriter) Write(b []byte) (int, error) {
+	w.start(http.StatusOK)
+	return w.out.Body.Write(b)
+}
+
+func (w *outputWriter) FlushError() error {
+	w.start(http.StatusOK)
+	if w.out.Flush != nil {
+		return w.out.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package httpcompression
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngine(t *testing.T) {
+	t.Parallel()
+
+	e, err := NewDefaultEngine()
+	if !assert.NoError(t, err) {
+		return
+	}
+	serve := func(accept string, status int, body string) (int, http.Header, []byte) {
+		var (
+			code   int
+			header http.Header
+			buf    bytes.Buffer
+		)
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(acceptEncoding, accept)
+		w := e.Start(r, Output{
+			WriteHeader: func(status int, h http.Header) {
+				assert.Zero(t, code, "headers written twice")
+				code, header = status, h.Clone()
+			},
+			Body: &buf,
+		})
+		assert.Equal(t, accept, EncodingFromRequest(w.Request()))
+		w.Header().Set(contentType, "text/plain")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+		assert.NoError(t, w.Close())
+		assert.NoError(t, w.Close())
+		return code, header, buf.Bytes()
+	}
+
+	code, h, b := serve("gzip", http.StatusOK, testBody)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "gzip", h.Get(contentEncoding))
+	assert.Equal(t, acceptEncoding, h.Get(vary))
+	d, err := decodeGzip(bytes.NewReader(b))
+	assert.NoError(t, err)
+	assert.Equal(t, testBody, string(d))
+
+	code, h, b = serve("", http.StatusNotFound, testBody)
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Empty(t, h.Get(contentEncoding))
+	assert.Equal(t, testBody, string(b))
+
+	// The headers of responses without a body are written on Close.
+	code, h, b = serve("gzip", http.StatusNoContent, "")
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Empty(t, h.Get(contentEncoding))
+	assert.Empty(t, b)
+}
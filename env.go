@@ -0,0 +1,107 @@
+package httpcompression
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultEnvPrefix is the prefix of the environment variables read by
+// OptionsFromEnv if no prefix is specified.
+const DefaultEnvPrefix = "HTTPCOMPRESSION"
+
+// OptionsFromEnv returns the options configured by the environment variables
+// starting with prefix followed by an underscore (DefaultEnvPrefix if prefix
+// is empty), e.g. for deployments configured via Kubernetes ConfigMaps:
+//
+//   - <prefix>_MIN_SIZE: the minimum size of the responses to compress;
+//   - <prefix>_<ENCODING>_LEVEL: the compression level of the encoding (GZIP,
+//     DEFLATE, BR or ZSTD);
+//   - <prefix>_<ENCODING>_PRIORITY: the priority of the encoding;
+//   - <prefix>_DISABLED_ENCODINGS: a comma-separated list of encodings to
+//     disable;
+//   - <prefix>_CONTENT_TYPES: a comma-separated list of the only content
+//     types to compress;
+//   - <prefix>_EXCLUDED_CONTENT_TYPES: a comma-separated list of content
+//     types not to compress;
+//   - <prefix>_PREFER: "server" or "client".
+//
+// Variables that are not set (or are empty) leave the corresponding
+// settings unchanged, so the returned options are usually passed to
+// DefaultAdapter. An error will be returned if a variable is invalid.
+func OptionsFromEnv(prefix string) ([]Option, error) {
+	return optionsFromEnv(prefix, os.Getenv)
+}
+
+func optionsFromEnv(prefix string, getenv func(string) string) ([]Option, error) {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	env := func(name string) string {
+		return strings.TrimSpace(getenv(prefix + "_" + name))
+	}
+	intEnv := func(name string) (*int, error) {
+		v := env(name)
+		if v == "" {
+			return nil, nil
+		}
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s_%s: %w", prefix, name, err)
+		}
+		return &i, nil
+	}
+
+	var (
+		cfg Config
+		err error
+	)
+	if cfg.MinSize, err = intEnv("MIN_SIZE"); err != nil {
+		return nil, err
+	}
+	encs := make([]string, 0, len(levelOptions))
+	for enc := range levelOptions {
+		encs = append(encs, enc)
+	}
+	sort.Strings(encs)
+	for _, enc := range encs {
+		var ec EncodingConfig
+		if ec.Level, err = intEnv(strings.ToUpper(enc) + "_LEVEL"); err != nil {
+			return nil, err
+		}
+		if ec.Priority, err = intEnv(strings.ToUpper(enc) + "_PRIORITY"); err != nil {
+			return nil, err
+		}
+		if ec.Level != nil || ec.Priority != nil {
+			cfg.encoding(enc, ec)
+		}
+	}
+	for _, enc := range splitEnv(env("DISABLED_ENCODINGS")) {
+		cfg.encoding(strings.ToLower(enc), EncodingConfig{Disabled: true})
+	}
+	cfg.ContentTypes = splitEnv(env("CONTENT_TYPES"))
+	cfg.ExcludedContentTypes = splitEnv(env("EXCLUDED_CONTENT_TYPES"))
+	cfg.Prefer = strings.ToLower(env("PREFER"))
+	return FromConfig(cfg)
+}
+
+// encoding sets the configuration of the encoding enc.
+func (cfg *Config) encoding(enc string, ec EncodingConfig) {
+	if cfg.Encodings == nil {
+		cfg.Encodings = map[string]EncodingConfig{}
+	}
+	cfg.Encodings[enc] = ec
+}
+
+// splitEnv splits a comma-separated list, ignoring empty elements.
+func splitEnv(v string) []string {
+	var list []string
+	for _, e := range strings.Split(v, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
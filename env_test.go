@@ -0,0 +1,56 @@
+package httpcompression
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionsFromEnv(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	env := map[string]string{
+		"HTTPCOMPRESSION_MIN_SIZE":           "512",
+		"HTTPCOMPRESSION_GZIP_LEVEL":         "9",
+		"HTTPCOMPRESSION_ZSTD_PRIORITY":      " -10 ",
+		"HTTPCOMPRESSION_DISABLED_ENCODINGS": "BR, deflate,",
+		"HTTPCOMPRESSION_CONTENT_TYPES":      "text/html,application/json",
+		"HTTPCOMPRESSION_PREFER":             "Client",
+		"OTHER_MIN_SIZE":                     "1",
+	}
+	opts, err := optionsFromEnv("", func(k string) string { return env[k] })
+	if !assert.NoError(t, err) {
+		return
+	}
+	c, err := newConfig(append(defaultOptions(), opts...)...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 512, c.minSize)
+	assert.Equal(t, PreferClient, c.prefer)
+	assert.Len(t, c.contentTypes, 2)
+	assert.NotContains(t, c.compressor, "br")
+	assert.NotContains(t, c.compressor, "deflate")
+	assert.Equal(t, -10, c.compressor["zstd"].priority)
+	assert.Equal(t, -200, c.compressor["gzip"].priority)
+
+	opts, err = optionsFromEnv("OTHER", func(k string) string { return env[k] })
+	if !assert.NoError(t, err) {
+		return
+	}
+	c, err = newConfig(opts...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, c.minSize)
+
+	for _, bad := range []map[string]string{
+		{"HTTPCOMPRESSION_MIN_SIZE": "big"},
+		{"HTTPCOMPRESSION_BR_LEVEL": "1.5"},
+		{"HTTPCOMPRESSION_PREFER": "nobody"},
+	} {
+		_, err := optionsFromEnv("", func(k string) string { return bad[k] })
+		assert.Error(t, err, "%v", bad)
+	}
+}
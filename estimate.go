@@ -0,0 +1,77 @@
+package httpcompression
+
+import (
+	"io"
+	"sort"
+	"time"
+)
+
+// SizeEstimate is the compressed size of a payload with an encoding (see
+// EstimateSizes).
+type SizeEstimate struct {
+	// Encoding is the Content-Encoding.
+	Encoding string `json:"encoding"`
+	// Size is the size of the payload compressed with Encoding.
+	Size int64 `json:"size"`
+	// Ratio is the ratio between Size and the uncompressed size.
+	Ratio float64 `json:"ratio"`
+	// Duration is the time spent compressing the payload.
+	Duration time.Duration `json:"duration"`
+	// Compressed reports whether the middleware would compress a response
+	// with the payload with Encoding, i.e. whether the payload is not
+	// smaller than the minimum size of Encoding, and its Content-Type is
+	// compressed with Encoding (see ContentTypes, and the content types of
+	// ZstandardDictionaryCompressor).
+	Compressed bool `json:"compressed"`
+}
+
+// EstimateSizes compresses sample, a payload whose Content-Type is ct (if
+// empty, it is not used to filter the encodings), with each compressor of
+// the configuration resulting from opts (the options of Adapter), and
+// returns the resulting sizes, sorted by size, without standing up the
+// middleware, e.g. for capacity planning or to check the budget of a
+// response. The compressors are the ones used by the middleware, so the
+// sizes are exact, and they are obtained from their pools as for a
+// response. To estimate the sizes with the configuration of DefaultAdapter,
+// include its defaults with DefaultOptions.
+// An error will be returned if invalid options are given.
+func EstimateSizes(sample []byte, ct string, opts ...Option) ([]SizeEstimate, error) {
+	c, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	var estimates []SizeEstimate
+	for enc, cc := range c.compressor {
+		cw := &countingWriter{w: io.Discard}
+		start := time.Now()
+		w := cc.comp.Get(cw)
+		_, err := w.Write(sample)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+		e := SizeEstimate{
+			Encoding:   enc,
+			Size:       cw.n,
+			Duration:   time.Since(start),
+			Compressed: len(sample) >= c.encodingMinSize(enc),
+		}
+		if len(sample) > 0 {
+			e.Ratio = float64(cw.n) / float64(len(sample))
+		}
+		if ct != "" && e.Compressed {
+			e.Compressed = handleContentType(ct, c.contentTypes, c.blacklist) &&
+				(len(cc.contentTypes) == 0 || handleContentType(ct, cc.contentTypes, false))
+		}
+		estimates = append(estimates, e)
+	}
+	sort.Slice(estimates, func(i, j int) bool {
+		if estimates[i].Size != estimates[j].Size {
+			return estimates[i].Size < estimates[j].Size
+		}
+		return estimates[i].Encoding < estimates[j].Encoding
+	})
+	return estimates, nil
+}
@@ -0,0 +1,54 @@
+package httpcompression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateSizes(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	sample := []byte(testBody)
+	estimates, err := EstimateSizes(sample, "text/plain", append(DefaultOptions(), EncodingMinSize("br", len(sample)+1))...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	encs := map[string]SizeEstimate{}
+	for i, e := range estimates {
+		encs[e.Encoding] = e
+		if i > 0 {
+			assert.LessOrEqual(t, estimates[i-1].Size, e.Size)
+		}
+	}
+	for _, enc := range []string{"gzip", "deflate", "br", "zstd"} {
+		e, ok := encs[enc]
+		if !assert.True(t, ok, enc) {
+			continue
+		}
+		assert.Less(t, e.Size, int64(len(sample)), enc)
+		assert.InDelta(t, float64(e.Size)/float64(len(sample)), e.Ratio, 1e-9, enc)
+		assert.Equal(t, enc != "br", e.Compressed, enc)
+	}
+
+	// The sizes are the ones of the responses.
+	gz, err := NewDefaultGzipCompressor(gzip.DefaultCompression)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var buf bytes.Buffer
+	w := gz.Get(&buf)
+	w.Write(sample)
+	w.Close()
+	assert.EqualValues(t, buf.Len(), encs["gzip"].Size)
+
+	estimates, err = EstimateSizes(sample, "image/png", PresetStaticAssets(), GzipCompressionLevel(6))
+	if assert.NoError(t, err) {
+		for _, e := range estimates {
+			assert.False(t, e.Compressed, e.Encoding)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package httpcompression
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	ifNoneMatch = "If-None-Match"
+	ifMatch     = "If-Match"
+	ifRange     = "If-Range"
+)
+
+// EncodingETags is an option that gives the compressed responses their own
+// ETag, derived from the strong ETag set by the handler with EncodingETag, as
+// each encoding is a different representation of the content: without it,
+// the compressed and the uncompressed responses carry the same strong ETag,
+// that caches and range requests assume to identify the same bytes.
+//
+// The conditional requests keep working with the handlers that evaluate
+// them (e.g. with http.ServeContent or http.ServeFile): the encoding-specific
+// ETags in the If-None-Match and If-Match headers of the requests are
+// replaced with the ETags set by the handler, and the 304 Not Modified
+// responses of the handler get the ETag sent by the client, before any
+// compressor is allocated. The responses compressed with a dictionary (see
+// Dictionaries) get a weak ETag, as their content also depends on the
+// dictionary.
+//
+// Without EncodingETags the Range and If-Range headers of the If-Range
+// requests are removed when the response could be compressed, as a client
+// resuming a compressed response would get a range of the uncompressed one:
+// with it, they are passed to the handler, as the ETags of the compressed
+// responses never match the ones of the handler.
+func EncodingETags() Option {
+	return func(c *config) error {
+		c.etags = true
+		return nil
+	}
+}
+
+// EncodingETag returns the ETag of the representation of a content, whose
+// strong ETag is etag, compressed with contentEncoding, as used by the
+// EncodingETags option and by FileServer: e.g. `"abc"` becomes `"abc-br"` for
+// "br". The weak ETags, and the ETags of the uncompressed representation,
+// are returned as they are.
+func EncodingETag(etag, contentEncoding string) string {
+	if contentEncoding == "" || contentEncoding == identity || !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) || len(etag) < 2 {
+		return etag
+	}
+	return etag[:len(etag)-1] + "-" + contentEncoding + `"`
+}
+
+// encodingETag returns the ETag of the response compressed with enc, whose
+// ETag set by the handler is etag (see EncodingETags).
+func (w *compressWriter) encodingETag(etag, enc string) string {
+	tag := EncodingETag(etag, enc)
+	if tag != etag && w.dict != nil && enc == w.dict.enc {
+		tag = "W/" + tag
+	}
+	return tag
+}
+
+// handlerETags replaces the encoding-specific ETags in the conditional
+// headers of r with the ETags set by the handler (see EncodingETags). It
+// returns the request to be passed to the handler, and the ETags sent by
+// the client, by the opaque tag of the corresponding ETag of the handler.
+func (c *config) handlerETags(r *http.Request) (*http.Request, sentETags) {
+	if r.Header.Get(ifNoneMatch) == "" && r.Header.Get(ifMatch) == "" {
+		return r, nil
+	}
+	var (
+		header http.Header
+		sent   sentETags
+	)
+	for _, name := range []string{ifNoneMatch, ifMatch} {
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		var tags []string
+		changed := false
+		for _, v := range values {
+			for _, tag := range splitETags(v) {
+				weak, opaque := strings.HasPrefix(tag, "W/"), strings.TrimPrefix(tag, "W/")
+				if orig, ok := c.handlerETag(opaque); ok {
+					if sent == nil {
+						sent = sentETags{}
+					}
+					sent[orig] = tag
+					if weak {
+						orig = "W/" + orig
+					}
+					tag, changed = orig, true
+				}
+				tags = append(tags, tag)
+			}
+		}
+		if !changed {
+			continue
+		}
+		if header == nil {
+			header = r.Header.Clone()
+		}
+		header.Set(name, strings.Join(tags, ", "))
+	}
+	if header == nil {
+		return r, nil
+	}
+	r2 := *r
+	r2.Header = header
+	return &r2, sent
+}
+
+// handlerETag returns the ETag set by the handler, if opaque is the opaque
+// tag of the ETag of a compressed response (see EncodingETag).
+func (c *config) handlerETag(opaque string) (string, bool) {
+	if len(opaque) < 2 || !strings.HasSuffix(opaque, `"`) {
+		return "", false
+	}
+	i := strings.LastIndexByte(opaque, '-')
+	if i < 1 {
+		return "", false
+	}
+	enc := opaque[i+1 : len(opaque)-1]
+	if _, ok := c.compressor[enc]; ok {
+		return opaque[:i] + `"`, true
+	}
+	if c.dict != nil {
+		if _, ok := c.dict.comps[enc]; ok {
+			return opaque[:i] + `"`, true
+		}
+	}
+	return "", false
+}
+
+// restoreETag sets the ETag of a 304 Not Modified response to the ETag sent
+// by the client, if the handler matched it (see EncodingETags).
+func (w *compressWriter) restoreETag() {
+	if tag, ok := w.sent[strings.TrimPrefix(w.Header().Get(etag), "W/")]; ok {
+		w.Header().Set(etag, tag)
+	}
+}
+
+// sentETags are the encoding-specific ETags sent by the client in the
+// conditional headers, by the opaque tag of the corresponding ETag of the
+// handler.
+type sentETags map[string]string
+
+// splitETags splits the list of entity tags v (e.g. of an If-None-Match
+// header), whose opaque tags can contain commas.
+func splitETags(v string) []string {
+	var tags []string
+	for {
+		v = strings.TrimLeft(v, " \t,")
+		if v == "" {
+			return tags
+		}
+		start := 0
+		if strings.HasPrefix(v, "W/") {
+			start = 2
+		}
+		if !strings.HasPrefix(v[start:], `"`) {
+			// "*", or an invalid tag: kept as it is up to the next comma.
+			end := strings.IndexByte(v, ',')
+			if end < 0 {
+				end = len(v)
+			}
+			tags = append(tags, strings.TrimSpace(v[:end]))
+			v = v[end:]
+			continue
+		}
+		end := strings.IndexByte(v[start+1:], '"')
+		if end < 0 {
+			return append(tags, strings.TrimSpace(v))
+		}
+		end += start + 2
+		tags = append(tags, v[:end])
+		v = v[end:]
+	}
+}
@@ -0,0 +1,78 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodingETags(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	a, err := DefaultAdapter(EncodingETags())
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(etag, `"v1"`)
+		w.Header().Set(contentType, "text/plain")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(testBody))
+	}))
+	get := func(accept, tags string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, accept)
+		if tags != "" {
+			req.Header.Set(ifNoneMatch, tags)
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	res := get("gzip", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+	assert.Equal(t, `"v1-gzip"`, res.Header().Get(etag))
+	res = get("identity", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `"v1"`, res.Header().Get(etag))
+
+	// The conditional requests are evaluated by the handler.
+	for _, c := range []struct{ accept, tags string }{
+		{"gzip", `"v1-gzip"`},
+		{"gzip", `"v0", "v1-gzip"`},
+		{"gzip", `W/"v1-gzip"`},
+		{"br", `"v1-br"`},
+		{"identity", `"v1"`},
+	} {
+		res := get(c.accept, c.tags)
+		assert.Equal(t, http.StatusNotModified, res.Code, c.tags)
+		assert.Empty(t, res.Header().Get(contentEncoding), c.tags)
+		assert.Empty(t, res.Body.String(), c.tags)
+		tags := splitETags(c.tags)
+		assert.Equal(t, tags[len(tags)-1], res.Header().Get(etag), c.tags)
+	}
+	res = get("br", `"v1-gzip", "v0-br"`)
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Equal(t, `"v1-gzip"`, res.Header().Get(etag))
+	res = get("br", `"v0-br", "v1-zz"`)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `"v1-br"`, res.Header().Get(etag))
+}
+
+func TestEncodingETag(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, `"abc-br"`, EncodingETag(`"abc"`, "br"))
+	assert.Equal(t, `W/"abc"`, EncodingETag(`W/"abc"`, "br"))
+	assert.Equal(t, `"abc"`, EncodingETag(`"abc"`, ""))
+	assert.Equal(t, `"abc"`, EncodingETag(`"abc"`, identity))
+	assert.Equal(t, `abc`, EncodingETag(`abc`, "br"))
+
+	assert.Equal(t, []string{`"a,b"`, `W/"c"`, `*`, `"d"`}, splitETags(`"a,b", W/"c",*  ,"d"`))
+}
@@ -0,0 +1,148 @@
+package httpcompression
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+)
+
+// Experiment is an A/B experiment assigning deterministically the requests
+// to arms using different options (e.g. different encodings or levels), to
+// measure their impact on real traffic before changing the defaults.
+//
+// Each request is assigned to an arm by hashing the experiment name and the
+// key of the request (e.g. a user or session ID, see BucketByHeader and
+// BucketByCookie), so that the requests with the same key always get the
+// same arm, and the experiments with different names are independent. The
+// requests without a key are not part of the experiment, and they are
+// served with the options of the middleware.
+//
+// The WriterHooks of the middleware (e.g. the ones collecting metrics) can
+// tag the requests with their arm by calling Arm.
+type Experiment struct {
+	// Name identifies the experiment.
+	Name string
+	// Key returns the bucketing key of the request, or an empty string if
+	// the request is not part of the experiment.
+	Key func(r *http.Request) string
+	// Arms are the arms of the experiment.
+	Arms []ExperimentArm
+}
+
+// ExperimentArm is an arm of an Experiment.
+type ExperimentArm struct {
+	// Name identifies the arm.
+	Name string
+	// Weight is the share of the requests assigned to the arm, relative to
+	// the sum of the weights of all arms. It must be positive.
+	Weight int
+	// Options are the options used for the requests assigned to the arm,
+	// in addition to the options of the middleware, like for Route. The
+	// control arm has no options.
+	Options []Option
+}
+
+// BucketByHeader returns an Experiment key function returning the value of
+// the request header name.
+func BucketByHeader(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// BucketByCookie returns an Experiment key function returning the value of
+// the cookie name of the request.
+func BucketByCookie(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		c, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	}
+}
+
+// BucketByRemoteAddr returns an Experiment key function returning the IP
+// address of the client (without the port).
+func BucketByRemoteAddr() func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			return host
+		}
+		return r.RemoteAddr
+	}
+}
+
+// Option returns the option running the experiment. Each arm is added as a
+// Route (matching the requests assigned to it), so the routes specified
+// before the experiment take precedence over it, and the experiment can not
+// be used in a route.
+func (e *Experiment) Option() Option {
+	return func(c *config) error {
+		if e.Name == "" {
+			return fmt.Errorf("the experiment must have a name")
+		}
+		if e.Key == nil {
+			return fmt.Errorf("experiment %q: the key function can not be nil", e.Name)
+		}
+		if len(e.Arms) == 0 {
+			return fmt.Errorf("experiment %q: no arms", e.Name)
+		}
+		names := map[string]bool{}
+		for _, a := range e.Arms {
+			if a.Weight <= 0 {
+				return fmt.Errorf("experiment %q: the weight of arm %q must be positive: %d", e.Name, a.Name, a.Weight)
+			}
+			if names[a.Name] {
+				return fmt.Errorf("experiment %q: duplicate arm %q", e.Name, a.Name)
+			}
+			names[a.Name] = true
+		}
+		for i, a := range e.Arms {
+			i := i
+			c.routes = append(c.routes, route{match: func(r *http.Request) bool {
+				arm, ok := e.arm(r)
+				return ok && arm == i
+			}, opts: a.Options})
+		}
+		return nil
+	}
+}
+
+// Arm returns the name of the arm r is assigned to, and false if r is not
+// part of the experiment.
+func (e *Experiment) Arm(r *http.Request) (string, bool) {
+	i, ok := e.arm(r)
+	if !ok {
+		return "", false
+	}
+	return e.Arms[i].Name, true
+}
+
+// arm returns the index of the arm r is assigned to.
+func (e *Experiment) arm(r *http.Request) (int, bool) {
+	key := e.Key(r)
+	if key == "" || len(e.Arms) == 0 {
+		return 0, false
+	}
+	total := 0
+	for _, a := range e.Arms {
+		total += maxInt(a.Weight, 0)
+	}
+	if total == 0 {
+		return 0, false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(e.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	n := int(h.Sum64() % uint64(total))
+	for i, a := range e.Arms {
+		if n < maxInt(a.Weight, 0) {
+			return i, true
+		}
+		n -= maxInt(a.Weight, 0)
+	}
+	return 0, false
+}
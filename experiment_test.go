@@ -0,0 +1,93 @@
+package httpcompression
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExperiment(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	e := &Experiment{
+		Name: "brotli-default",
+		Key:  BucketByHeader("X-User"),
+		Arms: []ExperimentArm{
+			{Name: "control", Weight: 1},
+			{Name: "brotli", Weight: 1, Options: []Option{Prefer(PreferClient)}},
+		},
+	}
+	var (
+		mu   sync.Mutex
+		tags = map[string]string{}
+	)
+	a, err := DefaultAdapter(e.Option(), ResponseWriterHook(WriterHook{Negotiated: func(r *http.Request, enc string) {
+		arm, _ := e.Arm(r)
+		mu.Lock()
+		tags[r.Header.Get("X-User")] = arm + "/" + enc
+		mu.Unlock()
+	}}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(testBody))
+	}))
+	get := func(user string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "br, zstd;q=0.5")
+		if user != "" {
+			req.Header.Set("X-User", user)
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res.Header().Get(contentEncoding)
+	}
+
+	arms := map[string]int{}
+	for i := 0; i < 100; i++ {
+		user := fmt.Sprint("user", i)
+		enc := get(user)
+		arm, ok := e.Arm(httptest.NewRequest("GET", "/", nil))
+		assert.False(t, ok)
+		assert.Empty(t, arm)
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-User", user)
+		arm, ok = e.Arm(req)
+		assert.True(t, ok)
+		arms[arm]++
+		if arm == "brotli" {
+			assert.Equal(t, "br", enc, user)
+		} else {
+			assert.Equal(t, "zstd", enc, user)
+		}
+		assert.Equal(t, arm+"/"+enc, tags[user], user)
+		assert.Equal(t, enc, get(user), user)
+	}
+	assert.Greater(t, arms["control"], 25)
+	assert.Greater(t, arms["brotli"], 25)
+	assert.Equal(t, "zstd", get(""))
+}
+
+func TestExperimentInvalid(t *testing.T) {
+	t.Parallel()
+
+	key := BucketByCookie("session")
+	for _, e := range []*Experiment{
+		{Key: key, Arms: []ExperimentArm{{Name: "a", Weight: 1}}},
+		{Name: "e", Arms: []ExperimentArm{{Name: "a", Weight: 1}}},
+		{Name: "e", Key: key},
+		{Name: "e", Key: key, Arms: []ExperimentArm{{Name: "a"}}},
+		{Name: "e", Key: key, Arms: []ExperimentArm{{Name: "a", Weight: 1}, {Name: "a", Weight: 1}}},
+		{Name: "e", Key: key, Arms: []ExperimentArm{{Name: "a", Weight: 1, Options: []Option{MinSize(-1)}}}},
+	} {
+		_, err := Adapter(e.Option())
+		assert.Error(t, err, "%+v", e)
+	}
+}
@@ -0,0 +1,205 @@
+package httpcompression
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// failoverRetry is how long a provider of a failover chain is not used
+	// after one of its compressors failed.
+	failoverRetry = time.Minute
+	// failoverReplay is the maximum amount of data buffered by the
+	// compressors of a failover chain, so that it can be written again to
+	// the next provider if a compressor fails before producing any output.
+	failoverReplay = 64 << 10
+)
+
+// HealthChecker is an optional interface that can be implemented by the
+// CompressorProviders of a failover chain (see FailoverCompressor):
+// providers that report that they are not healthy are skipped.
+type HealthChecker interface {
+	Healthy() bool
+}
+
+// FailoverCompressor returns an Option that sets, for contentEncoding, a
+// chain of CompressorProviders in priority order (e.g. a cgo zstd provider
+// followed by a pure-Go one), with the given priority (see Compressor).
+//
+// Each response is compressed with the first provider of the chain that is
+// healthy: nil providers (e.g. returned by a constructor that failed) are
+// ignored, providers implementing HealthChecker are skipped while they are
+// not healthy, and providers whose compressors returned an error are
+// skipped for a minute. If a compressor fails before it wrote any
+// compressed data, the response is transparently compressed again with the
+// next provider (as long as its uncompressed size is at most 64KB); later
+// failures are returned to the handler, as part of the response has already
+// been sent. The last provider is used if all the others are not healthy.
+func FailoverCompressor(contentEncoding string, priority int, providers ...CompressorProvider) Option {
+	f := &failover{}
+	for _, p := range providers {
+		if !isNil(p) {
+			f.providers = append(f.providers, p)
+		}
+	}
+	if len(f.providers) == 0 {
+		return errorOption("FailoverCompressor", fmt.Errorf("no compressor providers for %q", contentEncoding))
+	}
+	f.failed = make([]atomic.Int64, len(f.providers))
+	return Compressor(contentEncoding, priority, f)
+}
+
+// isNil reports whether p is nil, or a nil pointer (e.g. returned, with an
+// error, by the constructor of a provider). The %p verb formats the nil
+// pointers (and maps, funcs and chans) as 0x0, and the other kinds as an
+// error.
+func isNil(p CompressorProvider) bool {
+	return p == nil || fmt.Sprintf("%p", p) == "0x0"
+}
+
+type failover struct {
+	providers []CompressorProvider
+	failed    []atomic.Int64 // time (in UnixNano) of the last failure of each provider
+}
+
+// usable returns the index of the first usable provider after the i-th one
+// (included), or -1 if none is.
+func (f *failover) usable(i int) int {
+	now := time.Now().UnixNano()
+	for ; i < len(f.providers); i++ {
+		if t := f.failed[i].Load(); t != 0 && now-t < int64(failoverRetry) {
+			continue
+		}
+		if hc, ok := f.providers[i].(HealthChecker); ok && !hc.Healthy() {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// health reports, for each provider, whether it is usable.
+func (f *failover) health() []bool {
+	h := make([]bool, len(f.providers))
+	for i := range f.providers {
+		h[i] = f.usable(i) == i
+	}
+	return h
+}
+
+func (f *failover) Get(parent io.Writer) io.WriteCloser {
+	i := f.usable(0)
+	if i < 0 {
+		i = len(f.providers) - 1
+	}
+	w := &failoverWriter{f: f, parent: parent, replay: true}
+	w.use(i)
+	return w
+}
+
+// failoverWriter is a compressor of a failover chain.
+type failoverWriter struct {
+	f      *failover
+	parent io.Writer
+	i      int // index of the provider of w
+	w      io.WriteCloser
+	out    *countingWriter // output of w
+	buf    []byte          // the data written so far, if replay
+	replay bool
+}
+
+func (w *failoverWriter) use(i int) {
+	w.i = i
+	w.out = &countingWriter{w: w.parent}
+	w.w = w.f.providers[i].Get(w.out)
+}
+
+// fail handles the failure of the current compressor (closed reports
+// whether it has already been closed): if it did not write any output, the
+// data written so far is written to the next usable provider, and nil is
+// returned.
+func (w *failoverWriter) fail(err error, closed bool) error {
+	for {
+		w.f.failed[w.i].Store(time.Now().UnixNano())
+		next := -1
+		if w.replay && w.out.n == 0 && w.i+1 < len(w.f.providers) {
+			next = w.f.usable(w.i + 1)
+		}
+		if next < 0 {
+			return err
+		}
+		// The failed compressor must not write to the response anymore.
+		w.out.w = io.Discard
+		if !closed {
+			w.w.Close()
+		}
+		w.use(next)
+		closed = false
+		if len(w.buf) == 0 {
+			return nil
+		}
+		if err = writeAll(w.w, w.buf); err == nil {
+			return nil
+		}
+	}
+}
+
+// writeAll writes b to w, returning an error on short writes.
+func writeAll(w io.Writer, b []byte) error {
+	n, err := w.Write(b)
+	if err == nil && n < len(b) {
+		err = io.ErrShortWrite
+	}
+	return err
+}
+
+func (w *failoverWriter) Write(b []byte) (int, error) {
+	if w.replay {
+		if w.out.n > 0 || len(w.buf)+len(b) > failoverReplay {
+			w.replay, w.buf = false, nil
+		} else {
+			w.buf = append(w.buf, b...)
+		}
+	}
+	if err := writeAll(w.w, b); err != nil {
+		if err := w.fail(err, false); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (w *failoverWriter) Flush() error {
+	for {
+		f, ok := w.w.(Flusher)
+		if !ok {
+			return nil
+		}
+		err := f.Flush()
+		if err == nil {
+			return nil
+		}
+		if err := w.fail(err, false); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *failoverWriter) Close() error {
+	if w.w == nil {
+		return nil // already closed
+	}
+	var err error
+	for {
+		if err = w.w.Close(); err == nil {
+			break
+		}
+		if err = w.fail(err, true); err != nil {
+			break
+		}
+	}
+	w.w, w.buf = nil, nil
+	return err
+}
@@ -0,0 +1,129 @@
+package httpcompression
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errTestCompressor = errors.New("compressor failure")
+
+// failingProvider returns compressors failing after writing after bytes
+// of compressed data (if after is negative, the compressors do not fail).
+type failingProvider struct {
+	CompressorProvider
+	after   int
+	healthy atomic.Bool
+	gets    atomic.Int32
+}
+
+func (p *failingProvider) Get(w io.Writer) io.WriteCloser {
+	p.gets.Add(1)
+	if p.after < 0 {
+		return p.CompressorProvider.Get(w)
+	}
+	return &failingWriter{w: w, after: p.after}
+}
+
+func (p *failingProvider) Healthy() bool {
+	return p.healthy.Load()
+}
+
+type failingWriter struct {
+	w     io.Writer
+	after int
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if w.after == 0 {
+		return 0, errTestCompressor
+	}
+	n := min(w.after, len(b))
+	w.after -= n
+	w.w.Write(b[:n])
+	return len(b), nil
+}
+
+func (w *failingWriter) Close() error {
+	return errTestCompressor
+}
+
+func newFailingProvider(t *testing.T, after int) *failingProvider {
+	t.Helper()
+	gz, err := NewDefaultGzipCompressor(6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &failingProvider{CompressorProvider: gz, after: after}
+	p.healthy.Store(true)
+	return p
+}
+
+func TestFailoverCompressor(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat(testBody, 10)
+	serve := func(a func(http.Handler) http.Handler) (*httptest.ResponseRecorder, error) {
+		var err error
+		h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(contentType, "text/plain")
+			_, err = io.WriteString(w, body)
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res, err
+	}
+
+	primary, secondary := newFailingProvider(t, 0), newFailingProvider(t, -1)
+	a, err := Adapter(FailoverCompressor("gzip", 0, nil, (*failingProvider)(nil), primary, secondary))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for i := 0; i < 2; i++ {
+		res, err := serve(a)
+		assert.NoError(t, err)
+		assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+		d, err := decodeGzip(res.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, body, string(d))
+	}
+	// After the failure, the primary is skipped.
+	assert.EqualValues(t, 1, primary.gets.Load())
+	assert.EqualValues(t, 2, secondary.gets.Load())
+
+	// Unhealthy providers are skipped.
+	primary, secondary = newFailingProvider(t, -1), newFailingProvider(t, -1)
+	primary.healthy.Store(false)
+	a, err = Adapter(FailoverCompressor("gzip", 0, primary, secondary))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = serve(a)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, primary.gets.Load())
+	assert.EqualValues(t, 1, secondary.gets.Load())
+
+	// There is no failover after the compressor wrote some output.
+	primary, secondary = newFailingProvider(t, 10), newFailingProvider(t, -1)
+	a, err = Adapter(FailoverCompressor("gzip", 0, primary, secondary))
+	if !assert.NoError(t, err) {
+		return
+	}
+	res, _ := serve(a)
+	assert.Equal(t, 10, res.Body.Len())
+	assert.EqualValues(t, 0, secondary.gets.Load())
+
+	_, err = Adapter(FailoverCompressor("gzip", 0, nil))
+	assert.Error(t, err)
+	_, err = Adapter(FailoverCompressor("gzip", 0, (*failingProvider)(nil)))
+	assert.Error(t, err)
+	assert.False(t, isNil(funcProvider{}))
+}
@@ -0,0 +1,317 @@
+package httpcompression
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	cgzip "github.com/CAFxX/httpcompression/contrib/compress/gzip"
+)
+
+const etag = "ETag"
+
+// precompressedVariants lists the encodings of the precompressed variants
+// served by FileServer, with the extension of the corresponding files and
+// their default priority (the same of the corresponding default compressors).
+var precompressedVariants = []struct {
+	enc      string
+	ext      string
+	priority int
+}{
+	{zstandardEncoding, ".zst", -50},
+	{brotliEncoding, ".br", -100},
+	{cgzip.Encoding, ".gz", -200},
+}
+
+// FileServer returns a handler that serves HTTP requests with the contents of
+// the file system rooted at root, like http.FileServer.
+//
+// If the client accepts them, precompressed variants of the requested file
+// (a file with the same name plus the ".zst", ".br" or ".gz" extension) are
+// served instead of the requested file. The Content-Type of the response is
+// determined by the extension of the requested file and each variant has its
+// own ETag, so that caches do not mix up different variants. Range and
+// conditional requests are supported, like in http.FileServer.
+//
+// Files that exist only as a ".zst" variant in the zstd seekable format (see
+// zstd.NewSeekable) are also served, decompressed, to the clients that do
+// not accept zstd: Range requests for them decompress only the frames
+// containing the requested ranges, so that large compressed artifacts can be
+// stored only once and still support resumable downloads.
+//
+// If no acceptable precompressed variant exists, the file is served by
+// http.FileServer and compressed dynamically according to opts. The opts
+// are the same accepted by Adapter: in particular the priorities of the
+// compressors configured in opts (and the Prefer option) are used also to
+// choose among the precompressed variants, and the variants of the encodings
+// disabled in opts (see DisableEncoding) are not served.
+// An error will be returned if invalid options are given.
+func FileServer(root http.FileSystem, opts ...Option) (http.Handler, error) {
+	c, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	variants := comps{}
+	for _, v := range precompressedVariants {
+		if c.disabled[v.enc] {
+			continue
+		}
+		priority := v.priority
+		if cc, ok := c.compressor[v.enc]; ok {
+			priority = cc.priority
+		}
+		variants[v.enc] = comp{priority: priority}
+	}
+	return &fileServer{
+		root:     root,
+		variants: variants,
+		prefer:   c.prefer,
+		fallback: adapter(c, &pools{})(http.FileServer(root)),
+	}, nil
+}
+
+// DefaultFileServer is like FileServer, but it includes the defaults of
+// DefaultAdapter for dynamic compression.
+// The provided opts override the defaults.
+func DefaultFileServer(root http.FileSystem, opts ...Option) (http.Handler, error) {
+	return FileServer(root, append(defaultOptions(), opts...)...)
+}
+
+// FileServerFS is like FileServer, but it serves the files in fsys (e.g. an
+// embed.FS), like http.FileServerFS.
+// Use ValidatePrecompressed to check at startup that fsys contains all the
+// expected precompressed variants.
+func FileServerFS(fsys fs.FS, opts ...Option) (http.Handler, error) {
+	return FileServer(http.FS(fsys), opts...)
+}
+
+// DefaultFileServerFS is like FileServerFS, but it includes the defaults of
+// DefaultAdapter for dynamic compression.
+// The provided opts override the defaults.
+func DefaultFileServerFS(fsys fs.FS, opts ...Option) (http.Handler, error) {
+	return DefaultFileServer(http.FS(fsys), opts...)
+}
+
+// ValidatePrecompressed checks that, for each regular file in fsys for which
+// match returns true (all files if match is nil), a non-empty precompressed
+// variant exists for each of the specified encodings (e.g. "gzip", "br").
+// Precompressed variants themselves are not checked.
+// It is meant to be called at startup, to detect assets that were not
+// precompressed at build time. All the missing variants are reported in the
+// returned error.
+func ValidatePrecompressed(fsys fs.FS, match func(name string) bool, encodings ...string) error {
+	var exts []string
+	for _, enc := range encodings {
+		ext := variantExt(enc)
+		if ext == "" {
+			return fmt.Errorf("unsupported precompressed encoding: %q", enc)
+		}
+		exts = append(exts, ext)
+	}
+	var errs []error
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || encodingFromExt(path.Ext(name)) != "" {
+			return nil
+		}
+		if match != nil && !match(name) {
+			return nil
+		}
+		for _, ext := range exts {
+			fi, err := fs.Stat(fsys, name+ext)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: missing precompressed variant %s: %w", name, name+ext, err))
+			} else if !fi.Mode().IsRegular() || fi.Size() == 0 {
+				errs = append(errs, fmt.Errorf("%s: invalid precompressed variant %s", name, name+ext))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+type fileServer struct {
+	root     http.FileSystem
+	variants comps
+	prefer   PreferType
+	fallback http.Handler
+	etags    sync.Map // map[etagKey]string, for files without a modification time
+}
+
+type etagKey struct {
+	name string
+	enc  string
+	size int64
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	addVaryHeader(w.Header(), acceptEncoding)
+
+	upath := r.URL.Path
+	if (r.Method != http.MethodGet && r.Method != http.MethodHead) || strings.HasSuffix(upath, "/") {
+		// Directories (and their index files) are handled by http.FileServer.
+		s.fallback.ServeHTTP(w, r)
+		return
+	}
+	if !strings.HasPrefix(upath, "/") {
+		upath = "/" + upath
+	}
+	name := path.Clean(upath)
+
+	accept := parseEncodings(r.Header.Values(acceptEncoding))
+	var common []string
+	for _, v := range precompressedVariants {
+		if _, ok := s.variants[v.enc]; ok && accept[v.enc] > 0 {
+			common = append(common, v.enc)
+		}
+	}
+	if len(common) > 0 {
+		// preferredEncoding sorts common by preference.
+		preferredEncoding(accept, s.variants, common, s.prefer)
+		for _, enc := range common {
+			if s.serveVariant(w, r, name, enc) {
+				return
+			}
+		}
+	}
+	if s.serveSeekable(w, r, name) {
+		return
+	}
+	s.fallback.ServeHTTP(w, r)
+}
+
+// serveVariant serves the variant of the file name for the encoding enc.
+// It returns false if the variant does not exist.
+func (s *fileServer) serveVariant(w http.ResponseWriter, r *http.Request, name, enc string) bool {
+	f, err := s.root.Open(name + variantExt(enc))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+
+	h := w.Header()
+	if _, ok := h[contentType]; !ok {
+		// http.ServeContent would sniff the compressed data.
+		h.Set(contentType, s.contentType(name))
+	}
+	if h.Get(etag) == "" {
+		if tag, err := s.etag(f, name, enc, fi); err == nil {
+			h.Set(etag, tag)
+		}
+	}
+	h.Set(contentEncoding, enc)
+	http.ServeContent(w, r, name, fi.ModTime(), f)
+	return true
+}
+
+// serveSeekable serves the decompressed content of the file name from its
+// ".zst" variant, if the file does not exist and the variant is in the zstd
+// seekable format (see zstd.NewSeekable): only the frames of the variant
+// containing the requested ranges are decompressed. It returns false if the
+// content can not be served in this way.
+func (s *fileServer) serveSeekable(w http.ResponseWriter, r *http.Request, name string) bool {
+	f, err := s.root.Open(name + variantExt(zstandardEncoding))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+	if of, err := s.root.Open(name); err == nil {
+		of.Close()
+		return false
+	}
+	rs, ok := openSeekable(f, fi.Size())
+	if !ok {
+		return false
+	}
+	defer rs.Close()
+
+	h := w.Header()
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" && h.Get(contentType) == "" {
+		h.Set(contentType, ct)
+	}
+	if h.Get(etag) == "" {
+		if tag, err := s.etag(f, name, "identity", fi); err == nil {
+			h.Set(etag, tag)
+		}
+	}
+	http.ServeContent(w, r, name, fi.ModTime(), rs)
+	return true
+}
+
+// etag returns the ETag of the variant file f, for the file name and the
+// encoding enc. Files embedded with embed.FS have no modification time, so
+// ETags of files without a modification time are derived from their content:
+// they are computed once and then cached.
+func (s *fileServer) etag(f http.File, name, enc string, fi fs.FileInfo) (string, error) {
+	if !fi.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x-%s"`, fi.ModTime().UnixNano(), fi.Size(), enc), nil
+	}
+	key := etagKey{name, enc, fi.Size()}
+	if tag, ok := s.etags.Load(key); ok {
+		return tag.(string), nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	tag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + "-" + enc + `"`
+	s.etags.Store(key, tag)
+	return tag, nil
+}
+
+// contentType returns the Content-Type of the file name, determined by its
+// extension or, if the extension is unknown, by sniffing its content.
+func (s *fileServer) contentType(name string) string {
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct
+	}
+	if f, err := s.root.Open(name); err == nil {
+		defer f.Close()
+		var buf [512]byte
+		n, _ := io.ReadFull(f, buf[:])
+		return http.DetectContentType(buf[:n])
+	}
+	return "application/octet-stream"
+}
+
+func encodingFromExt(ext string) string {
+	for _, v := range precompressedVariants {
+		if v.ext == ext {
+			return v.enc
+		}
+	}
+	return ""
+}
+
+func variantExt(enc string) string {
+	for _, v := range precompressedVariants {
+		if v.enc == enc {
+			return v.ext
+		}
+	}
+	return ""
+}
@@ -0,0 +1,217 @@
+package httpcompression
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// CachingFileServerFS returns a handler that serves the files in fsys, like
+// http.FileServerFS, compressing each file on the first request for it and
+// storing the compressed variant in cache: the following requests for the
+// file are served from the cache, without compressing it again. It is a
+// middle ground between compressing the files dynamically and
+// precompressing them at build time (see FileServerFS): as each file is
+// compressed only once, the highest compression levels can be used (see
+// PresetStaticAssets and DefaultCachingFileServerFS).
+//
+// The cached variants are keyed by the path of the file, its size and its
+// modification time (or, for the files without a modification time, such as
+// those embedded with embed.FS, a hash of their content), so that a file
+// that changes is compressed again. Each variant has its own ETag, and the
+// conditional requests are served like http.ServeContent does; Range
+// requests are only served for the uncompressed files.
+//
+// The files are compressed according to opts, that are the same accepted by
+// Adapter: the files that are smaller than MinSize or whose Content-Type
+// (determined by their extension or by sniffing their content) is excluded
+// by ContentTypes, the directories and the requests that accept no
+// compression are served by http.FileServerFS, and compressed dynamically
+// (if at all) according to opts.
+// An error will be returned if invalid options are given.
+func CachingFileServerFS(fsys fs.FS, cache Cache, opts ...Option) (http.Handler, error) {
+	if cache == nil {
+		return nil, errors.New("file server cache can not be nil")
+	}
+	c, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &cachingFileServer{
+		fsys:     fsys,
+		cache:    cache,
+		c:        &c,
+		fallback: adapter(c, &pools{})(http.FileServerFS(fsys)),
+		pending:  map[CacheKey]chan struct{}{},
+	}, nil
+}
+
+// DefaultCachingFileServerFS is like CachingFileServerFS, but it includes
+// the defaults of DefaultAdapter, and PresetStaticAssets.
+// The provided opts override the defaults.
+func DefaultCachingFileServerFS(fsys fs.FS, cache Cache, opts ...Option) (http.Handler, error) {
+	return CachingFileServerFS(fsys, cache, append(defaultOptions(), append([]Option{PresetStaticAssets()}, opts...)...)...)
+}
+
+type cachingFileServer struct {
+	fsys     fs.FS
+	cache    Cache
+	c        *config
+	fallback http.Handler
+	hashes   sync.Map // map[etagKey]string, for files without a modification time
+
+	mu      sync.Mutex
+	pending map[CacheKey]chan struct{} // the variants being compressed
+}
+
+func (s *cachingFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	upath := r.URL.Path
+	if (r.Method != http.MethodGet && r.Method != http.MethodHead) || strings.HasSuffix(upath, "/") {
+		s.fallback.ServeHTTP(w, r)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+upath), "/")
+	fi, err := fs.Stat(s.fsys, name)
+	if err != nil || !fi.Mode().IsRegular() {
+		s.fallback.ServeHTTP(w, r)
+		return
+	}
+
+	c := s.c.route(r)
+	accept := parseEncodings(r.Header.Values(acceptEncoding))
+	c.gateEncodings(w, r, accept, nil)
+	common := acceptedCompression(accept, c.compressor)
+	if len(common) == 0 {
+		s.fallback.ServeHTTP(w, r)
+		return
+	}
+	enc := preferredEncoding(accept, c.compressor, common, c.prefer)
+	ct := s.contentType(name)
+	if fi.Size() < int64(c.encodingMinSize(enc)) || !handleContentType(ct, c.contentTypes, c.blacklist) {
+		s.fallback.ServeHTTP(w, r)
+		return
+	}
+	validator, err := s.validator(name, fi)
+	if err != nil {
+		s.fallback.ServeHTTP(w, r)
+		return
+	}
+	key := CacheKey{URL: "/" + name, Encoding: enc, Validator: validator}
+	b, err := s.variant(key, c.compressor[enc].comp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, ok := w.Header()[contentType]; !ok {
+		w.Header().Set(contentType, ct)
+	}
+	ServeContent(w, r, name, fi.ModTime(), []Variant{{
+		Encoding: enc,
+		Content:  bytes.NewReader(b),
+		ETag:     `"` + validator + "-" + enc + `"`,
+	}})
+}
+
+// variant returns the variant of the file identified by key, compressing it
+// with p if it is not in the cache. Concurrent requests for the same variant
+// wait for it to be compressed once.
+func (s *cachingFileServer) variant(key CacheKey, p CompressorProvider) ([]byte, error) {
+	if b, ok := s.cache.Get(key); ok {
+		return b, nil
+	}
+	s.mu.Lock()
+	if done, ok := s.pending[key]; ok {
+		s.mu.Unlock()
+		<-done
+		if b, ok := s.cache.Get(key); ok {
+			return b, nil
+		}
+		// The cache did not store the variant (e.g. it is too large).
+		return s.compress(key.URL, p)
+	}
+	done := make(chan struct{})
+	s.pending[key] = done
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, key)
+		s.mu.Unlock()
+		close(done)
+	}()
+
+	b, err := s.compress(key.URL, p)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Set(key, b, 0)
+	return b, nil
+}
+
+// compress returns the file at the URL upath compressed with p.
+func (s *cachingFileServer) compress(upath string, p CompressorProvider) ([]byte, error) {
+	f, err := s.fsys.Open(strings.TrimPrefix(upath, "/"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	cw := p.Get(&buf)
+	_, err = io.Copy(cw, f)
+	if cerr := cw.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("compressing %s: %w", upath, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// validator returns the part of the cache key identifying the version of the
+// file name: its modification time and its size or, if the file has no
+// modification time, a hash of its content, computed once and then cached.
+func (s *cachingFileServer) validator(name string, fi fs.FileInfo) (string, error) {
+	if !fi.ModTime().IsZero() {
+		return fmt.Sprintf("%x-%x", fi.ModTime().UnixNano(), fi.Size()), nil
+	}
+	key := etagKey{name: name, size: fi.Size()}
+	if v, ok := s.hashes.Load(key); ok {
+		return v.(string), nil
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	v := hex.EncodeToString(hash.Sum(nil)[:16])
+	s.hashes.Store(key, v)
+	return v, nil
+}
+
+// contentType returns the Content-Type of the file name, determined by its
+// extension or, if the extension is unknown, by sniffing its content.
+func (s *cachingFileServer) contentType(name string) string {
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct
+	}
+	if f, err := s.fsys.Open(name); err == nil {
+		defer f.Close()
+		var buf [512]byte
+		n, _ := io.ReadFull(f, buf[:])
+		return http.DetectContentType(buf[:n])
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,106 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingCache counts the variants stored in a Cache.
+type countingCache struct {
+	Cache
+	sets atomic.Int64
+}
+
+func (c *countingCache) Set(key CacheKey, value []byte, ttl time.Duration) {
+	c.sets.Add(1)
+	c.Cache.Set(key, value, ttl)
+}
+
+func TestCachingFileServerFS(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"app.js":       {Data: []byte(testBody), ModTime: mtime},
+		"embedded.css": {Data: []byte(testBody)},
+		"small.txt":    {Data: []byte("small"), ModTime: mtime},
+		"image.png":    {Data: []byte(testBody), ModTime: mtime},
+	}
+	cache := &countingCache{Cache: NewMemoryCache(1 << 20)}
+	fs, err := DefaultCachingFileServerFS(fsys, cache)
+	if !assert.NoError(t, err) {
+		return
+	}
+	get := func(path, accept, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(acceptEncoding, accept)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		res := httptest.NewRecorder()
+		fs.ServeHTTP(res, req)
+		return res
+	}
+	check := func(res *httptest.ResponseRecorder, enc string) {
+		t.Helper()
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, enc, res.Header().Get(contentEncoding))
+		assert.Equal(t, acceptEncoding, res.Header().Get(vary))
+		b, err := decodeBody(res.Body, enc)
+		assert.NoError(t, err)
+		assert.Equal(t, testBody, string(b))
+	}
+
+	// The file is compressed once for each encoding.
+	res := get("/app.js", "br", "")
+	check(res, "br")
+	assert.Equal(t, "text/javascript; charset=utf-8", res.Header().Get(contentType))
+	assert.Equal(t, mtime.Format(http.TimeFormat), res.Header().Get(lastModified))
+	br := res.Header().Get(etag)
+	assert.NotEmpty(t, br)
+	check(get("/app.js", "br", ""), "br")
+	assert.Equal(t, int64(1), cache.sets.Load())
+	res = get("/app.js", "gzip", "")
+	check(res, "gzip")
+	assert.NotEqual(t, br, res.Header().Get(etag))
+	assert.Equal(t, int64(2), cache.sets.Load())
+
+	// Conditional requests.
+	assert.Equal(t, http.StatusNotModified, get("/app.js", "br", br).Code)
+	check(get("/app.js", "gzip", br), "gzip")
+
+	// The files without a modification time are keyed by their content.
+	res = get("/embedded.css", "br", "")
+	check(res, "br")
+	assert.NotEmpty(t, res.Header().Get(etag))
+	check(get("/embedded.css", "br", ""), "br")
+	assert.Equal(t, int64(3), cache.sets.Load())
+
+	// The modified files are compressed again.
+	fsys["app.js"] = &fstest.MapFile{Data: []byte(testBody), ModTime: mtime.Add(time.Second)}
+	res = get("/app.js", "br", br)
+	check(res, "br")
+	assert.NotEqual(t, br, res.Header().Get(etag))
+	assert.Equal(t, int64(4), cache.sets.Load())
+
+	// The other files are served by http.FileServerFS.
+	res = get("/small.txt", "br", "")
+	assert.Empty(t, res.Header().Get(contentEncoding))
+	assert.Equal(t, "small", res.Body.String())
+	res = get("/image.png", "br", "")
+	assert.Empty(t, res.Header().Get(contentEncoding))
+	assert.Equal(t, testBody, res.Body.String())
+	check(get("/app.js", "identity", ""), "")
+	assert.Equal(t, http.StatusNotFound, get("/missing.js", "br", "").Code)
+	assert.Equal(t, int64(4), cache.sets.Load())
+
+	_, err = CachingFileServerFS(fsys, nil)
+	assert.Error(t, err)
+}
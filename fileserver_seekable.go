@@ -0,0 +1,43 @@
+//go:build !httpcompression_minimal
+// +build !httpcompression_minimal
+
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+)
+
+// openSeekable returns a reader of the decompressed content of f, a file of
+// size bytes, if f is in the zstd seekable format (see zstd.NewSeekable).
+// The returned reader must be closed, before closing f.
+func openSeekable(f http.File, size int64) (io.ReadSeekCloser, bool) {
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		ra = &seekingReaderAt{f: f}
+	}
+	r, err := zstd.NewSeekableReader(ra, size)
+	if err != nil {
+		return nil, false
+	}
+	return r, true
+}
+
+// seekingReaderAt implements io.ReaderAt for files that do not implement it
+// (e.g. the files of http.FS), by seeking before each read.
+type seekingReaderAt struct {
+	mu sync.Mutex
+	f  io.ReadSeeker
+}
+
+func (r *seekingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.f.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(r.f, p)
+}
@@ -0,0 +1,15 @@
+//go:build httpcompression_minimal
+// +build httpcompression_minimal
+
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+)
+
+// openSeekable always fails in httpcompression_minimal builds, that do not
+// include a zstd decoder.
+func openSeekable(f http.File, size int64) (io.ReadSeekCloser, bool) {
+	return nil, false
+}
@@ -0,0 +1,305 @@
+package httpcompression
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/stretchr/testify/assert"
+
+	kpzstd "github.com/klauspost/compress/zstd"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestFileServer(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		"app.js":         testBody,
+		"app.js.gz":      "gzip variant",
+		"app.js.br":      "brotli variant",
+		"data":           "<html>" + testBody,
+		"data.zst":       "zstd variant",
+		"only.css.gz":    "gzip only",
+		"plain.txt":      testBody,
+		"dir/index.html": testBody,
+	})
+	fs, err := DefaultFileServer(http.Dir(dir))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cases := []struct {
+		path, accept string
+		status       int
+		encoding     string
+		contentType  string
+		body         string
+	}{
+		{"/app.js", "gzip, br", 200, "br", "text/javascript; charset=utf-8", "brotli variant"},
+		{"/app.js", "gzip", 200, "gzip", "text/javascript; charset=utf-8", "gzip variant"},
+		{"/app.js", "gzip, br;q=0", 200, "gzip", "text/javascript; charset=utf-8", "gzip variant"},
+		{"/app.js", "", 200, "", "text/javascript; charset=utf-8", testBody},
+		{"/app.js", "zstd", 200, "zstd", "text/javascript; charset=utf-8", ""}, // dynamic compression
+		{"/data", "zstd", 200, "zstd", "text/html; charset=utf-8", "zstd variant"},
+		{"/only.css", "gzip", 200, "gzip", "text/css; charset=utf-8", "gzip only"},
+		{"/only.css", "br", 404, "", "", ""},
+		{"/plain.txt", "gzip", 200, "gzip", "text/plain; charset=utf-8", ""}, // dynamic compression
+		{"/dir/", "gzip", 200, "gzip", "text/html; charset=utf-8", ""},       // dynamic compression
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		if c.accept != "" {
+			req.Header.Set(acceptEncoding, c.accept)
+		}
+		res := httptest.NewRecorder()
+		fs.ServeHTTP(res, req)
+		assert.Equal(t, c.status, res.Code, "%s %s", c.path, c.accept)
+		if c.status != 200 {
+			continue
+		}
+		assert.Equal(t, c.encoding, res.Header().Get(contentEncoding), "%s %s", c.path, c.accept)
+		assert.Equal(t, c.contentType, res.Header().Get(contentType), "%s %s", c.path, c.accept)
+		assert.Equal(t, []string{acceptEncoding}, res.Header().Values(vary), "%s %s", c.path, c.accept)
+		if c.body != "" {
+			assert.Equal(t, c.body, res.Body.String(), "%s %s", c.path, c.accept)
+		} else {
+			assert.NotEqual(t, testBody, res.Body.String(), "%s %s", c.path, c.accept)
+		}
+	}
+}
+
+func TestFileServerETag(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		"app.js":    testBody,
+		"app.js.gz": "gzip variant",
+		"app.js.br": "brotli variant",
+	})
+	fs, err := FileServer(http.Dir(dir))
+	if !assert.NoError(t, err) {
+		return
+	}
+	get := func(accept, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/app.js", nil)
+		req.Header.Set(acceptEncoding, accept)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		res := httptest.NewRecorder()
+		fs.ServeHTTP(res, req)
+		return res
+	}
+
+	gz, br := get("gzip", "").Header().Get(etag), get("br", "").Header().Get(etag)
+	assert.NotEmpty(t, gz)
+	assert.NotEmpty(t, br)
+	assert.NotEqual(t, gz, br)
+	assert.Equal(t, http.StatusNotModified, get("gzip", gz).Code)
+	assert.Equal(t, http.StatusOK, get("br", gz).Code)
+}
+
+func TestFileServerRange(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		"app.js":    testBody,
+		"app.js.gz": "gzip variant",
+	})
+	fs, err := FileServer(http.Dir(dir))
+	if !assert.NoError(t, err) {
+		return
+	}
+	req := httptest.NewRequest("GET", "/app.js", nil)
+	req.Header.Set(acceptEncoding, "gzip")
+	req.Header.Set("Range", "bytes=0-3")
+	res := httptest.NewRecorder()
+	fs.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusPartialContent, res.Code)
+	assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+	assert.True(t, bytes.Equal([]byte("gzip"), res.Body.Bytes()))
+}
+
+func TestFileServerDisabledVariants(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		"app.js":     testBody,
+		"app.js.gz":  "gzip variant",
+		"app.js.br":  "brotli variant",
+		"app.js.zst": "zstd variant",
+	})
+	fs, err := FileServer(http.Dir(dir), Compressor(brotliEncoding, 0, nil), DisableEncoding(zstandardEncoding))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, accept := range []string{"zstd, br, gzip", "br, gzip", "gzip"} {
+		req := httptest.NewRequest("GET", "/app.js", nil)
+		req.Header.Set(acceptEncoding, accept)
+		res := httptest.NewRecorder()
+		fs.ServeHTTP(res, req)
+		assert.Equal(t, "gzip", res.Header().Get(contentEncoding), accept)
+		assert.Equal(t, "gzip variant", res.Body.String(), accept)
+	}
+
+	req := httptest.NewRequest("GET", "/app.js", nil)
+	req.Header.Set(acceptEncoding, "br")
+	res := httptest.NewRecorder()
+	fs.ServeHTTP(res, req)
+	assert.Equal(t, "", res.Header().Get(contentEncoding))
+	assert.Equal(t, testBody, res.Body.String())
+}
+
+func TestFileServerInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	_, err := FileServer(http.Dir("."), MinSize(-1))
+	assert.Error(t, err)
+}
+
+func TestFileServerFS(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"app.js":    {Data: []byte(testBody)},
+		"app.js.gz": {Data: []byte("gzip variant")},
+		"app.js.br": {Data: []byte("brotli variant")},
+	}
+	fs, err := DefaultFileServerFS(fsys)
+	if !assert.NoError(t, err) {
+		return
+	}
+	get := func(accept, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/app.js", nil)
+		req.Header.Set(acceptEncoding, accept)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		res := httptest.NewRecorder()
+		fs.ServeHTTP(res, req)
+		return res
+	}
+
+	res := get("gzip", "")
+	assert.Equal(t, "gzip variant", res.Body.String())
+	assert.Equal(t, "text/javascript; charset=utf-8", res.Header().Get(contentType))
+	gz := res.Header().Get(etag)
+	assert.NotEmpty(t, gz)
+	assert.Equal(t, gz, get("gzip", "").Header().Get(etag))
+	assert.NotEqual(t, gz, get("br", "").Header().Get(etag))
+	assert.Equal(t, http.StatusNotModified, get("gzip", gz).Code)
+	assert.Equal(t, "brotli variant", get("br", gz).Body.String())
+}
+
+func TestValidatePrecompressed(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"app.js":           {Data: []byte(testBody)},
+		"app.js.gz":        {Data: []byte("gzip variant")},
+		"app.js.br":        {Data: []byte("brotli variant")},
+		"css/style.css":    {Data: []byte(testBody)},
+		"css/style.css.gz": {Data: []byte("gzip variant")},
+		"css/style.css.br": {Data: []byte{}},
+		"img/logo.png":     {Data: []byte("png")},
+	}
+	noPNG := func(name string) bool { return path.Ext(name) != ".png" }
+	assert.NoError(t, ValidatePrecompressed(fsys, noPNG, "gzip"))
+	assert.NoError(t, ValidatePrecompressed(fsys, func(name string) bool { return path.Ext(name) == ".js" }, "gzip", "br"))
+	assert.Error(t, ValidatePrecompressed(fsys, nil, "gzip"))
+
+	err := ValidatePrecompressed(fsys, noPNG, "gzip", "br", "zstd")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "app.js.zst")
+		assert.Contains(t, err.Error(), "css/style.css.br")
+		assert.Contains(t, err.Error(), "css/style.css.zst")
+		assert.NotContains(t, err.Error(), "app.js.gz")
+		assert.NotContains(t, err.Error(), "logo.png")
+	}
+
+	assert.Error(t, ValidatePrecompressed(fsys, nil, "lzma"))
+}
+
+func TestFileServerSeekable(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	content := strings.Repeat(testBody, 20)
+	c, err := zstd.NewSeekable(1000)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var b bytes.Buffer
+	w := c.Get(&b)
+	w.Write([]byte(content))
+	if !assert.NoError(t, w.Close()) {
+		return
+	}
+	dir := writeFiles(t, map[string]string{"big.txt.zst": b.String(), "plain.txt.zst": string(zstdStrLevel(content, kpzstd.SpeedFastest))})
+	fsys := fstest.MapFS{"big.txt.zst": {Data: b.Bytes()}}
+	for _, root := range []http.FileSystem{http.Dir(dir), http.FS(fsys)} {
+		fs, err := FileServer(root)
+		if !assert.NoError(t, err) {
+			return
+		}
+		get := func(name, accept, rng string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", name, nil)
+			req.Header.Set(acceptEncoding, accept)
+			if rng != "" {
+				req.Header.Set("Range", rng)
+			}
+			res := httptest.NewRecorder()
+			fs.ServeHTTP(res, req)
+			return res
+		}
+
+		res := get("/big.txt", "gzip", "")
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "", res.Header().Get(contentEncoding))
+		assert.Equal(t, "text/plain; charset=utf-8", res.Header().Get(contentType))
+		assert.Equal(t, content, res.Body.String())
+		assert.NotEmpty(t, res.Header().Get(etag))
+
+		res = get("/big.txt", "", "bytes=5000-5099")
+		assert.Equal(t, http.StatusPartialContent, res.Code)
+		assert.Equal(t, content[5000:5100], res.Body.String())
+
+		res = get("/big.txt", "zstd", "")
+		assert.Equal(t, "zstd", res.Header().Get(contentEncoding))
+		assert.Equal(t, b.Bytes(), res.Body.Bytes())
+	}
+
+	// Variants that are not seekable are not decompressed.
+	fs, err := FileServer(http.Dir(dir))
+	if !assert.NoError(t, err) {
+		return
+	}
+	req := httptest.NewRequest("GET", "/plain.txt", nil)
+	res := httptest.NewRecorder()
+	fs.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
@@ -0,0 +1,98 @@
+package httpcompression
+
+import (
+	"fmt"
+	"sort"
+
+	cgzip "github.com/CAFxX/httpcompression/contrib/compress/gzip"
+	"github.com/CAFxX/httpcompression/contrib/compress/zlib"
+)
+
+// Config is a serializable configuration of the middleware, e.g. loaded
+// from a JSON or YAML file or from a configuration service. FromConfig
+// converts it to options. The zero value of each field leaves the
+// corresponding setting unchanged.
+type Config struct {
+	// Encodings configures the compressors, by Content-Encoding ("gzip",
+	// "deflate", "br" or "zstd").
+	Encodings map[string]EncodingConfig `json:"encodings,omitempty" yaml:"encodings,omitempty"`
+	// MinSize is the minimum size of the responses to compress (see MinSize).
+	MinSize *int `json:"minSize,omitempty" yaml:"minSize,omitempty"`
+	// ContentTypes are the only content types to compress (see ContentTypes).
+	ContentTypes []string `json:"contentTypes,omitempty" yaml:"contentTypes,omitempty"`
+	// ExcludedContentTypes are content types not to compress (see
+	// ContentTypes). It can not be used together with ContentTypes.
+	ExcludedContentTypes []string `json:"excludedContentTypes,omitempty" yaml:"excludedContentTypes,omitempty"`
+	// Prefer is "server" or "client" (see Prefer).
+	Prefer string `json:"prefer,omitempty" yaml:"prefer,omitempty"`
+}
+
+// EncodingConfig is the configuration of a compressor (see Config).
+type EncodingConfig struct {
+	// Level is the compression level. If set, a compressor with this
+	// level replaces the configured one, if any.
+	Level *int `json:"level,omitempty" yaml:"level,omitempty"`
+	// Priority is the priority of the compressor (see Compressor).
+	Priority *int `json:"priority,omitempty" yaml:"priority,omitempty"`
+	// Disabled disables the compressor.
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+}
+
+// levelOptions are the options setting the compression level of the
+// encodings supported by FromConfig.
+var levelOptions = map[string]func(level int) Option{
+	zlib.Encoding:     DeflateCompressionLevel,
+	cgzip.Encoding:    GzipCompressionLevel,
+	brotliEncoding:    BrotliCompressionLevel,
+	zstandardEncoding: ZstandardCompressionLevel,
+}
+
+// FromConfig returns the options corresponding to cfg. They can be passed
+// to Adapter or, to override only some of the defaults, to DefaultAdapter.
+// An error will be returned if cfg is invalid.
+func FromConfig(cfg Config) ([]Option, error) {
+	var opts []Option
+	encs := make([]string, 0, len(cfg.Encodings))
+	for enc := range cfg.Encodings {
+		encs = append(encs, enc)
+	}
+	sort.Strings(encs)
+	for _, enc := range encs {
+		ec := cfg.Encodings[enc]
+		if ec.Disabled {
+			opts = append(opts, DisableEncoding(enc))
+			continue
+		}
+		if ec.Level != nil {
+			level, ok := levelOptions[enc]
+			if !ok {
+				return nil, fmt.Errorf("unsupported encoding: %q", enc)
+			}
+			opts = append(opts, level(*ec.Level))
+		}
+		if ec.Priority != nil {
+			opts = append(opts, Priority(enc, *ec.Priority))
+		}
+	}
+	if cfg.MinSize != nil {
+		opts = append(opts, MinSize(*cfg.MinSize))
+	}
+	switch {
+	case len(cfg.ContentTypes) > 0 && len(cfg.ExcludedContentTypes) > 0:
+		return nil, fmt.Errorf("contentTypes and excludedContentTypes can not be used together")
+	case len(cfg.ContentTypes) > 0:
+		opts = append(opts, ContentTypes(cfg.ContentTypes, false))
+	case len(cfg.ExcludedContentTypes) > 0:
+		opts = append(opts, ContentTypes(cfg.ExcludedContentTypes, true))
+	}
+	switch cfg.Prefer {
+	case "":
+	case "server":
+		opts = append(opts, Prefer(PreferServer))
+	case "client":
+		opts = append(opts, Prefer(PreferClient))
+	default:
+		return nil, fmt.Errorf("unknown prefer type: %q", cfg.Prefer)
+	}
+	return opts, nil
+}
@@ -0,0 +1,88 @@
+package httpcompression
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromConfig(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	var cfg Config
+	err := json.Unmarshal([]byte(`{
+		"encodings": {
+			"br": {"disabled": true},
+			"gzip": {"level": 9, "priority": 10},
+			"zstd": {"level": 3}
+		},
+		"minSize": 100,
+		"contentTypes": ["text/plain"],
+		"prefer": "client"
+	}`), &cfg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	opts, err := FromConfig(cfg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	c, err := newConfig(append(defaultOptions(), opts...)...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 100, c.minSize)
+	assert.Equal(t, PreferClient, c.prefer)
+	assert.False(t, c.blacklist)
+	assert.Len(t, c.contentTypes, 1)
+	assert.NotContains(t, c.compressor, "br")
+	assert.Equal(t, 10, c.compressor["gzip"].priority)
+	assert.Equal(t, -50, c.compressor["zstd"].priority)
+
+	mw, err := DefaultAdapter(opts...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(testBody))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, "br, zstd;q=0.5, gzip;q=0.5")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+}
+
+func TestFromConfigInvalid(t *testing.T) {
+	t.Parallel()
+
+	level := 5
+	for _, cfg := range []Config{
+		{Encodings: map[string]EncodingConfig{"lz4": {Level: &level}}},
+		{ContentTypes: []string{"text/plain"}, ExcludedContentTypes: []string{"image/png"}},
+		{Prefer: "nobody"},
+	} {
+		_, err := FromConfig(cfg)
+		assert.Error(t, err, "%+v", cfg)
+	}
+
+	prio := 1
+	opts, err := FromConfig(Config{Encodings: map[string]EncodingConfig{"lz4": {Priority: &prio}}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = DefaultAdapter(opts...)
+	assert.Error(t, err)
+
+	opts, err = FromConfig(Config{Encodings: map[string]EncodingConfig{"zstd": {Level: new(int)}}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = DefaultAdapter(opts...)
+	assert.Error(t, err)
+}
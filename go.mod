@@ -1,6 +1,6 @@
 module github.com/CAFxX/httpcompression
 
-go 1.11
+go 1.22
 
 require (
 	github.com/andybalholm/brotli v1.1.1
@@ -12,3 +12,9 @@ require (
 	github.com/ulikunitz/xz v0.5.12
 	github.com/valyala/gozstd v1.21.1
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
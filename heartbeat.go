@@ -0,0 +1,79 @@
+package httpcompression
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Heartbeats is an option that passes through the heartbeats written by
+// long-polling and streaming handlers to keep the connections alive: the
+// writes of zero bytes, and the writes of at most maxSize bytes that only
+// contain whitespace (spaces, tabs, CR and LF), are written and then
+// flushed to the client right away, instead of being held in the buffers
+// of the middleware and of the compressor until the handler writes enough
+// data, so that the idle timeouts of the proxies and load balancers in
+// between do not expire.
+//
+// If the middleware has not yet decided whether the response is compressed
+// when the first heartbeat is written, the decision is taken right away
+// based on the headers of the response, regardless of MinSize, as the
+// response is expected to be long-lived.
+func Heartbeats(maxSize int) Option {
+	return named("Heartbeats", func(c *config) error {
+		if maxSize < 0 {
+			return fmt.Errorf("heartbeat size can not be negative: %d", maxSize)
+		}
+		c.heartbeats, c.heartbeatSize = true, maxSize
+		return nil
+	})
+}
+
+// isHeartbeat reports whether b is a heartbeat (see Heartbeats).
+func (c *config) isHeartbeat(b []byte) bool {
+	if !c.heartbeats || len(b) > c.heartbeatSize {
+		return false
+	}
+	for _, ch := range b {
+		if ch != ' ' && ch != '\t' && ch != '\r' && ch != '\n' {
+			return false
+		}
+	}
+	return true
+}
+
+// startHeartbeat starts the response, not started yet, when the first
+// heartbeat is written.
+func (w *compressWriter) startHeartbeat() error {
+	if w.buf == nil {
+		if ok, err := w.startEmpty(); ok || err != nil {
+			return err
+		}
+		w.buf = w.getBuffer()
+	}
+	if *w.buf == nil {
+		// startCompress initializes the compressor only for a non-nil
+		// buffer.
+		*w.buf = []byte{}
+	}
+	ct := w.Header().Get(contentType)
+	if w.Header().Get(contentEncoding) != "" || w.uncompressed(ct) {
+		return w.startPlain(*w.buf)
+	}
+	// The size of the response is unknown, so it is assumed to be large
+	// enough for all the encodings.
+	return w.startBuffered(ct, maxInt(w.waitSize, len(*w.buf)))
+}
+
+// writeHeartbeat writes the heartbeat b to the started response, and
+// flushes it.
+func (w *compressWriter) writeHeartbeat(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	if err != nil {
+		return n, err
+	}
+	if err := w.flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return n, err
+	}
+	return n, nil
+}
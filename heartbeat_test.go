@@ -0,0 +1,66 @@
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeats(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		opts     []Option
+		ct       string
+		writes   []string
+		flushed  []bool // whether the response is flushed after each write
+		encoding string
+	}{
+		{"disabled", nil, "text/plain", []string{"\n", "", testBody}, []bool{false, false, true}, "gzip"},
+		{"heartbeat first", []Option{Heartbeats(2)}, "text/plain", []string{"\n", testBody}, []bool{true, true}, "gzip"},
+		{"empty write", []Option{Heartbeats(0)}, "text/plain", []string{"", testBody[:10]}, []bool{true, true}, "gzip"},
+		{"after data", []Option{Heartbeats(2)}, "text/plain", []string{"data", " \n", testBody}, []bool{false, true, true}, "gzip"},
+		{"too large", []Option{Heartbeats(2)}, "text/plain", []string{"   ", testBody}, []bool{false, true}, "gzip"},
+		{"not whitespace", []Option{Heartbeats(2)}, "text/plain", []string{":", testBody}, []bool{false, true}, "gzip"},
+		{"not compressed", []Option{Heartbeats(2), ContentTypes([]string{"text/html"}, false)}, "text/plain", []string{"\n", testBody}, []bool{true, true}, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			a, err := DefaultAdapter(append([]Option{GzipCompressionLevel(6), BrotliCompressor(nil), ZstandardCompressor(nil)}, c.opts...)...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			res := httptest.NewRecorder()
+			var exp string
+			h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(contentType, c.ct)
+				for i, s := range c.writes {
+					exp += s
+					io.WriteString(w, s)
+					if c.writes[i] == testBody {
+						w.(http.Flusher).Flush()
+					}
+					assert.Equal(t, c.flushed[i], res.Flushed, "write %d", i)
+					assert.Equal(t, c.flushed[i], res.Body.Len() > 0, "write %d", i)
+				}
+			}))
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(acceptEncoding, "gzip")
+			h.ServeHTTP(res, req)
+
+			assert.Equal(t, c.encoding, res.Header().Get(contentEncoding))
+			b, err := decodeBody(res.Body, c.encoding)
+			assert.NoError(t, err)
+			assert.Equal(t, exp, string(b))
+		})
+	}
+
+	_, err := DefaultAdapter(Heartbeats(-1))
+	assert.Error(t, err)
+}
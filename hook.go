@@ -0,0 +1,139 @@
+package httpcompression
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// WriterHook allows other middlewares (e.g. for size accounting or security
+// headers) to integrate with the ResponseWriter of the middleware (see
+// ResponseWriterHook).
+type WriterHook struct {
+	// Wrap, if not nil, is called for each request with the ResponseWriter
+	// of the middleware, before it is passed to the handler: the returned
+	// ResponseWriter is passed to the handler instead. Writes to w are
+	// compressed, if the response is compressed. The returned
+	// ResponseWriter should implement the Unwrap method, returning w, so that
+	// the handler can still reach the optional interfaces of w (e.g.
+	// http.Flusher) via http.ResponseController.
+	Wrap func(w http.ResponseWriter, r *http.Request) http.ResponseWriter
+	// Negotiated, if not nil, is called for each request once the middleware
+	// has decided whether the response is compressed, with the
+	// Content-Encoding of the response (empty if the response is not
+	// compressed by the middleware, e.g. because it is too small).
+	Negotiated func(r *http.Request, contentEncoding string)
+	// Started, if not nil, is called for each request right before the
+	// headers of the response are written, with the status code and the
+	// headers of the response, that can still be modified (e.g. to add
+	// security headers depending on the Content-Type).
+	Started func(r *http.Request, status int, h http.Header)
+	// Closed, if not nil, is called for each request once the handler has
+	// returned and the response has been completed (i.e. the compressor has
+	// been closed), with the Content-Encoding of the response (empty if the
+	// response was not compressed) and the error returned when completing
+	// the response, if any.
+	Closed func(r *http.Request, contentEncoding string, err error)
+}
+
+// ResponseWriterHook is an option that adds a WriterHook. Hooks are called
+// in the order in which they are added, so the ResponseWriter returned by
+// the Wrap function of the last hook is the one passed to the handler.
+func ResponseWriterHook(hook WriterHook) Option {
+	return named("ResponseWriterHook", func(c *config) error {
+		if hook.Wrap == nil && hook.Negotiated == nil && hook.Started == nil && hook.Closed == nil {
+			return fmt.Errorf("the writer hook must have at least one function")
+		}
+		c.hooks = append(c.hooks, hook)
+		return nil
+	})
+}
+
+// ErrorHandler is an option that calls h with the error of each response
+// that failed to be completed (e.g. because the compressor or the connection
+// failed), once the handler has returned. h is called once per response,
+// also if the handler (or its framework) closed the ResponseWriter itself.
+func ErrorHandler(h func(r *http.Request, err error)) Option {
+	if h == nil {
+		return errorOption("ErrorHandler", errors.New("nil error handler"))
+	}
+	return ResponseWriterHook(WriterHook{Closed: func(r *http.Request, _ string, err error) {
+		if err != nil {
+			h(r, err)
+		}
+	}})
+}
+
+func (c *config) wrapWriter(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	for _, hook := range c.hooks {
+		if hook.Wrap != nil {
+			w = hook.Wrap(w, r)
+		}
+	}
+	return w
+}
+
+func (c *config) writerClosed(r *http.Request, enc string, err error) {
+	for _, hook := range c.hooks {
+		if hook.Closed != nil {
+			hook.Closed(r, enc, err)
+		}
+	}
+}
+
+func (c *config) writerNegotiated(r *http.Request, enc string) {
+	for _, hook := range c.hooks {
+		if hook.Negotiated != nil {
+			hook.Negotiated(r, enc)
+		}
+	}
+}
+
+func (c *config) writerStarted(r *http.Request, status int, h http.Header) {
+	for _, hook := range c.hooks {
+		if hook.Started != nil {
+			hook.Started(r, status, h)
+		}
+	}
+}
+
+// startWriter calls the Started hooks for the responses that are not
+// handled by a compressWriter.
+type startWriter struct {
+	http.ResponseWriter
+	c       *config
+	r       *http.Request
+	started bool
+}
+
+func (w *startWriter) start(status int) {
+	if !w.started {
+		w.started = true
+		w.c.writerStarted(w.r, status, w.Header())
+	}
+}
+
+func (w *startWriter) WriteHeader(code int) {
+	if code >= http.StatusOK {
+		w.start(code)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *startWriter) Write(b []byte) (int, error) {
+	w.start(http.StatusOK)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *startWriter) Flush() {
+	_ = w.FlushError()
+}
+
+func (w *startWriter) FlushError() error {
+	w.start(http.StatusOK)
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *startWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
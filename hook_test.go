@@ -0,0 +1,197 @@
+package httpcompression
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sizeWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+func (w sizeWriter) Write(b []byte) (int, error) {
+	atomic.AddInt64(w.n, int64(len(b)))
+	return w.ResponseWriter.Write(b)
+}
+
+func (w sizeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestResponseWriterHook(t *testing.T) {
+	t.Parallel()
+
+	var (
+		written int64
+		encs    []string
+		order   []string
+	)
+	mw, err := DefaultAdapter(
+		ResponseWriterHook(WriterHook{
+			Wrap: func(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+				order = append(order, "count")
+				return sizeWriter{w, &written}
+			},
+			Closed: func(r *http.Request, enc string, err error) {
+				assert.NoError(t, err)
+				encs = append(encs, enc)
+			},
+		}),
+		ResponseWriterHook(WriterHook{
+			Wrap: func(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+				order = append(order, "headers")
+				w.Header().Set("X-Content-Type-Options", "nosniff")
+				return w
+			},
+		}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := w.(sizeWriter)
+		assert.True(t, ok)
+		assert.NoError(t, http.NewResponseController(w).Flush())
+		w.Write([]byte(testBody))
+	}))
+	for _, accept := range []string{"gzip", ""} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, accept)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, "nosniff", res.Header().Get("X-Content-Type-Options"))
+	}
+	assert.Equal(t, int64(2*len(testBody)), written)
+	assert.Equal(t, []string{"gzip", ""}, encs)
+	assert.Equal(t, []string{"count", "headers", "count", "headers"}, order)
+
+	_, err = Adapter(ResponseWriterHook(WriterHook{}))
+	assert.Error(t, err)
+}
+
+func TestResponseWriterHookLifecycle(t *testing.T) {
+	t.Parallel()
+
+	var events []string
+	mw, err := DefaultAdapter(ResponseWriterHook(WriterHook{
+		Negotiated: func(r *http.Request, enc string) {
+			events = append(events, "negotiated "+enc)
+		},
+		Started: func(r *http.Request, status int, h http.Header) {
+			events = append(events, fmt.Sprintf("started %d %s", status, h.Get(contentEncoding)))
+			h.Set("X-Started", "1")
+		},
+		Closed: func(r *http.Request, enc string, err error) {
+			events = append(events, "closed "+enc)
+		},
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, c := range []struct {
+		accept string
+		status int
+		body   string
+		events []string
+	}{
+		{"gzip", http.StatusOK, testBody, []string{"negotiated gzip", "started 200 gzip", "closed gzip"}},
+		{"gzip", http.StatusNotFound, "small", []string{"negotiated ", "started 404 ", "closed "}},
+		{"", http.StatusOK, testBody, []string{"negotiated ", "started 200 ", "closed "}},
+		{"", http.StatusNoContent, "", []string{"negotiated ", "started 204 ", "closed "}},
+	} {
+		events = nil
+		h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(contentType, "text/plain")
+			w.WriteHeader(c.status)
+			io.WriteString(w, c.body)
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, c.accept)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, c.status, res.Code)
+		assert.Equal(t, "1", res.Header().Get("X-Started"))
+		assert.Equal(t, c.events, events)
+	}
+}
+
+// closeCountingProvider counts the Close calls of its compressors.
+type closeCountingProvider struct {
+	CompressorProvider
+	closes atomic.Int32
+	err    error
+}
+
+func (p *closeCountingProvider) Get(w io.Writer) io.WriteCloser {
+	return &closeCountingWriter{p.CompressorProvider.Get(w), p}
+}
+
+type closeCountingWriter struct {
+	io.WriteCloser
+	p *closeCountingProvider
+}
+
+func (w *closeCountingWriter) Close() error {
+	w.p.closes.Add(1)
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return w.p.err
+}
+
+func TestCloseIdempotent(t *testing.T) {
+	t.Parallel()
+
+	gz, err := NewDefaultGzipCompressor(6)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, failing := range []bool{false, true} {
+		p := &closeCountingProvider{CompressorProvider: gz}
+		if failing {
+			p.err = fmt.Errorf("compressor failed")
+		}
+		var errs []error
+		a, err := Adapter(GzipCompressor(p), ErrorHandler(func(r *http.Request, err error) {
+			errs = append(errs, err)
+		}))
+		if !assert.NoError(t, err) {
+			return
+		}
+		h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(contentType, "text/plain")
+			w.Write([]byte(testBody))
+			c := w.(io.Closer)
+			err := c.Close()
+			assert.Equal(t, p.err, err)
+			assert.Equal(t, err, c.Close())
+			_, err = w.Write([]byte(testBody))
+			assert.Error(t, err)
+			assert.Error(t, http.NewResponseController(w).Flush())
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+
+		assert.EqualValues(t, 1, p.closes.Load())
+		if failing {
+			assert.Equal(t, []error{p.err}, errs)
+			continue
+		}
+		assert.Empty(t, errs)
+		b, err := decodeBody(res.Body, res.Header().Get(contentEncoding))
+		assert.NoError(t, err)
+		assert.Equal(t, testBody, string(b))
+	}
+
+	_, err = Adapter(ErrorHandler(nil))
+	assert.Error(t, err)
+}
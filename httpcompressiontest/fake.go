@@ -0,0 +1,195 @@
+package httpcompressiontest
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/CAFxX/httpcompression"
+)
+
+// ErrFake is the error returned by the compressors of a FakeProvider at the
+// configured failure points, if FakeProvider.Err is nil.
+var ErrFake = errors.New("httpcompressiontest: fake failure")
+
+// ErrClosed is the error returned by the compressors of a FakeProvider when
+// they are used after Close.
+var ErrClosed = errors.New("httpcompressiontest: compressor used after Close")
+
+// FailPoint is a set of operations at which the compressors of a
+// FakeProvider fail (see FakeProvider.Fail).
+type FailPoint int
+
+const (
+	// FailGet makes all the operations of the compressors returned by Get
+	// fail, like the compressors returned by providers that fail to
+	// initialize.
+	FailGet FailPoint = 1 << iota
+	// FailWrite makes Write fail.
+	FailWrite
+	// FailFlush makes Flush fail.
+	FailFlush
+	// FailClose makes Close fail.
+	FailClose
+)
+
+// FakeStats are the calls recorded by a FakeProvider.
+type FakeStats struct {
+	// Gets is the number of calls to Get.
+	Gets int
+	// Resets is the number of calls to Get that reused a compressor
+	// previously closed.
+	Resets int
+	// Writes, Flushes and Closes are the number of calls to the
+	// corresponding methods of the compressors.
+	Writes, Flushes, Closes int
+	// Bytes is the number of uncompressed bytes written to the compressors.
+	Bytes int64
+	// Open is the number of compressors returned by Get and not closed yet.
+	Open int
+	// Misuses is the number of calls to the compressors after they have
+	// been closed (including repeated calls to Close).
+	Misuses int
+}
+
+// FakeProvider is an instrumented httpcompression.CompressorProvider, to
+// test the usage of the compressors by the middleware (e.g. that all the
+// compressors are closed and not used after Close, or how errors are
+// handled) when writing custom options or wrappers. It records the calls to
+// Get and to the methods of the compressors (see Stats), and it can be
+// configured to fail at specific points.
+//
+// The compressors are pooled: calling Get after Close reuses the closed
+// compressors, like the providers of this module do.
+// The zero value is a FakeProvider that writes the data uncompressed
+// (i.e. with the identity encoding). A FakeProvider is safe for concurrent
+// use; its fields must not be changed after its first use.
+type FakeProvider struct {
+	// Provider, if not nil, is the provider used to compress the data.
+	Provider httpcompression.CompressorProvider
+	// Fail are the operations at which the compressors fail.
+	Fail FailPoint
+	// FailAfter is the number of calls to Write that succeed before Write
+	// fails, if Fail includes FailWrite.
+	FailAfter int
+	// Err is the error returned at the failure points. If nil, ErrFake is
+	// used.
+	Err error
+
+	mu    sync.Mutex
+	stats FakeStats
+	pool  []*fakeCompressor
+}
+
+var _ httpcompression.CompressorProvider = &FakeProvider{}
+
+// Get implements httpcompression.CompressorProvider.
+func (p *FakeProvider) Get(w io.Writer) io.WriteCloser {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Gets++
+	p.stats.Open++
+	var c *fakeCompressor
+	if n := len(p.pool); n > 0 {
+		c, p.pool = p.pool[n-1], p.pool[:n-1]
+		p.stats.Resets++
+	} else {
+		c = &fakeCompressor{p: p}
+	}
+	c.closed = false
+	c.writes = 0
+	c.w = nopCloser{w}
+	if p.Provider != nil {
+		c.w = p.Provider.Get(w)
+	}
+	return c
+}
+
+// Stats returns the calls recorded so far.
+func (p *FakeProvider) Stats() FakeStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+func (p *FakeProvider) err() error {
+	if p.Err != nil {
+		return p.Err
+	}
+	return ErrFake
+}
+
+type fakeCompressor struct {
+	p      *FakeProvider
+	w      io.WriteCloser
+	writes int
+	closed bool
+}
+
+func (c *fakeCompressor) Write(buf []byte) (int, error) {
+	p := c.p
+	p.mu.Lock()
+	if c.closed {
+		p.stats.Misuses++
+		p.mu.Unlock()
+		return 0, ErrClosed
+	}
+	p.stats.Writes++
+	c.writes++
+	fail := p.Fail&FailGet != 0 || (p.Fail&FailWrite != 0 && c.writes > p.FailAfter)
+	if !fail {
+		p.stats.Bytes += int64(len(buf))
+	}
+	p.mu.Unlock()
+	if fail {
+		return 0, p.err()
+	}
+	return c.w.Write(buf)
+}
+
+func (c *fakeCompressor) Flush() error {
+	p := c.p
+	p.mu.Lock()
+	if c.closed {
+		p.stats.Misuses++
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	p.stats.Flushes++
+	p.mu.Unlock()
+	if p.Fail&(FailGet|FailFlush) != 0 {
+		return p.err()
+	}
+	if f, ok := c.w.(httpcompression.Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (c *fakeCompressor) Close() error {
+	p := c.p
+	p.mu.Lock()
+	if c.closed {
+		p.stats.Misuses++
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	c.closed = true
+	p.stats.Closes++
+	p.stats.Open--
+	w := c.w
+	c.w = nil
+	p.pool = append(p.pool, c)
+	p.mu.Unlock()
+	err := w.Close()
+	if p.Fail&(FailGet|FailClose) != 0 {
+		return p.err()
+	}
+	return err
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
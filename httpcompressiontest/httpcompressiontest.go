@@ -0,0 +1,149 @@
+// Package httpcompressiontest provides utilities to test handlers wrapped
+// with the httpcompression middleware: requests with specific
+// Accept-Encoding headers, a ResponseRecorder that decodes the recorded
+// response, and assertions on the encoding of the responses.
+//
+//	rec := httpcompressiontest.NewRecorder()
+//	handler.ServeHTTP(rec, httpcompressiontest.NewRequest("GET", "/", "br", "gzip"))
+//	body := httpcompressiontest.AssertEncoded(t, rec, "br")
+package httpcompressiontest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// NewRequest returns a new incoming server request, like httptest.NewRequest,
+// accepting the specified encodings: each of them is added as a separate
+// Accept-Encoding header (e.g. "gzip", or "br;q=0.5"). If no encoding is
+// specified, the request has no Accept-Encoding header.
+func NewRequest(method, target string, acceptEncoding ...string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	for _, enc := range acceptEncoding {
+		r.Header.Add("Accept-Encoding", enc)
+	}
+	return r
+}
+
+// ResponseRecorder is an httptest.ResponseRecorder that can decode the
+// recorded response body.
+type ResponseRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+// NewRecorder returns an initialized ResponseRecorder.
+func NewRecorder() *ResponseRecorder {
+	return &ResponseRecorder{httptest.NewRecorder()}
+}
+
+// Encoding returns the Content-Encoding of the recorded response, or "" if
+// the response is not encoded.
+func (rec *ResponseRecorder) Encoding() string {
+	return strings.Join(rec.Result().Header.Values("Content-Encoding"), ",")
+}
+
+// DecodedBody returns the recorded response body, decoded according to its
+// Content-Encoding (see Decode).
+func (rec *ResponseRecorder) DecodedBody() ([]byte, error) {
+	return Decode(rec.Encoding(), rec.Body.Bytes())
+}
+
+// Decode decodes body according to contentEncoding, the value of a
+// Content-Encoding header. The supported encodings are "gzip", "deflate",
+// "br", "zstd" and "identity"; if multiple encodings are listed (e.g.
+// "gzip, br") they are decoded in the reverse order in which they were
+// applied. An error will be returned if an encoding is not supported, or if
+// body is not correctly encoded.
+func Decode(contentEncoding string, body []byte) ([]byte, error) {
+	encs := strings.Split(contentEncoding, ",")
+	for i := len(encs) - 1; i >= 0; i-- {
+		enc := strings.ToLower(strings.TrimSpace(encs[i]))
+		var err error
+		body, err = decode(enc, body)
+		if err != nil {
+			return nil, fmt.Errorf("decoding %q: %w", enc, err)
+		}
+	}
+	return body, nil
+}
+
+func decode(enc string, body []byte) ([]byte, error) {
+	r, err := NewReader(enc, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// NewReader returns a reader decoding the data read from r according to
+// contentEncoding, that must be one of the encodings supported by Decode.
+// The returned reader must be closed when it is not needed anymore.
+func NewReader(contentEncoding string, r io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		return io.NopCloser(r), nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return zlib.NewReader(r)
+	case "br":
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case "zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unsupported encoding")
+}
+
+// AssertEncoded checks that the response recorded by rec has the specified
+// Content-Encoding, and that its body is correctly encoded. It returns the
+// decoded body, or nil if the check fails.
+func AssertEncoded(t testing.TB, rec *ResponseRecorder, encoding string) []byte {
+	t.Helper()
+	if enc := rec.Encoding(); enc != encoding {
+		t.Errorf("Content-Encoding: got %q, want %q", enc, encoding)
+		return nil
+	}
+	body, err := rec.DecodedBody()
+	if err != nil {
+		t.Errorf("invalid response body: %v", err)
+		return nil
+	}
+	return body
+}
+
+// AssertNotEncoded checks that the response recorded by rec has no
+// Content-Encoding. It returns the body, or nil if the check fails.
+func AssertNotEncoded(t testing.TB, rec *ResponseRecorder) []byte {
+	t.Helper()
+	return AssertEncoded(t, rec, "")
+}
+
+// AssertVary checks that the Vary header of the response recorded by rec
+// includes Accept-Encoding, as required for the responses whose encoding
+// depends on the Accept-Encoding header of the request.
+func AssertVary(t testing.TB, rec *ResponseRecorder) {
+	t.Helper()
+	for _, v := range rec.Result().Header.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), "Accept-Encoding") {
+				return
+			}
+		}
+	}
+	t.Errorf("Vary: Accept-Encoding not found in %q", rec.Result().Header.Values("Vary"))
+}
@@ -0,0 +1,102 @@
+package httpcompressiontest_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/httpcompressiontest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssertEncoded(t *testing.T) {
+	t.Parallel()
+	skipMinimal(t)
+
+	body := strings.Repeat("hello world ", 1000)
+	compress, err := httpcompression.DefaultAdapter()
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(body))
+	}))
+
+	for _, enc := range []string{"gzip", "deflate", "br", "zstd"} {
+		rec := httpcompressiontest.NewRecorder()
+		h.ServeHTTP(rec, httpcompressiontest.NewRequest("GET", "/", enc))
+		assert.Equal(t, body, string(httpcompressiontest.AssertEncoded(t, rec, enc)), enc)
+		httpcompressiontest.AssertVary(t, rec)
+	}
+
+	rec := httpcompressiontest.NewRecorder()
+	h.ServeHTTP(rec, httpcompressiontest.NewRequest("GET", "/"))
+	assert.Equal(t, body, string(httpcompressiontest.AssertNotEncoded(t, rec)))
+}
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	body, err := httpcompressiontest.Decode("identity", []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	_, err = httpcompressiontest.Decode("gzip", []byte("hello"))
+	assert.Error(t, err)
+
+	_, err = httpcompressiontest.Decode("compress", []byte("hello"))
+	assert.Error(t, err)
+}
+
+func TestFakeProvider(t *testing.T) {
+	t.Parallel()
+
+	gz, err := httpcompression.NewDefaultGzipCompressor(6)
+	if !assert.NoError(t, err) {
+		return
+	}
+	p := &httpcompressiontest.FakeProvider{Provider: gz}
+	compress, err := httpcompression.Adapter(httpcompression.GzipCompressor(p), httpcompression.MinSize(0))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello "))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("world"))
+	}))
+	for i := 0; i < 3; i++ {
+		rec := httpcompressiontest.NewRecorder()
+		h.ServeHTTP(rec, httpcompressiontest.NewRequest("GET", "/", "gzip"))
+		assert.Equal(t, "hello world", string(httpcompressiontest.AssertEncoded(t, rec, "gzip")))
+	}
+	s := p.Stats()
+	assert.Equal(t, 3, s.Gets)
+	assert.Equal(t, 2, s.Resets)
+	assert.Equal(t, 3, s.Closes)
+	assert.Equal(t, 0, s.Open)
+	assert.Equal(t, 0, s.Misuses)
+	assert.EqualValues(t, 3*len("hello world"), s.Bytes)
+}
+
+func TestFakeProviderFail(t *testing.T) {
+	t.Parallel()
+
+	p := &httpcompressiontest.FakeProvider{Fail: httpcompressiontest.FailWrite, FailAfter: 1}
+	w := p.Get(io.Discard)
+	_, err := w.Write([]byte("hello"))
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("world"))
+	assert.ErrorIs(t, err, httpcompressiontest.ErrFake)
+	assert.NoError(t, w.Close())
+	assert.ErrorIs(t, w.Close(), httpcompressiontest.ErrClosed)
+
+	s := p.Stats()
+	assert.Equal(t, 2, s.Writes)
+	assert.EqualValues(t, 5, s.Bytes)
+	assert.Equal(t, 1, s.Misuses)
+	assert.Equal(t, 0, s.Open)
+}
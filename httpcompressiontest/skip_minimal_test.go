@@ -0,0 +1,13 @@
+//go:build httpcompression_minimal
+// +build httpcompression_minimal
+
+package httpcompressiontest_test
+
+import "testing"
+
+// skipMinimal skips the tests that need the compressors enabled only
+// outside of httpcompression_minimal builds.
+func skipMinimal(t testing.TB) {
+	t.Helper()
+	t.Skip("requires the brotli and zstd compressors, not available in httpcompression_minimal builds")
+}
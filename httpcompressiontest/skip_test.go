@@ -0,0 +1,10 @@
+//go:build !httpcompression_minimal
+// +build !httpcompression_minimal
+
+package httpcompressiontest_test
+
+import "testing"
+
+// skipMinimal skips the tests that need the compressors enabled only
+// outside of httpcompression_minimal builds.
+func skipMinimal(t testing.TB) {}
@@ -0,0 +1,54 @@
+package httpcompression
+
+import (
+	"os"
+	"os/signal"
+)
+
+// Disable disables the compression of all the responses of the middleware,
+// e.g. during an incident (such as a CPU saturation, or a suspected bug of a
+// compressor), without redeploying: the requests received after Disable has
+// been called are passed to the wrapped handlers without compressing their
+// responses, until Enable is called, while the responses being compressed
+// are completed. Unlike the options, the kill switch is kept by Reload; the
+// middlewares returned by With have their own.
+func (m *Middleware) Disable() {
+	m.disabled.Store(true)
+}
+
+// Enable enables again the compression of the responses disabled by Disable.
+func (m *Middleware) Enable() {
+	m.disabled.Store(false)
+}
+
+// Disabled reports whether the compression of the responses has been
+// disabled with Disable.
+func (m *Middleware) Disabled() bool {
+	return m.disabled.Load()
+}
+
+// ToggleOnSignal disables the compression of the responses when one of sigs
+// (e.g. syscall.SIGUSR2) is received, and enables it again when one of them
+// is received again (see Disable), so that the compression can be turned off
+// during an incident also without an AdminHandler. The returned function
+// stops the notifications of sigs.
+func (m *Middleware) ToggleOnSignal(sigs ...os.Signal) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				for old := m.disabled.Load(); !m.disabled.CompareAndSwap(old, !old); old = m.disabled.Load() {
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
@@ -0,0 +1,63 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisable(t *testing.T) {
+	t.Parallel()
+
+	m, err := DefaultMiddleware()
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(testBody))
+	}))
+	get := func() string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if res.Header().Get(contentEncoding) == "" {
+			assert.Equal(t, testBody, res.Body.String())
+		}
+		return res.Header().Get(contentEncoding)
+	}
+	admin := func(form url.Values) int {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		req.Header.Set(contentType, "application/x-www-form-urlencoded")
+		res := httptest.NewRecorder()
+		m.AdminHandler(true).ServeHTTP(res, req)
+		return res.Code
+	}
+
+	assert.Equal(t, "gzip", get())
+	m.Disable()
+	assert.True(t, m.Disabled())
+	assert.Equal(t, "", get())
+
+	// The kill switch survives the reloads.
+	assert.NoError(t, m.Reload(MinSize(0)))
+	assert.Equal(t, "", get())
+	assert.True(t, m.adminReport().Disabled)
+
+	m.Enable()
+	assert.False(t, m.Disabled())
+	assert.Equal(t, "gzip", get())
+
+	// The kill switch can be toggled by the AdminHandler.
+	assert.Equal(t, http.StatusOK, admin(url.Values{"disable": {"true"}}))
+	assert.Equal(t, "", get())
+	assert.Equal(t, http.StatusOK, admin(url.Values{"disable": {"false"}}))
+	assert.Equal(t, "gzip", get())
+	assert.Equal(t, http.StatusBadRequest, admin(url.Values{"disable": {"maybe"}}))
+	assert.Equal(t, http.StatusBadRequest, admin(url.Values{}))
+}
@@ -0,0 +1,120 @@
+package httpcompression
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"sync"
+)
+
+const (
+	// learnMinSamples is the number of responses of each pattern compressed
+	// with each encoding before the best encoding is preferred.
+	learnMinSamples = 8
+	// learnExplore is the fraction of the responses of each pattern that,
+	// once all the encodings have been sampled, are compressed with a
+	// random encoding, to keep track of changes of the responses.
+	learnExplore = 0.05
+	// learnWeight is the weight of each response in the moving average of
+	// the ratio of each pattern and encoding.
+	learnWeight = 0.1
+	// learnMinSize is the minimum size of the responses whose ratio is
+	// recorded: the ratio of smaller responses is dominated by the headers
+	// of the compressed formats.
+	learnMinSize = 1 << 10
+	// learnMaxPatterns is the maximum number of patterns whose ratios are
+	// recorded, to bound the memory used by LearnEncodings.
+	learnMaxPatterns = 4096
+)
+
+// LearnEncodings is an option that makes the middleware learn which encoding
+// compresses best the responses of each path pattern. The middleware records
+// the compression ratio achieved by each encoding for the responses to the
+// requests of each pattern (as returned by pattern, e.g. the pattern of the
+// route matched by the request; if pattern is nil the path of the request is
+// used), and compresses the responses with the encoding that achieved the
+// best ratio for their pattern, among the encodings acceptable for the
+// response (i.e. accepted by the client, and allowed for its Content-Type
+// and size).
+//
+// Until each encoding has been used for a few responses of the pattern, the
+// encodings are tried in turn; afterwards a small fraction of the responses
+// still use a random encoding, to track changes in the responses. Requests
+// for which pattern returns the empty string are negotiated as usual.
+// Up to 4096 patterns are learned: the additional patterns are negotiated
+// as usual.
+func LearnEncodings(pattern func(r *http.Request) string) Option {
+	if pattern == nil {
+		pattern = func(r *http.Request) string {
+			return r.URL.Path
+		}
+	}
+	return func(c *config) error {
+		c.learn = &learnConfig{pattern: pattern, stats: map[string]map[string]*learnStats{}}
+		return nil
+	}
+}
+
+type learnConfig struct {
+	pattern func(r *http.Request) string
+
+	mu    sync.Mutex
+	stats map[string]map[string]*learnStats // by pattern and encoding
+}
+
+type learnStats struct {
+	n     int     // number of responses
+	ratio float64 // moving average of the compressed/uncompressed size ratio
+}
+
+// choose returns the encoding to use, among common (sorted by preference),
+// for a response of pattern.
+func (l *learnConfig) choose(pattern string, common []string) string {
+	if pattern == "" || len(common) == 1 {
+		return common[0]
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := l.stats[pattern]
+	if stats == nil {
+		return common[0]
+	}
+	best := ""
+	for _, enc := range common {
+		s := stats[enc]
+		if s == nil || s.n < learnMinSamples {
+			return enc
+		}
+		if best == "" || s.ratio < stats[best].ratio {
+			best = enc
+		}
+	}
+	if rand.Float64() < learnExplore {
+		return common[rand.IntN(len(common))]
+	}
+	return best
+}
+
+// record records the ratio achieved by enc for a response of pattern.
+func (l *learnConfig) record(pattern, enc string, in, out int64) {
+	if pattern == "" || in < learnMinSize {
+		return
+	}
+	ratio := float64(out) / float64(in)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := l.stats[pattern]
+	if stats == nil {
+		if len(l.stats) >= learnMaxPatterns {
+			return
+		}
+		stats = map[string]*learnStats{}
+		l.stats[pattern] = stats
+	}
+	s := stats[enc]
+	if s == nil {
+		s = &learnStats{ratio: ratio}
+		stats[enc] = s
+	}
+	s.n++
+	s.ratio += (ratio - s.ratio) * learnWeight
+}
@@ -0,0 +1,70 @@
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bloatingProvider returns compressors writing the data twice.
+type bloatingProvider struct{}
+
+func (bloatingProvider) Get(w io.Writer) io.WriteCloser {
+	return nopWriteCloser{writerFunc(func(b []byte) (int, error) {
+		w.Write(b)
+		w.Write(b)
+		return len(b), nil
+	})}
+}
+
+func TestLearnEncodings(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	a, err := Adapter(
+		Compressor("x-bloat", 10, bloatingProvider{}),
+		BrotliCompressionLevel(5),
+		LearnEncodings(func(r *http.Request) string {
+			return r.URL.Query().Get("pattern")
+		}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		io.WriteString(w, strings.Repeat(testBody, 20))
+	}))
+	serve := func(pattern, accept string) string {
+		req := httptest.NewRequest("GET", "/?pattern="+pattern, nil)
+		req.Header.Set(acceptEncoding, accept)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res.Header().Get(contentEncoding)
+	}
+
+	// Each encoding is sampled first, in order of preference.
+	for i := 0; i < learnMinSamples; i++ {
+		assert.Equal(t, "x-bloat", serve("p", "x-bloat, br"))
+	}
+	for i := 0; i < learnMinSamples; i++ {
+		assert.Equal(t, "br", serve("p", "x-bloat, br"))
+	}
+	n := 0
+	for i := 0; i < 100; i++ {
+		if serve("p", "x-bloat, br") == "br" {
+			n++
+		}
+	}
+	assert.Greater(t, n, 80)
+
+	// Only the acceptable encodings are used.
+	assert.Equal(t, "x-bloat", serve("p", "x-bloat"))
+	// The other patterns, and requests without a pattern, are negotiated as usual.
+	assert.Equal(t, "x-bloat", serve("q", "x-bloat, br"))
+	assert.Equal(t, "x-bloat", serve("", "x-bloat, br"))
+}
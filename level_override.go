@@ -0,0 +1,120 @@
+package httpcompression
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LevelOverrides is an option that allows to override the compression level
+// of single responses, e.g. to compress the responses of a latency-critical
+// endpoint with the fastest level while keeping a higher level elsewhere:
+// the level of each encoding can be set with WithCompressionLevel in the
+// context of the request, by the middlewares in front of the adapter, or,
+// if header is not empty, by the handler in the response header with that
+// name, as a comma-separated list of encoding=level pairs (e.g.
+// "gzip=1, br=2"). The header is internal: it is removed from all the
+// responses, and it is taken into account only when set by the handler,
+// never when it comes from the client.
+//
+// The levels have the meaning of the *CompressionLevel options (e.g.
+// BrotliCompressionLevel), and they can only be set for the encodings with
+// one of these options (gzip, deflate, br and zstd); the compressors for
+// each level are created the first time they are used. The overrides of
+// the other encodings, and the invalid levels, are ignored. The responses
+// compressed with a dictionary (see Dictionaries) keep their level.
+func LevelOverrides(header string) Option {
+	return func(c *config) error {
+		c.levels = &levelOverrides{header: http.CanonicalHeaderKey(header)}
+		return nil
+	}
+}
+
+// WithCompressionLevel returns a copy of ctx that sets the compression level
+// of the responses compressed with contentEncoding, for the requests with
+// the returned context (see LevelOverrides).
+func WithCompressionLevel(ctx context.Context, contentEncoding string, level int) context.Context {
+	levels := map[string]int{}
+	if prev, ok := ctx.Value(levelKey{}).(map[string]int); ok {
+		for enc, l := range prev {
+			levels[enc] = l
+		}
+	}
+	levels[contentEncoding] = level
+	return context.WithValue(ctx, levelKey{}, levels)
+}
+
+type levelKey struct{}
+
+type levelOverrides struct {
+	header string
+	levelProviders
+}
+
+// levelProviders are the providers of the built-in encodings for each
+// level, created the first time they are used (see LevelOverrides and
+// EgressAware).
+type levelProviders struct {
+	providers sync.Map // providerLevel -> CompressorProvider, nil if the level is invalid
+}
+
+type providerLevel struct {
+	enc   string
+	level int
+}
+
+// provider returns the provider of enc compressing with level, or nil if
+// there is none.
+func (lp *levelProviders) provider(enc string, level int) CompressorProvider {
+	key := providerLevel{enc: enc, level: level}
+	if p, ok := lp.providers.Load(key); ok {
+		p, _ := p.(CompressorProvider)
+		return p
+	}
+	var p CompressorProvider
+	if opt, ok := adminLevelOptions[enc]; ok {
+		c := config{compressor: comps{}}
+		if opt(level)(&c) == nil {
+			p = c.compressor[enc].comp
+		}
+	}
+	if p == nil {
+		lp.providers.Store(key, nil)
+		return nil
+	}
+	actual, _ := lp.providers.LoadOrStore(key, p)
+	return actual.(CompressorProvider)
+}
+
+// levelOverride returns the level of the response compressed with enc, if
+// it has been overridden, removing the internal header from the response.
+func (w *compressWriter) levelOverride(enc string) (int, bool) {
+	lo := w.config.levels
+	var (
+		level int
+		ok    bool
+	)
+	if w.ctx != nil {
+		if levels, found := w.ctx.Value(levelKey{}).(map[string]int); found {
+			level, ok = levels[enc]
+		}
+	}
+	if lo.header == "" {
+		return level, ok
+	}
+	for _, v := range w.Header().Values(lo.header) {
+		for _, pair := range strings.Split(v, ",") {
+			e, l, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if !found || strings.TrimSpace(e) != enc {
+				continue
+			}
+			if n, err := strconv.Atoi(strings.TrimSpace(l)); err == nil {
+				level, ok = n, true
+			}
+		}
+	}
+	w.Header().Del(lo.header)
+	return level, ok
+}
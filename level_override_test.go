@@ -0,0 +1,73 @@
+package httpcompression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelOverrides(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat(testBody, 20)
+	// The gzip streams record the extremes of the levels in their header.
+	gzipLevel := func(b []byte) byte {
+		if len(b) < 10 {
+			return 0
+		}
+		return b[8] // XFL: 2 for the best compression, 4 for the fastest
+	}
+	a, err := DefaultAdapter(GzipCompressionLevel(9), LevelOverrides("X-Compression-Level"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		if v := r.URL.Query().Get("level"); v != "" {
+			w.Header().Set("X-Compression-Level", v)
+		}
+		io.WriteString(w, body)
+	}))
+	serve := func(req *http.Request, accept string) *httptest.ResponseRecorder {
+		req.Header.Set(acceptEncoding, accept)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Empty(t, res.Header().Values("X-Compression-Level"))
+		return res
+	}
+	check := func(res *httptest.ResponseRecorder) []byte {
+		assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+		zr, err := gzip.NewReader(bytes.NewReader(res.Body.Bytes()))
+		if assert.NoError(t, err) {
+			b, err := io.ReadAll(zr)
+			assert.NoError(t, err)
+			assert.Equal(t, body, string(b))
+		}
+		return res.Body.Bytes()
+	}
+
+	assert.Equal(t, byte(2), gzipLevel(check(serve(httptest.NewRequest("GET", "/", nil), "gzip"))))
+
+	// Set by the handler.
+	assert.Equal(t, byte(4), gzipLevel(check(serve(httptest.NewRequest("GET", "/?level=br%3D5,+gzip%3D1", nil), "gzip"))))
+
+	// Set in the context.
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(WithCompressionLevel(WithCompressionLevel(context.Background(), "gzip", 1), "br", 3))
+	assert.Equal(t, byte(4), gzipLevel(check(serve(req, "gzip"))))
+
+	// The invalid levels are ignored.
+	assert.Equal(t, byte(2), gzipLevel(check(serve(httptest.NewRequest("GET", "/?level=gzip%3D42", nil), "gzip"))))
+
+	// The header is removed also from the responses that are not compressed.
+	res := serve(httptest.NewRequest("GET", "/?level=gzip%3D1", nil), "identity")
+	assert.Empty(t, res.Header().Get(contentEncoding))
+	assert.Equal(t, body, res.Body.String())
+}
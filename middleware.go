@@ -0,0 +1,241 @@
+package httpcompression
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Middleware is a middleware whose options can be replaced at runtime (e.g.
+// on SIGHUP, or when a remote configuration changes) with Reload, without
+// recreating the handlers it wraps and without losing its pools.
+// A Middleware is safe for concurrent use.
+type Middleware struct {
+	base     []Option // prepended to the options passed to Reload
+	pools    *pools
+	stats    *adminStats
+	shutdown shutdown
+	disabled atomic.Bool        // see Disable
+	mu       sync.Mutex         // serializes the updates of state and retired
+	state    atomic.Value       // *middlewareState
+	retired  []*middlewareState // the previous states still serving requests
+}
+
+// middlewareState is the middleware built from the options of a Reload.
+type middlewareState struct {
+	config   config
+	adapter  func(http.Handler) http.Handler
+	requests drain // the requests served with this state
+}
+
+// current returns the state of the last Reload.
+func (m *Middleware) current() *middlewareState {
+	s, _ := m.state.Load().(*middlewareState)
+	return s
+}
+
+// NewMiddleware returns a Middleware using opts, like Adapter.
+// An error will be returned if invalid options are given.
+func NewMiddleware(opts ...Option) (*Middleware, error) {
+	m := &Middleware{pools: &pools{}, stats: newAdminStats()}
+	if err := m.Reload(opts...); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DefaultMiddleware is like NewMiddleware, but it includes the defaults of
+// DefaultAdapter, both initially and in each Reload.
+// The provided opts override the defaults.
+func DefaultMiddleware(opts ...Option) (*Middleware, error) {
+	m := &Middleware{base: defaultOptions(), pools: &pools{}, stats: newAdminStats()}
+	if err := m.Reload(opts...); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload atomically replaces the options of the middleware with opts: the
+// requests received after Reload returns use the new options, while the
+// requests being served keep using the previous ones. If invalid options are
+// given an error is returned, and the previous options are kept.
+func (m *Middleware) Reload(opts ...Option) error {
+	c, err := newConfig(append(m.base[:len(m.base):len(m.base)], opts...)...)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store(c)
+	return nil
+}
+
+// update applies opts on top of the current options of the middleware.
+// The options passed to the next Reload replace them.
+func (m *Middleware) update(opts ...Option) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.updateLocked(opts...)
+}
+
+// updateLocked is like update, but m.mu must be held.
+func (m *Middleware) updateLocked(opts ...Option) error {
+	cur := m.current().config
+	c, err := newConfig(append([]Option{func(c *config) error {
+		*c = cur.clone()
+		return nil
+	}}, opts...)...)
+	if err != nil {
+		return err
+	}
+	m.store(c)
+	return nil
+}
+
+// store makes c the current configuration of the middleware. The responses
+// are counted in the statistics of the middleware (see AdminHandler), also
+// for the routes of c.
+func (m *Middleware) store(c config) {
+	ac := c.clone()
+	hook := m.stats.hook()
+	ac.hooks = append(ac.hooks, hook)
+	for i, rt := range ac.routes {
+		rc := *rt.config
+		rc.hooks = append(rc.hooks[:len(rc.hooks):len(rc.hooks)], hook)
+		ac.routes[i].config = &rc
+	}
+	state := &middlewareState{config: c, adapter: adapter(ac, m.pools), requests: newDrain()}
+	state.registerProviders()
+	prev, _ := m.state.Swap(state).(*middlewareState)
+	if prev == nil {
+		return
+	}
+	prev.requests.close()
+	var drained []*middlewareState
+	retired := m.retired[:0]
+	for _, s := range append(m.retired, prev) {
+		if s.requests.drained() {
+			drained = append(drained, s)
+		} else {
+			retired = append(retired, s)
+		}
+	}
+	m.retired = retired
+	m.forgetProviders(drained)
+}
+
+// configs returns the configuration of s and the ones of its routes.
+func (s *middlewareState) configs() []*config {
+	configs := []*config{&s.config}
+	for _, rt := range s.config.routes {
+		configs = append(configs, rt.config)
+	}
+	return configs
+}
+
+// registerProviders registers the caches of the dictionary providers of s
+// with its DictionaryStores: SwapDictionaryCompressor replaces them.
+func (s *middlewareState) registerProviders() {
+	for _, c := range s.configs() {
+		if c.dict != nil {
+			for _, st := range c.dict.stores {
+				st.register(c.dict.providers)
+			}
+		}
+	}
+}
+
+// forgetProviders unregisters from their DictionaryStores the caches of the
+// dictionary providers of the drained states, unless they are still used by
+// the current or by the other retired states.
+func (m *Middleware) forgetProviders(drained []*middlewareState) {
+	if len(drained) == 0 {
+		return
+	}
+	used := map[*sync.Map]bool{}
+	for _, s := range append([]*middlewareState{m.current()}, m.retired...) {
+		for _, c := range s.configs() {
+			if c.dict != nil {
+				used[c.dict.providers] = true
+			}
+		}
+	}
+	for _, s := range drained {
+		for _, c := range s.configs() {
+			if c.dict == nil || used[c.dict.providers] {
+				continue
+			}
+			for _, st := range c.dict.stores {
+				st.unregister(c.dict.providers)
+			}
+		}
+	}
+}
+
+// With returns a new Middleware using the current options of m, plus opts
+// (e.g. m.With(MinSize(0)) for a streaming endpoint). The new Middleware
+// shares the pools and the compressors of m, but it is independent from it:
+// reloading one of them does not affect the other. The options passed to
+// Reload on the new Middleware are applied on top of the current options
+// of m, plus opts.
+// An error will be returned if invalid options are given.
+func (m *Middleware) With(opts ...Option) (*Middleware, error) {
+	base := m.current().config
+	d := &Middleware{
+		base: append([]Option{func(c *config) error {
+			*c = base.clone()
+			return nil
+		}}, opts...),
+		pools: m.pools,
+		stats: newAdminStats(),
+	}
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Wrap returns a handler that compresses the responses of h using the
+// current options of the middleware.
+func (m *Middleware) Wrap(h http.Handler) http.Handler {
+	return &reloadingHandler{m: m, h: h}
+}
+
+type reloadingHandler struct {
+	m       *Middleware
+	h       http.Handler
+	current atomic.Value // *reloadedHandler
+}
+
+// reloadedHandler is the handler wrapped with the middleware of a Reload.
+type reloadedHandler struct {
+	state   *middlewareState
+	handler http.Handler
+}
+
+func (rh *reloadingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if rh.m.disabled.Load() {
+		// The compression has been disabled (see Disable).
+		rh.h.ServeHTTP(w, r)
+		return
+	}
+	if !rh.m.shutdown.begin() {
+		// The middleware has been shut down (see Shutdown).
+		rh.h.ServeHTTP(w, r)
+		return
+	}
+	defer rh.m.shutdown.end()
+	state := rh.m.current()
+	for !state.requests.begin() {
+		// The options have just been replaced.
+		state = rh.m.current()
+	}
+	defer state.requests.end()
+	cur, _ := rh.current.Load().(*reloadedHandler)
+	if cur == nil || cur.state != state {
+		// The options changed since the last request: wrap the handler again.
+		cur = &reloadedHandler{state: state, handler: state.adapter(rh.h)}
+		rh.current.Store(cur)
+	}
+	cur.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,119 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareReload(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	m, err := DefaultMiddleware()
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(testBody))
+	}))
+	get := func() string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip, br")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res.Header().Get(contentEncoding)
+	}
+
+	assert.Equal(t, "br", get())
+	assert.NoError(t, m.Reload(BrotliCompressor(nil)))
+	assert.Equal(t, "gzip", get())
+	assert.NoError(t, m.Reload(MinSize(len(testBody)+1)))
+	assert.Equal(t, "", get())
+
+	// Invalid options keep the previous ones.
+	assert.Error(t, m.Reload(MinSize(-1)))
+	assert.Equal(t, "", get())
+	assert.NoError(t, m.Reload())
+	assert.Equal(t, "br", get())
+
+	_, err = NewMiddleware(MinSize(-1))
+	assert.Error(t, err)
+}
+
+func TestMiddlewareReloadConcurrent(t *testing.T) {
+	t.Parallel()
+
+	m, err := DefaultMiddleware()
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testBody))
+	}))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				req := httptest.NewRequest("GET", "/", nil)
+				req.Header.Set(acceptEncoding, "gzip, br")
+				res := httptest.NewRecorder()
+				h.ServeHTTP(res, req)
+				if enc := res.Header().Get(contentEncoding); enc != "br" && enc != "gzip" {
+					t.Errorf("unexpected encoding %q", enc)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		if i%2 == 0 {
+			assert.NoError(t, m.Reload(BrotliCompressor(nil)))
+		} else {
+			assert.NoError(t, m.Reload())
+		}
+	}
+	wg.Wait()
+}
+
+func TestMiddlewareWith(t *testing.T) {
+	t.Parallel()
+
+	m, err := DefaultMiddleware(MinSize(len(testBody) + 1))
+	if !assert.NoError(t, err) {
+		return
+	}
+	streaming, err := m.With(MinSize(0), BrotliCompressor(nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, m.pools, streaming.pools)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testBody))
+	})
+	get := func(h http.Handler) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip, br")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res.Header().Get(contentEncoding)
+	}
+	mh, sh := m.Wrap(handler), streaming.Wrap(handler)
+	assert.Equal(t, "", get(mh))
+	assert.Equal(t, "gzip", get(sh))
+
+	// Reloading the derived middleware keeps the options it was derived with.
+	assert.NoError(t, streaming.Reload(GzipCompressor(nil)))
+	assert.Equal(t, "", get(sh))
+	assert.NoError(t, streaming.Reload())
+	assert.Equal(t, "gzip", get(sh))
+	assert.Equal(t, "", get(mh))
+
+	_, err = m.With(MinSize(-1))
+	assert.Error(t, err)
+}
@@ -0,0 +1,335 @@
+package httpcompression
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+)
+
+const (
+	// partsMaxSize is the maximum size of the parts compressed by
+	// MixedReplaceParts: larger parts are sent as they are.
+	partsMaxSize = 1 << 20
+	// partsMaxHeaderSize is the maximum size of the headers of the parts.
+	partsMaxHeaderSize = 16 << 10
+)
+
+// MixedReplaceParts is an option that compresses the multipart/x-mixed-replace
+// streams (e.g. MJPEG streams, or streams of JSON documents) part by part,
+// instead of compressing the whole never-ending stream as one body: each
+// part for which compress returns true is compressed on its own with the
+// encoding negotiated for the response, and its headers get the
+// corresponding Content-Encoding (and Content-Length, if it was set), while
+// the other parts are sent as they are. The response is flushed at the end
+// of each part, so each part is delivered as soon as it is complete.
+//
+// The parts are compressed only for the clients decoding them according to
+// their own Content-Encoding: the response itself is not compressed. If
+// compress is nil, the parts that are not already compressed (e.g. JPEG
+// frames), that match ContentTypes and that are not smaller than MinSize
+// are compressed. The end of each part is detected by its Content-Length,
+// if set, or by the following boundary.
+func MixedReplaceParts(compress func(h textproto.MIMEHeader) bool) Option {
+	return func(c *config) error {
+		c.parts = &partsConfig{compress: compress}
+		return nil
+	}
+}
+
+type partsConfig struct {
+	compress func(h textproto.MIMEHeader) bool
+}
+
+// mixedReplaceBoundary returns the boundary of ct, if it is the type of a
+// multipart/x-mixed-replace stream.
+func mixedReplaceBoundary(ct string) (string, bool) {
+	if ct == "" {
+		return "", false
+	}
+	mt, params, err := mime.ParseMediaType(ct)
+	if err != nil || mt != "multipart/x-mixed-replace" || params["boundary"] == "" {
+		return "", false
+	}
+	return params["boundary"], true
+}
+
+// startParts starts the response as a stream of parts, if the option
+// MixedReplaceParts is used and the response is a multipart/x-mixed-replace
+// stream.
+func (w *compressWriter) startParts() error {
+	boundary, ok := mixedReplaceBoundary(w.Header().Get(contentType))
+	if !ok || w.Header().Get(contentEncoding) != "" {
+		return nil
+	}
+	p := &partsWriter{
+		cw:    w,
+		w:     w.ResponseWriter,
+		delim: []byte("\r\n--" + boundary),
+	}
+	if len(w.common) > 0 {
+		p.enc = preferredEncoding(w.accept, w.config.compressor, w.common, w.config.prefer)
+		p.provider = w.config.compressor[p.enc].comp
+	}
+	w.Header().Del(contentLength)
+	if err := w.startPlain(nil); err != nil {
+		return err
+	}
+	w.parts = p
+	return nil
+}
+
+type partsState int
+
+const (
+	partsPreamble partsState = iota // before a delimiter
+	partsHeader                     // after a delimiter, in the headers of a part
+	partsBody                       // in the body of a part
+	partsEpilogue                   // after the close delimiter
+)
+
+// partsWriter rewrites a multipart/x-mixed-replace stream, compressing the
+// bodies of its parts (see MixedReplaceParts).
+type partsWriter struct {
+	cw       *compressWriter
+	w        io.Writer
+	delim    []byte // CRLF "--" boundary
+	enc      string // the encoding of the parts, if any
+	provider CompressorProvider
+
+	state    partsState
+	pending  []byte               // the data not written yet
+	header   []byte               // the headers of the current part, as written by the handler
+	mime     textproto.MIMEHeader // the parsed headers of the current part
+	compress bool                 // the current part is being buffered to be compressed
+	length   int                  // the Content-Length of the current part, or -1
+	done     bool                 // a part has been completed since the last flush
+	started  bool                 // some data has been written
+}
+
+func (p *partsWriter) Write(b []byte) (int, error) {
+	p.pending = append(p.pending, b...)
+	err := p.process()
+	if p.done && err == nil {
+		p.done = false
+		err = http.NewResponseController(p.cw.ResponseWriter).Flush()
+		if errors.Is(err, http.ErrNotSupported) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// process writes the pending data that can be written.
+func (p *partsWriter) process() error {
+	for {
+		switch p.state {
+		case partsPreamble:
+			// The first delimiter may not be preceded by CRLF.
+			i, n := bytes.Index(p.pending, p.delim), len(p.delim)
+			if !p.started && bytes.HasPrefix(p.pending, p.delim[2:]) {
+				i, n = 0, len(p.delim)-2
+			}
+			if len(p.pending) < len(p.delim) && !p.started {
+				return nil
+			}
+			if i < 0 {
+				return p.writePending(len(p.pending) - len(p.delim) + 1)
+			}
+			// The delimiter is followed by "--" for the close delimiter.
+			if len(p.pending) < i+n+2 {
+				return p.writePending(i)
+			}
+			closing := bytes.HasPrefix(p.pending[i+n:], []byte("--"))
+			if err := p.writePending(i + n); err != nil {
+				return err
+			}
+			if closing {
+				p.state = partsEpilogue
+			} else {
+				p.state = partsHeader
+			}
+		case partsHeader:
+			// Skip the transport padding and the CRLF of the delimiter.
+			start := bytes.Index(p.pending, []byte("\r\n"))
+			end := -1
+			if start >= 0 {
+				end = bytes.Index(p.pending[start:], []byte("\r\n\r\n"))
+			}
+			if end < 0 {
+				if len(p.pending) > partsMaxHeaderSize {
+					// Not a valid part: send the rest of the stream as it is.
+					p.state = partsEpilogue
+					continue
+				}
+				return nil
+			}
+			end += start + 4
+			h, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(p.pending[start+2 : end]))).ReadMIMEHeader()
+			if err != nil {
+				p.state = partsEpilogue
+				continue
+			}
+			p.header, p.mime = append([]byte(nil), p.pending[:end]...), h
+			p.pending = p.pending[end:]
+			p.length = -1
+			if n, err := strconv.Atoi(h.Get(contentLength)); err == nil && n >= 0 {
+				p.length = n
+			}
+			p.compress = p.provider != nil && p.compressible(h)
+			if !p.compress {
+				if err := p.write(p.header); err != nil {
+					return err
+				}
+			}
+			p.state = partsBody
+		case partsBody:
+			end := -1
+			if p.length < 0 {
+				end = bytes.Index(p.pending, p.delim)
+			} else if len(p.pending) >= p.length {
+				end = p.length
+			}
+			if end < 0 {
+				if !p.compress {
+					n := len(p.pending)
+					if p.length < 0 {
+						n -= len(p.delim) - 1
+					}
+					return p.writeBody(n)
+				}
+				if len(p.pending) > partsMaxSize {
+					// Too large: send the part as it is.
+					p.compress = false
+					if err := p.write(p.header); err != nil {
+						return err
+					}
+					continue
+				}
+				return nil
+			}
+			if p.compress {
+				if err := p.writeCompressed(p.pending[:end]); err != nil {
+					return err
+				}
+				p.pending = p.pending[end:]
+			} else if err := p.writeBody(end); err != nil {
+				return err
+			}
+			p.done = true
+			p.state = partsPreamble
+		case partsEpilogue:
+			return p.writePending(len(p.pending))
+		}
+	}
+}
+
+// compressible reports whether the part with headers h must be compressed.
+func (p *partsWriter) compressible(h textproto.MIMEHeader) bool {
+	if h.Get(contentEncoding) != "" {
+		return false
+	}
+	if f := p.cw.config.parts.compress; f != nil {
+		return f(h)
+	}
+	ct := h.Get(contentType)
+	if ct != "" && handleContentType(ct, compressedParsedTypes, false) {
+		return false
+	}
+	if (ct != "" || len(p.cw.config.contentTypes) > 0) && !handleContentType(ct, p.cw.config.contentTypes, p.cw.config.blacklist) {
+		return false
+	}
+	return p.length < 0 || p.length >= p.cw.config.minSize
+}
+
+// writeCompressed writes the current part, whose body is body, compressed.
+func (p *partsWriter) writeCompressed(body []byte) error {
+	var buf bytes.Buffer
+	zw := p.provider.Get(&buf)
+	_, err := zw.Write(body)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || len(body) < p.cw.config.minSize || buf.Len() >= len(body) {
+		// Not worth it.
+		if err := p.write(p.header); err != nil {
+			return err
+		}
+		return p.write(body)
+	}
+	h := textproto.MIMEHeader{}
+	for k, v := range p.mime {
+		h[k] = v
+	}
+	h.Set(contentEncoding, p.enc)
+	if p.length >= 0 {
+		h.Set(contentLength, strconv.Itoa(buf.Len()))
+	}
+	start := bytes.Index(p.header, []byte("\r\n")) + 2
+	hdr := append([]byte(nil), p.header[:start]...)
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			hdr = append(append(append(append(hdr, k...), ": "...), v...), "\r\n"...)
+		}
+	}
+	if err := p.write(append(hdr, "\r\n"...)); err != nil {
+		return err
+	}
+	return p.write(buf.Bytes())
+}
+
+// writeBody writes the first n bytes of the body of the current part.
+func (p *partsWriter) writeBody(n int) error {
+	if n > 0 && p.length >= 0 {
+		p.length -= n
+	}
+	return p.writePending(n)
+}
+
+// writePending writes the first n bytes of pending, if n is positive.
+func (p *partsWriter) writePending(n int) error {
+	if n <= 0 {
+		return nil
+	}
+	err := p.write(p.pending[:n])
+	p.pending = p.pending[n:]
+	return err
+}
+
+func (p *partsWriter) write(b []byte) error {
+	p.started = true
+	n, err := p.w.Write(b)
+	if err == nil && n < len(b) {
+		err = io.ErrShortWrite
+	}
+	return err
+}
+
+// close writes the data not written yet, as it is.
+func (p *partsWriter) close() error {
+	if p.state == partsBody && p.compress {
+		if err := p.write(p.header); err != nil {
+			return err
+		}
+	}
+	if err := p.writePending(len(p.pending)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// compressedParsedTypes are the parsed compressedContentTypes.
+var compressedParsedTypes, _ = parseContentTypes(compressedContentTypes)
@@ -0,0 +1,115 @@
+package httpcompression
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMixedReplaceParts(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	type part struct {
+		ct     string
+		length bool
+		body   string
+		enc    string
+	}
+	jpeg := "\xff\xd8\xff\xe0" + strings.Repeat("jpeg", 100)
+	parts := []part{
+		{"image/jpeg", true, jpeg, ""},
+		{"application/json", true, strings.Repeat(`{"a":1}`, 100), "br"},
+		{"application/json", false, strings.Repeat(`{"b":2}`, 100), "br"},
+		{"application/json", false, `{}`, ""},
+		{"image/jpeg", false, jpeg, ""},
+	}
+	a, err := DefaultAdapter(MixedReplaceParts(nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "multipart/x-mixed-replace; boundary=frame")
+		var b bytes.Buffer
+		for _, p := range parts {
+			fmt.Fprintf(&b, "--frame\r\nContent-Type: %s\r\n", p.ct)
+			if p.length {
+				fmt.Fprintf(&b, "Content-Length: %d\r\n", len(p.body))
+			}
+			fmt.Fprintf(&b, "\r\n%s\r\n", p.body)
+		}
+		b.WriteString("--frame--\r\n")
+		// Split the writes, so that the delimiters span multiple writes.
+		for s := b.Bytes(); len(s) > 0; {
+			n := min(len(s), 7)
+			w.Write(s[:n])
+			s = s[n:]
+		}
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, "br, gzip")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	assert.Empty(t, res.Header().Get(contentEncoding))
+	assert.Equal(t, acceptEncoding, res.Header().Get(vary))
+	assert.True(t, res.Flushed)
+	mr := multipart.NewReader(res.Body, "frame")
+	for i, p := range parts {
+		mp, err := mr.NextRawPart()
+		if !assert.NoError(t, err) {
+			return
+		}
+		enc := mp.Header.Get(contentEncoding)
+		assert.Equal(t, p.enc, enc, i)
+		raw, _ := io.ReadAll(mp)
+		if p.length {
+			assert.Equal(t, strconv.Itoa(len(raw)), mp.Header.Get(contentLength), i)
+		}
+		b, err := decodeBody(bytes.NewReader(raw), enc)
+		assert.NoError(t, err)
+		assert.Equal(t, p.body, string(b), i)
+	}
+	_, err = mr.NextRawPart()
+	assert.Equal(t, io.EOF, err)
+
+	// The parts are selected by the function.
+	a, err = DefaultAdapter(MixedReplaceParts(func(h textproto.MIMEHeader) bool {
+		return h.Get(contentType) == "image/jpeg"
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h = a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "multipart/x-mixed-replace; boundary=frame")
+		io.WriteString(w, "--frame\r\nContent-Type: image/jpeg\r\n\r\n"+testBody+"\r\n--frame--")
+	}))
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	mr = multipart.NewReader(res.Body, "frame")
+	mp, err := mr.NextRawPart()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "br", mp.Header.Get(contentEncoding))
+		b, err := decodeBody(mp, "br")
+		assert.NoError(t, err)
+		assert.Equal(t, testBody, string(b))
+	}
+
+	// The other responses are not affected.
+	h = a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		io.WriteString(w, testBody)
+	}))
+	res = httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	assert.Equal(t, "br", res.Header().Get(contentEncoding))
+}
@@ -0,0 +1,78 @@
+package httpcompression
+
+import "net/http"
+
+// ServeMux wraps an http.ServeMux, allowing to use different compression
+// options for each pattern (e.g. "GET /api/{rest...}" or "/static/").
+//
+// The options passed to NewServeMux apply to all patterns, and the options
+// passed when registering each pattern are applied on top of them. All
+// patterns share the same pools, and the compressors configured by the
+// options passed to NewServeMux are shared as well, so registering many
+// patterns is much cheaper than creating a separate Adapter for each one.
+//
+// Patterns are matched by the wrapped http.ServeMux, so all the pattern
+// features of http.ServeMux (methods, hosts and wildcards) are supported.
+type ServeMux struct {
+	mux   *http.ServeMux
+	base  config
+	pools *pools
+}
+
+// NewServeMux returns a ServeMux that registers patterns in mux. If mux is
+// nil a new http.ServeMux is used.
+// The provided opts apply to all patterns registered in the ServeMux.
+// An error will be returned if invalid options are given.
+func NewServeMux(mux *http.ServeMux, opts ...Option) (*ServeMux, error) {
+	if mux == nil {
+		mux = http.NewServeMux()
+	}
+	c, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ServeMux{mux: mux, base: c, pools: &pools{}}, nil
+}
+
+// With returns a middleware using the options of the ServeMux, plus opts.
+// The middleware shares the pools and compressors of the ServeMux, and can
+// be used to wrap handlers registered in the ServeMux:
+//
+//	jsonPreset, err := mux.With(httpcompression.ContentTypes([]string{"application/json"}, false))
+//	...
+//	mux.Handle("GET /api/{rest...}", jsonPreset(apiHandler))
+func (m *ServeMux) With(opts ...Option) (func(http.Handler) http.Handler, error) {
+	c := m.base.clone()
+	if err := c.apply(opts...); err != nil {
+		return nil, err
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return adapter(c, m.pools), nil
+}
+
+// Handle registers handler for pattern, compressing its responses using the
+// options of the ServeMux, plus opts.
+// Like http.ServeMux.Handle, it panics if pattern is invalid or conflicts with
+// an already registered pattern. An error will be returned if invalid options
+// are given.
+func (m *ServeMux) Handle(pattern string, handler http.Handler, opts ...Option) error {
+	a, err := m.With(opts...)
+	if err != nil {
+		return err
+	}
+	m.mux.Handle(pattern, a(handler))
+	return nil
+}
+
+// HandleFunc is like Handle, but it accepts a handler function.
+func (m *ServeMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request), opts ...Option) error {
+	return m.Handle(pattern, http.HandlerFunc(handler), opts...)
+}
+
+// ServeHTTP dispatches the request to the handler whose pattern most closely
+// matches the request. See http.ServeMux.ServeHTTP for details.
+func (m *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mux.ServeHTTP(w, r)
+}
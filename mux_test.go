@@ -0,0 +1,78 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeMux(t *testing.T) {
+	t.Parallel()
+
+	mux, err := NewServeMux(nil, GzipCompressionLevel(1), MinSize(10))
+	if !assert.NoError(t, err) {
+		return
+	}
+	handler := func(ct string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(contentType, ct)
+			w.Write([]byte(testBody))
+		}
+	}
+	assert.NoError(t, mux.Handle("GET /api/{rest...}", handler("application/json"), ContentTypes([]string{"application/json"}, false)))
+	assert.NoError(t, mux.Handle("GET /html/{rest...}", handler("text/html"), ContentTypes([]string{"application/json"}, false)))
+	assert.NoError(t, mux.HandleFunc("/big/", handler("text/plain"), MinSize(len(testBody)+1)))
+	assert.NoError(t, mux.HandleFunc("GET /other", handler("text/plain")))
+	assert.Error(t, mux.HandleFunc("/invalid/", handler("text/plain"), MinSize(-1)))
+
+	cases := []struct {
+		method, path string
+		encoding     string
+		status       int
+	}{
+		{"GET", "/api/v1/users", "gzip", 200},
+		{"POST", "/api/v1/users", "", 405},
+		{"GET", "/html/index.html", "", 200},
+		{"GET", "/big/file", "", 200},
+		{"GET", "/other", "gzip", 200},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+		assert.Equal(t, c.status, res.Code, "%s %s", c.method, c.path)
+		assert.Equal(t, c.encoding, res.Header().Get(contentEncoding), "%s %s", c.method, c.path)
+	}
+}
+
+func TestServeMuxWith(t *testing.T) {
+	t.Parallel()
+
+	mux, err := NewServeMux(http.NewServeMux(), GzipCompressionLevel(1))
+	if !assert.NoError(t, err) {
+		return
+	}
+	small, err := mux.With(MinSize(0))
+	if !assert.NoError(t, err) {
+		return
+	}
+	mux.mux.Handle("/small", small(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(smallTestBody))
+	})))
+
+	req := httptest.NewRequest("GET", "/small", nil)
+	req.Header.Set(acceptEncoding, "gzip")
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, req)
+	assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+
+	// The options passed to With must not affect the base configuration.
+	assert.Equal(t, 0, mux.base.minSize)
+	_, err = mux.With(ContentTypes([]string{"text/plain"}, false))
+	assert.NoError(t, err)
+	assert.Empty(t, mux.base.contentTypes)
+}
@@ -0,0 +1,138 @@
+package httpcompression
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// NegotiationReport describes the negotiation of the encoding of a request
+// (see NegotiationHandler).
+type NegotiationReport struct {
+	// AcceptEncoding are the Accept-Encoding headers of the request, as
+	// received by the server.
+	AcceptEncoding []string `json:"acceptEncoding"`
+	// Parsed are the encodings parsed from AcceptEncoding, with their
+	// q-values.
+	Parsed map[string]float64 `json:"parsed"`
+	// Gates are the options that changed the accepted encodings for the
+	// request (e.g. "Intermediaries" or "SecretURLs").
+	Gates []string `json:"gates,omitempty"`
+	// Accepted are the encodings accepted for the request, with their
+	// q-values, once the Gates have been applied.
+	Accepted map[string]float64 `json:"accepted"`
+	// Candidates are the configured encodings that are accepted, in order
+	// of preference.
+	Candidates []NegotiationCandidate `json:"candidates"`
+	// Prefer is "server" or "client" (see Prefer).
+	Prefer string `json:"prefer"`
+	// Dictionary is the dictionary encoding negotiated for the request
+	// (see Dictionaries), if any: it is preferred to the Candidates.
+	Dictionary string `json:"dictionary,omitempty"`
+	// Chosen is the encoding that is used for the responses to the request,
+	// if they are large enough and of a compressible Content-Type; it is
+	// empty if the responses are not compressed.
+	Chosen string `json:"chosen"`
+	// Reason explains why Chosen was chosen.
+	Reason string `json:"reason"`
+}
+
+// NegotiationCandidate is an encoding that can be used for the responses to
+// a request (see NegotiationReport).
+type NegotiationCandidate struct {
+	Encoding string  `json:"encoding"`
+	Priority int     `json:"priority"`
+	QValue   float64 `json:"qvalue"`
+}
+
+// NegotiationHandler returns a diagnostic handler that responds to each
+// request with a JSON NegotiationReport describing how the middleware
+// configured with opts (the options of Adapter) negotiates the encoding for
+// it: what it parsed from the Accept-Encoding headers, which options
+// restricted the accepted encodings, and which encoding it chose and why.
+// Mounted behind the same CDNs and proxies of the application (e.g. at
+// /debug/compression), it shows how they modify the Accept-Encoding headers.
+// To describe DefaultAdapter, include its defaults with DefaultOptions.
+// The choice does not depend on the responses, so it does not take into
+// account the options depending on them (e.g. MinSize or LearnEncodings).
+func NegotiationHandler(opts ...Option) (http.Handler, error) {
+	c, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rep := c.negotiationReport(w, r)
+		b, err := json.MarshalIndent(rep, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(contentType, "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(append(b, '\n'))
+	}), nil
+}
+
+func (c *config) negotiationReport(w http.ResponseWriter, r *http.Request) NegotiationReport {
+	c = c.route(r)
+	accept := parseEncodings(r.Header.Values(acceptEncoding))
+	rep := NegotiationReport{
+		AcceptEncoding: r.Header.Values(acceptEncoding),
+		Parsed:         accept.clone(),
+		Prefer:         "server",
+	}
+	if c.prefer == PreferClient {
+		rep.Prefer = "client"
+	}
+	c.gateEncodings(w, r, accept, func(option string) {
+		rep.Gates = append(rep.Gates, option)
+	})
+	rep.Accepted = accept
+
+	common := acceptedCompression(accept, c.compressor)
+	if len(common) > 0 {
+		preferredEncoding(accept, c.compressor, common, c.prefer) // sorts common
+	}
+	for _, enc := range common {
+		rep.Candidates = append(rep.Candidates, NegotiationCandidate{
+			Encoding: enc,
+			Priority: c.compressor[enc].priority,
+			QValue:   accept[enc],
+		})
+	}
+	if c.dict.enabled() {
+		if dict := c.dict.negotiate(r, accept); dict != nil {
+			rep.Dictionary = dict.enc
+			rep.Chosen = dict.enc
+			rep.Reason = "the client has the dictionary advertised in " + availableDictionary
+			return rep
+		}
+	}
+
+	switch {
+	case len(rep.Candidates) == 0:
+		rep.Reason = "none of the configured encodings is accepted"
+	case len(rep.Candidates) == 1:
+		rep.Chosen = rep.Candidates[0].Encoding
+		rep.Reason = "it is the only configured encoding that is accepted"
+	default:
+		first, second := rep.Candidates[0], rep.Candidates[1]
+		rep.Chosen = first.Encoding
+		byPriority := fmt.Sprintf("its priority (%d) is higher than the one of %s (%d)", first.Priority, second.Encoding, second.Priority)
+		byQValue := fmt.Sprintf("its q-value (%g) is higher than the one of %s (%g)", first.QValue, second.Encoding, second.QValue)
+		switch {
+		case c.prefer == PreferServer && first.Priority != second.Priority:
+			rep.Reason = byPriority + ", and the server preference is used"
+		case first.QValue != second.QValue:
+			rep.Reason = byQValue
+			if c.prefer == PreferServer {
+				rep.Reason += ", and their priority is the same"
+			}
+		case first.Priority != second.Priority:
+			rep.Reason = byPriority + ", and their q-value is the same"
+		default:
+			rep.Reason = fmt.Sprintf("its priority and q-value are the same of %s, and its name comes first", second.Encoding)
+		}
+	}
+	return rep
+}
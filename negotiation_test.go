@@ -0,0 +1,60 @@
+package httpcompression
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiationHandler(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		opts   []Option
+		accept string
+		target string
+		chosen string
+		gates  []string
+		reason string
+	}{
+		{"server", nil, "gzip, br;q=0.5, zstd;q=0.1", "/", "zstd", nil, "priority"},
+		{"client", []Option{Prefer(PreferClient)}, "gzip, br;q=0.5, zstd;q=0.1", "/", "gzip", nil, "q-value"},
+		{"client same q-value", []Option{Prefer(PreferClient)}, "gzip, zstd", "/", "zstd", nil, "priority"},
+		{"only", nil, "gzip, unknown", "/", "gzip", nil, "only"},
+		{"none", nil, "", "/", "", nil, "none"},
+		{"secret", []Option{SecretURLs(`^/account`)}, "gzip, zstd", "/account?id=1", "", []string{"SecretURLs"}, "none"},
+	}
+	for _, c := range cases {
+		h, err := NegotiationHandler(append(DefaultOptions(), c.opts...)...)
+		if !assert.NoError(t, err, c.name) {
+			continue
+		}
+		req := httptest.NewRequest("GET", c.target, nil)
+		if c.accept != "" {
+			req.Header.Set(acceptEncoding, c.accept)
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, "application/json", res.Header().Get(contentType), c.name)
+
+		var rep NegotiationReport
+		if !assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &rep), c.name) {
+			continue
+		}
+		assert.Equal(t, c.chosen, rep.Chosen, c.name)
+		assert.Equal(t, c.gates, rep.Gates, c.name)
+		assert.Contains(t, rep.Reason, c.reason, c.name)
+		if c.chosen != "" {
+			assert.Equal(t, c.chosen, rep.Candidates[0].Encoding, c.name)
+		}
+		if c.accept != "" {
+			assert.Equal(t, []string{c.accept}, rep.AcceptEncoding, c.name)
+			assert.Len(t, rep.Parsed, strings.Count(c.accept, ",")+1, c.name)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package httpcompression
+
+import "net/http"
+
+// OnNested is an option that sets a function called for each request
+// handled by a middleware that is nested inside another instance of the
+// middleware (e.g. because both a router and one of its handlers have been
+// wrapped), for example to log a warning about the misconfiguration. The
+// nested middlewares never compress the responses, whether OnNested is set
+// or not: the handler is called as if it were not wrapped, and the outer
+// middleware compresses the response, so that it is never compressed twice.
+func OnNested(warn func(r *http.Request)) Option {
+	return func(c *config) error {
+		c.nested = warn
+		return nil
+	}
+}
+
+// nestedRequest reports whether r is handled by another instance of the
+// middleware, that marks the requests in their context (see
+// EncodingFromRequest).
+func nestedRequest(r *http.Request) bool {
+	_, ok := r.Context().Value(encodingKey{}).(string)
+	return ok
+}
@@ -0,0 +1,46 @@
+package httpcompression
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNested(t *testing.T) {
+	t.Parallel()
+
+	var warnings atomic.Int32
+	outer, err := DefaultAdapter()
+	if !assert.NoError(t, err) {
+		return
+	}
+	inner, err := DefaultAdapter(OnNested(func(r *http.Request) {
+		warnings.Add(1)
+		assert.Equal(t, "/nested", r.URL.Path)
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := outer(inner(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gzip", EncodingFromRequest(r))
+		w.Header().Set(contentType, "text/plain")
+		io.WriteString(w, testBody)
+	})))
+
+	req := httptest.NewRequest("GET", "/nested", nil)
+	req.Header.Set(acceptEncoding, "gzip")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+
+	assert.EqualValues(t, 1, warnings.Load())
+	assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+	assert.Equal(t, []string{acceptEncoding}, res.Header().Values(vary))
+	d, err := decodeGzip(bytes.NewReader(res.Body.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, testBody, string(d))
+}
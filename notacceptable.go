@@ -0,0 +1,77 @@
+package httpcompression
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RejectNotAcceptable is an option that makes the middleware reject with a
+// 406 Not Acceptable response, without calling the handler, the requests
+// whose Accept-Encoding header excludes the identity encoding (e.g.
+// "identity;q=0" or "*;q=0") and accepts none of the configured encodings.
+// Without this option such requests are served uncompressed.
+//
+// The body of the response is an application/problem+json document (RFC
+// 9457) listing the supported encodings, so that the developers of the
+// clients can find out what they should accept.
+func RejectNotAcceptable() Option {
+	return func(c *config) error {
+		c.reject = true
+		return nil
+	}
+}
+
+// notAcceptable reports whether r has been rejected, as the client accepts
+// none of the encodings of the response (see RejectNotAcceptable).
+func (c *config) notAcceptable(w http.ResponseWriter, r *http.Request) bool {
+	accept := parseEncodings(r.Header.Values(acceptEncoding))
+	c.gateEncodings(w, r, accept, nil)
+	if acceptable(accept, identity) || len(acceptedCompression(accept, c.compressor)) > 0 {
+		return false
+	}
+	if c.dict.enabled() {
+		for enc := range c.dict.comps {
+			if accept[enc] > 0 {
+				return false
+			}
+		}
+	}
+	addVaryHeader(w.Header(), acceptEncoding)
+	writeNotAcceptable(w, c.responseEncodings())
+	return true
+}
+
+// notAcceptableProblem is the problem details document of the 406 responses.
+type notAcceptableProblem struct {
+	Type               string   `json:"type"`
+	Title              string   `json:"title"`
+	Status             int      `json:"status"`
+	Detail             string   `json:"detail"`
+	SupportedEncodings []string `json:"supportedEncodings"`
+}
+
+// writeNotAcceptable writes a 406 Not Acceptable response listing the
+// supported encodings ("identity" for the uncompressed content).
+func writeNotAcceptable(w http.ResponseWriter, encodings []string) {
+	p := notAcceptableProblem{
+		Type:               "about:blank",
+		Title:              http.StatusText(http.StatusNotAcceptable),
+		Status:             http.StatusNotAcceptable,
+		Detail:             "The Accept-Encoding header of the request accepts none of the supported encodings.",
+		SupportedEncodings: encodings,
+	}
+	if p.SupportedEncodings == nil {
+		p.SupportedEncodings = []string{}
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+		return
+	}
+	h := w.Header()
+	h.Del(contentEncoding)
+	h.Set(contentType, "application/problem+json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusNotAcceptable)
+	w.Write(append(b, '\n'))
+}
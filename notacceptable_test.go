@@ -0,0 +1,53 @@
+package httpcompression
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRejectNotAcceptable(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	a, err := DefaultAdapter(RejectNotAcceptable())
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(testBody))
+	}))
+	cases := []struct {
+		accept string
+		status int
+		enc    string
+	}{
+		{"", 200, ""},
+		{"xz", 200, ""},
+		{"gzip, identity;q=0", 200, "gzip"},
+		{"xz, identity;q=0", 406, ""},
+		{"xz, *;q=0", 406, ""},
+		{"*;q=0, identity", 200, ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, c.accept)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, c.status, res.Code, c.accept)
+		assert.Equal(t, c.enc, res.Header().Get(contentEncoding), c.accept)
+		if c.status == 200 {
+			continue
+		}
+		assert.Equal(t, "application/problem+json", res.Header().Get(contentType), c.accept)
+		var p notAcceptableProblem
+		if assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &p), c.accept) {
+			assert.Equal(t, 406, p.Status, c.accept)
+			assert.Equal(t, []string{"zstd", "br", "gzip", "deflate"}, p.SupportedEncodings, c.accept)
+		}
+	}
+}
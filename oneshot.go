@@ -0,0 +1,69 @@
+package httpcompression
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encoder is an optional interface that can be implemented by the
+// CompressorProviders that can compress a whole buffer at once (e.g. with
+// zstd's EncodeAll), which is cheaper than setting up a streaming compressor
+// for small responses (see OneShotMaxSize).
+type Encoder interface {
+	// EncodeAll appends to dst the compressed stream of src, and returns
+	// the extended buffer.
+	EncodeAll(src, dst []byte) ([]byte, error)
+}
+
+// OneShotMaxSize is an option that buffers the responses up to size bytes
+// (at most 64KB) until they are complete, so that they are compressed at
+// once if the compressor of the negotiated encoding implements Encoder (the
+// klauspost zstd and the cbrotli providers do), using a pooled scratch
+// buffer instead of a streaming compressor. The responses whose
+// Content-Length is larger are streamed as usual, and, as the responses can
+// not be compressed until they reach size bytes or they are complete,
+// flushing the responses starts the streaming compressor. It is disabled by default, and it has
+// no effect with the Deterministic option.
+func OneShotMaxSize(size int) Option {
+	if size < 0 || size > maxBuf {
+		return errorOption("OneShotMaxSize", fmt.Errorf("invalid one-shot maximum size: %d", size))
+	}
+	return func(c *config) error {
+		c.oneShot = size
+		return nil
+	}
+}
+
+var errOneShotWrite = errors.New("httpcompression: write after a one-shot compression")
+
+// oneShotWriter is the compressor of a complete response, that it
+// compresses at once, with an Encoder, when it is written.
+type oneShotWriter struct {
+	e    Encoder
+	w    io.Writer
+	cw   *compressWriter // for the scratch buffers
+	done bool
+}
+
+func (o *oneShotWriter) Write(b []byte) (int, error) {
+	if o.done {
+		return 0, errOneShotWrite
+	}
+	o.done = true
+	buf := o.cw.getBuffer()
+	defer o.cw.putBuffer(buf)
+	out, err := o.e.EncodeAll(b, (*buf)[:0])
+	if err != nil {
+		return 0, err
+	}
+	*buf = out
+	if err := writeAll(o.w, out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (o *oneShotWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,109 @@
+package httpcompression
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+// oneShotProvider counts the streaming compressors and the one-shot
+// compressions of the zstd compressor it wraps.
+type oneShotProvider struct {
+	c interface {
+		CompressorProvider
+		Encoder
+	}
+	streams atomic.Int32
+	shots   atomic.Int32
+}
+
+func (p *oneShotProvider) Get(w io.Writer) io.WriteCloser {
+	p.streams.Add(1)
+	return p.c.Get(w)
+}
+
+func (p *oneShotProvider) EncodeAll(src, dst []byte) ([]byte, error) {
+	p.shots.Add(1)
+	return p.c.EncodeAll(src, dst)
+}
+
+func TestOneShotMaxSize(t *testing.T) {
+	t.Parallel()
+
+	small := testBody[:2000]
+	large := strings.Repeat(testBody, 10)
+	for _, tc := range []struct {
+		name    string
+		body    string
+		chunks  int
+		length  bool
+		flush   bool
+		oneShot bool
+	}{
+		{name: "small", body: small, chunks: 1, oneShot: true},
+		{name: "small in chunks", body: small, chunks: 4, oneShot: true},
+		{name: "small with length", body: small, chunks: 1, length: true, oneShot: true},
+		{name: "small flushed", body: small, chunks: 2, flush: true},
+		{name: "large", body: large, chunks: 1},
+		{name: "large with length", body: large, chunks: 1, length: true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := zstd.New()
+			if !assert.NoError(t, err) {
+				return
+			}
+			p := &oneShotProvider{c: c}
+			a, err := Adapter(ZstandardCompressor(p), MinSize(100), OneShotMaxSize(4096))
+			if !assert.NoError(t, err) {
+				return
+			}
+			h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(contentType, "text/plain")
+				if tc.length {
+					w.Header().Set(contentLength, strconv.Itoa(len(tc.body)))
+				}
+				size := len(tc.body) / tc.chunks
+				for i := 0; i < tc.chunks; i++ {
+					chunk := tc.body[i*size:]
+					if i < tc.chunks-1 {
+						chunk = chunk[:size]
+					}
+					io.WriteString(w, chunk)
+					if tc.flush {
+						w.(http.Flusher).Flush()
+					}
+				}
+			}))
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(acceptEncoding, "zstd")
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+
+			assert.Equal(t, "zstd", res.Header().Get(contentEncoding))
+			d, err := decodeBody(bytes.NewReader(res.Body.Bytes()), "zstd")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.body, string(d))
+			if tc.oneShot {
+				assert.EqualValues(t, 1, p.shots.Load())
+				assert.EqualValues(t, 0, p.streams.Load())
+			} else {
+				assert.EqualValues(t, 0, p.shots.Load())
+				assert.EqualValues(t, 1, p.streams.Load())
+			}
+		})
+	}
+
+	_, err := Adapter(OneShotMaxSize(-1))
+	assert.Error(t, err)
+}
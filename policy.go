@@ -0,0 +1,77 @@
+package httpcompression
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// PolicySkipHeader is an option that marks the responses that are not
+// compressed because of a policy, so that the proxies and the CDNs in front
+// of the server do not compress them either: value is added to the header
+// name (e.g. PolicySkipHeader("Cache-Control", "no-transform"), or a header
+// recognized by the CDN) of the responses to the requests matching
+// SecretURLs, whose Content-Type is excluded by ContentTypes, or with a
+// Cache-Control: no-transform directive. With this option the middleware
+// itself honors the no-transform directive set by the handlers, and does
+// not compress their responses.
+//
+// The responses that are not compressed because of their size, or because
+// the client does not accept a compression, are not marked.
+func PolicySkipHeader(name, value string) Option {
+	if name == "" || value == "" {
+		return errorOption("PolicySkipHeader", errors.New("policy skip header name and value can not be empty"))
+	}
+	return func(c *config) error {
+		c.skipHeader = &skipHeader{name: http.CanonicalHeaderKey(name), value: value}
+		return nil
+	}
+}
+
+type skipHeader struct {
+	name  string
+	value string
+}
+
+// mark adds the value of the header to h, unless it is already there.
+func (s *skipHeader) mark(h http.Header) {
+	cur := h.Get(s.name)
+	switch {
+	case cur == "":
+		h.Set(s.name, s.value)
+	case !hasToken(cur, s.value):
+		h.Set(s.name, cur+", "+s.value)
+	}
+}
+
+// noTransform reports whether the Cache-Control of h has the no-transform
+// directive.
+func noTransform(h http.Header) bool {
+	for _, v := range h.Values(cacheControl) {
+		if hasToken(v, "no-transform") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasToken reports whether the comma-separated list v contains token, in
+// any case.
+func hasToken(v, token string) bool {
+	for _, t := range strings.Split(v, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// policySkipped reports whether the response, sent uncompressed, was not
+// compressed because of a policy (see PolicySkipHeader).
+func (w *compressWriter) policySkipped() bool {
+	if w.secret || noTransform(w.Header()) {
+		return true
+	}
+	ct := w.Header().Get(contentType)
+	return ct != "" && !handleContentType(ct, w.config.contentTypes, w.config.blacklist)
+}
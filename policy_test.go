@@ -0,0 +1,67 @@
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicySkipHeader(t *testing.T) {
+	t.Parallel()
+
+	a, err := DefaultAdapter(
+		PolicySkipHeader("cache-control", "no-transform"),
+		SecretURLs(`^/secret`),
+		ContentTypes([]string{"application/x-secret"}, true),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ct := r.URL.Query().Get("ct")
+		if ct == "" {
+			ct = "text/plain"
+		}
+		w.Header().Set(contentType, ct)
+		if cc := r.URL.Query().Get("cc"); cc != "" {
+			w.Header().Set(cacheControl, cc)
+		}
+		io.WriteString(w, testBody)
+	}))
+	serve := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if accept != "" {
+			req.Header.Set(acceptEncoding, accept)
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	for _, tc := range []struct {
+		target, accept string
+		enc, cc        string
+	}{
+		{"/", "gzip", "gzip", ""},
+		{"/", "", "", ""}, // not a policy
+		{"/secret", "gzip", "", "no-transform"},
+		{"/secret", "", "", "no-transform"},
+		{"/?ct=application/x-secret", "gzip", "", "no-transform"},
+		{"/?cc=max-age=60", "gzip", "gzip", "max-age=60"},
+		{"/?cc=max-age=60,+No-Transform", "gzip", "", "max-age=60, No-Transform"},
+		{"/secret?cc=max-age=60", "gzip", "", "max-age=60, no-transform"},
+	} {
+		res := serve(tc.target, tc.accept)
+		assert.Equal(t, tc.enc, res.Header().Get(contentEncoding), tc.target)
+		assert.Equal(t, tc.cc, res.Header().Get(cacheControl), tc.target)
+		if tc.enc == "" {
+			assert.Equal(t, testBody, res.Body.String(), tc.target)
+		}
+	}
+
+	_, err = DefaultAdapter(PolicySkipHeader("", "1"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,115 @@
+//go:build httpcompression_pooldebug
+// +build httpcompression_pooldebug
+
+package httpcompression
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+)
+
+// The httpcompression_pooldebug build tag enables the detection of misuses
+// of the objects recycled by the middleware (the response writers passed to
+// the handlers, and their buffers), that otherwise result in hard to debug
+// corruptions of unrelated responses:
+//
+//   - use after Put: the response writer is used after the handler returned
+//     (e.g. by a goroutine started by the handler, or by a wrapper that kept
+//     a reference to it);
+//   - double Put: an object is recycled twice, so that it could be used by
+//     two requests at the same time.
+//
+// When a misuse is detected the middleware panics, reporting the stack trace
+// of the point where the object was recycled. The recycled buffers are also
+// poisoned, so that stale references to them read garbage instead of the
+// data of other responses.
+//
+// The detection has a significant overhead, so it is meant to be enabled
+// only in tests (e.g. go test -tags httpcompression_pooldebug ./...).
+
+// poolPoison is the byte the recycled buffers are filled with.
+const poolPoison = 0xA5
+
+// poolStates tracks the state of the pooled objects, by pointer. The
+// entries are never removed: the objects created by the pools are kept
+// alive, that is acceptable in debug builds.
+var poolStates sync.Map // any -> *poolState
+
+type poolState struct {
+	mu     sync.Mutex
+	pooled bool
+	stack  []byte // stack trace of the last Put
+}
+
+func poolStateOf(p any) *poolState {
+	s, _ := poolStates.LoadOrStore(p, &poolState{})
+	return s.(*poolState)
+}
+
+// poolGot records that p has been obtained from a pool (or created).
+func poolGot(p any) {
+	s := poolStateOf(p)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pooled = false
+}
+
+// poolPut records that p is being returned to a pool. It panics if p has
+// already been returned to the pool.
+func poolPut(p any) {
+	s := poolStateOf(p)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pooled {
+		panic(fmt.Sprintf("httpcompression: %T %p recycled twice; it was previously recycled at:\n%s", p, p, s.stack))
+	}
+	s.pooled, s.stack = true, debug.Stack()
+}
+
+// poolCheck panics if p has been returned to a pool.
+func poolCheck(p any, op string) {
+	s, ok := poolStates.Load(p)
+	if !ok {
+		return
+	}
+	ps := s.(*poolState)
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.pooled {
+		panic(fmt.Sprintf("httpcompression: %s called on %T %p after it was recycled at:\n%s", op, p, p, ps.stack))
+	}
+}
+
+// poolPoisonBuffer fills the buffer being recycled with garbage.
+func poolPoisonBuffer(buf *[]byte) {
+	b := (*buf)[:cap(*buf)]
+	for i := range b {
+		b[i] = poolPoison
+	}
+}
+
+// poolPoisonWriter makes the methods of the recycled response writer w that
+// are promoted from the ResponseWriter (e.g. Header) report the misuse.
+func poolPoisonWriter(w *compressWriter) {
+	w.ResponseWriter = poisonedResponseWriter{w}
+}
+
+type poisonedResponseWriter struct {
+	w *compressWriter
+}
+
+func (p poisonedResponseWriter) Header() http.Header {
+	poolCheck(p.w, "Header")
+	return http.Header{}
+}
+
+func (p poisonedResponseWriter) Write(b []byte) (int, error) {
+	poolCheck(p.w, "Write")
+	return 0, fmt.Errorf("httpcompression: write after the response writer was recycled")
+}
+
+func (p poisonedResponseWriter) WriteHeader(int) {
+	poolCheck(p.w, "WriteHeader")
+}
@@ -0,0 +1,71 @@
+//go:build httpcompression_pooldebug
+// +build httpcompression_pooldebug
+
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolDebugUseAfterPut(t *testing.T) {
+	t.Parallel()
+
+	var leaked http.ResponseWriter
+	mw, err := DefaultAdapter()
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = w
+		w.Write([]byte(testBody))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, "gzip")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	for name, use := range map[string]func(){
+		"Write":  func() { leaked.Write([]byte(testBody)) },
+		"Flush":  func() { leaked.(http.Flusher).Flush() },
+		"Header": func() { leaked.Header() },
+	} {
+		msg := recoverString(use)
+		assert.True(t, strings.Contains(msg, "after it was recycled"), "%s: %q", name, msg)
+	}
+}
+
+func TestPoolDebugDoublePut(t *testing.T) {
+	t.Parallel()
+
+	w := &compressWriter{}
+	poolGot(w)
+	poolPut(w)
+	msg := recoverString(func() { poolPut(w) })
+	assert.True(t, strings.Contains(msg, "recycled twice"), msg)
+
+	poolGot(w)
+	assert.NotPanics(t, func() { poolPut(w) })
+}
+
+func TestPoolDebugPoisonBuffer(t *testing.T) {
+	t.Parallel()
+
+	w := &compressWriter{pools: &pools{}}
+	w.buf = w.getBuffer()
+	*w.buf = append(*w.buf, "secret"...)
+	b := *w.buf
+	w.recycleBuffer()
+	assert.Equal(t, strings.Repeat("\xa5", len("secret")), string(b))
+}
+
+func recoverString(f func()) (msg string) {
+	defer func() {
+		msg, _ = recover().(string)
+	}()
+	f()
+	return ""
+}
@@ -0,0 +1,13 @@
+//go:build !httpcompression_pooldebug
+// +build !httpcompression_pooldebug
+
+package httpcompression
+
+// Without the httpcompression_pooldebug build tag the misuses of the pooled
+// objects are not detected (see pool_debug.go).
+
+func poolGot(any)                      {}
+func poolPut(any)                      {}
+func poolCheck(any, string)            {}
+func poolPoisonBuffer(*[]byte)         {}
+func poolPoisonWriter(*compressWriter) {}
@@ -0,0 +1,284 @@
+package httpcompression
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// PrecompressConfig controls the generation of precompressed variants by
+// Precompress and StartPrecompress.
+type PrecompressConfig struct {
+	// Concurrency is the maximum number of variants generated concurrently.
+	// If zero, runtime.GOMAXPROCS(0) is used.
+	Concurrency int
+	// Match, if not nil, selects the files for which variants are generated.
+	// The name is slash-separated and relative to the root of the file system.
+	Match func(name string) bool
+	// Check, if true, makes Precompress only check that the variants are up
+	// to date, without writing them: each variant that would be generated is
+	// reported as an error.
+	Check bool
+}
+
+// PrecompressStats are the results of Precompress.
+type PrecompressStats struct {
+	Files    int // Number of files for which variants were considered.
+	Created  int // Number of variants generated.
+	UpToDate int // Number of variants already present and up to date.
+	Skipped  int // Number of variants not generated because they are not smaller than the file (the stale ones are removed).
+}
+
+// Precompress generates the precompressed variants (".zst", ".br" and
+// ".gz", see FileServer) of the files in fsys that are missing or older than
+// the corresponding file, writing them in the directory dir. To generate the
+// variants next to the original files use os.DirFS(dir) as fsys.
+//
+// The variants are generated by the compressors configured in opts, that
+// are the same options accepted by Adapter: only the encodings for which a
+// compressor is configured are generated, and files smaller than MinSize or
+// whose Content-Type (as determined by their extension) is excluded by
+// ContentTypes are skipped. Variants are written atomically, so concurrent
+// readers never see partially-written variants.
+//
+// Precompress returns when all variants have been generated, or when ctx is
+// done. All the errors encountered are reported in the returned error.
+func Precompress(ctx context.Context, fsys fs.FS, dir string, cfg PrecompressConfig, opts ...Option) (PrecompressStats, error) {
+	p, err := newPrecompressor(fsys, dir, cfg, opts)
+	if err != nil {
+		return PrecompressStats{}, err
+	}
+	return p.run(ctx)
+}
+
+// StartPrecompress is like Precompress, but it generates the variants in the
+// background, so that it can be used to warm up the variants at startup
+// without delaying it. done, if not nil, is called once all variants have
+// been generated. An error is returned (and done is not called) only if the
+// options are invalid.
+func StartPrecompress(ctx context.Context, fsys fs.FS, dir string, cfg PrecompressConfig, done func(PrecompressStats, error), opts ...Option) error {
+	p, err := newPrecompressor(fsys, dir, cfg, opts)
+	if err != nil {
+		return err
+	}
+	go func() {
+		stats, err := p.run(ctx)
+		if done != nil {
+			done(stats, err)
+		}
+	}()
+	return nil
+}
+
+type precompressor struct {
+	fsys   fs.FS
+	dir    string
+	cfg    PrecompressConfig
+	config config
+	encs   []string // encodings of the variants to generate
+}
+
+func newPrecompressor(fsys fs.FS, dir string, cfg PrecompressConfig, opts []Option) (*precompressor, error) {
+	c, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	var encs []string
+	for _, v := range precompressedVariants {
+		if _, ok := c.compressor[v.enc]; ok {
+			encs = append(encs, v.enc)
+		}
+	}
+	if len(encs) == 0 {
+		return nil, errors.New("no compressor configured for the precompressed variants")
+	}
+	if cfg.Concurrency < 0 {
+		return nil, fmt.Errorf("precompress concurrency can not be negative: %d", cfg.Concurrency)
+	}
+	if cfg.Concurrency == 0 {
+		cfg.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	if fi, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("not a directory: %s", dir)
+	}
+	return &precompressor{fsys: fsys, dir: dir, cfg: cfg, config: c, encs: encs}, nil
+}
+
+type precompressJob struct {
+	name string
+	fi   fs.FileInfo
+	enc  string
+}
+
+type precompressResult int
+
+const (
+	precompressCreated precompressResult = iota
+	precompressUpToDate
+	precompressSkipped
+)
+
+func (p *precompressor) run(ctx context.Context) (PrecompressStats, error) {
+	var (
+		stats PrecompressStats
+		errs  []error
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		jobs  = make(chan precompressJob)
+	)
+	for i := 0; i < p.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if ctx.Err() != nil {
+					continue // drain the jobs already queued
+				}
+				res, err := p.precompress(j)
+				mu.Lock()
+				switch {
+				case err != nil:
+					errs = append(errs, err)
+				case res == precompressCreated:
+					stats.Created++
+				case res == precompressUpToDate:
+					stats.UpToDate++
+				case res == precompressSkipped:
+					stats.Skipped++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	err := fs.WalkDir(p.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || encodingFromExt(path.Ext(name)) != "" {
+			return nil
+		}
+		if p.cfg.Match != nil && !p.cfg.Match(name) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if fi.Size() < int64(p.config.minSize) || !handleContentType(mime.TypeByExtension(path.Ext(name)), p.config.contentTypes, p.config.blacklist) {
+			return nil
+		}
+		stats.Files++
+		for _, enc := range p.encs {
+			select {
+			case jobs <- precompressJob{name: name, fi: fi, enc: enc}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	close(jobs)
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return stats, errors.Join(errs...)
+}
+
+// precompress generates the variant for job, if needed. The stale variants
+// that are not generated again, as they would not be smaller than the file,
+// are removed, so that FileServer does not keep serving them.
+func (p *precompressor) precompress(j precompressJob) (precompressResult, error) {
+	dst := filepath.Join(p.dir, filepath.FromSlash(j.name)+variantExt(j.enc))
+	fi, err := os.Stat(dst)
+	if err == nil && !fi.ModTime().Before(j.fi.ModTime()) {
+		return precompressUpToDate, nil
+	}
+	stale := err == nil
+
+	src, err := p.fsys.Open(j.name)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	if p.cfg.Check {
+		cw := &countingWriter{w: io.Discard}
+		if err := p.compress(cw, src, j.enc); err != nil {
+			return 0, fmt.Errorf("%s: %w", dst, err)
+		}
+		switch {
+		case cw.n < j.fi.Size():
+			return 0, fmt.Errorf("%s: missing or stale precompressed variant %s", j.name, dst)
+		case stale:
+			return 0, fmt.Errorf("%s: stale precompressed variant %s, not smaller than the file", j.name, dst)
+		}
+		return precompressSkipped, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".httpcompression-*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	cw := &countingWriter{w: tmp}
+	err = p.compress(cw, src, j.enc)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", dst, err)
+	}
+	if cw.n >= j.fi.Size() {
+		if stale {
+			if err := os.Remove(dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return 0, err
+			}
+		}
+		return precompressSkipped, nil
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return 0, err
+	}
+	return precompressCreated, nil
+}
+
+// compress writes src, compressed with the compressor for enc, to w.
+func (p *precompressor) compress(w io.Writer, src io.Reader, enc string) error {
+	zw := p.config.compressor[enc].comp.Get(w)
+	_, err := io.Copy(zw, src)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,193 @@
+package httpcompression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrecompress(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		"app.js":         testBody,
+		"css/style.css":  testBody,
+		"small.txt":      "small",
+		"image.png":      testBody,
+		"random.bin":     randomString(256), // incompressible
+		"stale.html":     testBody,
+		"stale.html.gz":  "stale",
+		"app.js.br":      "not regenerated",
+		"ignored/a.html": testBody,
+	})
+	old := time.Now().Add(-time.Hour)
+	assert.Nil(t, os.Chtimes(filepath.Join(dir, "stale.html.gz"), old, old))
+	assert.Nil(t, os.Chtimes(filepath.Join(dir, "app.js"), old, old))
+
+	cfg := PrecompressConfig{
+		Concurrency: 2,
+		Match:       func(name string) bool { return !strings.HasPrefix(name, "ignored/") },
+	}
+	stats, err := Precompress(context.Background(), os.DirFS(dir), dir, cfg,
+		GzipCompressionLevel(gzip.BestCompression),
+		BrotliCompressionLevel(5),
+		MinSize(100),
+		ContentTypes([]string{"image/png"}, true),
+	)
+	assert.Nil(t, err)
+	// app.js, css/style.css and stale.html for gzip; css/style.css and
+	// stale.html for brotli; random.bin does not compress.
+	assert.Equal(t, PrecompressStats{Files: 4, Created: 5, UpToDate: 1, Skipped: 2}, stats)
+
+	for _, name := range []string{"app.js.gz", "css/style.css.gz", "stale.html.gz"} {
+		f, err := os.Open(filepath.Join(dir, name))
+		if !assert.Nil(t, err, name) {
+			continue
+		}
+		zr, err := gzip.NewReader(f)
+		assert.Nil(t, err, name)
+		b, err := io.ReadAll(zr)
+		assert.Nil(t, err, name)
+		assert.Equal(t, testBody, string(b), name)
+		f.Close()
+	}
+	for _, name := range []string{"small.txt.gz", "image.png.gz", "ignored/a.html.gz", "css/style.css.zst"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "app.js.br"))
+	assert.Nil(t, err)
+	assert.Equal(t, "not regenerated", string(b))
+
+	// A second run finds everything up to date.
+	stats, err = Precompress(context.Background(), os.DirFS(dir), dir, cfg,
+		GzipCompressionLevel(gzip.BestCompression), BrotliCompressionLevel(5), MinSize(100), ContentTypes([]string{"image/png"}, true))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, stats.UpToDate)
+	assert.Equal(t, 0, stats.Created)
+}
+
+func TestPrecompressCheck(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		"app.js":     testBody,
+		"app.js.gz":  "up to date",
+		"index.html": testBody,
+	})
+	old := time.Now().Add(-time.Hour)
+	assert.Nil(t, os.Chtimes(filepath.Join(dir, "app.js"), old, old))
+
+	stats, err := Precompress(context.Background(), os.DirFS(dir), dir, PrecompressConfig{Check: true}, GzipCompressionLevel(5))
+	assert.ErrorContains(t, err, "index.html")
+	assert.NotContains(t, err.Error(), "app.js")
+	assert.Equal(t, PrecompressStats{Files: 2, UpToDate: 1}, stats)
+	_, err = os.Stat(filepath.Join(dir, "index.html.gz"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStartPrecompress(t *testing.T) {
+	t.Parallel()
+
+	src := writeFiles(t, map[string]string{"index.html": testBody})
+	dst := t.TempDir()
+
+	done := make(chan PrecompressStats)
+	err := StartPrecompress(context.Background(), os.DirFS(src), dst, PrecompressConfig{}, func(stats PrecompressStats, err error) {
+		assert.Nil(t, err)
+		done <- stats
+	}, GzipCompressionLevel(gzip.DefaultCompression))
+	assert.Nil(t, err)
+	assert.Equal(t, PrecompressStats{Files: 1, Created: 1}, <-done)
+
+	b, err := os.ReadFile(filepath.Join(dst, "index.html.gz"))
+	assert.Nil(t, err)
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	assert.Nil(t, err)
+	b, _ = io.ReadAll(zr)
+	assert.Equal(t, testBody, string(b))
+}
+
+func TestPrecompressErrors(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{"index.html": testBody})
+
+	// No compressor for the precompressed variants.
+	_, err := Precompress(context.Background(), os.DirFS(dir), dir, PrecompressConfig{}, DeflateCompressionLevel(5))
+	assert.NotNil(t, err)
+	// Missing output directory.
+	_, err = Precompress(context.Background(), os.DirFS(dir), filepath.Join(dir, "missing"), PrecompressConfig{}, GzipCompressionLevel(5))
+	assert.NotNil(t, err)
+	// Invalid options are reported synchronously.
+	err = StartPrecompress(context.Background(), os.DirFS(dir), dir, PrecompressConfig{Concurrency: -1}, nil, GzipCompressionLevel(5))
+	assert.NotNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Precompress(ctx, os.DirFS(dir), dir, PrecompressConfig{}, GzipCompressionLevel(5))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestPrecompressStaleNotSmaller(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		"random.bin":    randomString(256), // incompressible
+		"random.bin.gz": "stale",
+	})
+	old := time.Now().Add(-time.Hour)
+	assert.Nil(t, os.Chtimes(filepath.Join(dir, "random.bin.gz"), old, old))
+
+	stats, err := Precompress(context.Background(), os.DirFS(dir), dir, PrecompressConfig{Check: true}, GzipCompressionLevel(5))
+	assert.ErrorContains(t, err, "stale precompressed variant")
+	assert.Equal(t, PrecompressStats{Files: 1}, stats)
+
+	stats, err = Precompress(context.Background(), os.DirFS(dir), dir, PrecompressConfig{}, GzipCompressionLevel(5))
+	assert.Nil(t, err)
+	assert.Equal(t, PrecompressStats{Files: 1, Skipped: 1}, stats)
+	_, err = os.Stat(filepath.Join(dir, "random.bin.gz"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPrecompressCanceledJobs(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{"a.html": testBody, "b.html": testBody, "c.html": testBody})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The context is canceled while the first variant is being generated.
+	fsys := &cancelingFS{FS: os.DirFS(dir), cancel: cancel}
+	stats, err := Precompress(ctx, fsys, dir, PrecompressConfig{Concurrency: 1}, GzipCompressionLevel(5))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, stats.Created)
+}
+
+type cancelingFS struct {
+	fs.FS
+	cancel func()
+}
+
+func (f *cancelingFS) Open(name string) (fs.File, error) {
+	if strings.HasSuffix(name, ".html") {
+		f.cancel()
+	}
+	return f.FS.Open(name)
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(0)).Read(b)
+	return string(b)
+}
@@ -10,7 +10,7 @@ import (
 // encodings, and the MIME type of the response is allowed for both encodings).
 // See the comments on the PreferType constants for the supported values.
 func Prefer(prefer PreferType) Option {
-	return func(c *config) error {
+	return named("Prefer", func(c *config) error {
 		switch prefer {
 		case PreferServer, PreferClient:
 			c.prefer = prefer
@@ -18,7 +18,7 @@ func Prefer(prefer PreferType) Option {
 		default:
 			return fmt.Errorf("unknown prefer type: %v", prefer)
 		}
-	}
+	})
 }
 
 // PreferType allows to control the choice of compression algorithm when
@@ -0,0 +1,73 @@
+//go:build !httpcompression_minimal
+// +build !httpcompression_minimal
+
+package httpcompression
+
+import (
+	"compress/flate"
+	"compress/gzip"
+
+	"github.com/CAFxX/httpcompression/contrib/compress/zlib"
+)
+
+// PresetStaticAssets is an option for static assets (scripts, stylesheets,
+// fonts, etc.): it uses the highest compression levels of brotli, zstd and
+// gzip, and does not compress the content types that are already
+// compressed. As the highest levels are slow, it is meant to be used
+// together with precompressed files (see FileServer and Precompress) or with
+// VariantCache, so that each asset is compressed only once.
+// Like the other presets it can be combined with other options, that
+// override it if specified after it.
+func PresetStaticAssets() Option {
+	return options(
+		BrotliCompressionLevel(11),
+		ZstandardCompressionLevel(19),
+		GzipCompressionLevel(gzip.BestCompression),
+		DeflateCompressionLevel(flate.BestCompression),
+		ContentTypes(compressedContentTypes, true),
+	)
+}
+
+// PresetJSONAPI is an option for JSON APIs: it prefers zstd, uses moderate
+// compression levels, and compresses also small responses.
+func PresetJSONAPI() Option {
+	return options(
+		ZstandardCompressionLevel(3),
+		BrotliCompressionLevel(4),
+		GzipCompressionLevel(6),
+		DeflateCompressionLevel(6),
+		Priority(zstandardEncoding, 0),
+		MinSize(100),
+	)
+}
+
+// PresetStreaming is an option for streaming responses (e.g. server-sent
+// events or long polling): it uses the fastest compression levels, and does
+// not buffer the beginning of the responses (MinSize(0)), so that each
+// flush of the handler is sent immediately to the client.
+func PresetStreaming() Option {
+	return options(
+		ZstandardCompressionLevel(1),
+		BrotliCompressionLevel(1),
+		GzipCompressionLevel(gzip.BestSpeed),
+		DeflateCompressionLevel(flate.BestSpeed),
+		MinSize(0),
+	)
+}
+
+// PresetPrometheus is an option for Prometheus (and OpenMetrics) /metrics
+// endpoints: it compresses only the text exposition formats, with gzip (that
+// the Prometheus scrapers accept) or zstd, at low levels (the exposition
+// format is so repetitive that they achieve most of the compression ratio of
+// the higher levels, at a fraction of the cost of the frequent scrapes), and
+// only if the response is larger than 1KB. The protobuf exposition format is
+// not compressed.
+func PresetPrometheus() Option {
+	return options(
+		ZstandardCompressionLevel(1),
+		GzipCompressionLevel(3),
+		DisableEncoding(brotliEncoding, zlib.Encoding),
+		ContentTypes(metricsContentTypes, false),
+		MinSize(1024),
+	)
+}
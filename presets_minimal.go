@@ -0,0 +1,58 @@
+//go:build httpcompression_minimal
+// +build httpcompression_minimal
+
+package httpcompression
+
+import (
+	"compress/flate"
+	"compress/gzip"
+
+	"github.com/CAFxX/httpcompression/contrib/compress/zlib"
+)
+
+// PresetStaticAssets is an option for static assets. In
+// httpcompression_minimal builds it uses the highest compression levels of
+// gzip and deflate, and does not compress the content types that are
+// already compressed.
+func PresetStaticAssets() Option {
+	return options(
+		GzipCompressionLevel(gzip.BestCompression),
+		DeflateCompressionLevel(flate.BestCompression),
+		ContentTypes(compressedContentTypes, true),
+	)
+}
+
+// PresetJSONAPI is an option for JSON APIs. In httpcompression_minimal
+// builds it uses moderate gzip and deflate compression levels, and
+// compresses also small responses.
+func PresetJSONAPI() Option {
+	return options(
+		GzipCompressionLevel(6),
+		DeflateCompressionLevel(6),
+		MinSize(100),
+	)
+}
+
+// PresetStreaming is an option for streaming responses. In
+// httpcompression_minimal builds it uses the fastest gzip and deflate
+// compression levels, and does not buffer the beginning of the responses.
+func PresetStreaming() Option {
+	return options(
+		GzipCompressionLevel(gzip.BestSpeed),
+		DeflateCompressionLevel(flate.BestSpeed),
+		MinSize(0),
+	)
+}
+
+// PresetPrometheus is an option for Prometheus /metrics endpoints. In
+// httpcompression_minimal builds it compresses only the text exposition
+// formats, with a low gzip compression level, and only if the response is
+// larger than 1KB.
+func PresetPrometheus() Option {
+	return options(
+		GzipCompressionLevel(3),
+		DisableEncoding(zlib.Encoding),
+		ContentTypes(metricsContentTypes, false),
+		MinSize(1024),
+	)
+}
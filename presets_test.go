@@ -0,0 +1,58 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresets(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		preset  Option
+		ct      string
+		accept  string
+		enc     string
+		minSize int
+	}{
+		{"static", PresetStaticAssets(), "text/css", "gzip, br", "br", DefaultMinSize},
+		{"static image", PresetStaticAssets(), "image/png", "gzip, br", "", DefaultMinSize},
+		{"json", PresetJSONAPI(), "application/json", "gzip, br, zstd", "zstd", 100},
+		{"streaming", PresetStreaming(), "text/event-stream", "gzip", "gzip", 0},
+		{"prometheus", PresetPrometheus(), "text/plain; version=0.0.4; charset=utf-8", "gzip", "gzip", 1024},
+		{"prometheus zstd", PresetPrometheus(), "application/openmetrics-text; version=1.0.0; charset=utf-8", "gzip, br, zstd", "zstd", 1024},
+		{"prometheus protobuf", PresetPrometheus(), "application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited", "gzip", "", 1024},
+	}
+	for _, c := range cases {
+		cfg, err := newConfig(append(defaultOptions(), c.preset)...)
+		if !assert.NoError(t, err, c.name) {
+			continue
+		}
+		assert.Equal(t, c.minSize, cfg.minSize, c.name)
+
+		mw, err := DefaultAdapter(c.preset)
+		if !assert.NoError(t, err, c.name) {
+			continue
+		}
+		h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(contentType, c.ct)
+			w.Write([]byte(testBody))
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, c.accept)
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, c.enc, res.Header().Get(contentEncoding), c.name)
+	}
+
+	// Presets can be combined with other options, that override them.
+	cfg, err := newConfig(append(defaultOptions(), PresetStreaming(), MinSize(10))...)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 10, cfg.minSize)
+	}
+}
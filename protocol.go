@@ -0,0 +1,49 @@
+package httpcompression
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// protocolReq is the protocol required by an encoding (see EncodingProtocols).
+type protocolReq struct {
+	minProtoMajor int
+	tls           bool
+}
+
+// EncodingProtocols is an option that enables the specified encodings only
+// for the requests using at least HTTP/minProtoMajor and, if requireTLS is
+// true, received over TLS; for the other requests the encodings are not
+// negotiated, as if the clients did not accept them. For example, to use
+// brotli only over HTTP/2 or HTTP/3 with TLS, as some old HTTP/1.1
+// intermediaries mangle responses with unknown encodings:
+//
+//	httpcompression.EncodingProtocols(2, true, "br")
+//
+// The dictionary encodings (see DictionaryCompressor) can also be gated.
+// Multiple EncodingProtocols options for the same encoding replace each
+// other.
+func EncodingProtocols(minProtoMajor int, requireTLS bool, contentEncodings ...string) Option {
+	return named("EncodingProtocols", func(c *config) error {
+		if minProtoMajor < 1 {
+			return fmt.Errorf("invalid HTTP major version: %d", minProtoMajor)
+		}
+		if c.protocols == nil {
+			c.protocols = map[string]protocolReq{}
+		}
+		for _, enc := range contentEncodings {
+			c.protocols[enc] = protocolReq{minProtoMajor: minProtoMajor, tls: requireTLS}
+		}
+		return nil
+	})
+}
+
+// gateProtocols removes from accept the encodings that can not be used for
+// the protocol of r (see EncodingProtocols).
+func (c *config) gateProtocols(r *http.Request, accept codings) {
+	for enc, req := range c.protocols {
+		if r.ProtoMajor < req.minProtoMajor || req.tls && r.TLS == nil {
+			delete(accept, enc)
+		}
+	}
+}
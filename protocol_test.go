@@ -0,0 +1,45 @@
+package httpcompression
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodingProtocols(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	a, err := DefaultAdapter(EncodingProtocols(2, true, "br", "zstd"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(strings.Repeat(testBody, 10)))
+	}))
+	serve := func(protoMajor int, secure bool) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.ProtoMajor = protoMajor
+		if secure {
+			req.TLS = &tls.ConnectionState{}
+		}
+		req.Header.Set(acceptEncoding, "br, zstd, gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res.Header().Get(contentEncoding)
+	}
+
+	assert.Equal(t, "gzip", serve(1, false))
+	assert.Equal(t, "gzip", serve(1, true))
+	assert.Equal(t, "gzip", serve(2, false))
+	assert.Equal(t, "zstd", serve(2, true))
+	assert.Equal(t, "zstd", serve(3, true))
+
+	_, err = DefaultAdapter(EncodingProtocols(0, false, "br"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,349 @@
+// Package providertest implements a conformance test suite for
+// httpcompression.CompressorProvider implementations, checking that they
+// meet the expectations of the middleware:
+//
+//   - the data written to the compressors can be decoded, whatever the size
+//     and the number of writes, also when no data is written;
+//   - the compressors recycled after Close (e.g. with a sync.Pool) can be
+//     reused by later calls to Get without leaking state between streams,
+//     also when multiple compressors are in use at the same time;
+//   - calling Close more than once does not panic, and does not recycle the
+//     compressor more than once;
+//   - if the compressors implement httpcompression.Flusher, the data written
+//     before Flush can be decoded from the output written so far;
+//   - the provider is safe for concurrent use.
+//
+// For example, in the tests of a provider:
+//
+//	func TestConformance(t *testing.T) {
+//		providertest.Run(t, "gzip", func() (httpcompression.CompressorProvider, error) {
+//			return mygzip.New(mygzip.Options{Level: 6})
+//		})
+//	}
+package providertest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/CAFxX/httpcompression"
+	"github.com/CAFxX/httpcompression/httpcompressiontest"
+)
+
+// NewProviderFunc returns a new provider to test.
+type NewProviderFunc func() (httpcompression.CompressorProvider, error)
+
+// NewReaderFunc returns a reader decoding the data compressed by the
+// provider read from r. The returned reader must decode the data flushed
+// with Flush as the data becomes available.
+type NewReaderFunc func(r io.Reader) (io.ReadCloser, error)
+
+// Run runs the conformance test suite as subtests of t, for a provider of
+// the specified Content-Encoding, that must be supported by
+// httpcompressiontest.Decode ("gzip", "deflate", "br" or "zstd"). Each
+// subtest uses a new provider returned by newProvider.
+func Run(t *testing.T, contentEncoding string, newProvider NewProviderFunc) {
+	t.Helper()
+	RunWithDecoder(t, newProvider, func(r io.Reader) (io.ReadCloser, error) {
+		return httpcompressiontest.NewReader(contentEncoding, r)
+	})
+}
+
+// RunWithDecoder is like Run, but it decodes the compressed data with the
+// readers returned by newReader, e.g. for encodings not supported by
+// httpcompressiontest.Decode.
+func RunWithDecoder(t *testing.T, newProvider NewProviderFunc, newReader NewReaderFunc) {
+	t.Helper()
+	s := &suite{newProvider: newProvider, newReader: newReader}
+	t.Run("RoundTrip", s.testRoundTrip)
+	t.Run("Reuse", s.testReuse)
+	t.Run("DoubleClose", s.testDoubleClose)
+	t.Run("Flush", s.testFlush)
+	t.Run("Concurrent", s.testConcurrent)
+}
+
+type suite struct {
+	newProvider NewProviderFunc
+	newReader   NewReaderFunc
+}
+
+func (s *suite) provider(t *testing.T) httpcompression.CompressorProvider {
+	t.Helper()
+	p, err := s.newProvider()
+	if err != nil {
+		t.Fatalf("creating the provider: %v", err)
+	}
+	if p == nil {
+		t.Fatal("creating the provider: nil provider")
+	}
+	return p
+}
+
+// compress compresses data with p, in writes of at most chunk bytes (all of
+// data at once if chunk is 0).
+func compress(p httpcompression.CompressorProvider, data []byte, chunk int) ([]byte, error) {
+	var b bytes.Buffer
+	w := p.Get(&b)
+	if err := write(w, data, chunk); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("Close: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+func write(w io.Writer, data []byte, chunk int) error {
+	if chunk <= 0 {
+		chunk = len(data)
+	}
+	for len(data) > 0 {
+		n := min(chunk, len(data))
+		m, err := w.Write(data[:n])
+		if err != nil {
+			return fmt.Errorf("Write: %w", err)
+		}
+		if m != n {
+			return fmt.Errorf("Write: short write (%d of %d bytes)", m, n)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func (s *suite) decode(compressed []byte) ([]byte, error) {
+	r, err := s.newReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// check checks that compressed decodes to data.
+func (s *suite) check(t *testing.T, name string, compressed, data []byte) {
+	t.Helper()
+	got, err := s.decode(compressed)
+	if err != nil {
+		t.Errorf("%s: decoding: %v", name, err)
+		return
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("%s: decoded %d bytes, not matching the %d bytes written", name, len(got), len(data))
+	}
+}
+
+func testData(rnd *rand.Rand, size int, random bool) []byte {
+	data := make([]byte, size)
+	if random {
+		rnd.Read(data)
+		return data
+	}
+	words := strings.Fields("lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor")
+	for i := 0; i < size; {
+		i += copy(data[i:], words[rnd.Intn(len(words))]+" ")
+	}
+	return data
+}
+
+func (s *suite) testRoundTrip(t *testing.T) {
+	p := s.provider(t)
+	rnd := rand.New(rand.NewSource(0))
+	for _, size := range []int{0, 1, 100, 64 << 10, 1 << 20} {
+		for _, random := range []bool{false, true} {
+			data := testData(rnd, size, random)
+			for _, chunk := range []int{0, 1, 4096} {
+				if chunk == 1 && size > 64<<10 {
+					continue
+				}
+				name := fmt.Sprintf("size=%d,random=%t,chunk=%d", size, random, chunk)
+				compressed, err := compress(p, data, chunk)
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+					continue
+				}
+				s.check(t, name, compressed, data)
+			}
+		}
+	}
+}
+
+func (s *suite) testReuse(t *testing.T) {
+	p := s.provider(t)
+	rnd := rand.New(rand.NewSource(1))
+
+	// Sequential reuse, alternating different data and a compressor closed
+	// without writing any data.
+	for i := 0; i < 10; i++ {
+		data := testData(rnd, rnd.Intn(32<<10), i%3 == 0)
+		if i%4 == 1 {
+			data = nil
+		}
+		compressed, err := compress(p, data, 0)
+		if err != nil {
+			t.Errorf("stream %d: %v", i, err)
+			continue
+		}
+		s.check(t, fmt.Sprintf("stream %d", i), compressed, data)
+	}
+
+	// Interleaved compressors: each must only write to its own parent.
+	const n = 4
+	var bufs [n]bytes.Buffer
+	var ws [n]io.WriteCloser
+	var datas [n][]byte
+	for i := range ws {
+		ws[i] = p.Get(&bufs[i])
+		datas[i] = testData(rnd, 8<<10, false)
+	}
+	for off := 0; off < 8<<10; off += 1 << 10 {
+		for i, w := range ws {
+			if err := write(w, datas[i][off:off+1<<10], 0); err != nil {
+				t.Fatalf("interleaved stream %d: %v", i, err)
+			}
+		}
+	}
+	for i, w := range ws {
+		if err := w.Close(); err != nil {
+			t.Errorf("interleaved stream %d: Close: %v", i, err)
+		}
+		s.check(t, fmt.Sprintf("interleaved stream %d", i), bufs[i].Bytes(), datas[i])
+	}
+}
+
+func (s *suite) testDoubleClose(t *testing.T) {
+	p := s.provider(t)
+	data := testData(rand.New(rand.NewSource(2)), 4<<10, false)
+
+	var b bytes.Buffer
+	w := p.Get(&b)
+	if err := write(w, data, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	n := b.Len()
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Errorf("second Close panicked: %v", r)
+			}
+		}()
+		_ = w.Close()
+	}()
+	if b.Len() != n {
+		t.Errorf("second Close wrote %d bytes", b.Len()-n)
+	}
+	s.check(t, "closed twice", b.Bytes(), data)
+
+	// If the compressor was recycled twice, the next two calls to Get could
+	// return the same compressor.
+	var b1, b2 bytes.Buffer
+	w1, w2 := p.Get(&b1), p.Get(&b2)
+	if reflect.TypeOf(w1) == reflect.TypeOf(w2) && reflect.TypeOf(w1).Comparable() && w1 == w2 {
+		t.Fatal("Get returned the same compressor twice")
+	}
+	d1, d2 := data[:len(data)/2], data[len(data)/2:]
+	if err := write(w1, d1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := write(w2, d2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := w1.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err := w2.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	s.check(t, "first stream after double Close", b1.Bytes(), d1)
+	s.check(t, "second stream after double Close", b2.Bytes(), d2)
+}
+
+func (s *suite) testFlush(t *testing.T) {
+	p := s.provider(t)
+	rnd := rand.New(rand.NewSource(3))
+
+	var b bytes.Buffer
+	w := p.Get(&b)
+	f, ok := w.(httpcompression.Flusher)
+	if !ok {
+		w.Close()
+		t.Skip("the compressors do not implement Flusher")
+	}
+	if err := f.Flush(); err != nil {
+		t.Fatalf("Flush before writing: %v", err)
+	}
+	var written []byte
+	for i := 0; i < 5; i++ {
+		data := testData(rnd, 1+rnd.Intn(16<<10), false)
+		if err := write(w, data, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Flush(); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+		written = append(written, data...)
+
+		// All the data written so far must be decodable from the output
+		// written until Flush returned.
+		r, err := s.newReader(bytes.NewReader(b.Bytes()))
+		if err != nil {
+			t.Fatalf("flush %d: decoding: %v", i, err)
+		}
+		got := make([]byte, len(written))
+		_, err = io.ReadFull(r, got)
+		r.Close()
+		if err != nil {
+			t.Fatalf("flush %d: decoding: %v", i, err)
+		}
+		if !bytes.Equal(got, written) {
+			t.Fatalf("flush %d: decoded data not matching the data written", i)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	s.check(t, "flushed stream", b.Bytes(), written)
+}
+
+func (s *suite) testConcurrent(t *testing.T) {
+	p := s.provider(t)
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < cap(errs); g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < 20; i++ {
+				data := testData(rnd, rnd.Intn(8<<10), false)
+				compressed, err := compress(p, data, 1<<10)
+				if err == nil {
+					var got []byte
+					got, err = s.decode(compressed)
+					if err == nil && !bytes.Equal(got, data) {
+						err = fmt.Errorf("decoded data not matching the data written")
+					}
+				}
+				if err != nil {
+					errs <- fmt.Errorf("goroutine %d, stream %d: %w", g, i, err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
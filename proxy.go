@@ -0,0 +1,89 @@
+package httpcompression
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	cgzip "github.com/CAFxX/httpcompression/contrib/compress/gzip"
+)
+
+const (
+	via       = "Via"
+	forwarded = "Forwarded"
+)
+
+// ProxyAction is the action taken by the middleware for a request received
+// through intermediaries (see Intermediaries).
+type ProxyAction byte
+
+const (
+	// ProxyAllow negotiates the encoding as usual.
+	ProxyAllow ProxyAction = iota
+	// ProxyGzipOnly negotiates only gzip, that is supported by all the
+	// intermediaries.
+	ProxyGzipOnly
+	// ProxyNoCompression does not compress the response.
+	ProxyNoCompression
+)
+
+// ProxyDetector returns the ProxyAction to take for a request (see
+// Intermediaries).
+type ProxyDetector func(r *http.Request) ProxyAction
+
+// Intermediaries is an option that calls detect for each request, to detect
+// intermediaries (e.g. proxies listed in the Via or Forwarded headers, see
+// DetectVia) that are known to mishandle compressed responses: depending on
+// the returned ProxyAction, the response is compressed as usual, only with
+// gzip, or not at all.
+//
+// As the encoding still depends only on what the client accepts, the
+// responses are still safe to be cached by shared caches.
+func Intermediaries(detect ProxyDetector) Option {
+	return named("Intermediaries", func(c *config) error {
+		if detect == nil {
+			return fmt.Errorf("nil intermediaries detection function")
+		}
+		c.proxies = detect
+		return nil
+	})
+}
+
+// DetectVia returns a ProxyDetector returning
+// action for the requests whose Via or Forwarded headers contain (ignoring
+// case) any of names (e.g. the names of the problematic proxies, or their
+// pseudonyms configured in the Via headers), and ProxyAllow for the others.
+func DetectVia(action ProxyAction, names ...string) ProxyDetector {
+	lower := make([]string, len(names))
+	for i, n := range names {
+		lower[i] = strings.ToLower(n)
+	}
+	return func(r *http.Request) ProxyAction {
+		for _, h := range [...]string{via, forwarded} {
+			for _, v := range r.Header.Values(h) {
+				v = strings.ToLower(v)
+				for _, n := range lower {
+					if strings.Contains(v, n) {
+						return action
+					}
+				}
+			}
+		}
+		return ProxyAllow
+	}
+}
+
+// gateProxies removes from accept the encodings that can not be used for
+// the intermediaries of r (see Intermediaries).
+func (c *config) gateProxies(r *http.Request, accept codings) {
+	switch c.proxies(r) {
+	case ProxyGzipOnly:
+		for enc := range accept {
+			if enc != cgzip.Encoding {
+				delete(accept, enc)
+			}
+		}
+	case ProxyNoCompression:
+		accept.reset()
+	}
+}
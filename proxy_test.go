@@ -0,0 +1,49 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntermediaries(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	detect := func(r *http.Request) ProxyAction {
+		if a := DetectVia(ProxyNoCompression, "BadProxy")(r); a != ProxyAllow {
+			return a
+		}
+		return DetectVia(ProxyGzipOnly, "oldcache")(r)
+	}
+	a, err := DefaultAdapter(Intermediaries(detect))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(strings.Repeat(testBody, 10)))
+	}))
+	serve := func(header, value string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "br, gzip")
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res.Header().Get(contentEncoding)
+	}
+
+	assert.Equal(t, "br", serve("", ""))
+	assert.Equal(t, "br", serve(via, "1.1 goodproxy"))
+	assert.Equal(t, "", serve(via, "1.0 fred, 1.1 badproxy (BadProxy/2.1)"))
+	assert.Equal(t, "gzip", serve(via, "1.1 OldCache"))
+	assert.Equal(t, "gzip", serve(forwarded, "for=192.0.2.60;by=oldcache"))
+
+	_, err = DefaultAdapter(Intermediaries(nil))
+	assert.Error(t, err)
+}
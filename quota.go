@@ -0,0 +1,68 @@
+package httpcompression
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// EncodingQuota is an option that limits to max the number of responses
+// compressed at the same time with the specified Content-Encoding (e.g. for
+// the cgo compressors, that use a large amount of native memory for each
+// compressor). When max responses are being compressed with the encoding,
+// the following responses are compressed with the next encoding accepted by
+// the client, or sent uncompressed, instead of allocating more compressors.
+//
+// The quota is shared by the routes of the middleware (see Route); a
+// Middleware starts counting again when it is reloaded, so the responses
+// being compressed with the previous options are not counted.
+func EncodingQuota(contentEncoding string, max int) Option {
+	return named("EncodingQuota", func(c *config) error {
+		if max < 1 {
+			return fmt.Errorf("the quota of %q must be positive: %d", contentEncoding, max)
+		}
+		if c.quotas == nil {
+			c.quotas = map[string]*quota{}
+		}
+		c.quotas[contentEncoding] = &quota{max: int64(max)}
+		return nil
+	})
+}
+
+// quota counts the compressors in use for an encoding (see EncodingQuota).
+type quota struct {
+	max   int64
+	inUse atomic.Int64
+}
+
+func (q *quota) acquire() bool {
+	if q.inUse.Add(1) > q.max {
+		q.inUse.Add(-1)
+		return false
+	}
+	return true
+}
+
+func (q *quota) release() {
+	q.inUse.Add(-1)
+}
+
+// acquireQuota reports whether the response can be compressed with enc,
+// according to its quota; the quota is then released by Close.
+func (w *compressWriter) acquireQuota(enc string) bool {
+	q := w.config.quotas[enc]
+	if q == nil {
+		return true
+	}
+	if !q.acquire() {
+		return false
+	}
+	w.quota = q
+	return true
+}
+
+func (w *compressWriter) releaseQuota() {
+	if w.quota != nil {
+		w.quota.release()
+		w.quota = nil
+	}
+}
@@ -0,0 +1,54 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodingQuota(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	a, err := DefaultAdapter(EncodingQuota("zstd", 1), EncodingQuota("br", 1))
+	if !assert.NoError(t, err) {
+		return
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(testBody))
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+	}))
+	get := func(path string) string {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(acceptEncoding, "zstd, br, gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		b, err := decodeBody(res.Body, res.Header().Get(contentEncoding))
+		assert.NoError(t, err)
+		assert.Equal(t, testBody, string(b))
+		return res.Header().Get(contentEncoding)
+	}
+
+	slow := make(chan string, 2)
+	go func() { slow <- get("/slow") }()
+	<-started
+	assert.Equal(t, "br", get("/"))
+	go func() { slow <- get("/slow") }()
+	<-started
+	assert.Equal(t, "gzip", get("/"))
+
+	close(release)
+	encs := []string{<-slow, <-slow}
+	assert.ElementsMatch(t, []string{"zstd", "br"}, encs)
+	assert.Equal(t, "zstd", get("/"))
+
+	_, err = DefaultAdapter(EncodingQuota("zstd", 0))
+	assert.Error(t, err)
+}
@@ -0,0 +1,401 @@
+package httpcompression
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// The protocol spoken with the sidecars by RemoteCompressor (and by
+// ServeRemoteCompressors) is made of frames, each with a 1-byte type, the
+// 4-byte big-endian length of its payload, and the payload. A compressor
+// sends a remoteStart frame, with the Content-Encoding as payload, and then
+// the remoteData frames with the uncompressed data, the remoteFlush frames
+// and a final remoteClose frame. The sidecar answers each frame, in order,
+// with the remoteData frames with the compressed output, if any, followed
+// by a remoteAck frame, or by a remoteError frame with the error message
+// (that ends the stream). After the remoteAck of a remoteClose the
+// connection can be used for another stream.
+const (
+	remoteStart = 'S'
+	remoteData  = 'D'
+	remoteFlush = 'F'
+	remoteClose = 'C'
+	remoteAck   = 'A'
+	remoteError = 'E'
+
+	// remoteMaxFrame is the maximum length of the payload of a frame.
+	remoteMaxFrame = 1 << 20
+	// remoteMaxIdle is the default number of idle connections kept by a
+	// RemoteCompressor.
+	remoteMaxIdle = 16
+)
+
+// RemoteOptions are the options of a RemoteCompressor.
+type RemoteOptions struct {
+	// Network and Address are the address of the sidecar, as accepted by
+	// net.Dial (e.g. "unix" and "/run/compressor.sock"). If Network is
+	// empty, "unix" is used.
+	Network string
+	Address string
+	// Encoding is the Content-Encoding requested to the sidecar.
+	Encoding string
+	// Timeout, if positive, limits the time spent connecting to the
+	// sidecar, and waiting for each of its answers.
+	Timeout time.Duration
+	// MaxIdle is the maximum number of idle connections to the sidecar
+	// kept for the following responses. If it is 0, 16 are kept; if it is
+	// negative, none are.
+	MaxIdle int
+}
+
+// RemoteCompressor is a CompressorProvider whose compressors run in another
+// process, e.g. a sidecar running heavyweight or licensed encoders: the data
+// written to each compressor is streamed to the sidecar over a connection
+// (usually a unix socket), and its output is relayed to the response, while
+// the middleware keeps negotiating the encodings and pooling its writers.
+// A sidecar can be implemented in Go with ServeRemoteCompressors, or in
+// any language following the protocol described in the source.
+//
+// RemoteCompressor implements ContextCompressorProvider: if the sidecar can
+// not be reached, or it does not support the encoding, the response is sent
+// uncompressed (or compressed with the next provider, with
+// FailoverCompressor). The connections are reused for the following
+// responses, and closed by Close.
+type RemoteCompressor struct {
+	opt    RemoteOptions
+	dialer net.Dialer
+
+	mu     sync.Mutex
+	idle   []net.Conn
+	closed bool
+}
+
+// NewRemoteCompressor returns a RemoteCompressor using the sidecar at the
+// address in opt. The sidecar is not contacted until the first response.
+func NewRemoteCompressor(opt RemoteOptions) (*RemoteCompressor, error) {
+	if opt.Network == "" {
+		opt.Network = "unix"
+	}
+	if opt.Address == "" {
+		return nil, errors.New("remote compressor: missing address")
+	}
+	if opt.Encoding == "" {
+		return nil, errors.New("remote compressor: missing encoding")
+	}
+	if opt.MaxIdle == 0 {
+		opt.MaxIdle = remoteMaxIdle
+	}
+	return &RemoteCompressor{opt: opt, dialer: net.Dialer{Timeout: opt.Timeout}}, nil
+}
+
+// Get implements CompressorProvider. If the sidecar can not be used, the
+// returned compressor returns the error.
+func (c *RemoteCompressor) Get(parent io.Writer) io.WriteCloser {
+	w, err := c.GetContext(context.Background(), parent)
+	if err != nil {
+		return &remoteWriter{err: err}
+	}
+	return w
+}
+
+// GetContext implements ContextCompressorProvider.
+func (c *RemoteCompressor) GetContext(ctx context.Context, parent io.Writer) (io.WriteCloser, error) {
+	conn, reused, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w := c.newWriter(conn, parent)
+	if err = w.exchange(remoteStart, []byte(c.opt.Encoding)); err != nil && reused {
+		// The idle connection may have been closed by the sidecar.
+		w.conn.Close()
+		if conn, err = c.dial(ctx); err != nil {
+			return nil, err
+		}
+		w = c.newWriter(conn, parent)
+		err = w.exchange(remoteStart, []byte(c.opt.Encoding))
+	}
+	if err != nil {
+		w.conn.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Close closes the idle connections to the sidecar. The connections used
+// by the compressors are closed when they are closed.
+func (c *RemoteCompressor) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	var errs []error
+	for _, conn := range c.idle {
+		if err := conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	c.idle = nil
+	return errors.Join(errs...)
+}
+
+// conn returns an idle connection to the sidecar, or a new one.
+func (c *RemoteCompressor) conn(ctx context.Context) (conn net.Conn, reused bool, err error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		conn = c.idle[n-1]
+		c.idle = c.idle[:n-1]
+	}
+	c.mu.Unlock()
+	if conn != nil {
+		return conn, true, nil
+	}
+	conn, err = c.dial(ctx)
+	return conn, false, err
+}
+
+func (c *RemoteCompressor) dial(ctx context.Context) (net.Conn, error) {
+	conn, err := c.dialer.DialContext(ctx, c.opt.Network, c.opt.Address)
+	if err != nil {
+		return nil, fmt.Errorf("remote compressor: %w", err)
+	}
+	return conn, nil
+}
+
+// release keeps conn for the following compressors, or closes it.
+func (c *RemoteCompressor) release(conn net.Conn) {
+	c.mu.Lock()
+	if !c.closed && len(c.idle) < c.opt.MaxIdle {
+		c.idle = append(c.idle, conn)
+		conn = nil
+	}
+	c.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+func (c *RemoteCompressor) newWriter(conn net.Conn, parent io.Writer) *remoteWriter {
+	return &remoteWriter{
+		c:      c,
+		conn:   conn,
+		r:      bufio.NewReader(conn),
+		w:      bufio.NewWriter(conn),
+		parent: parent,
+	}
+}
+
+// remoteWriter is a compressor of a RemoteCompressor.
+type remoteWriter struct {
+	c      *RemoteCompressor
+	conn   net.Conn
+	r      *bufio.Reader
+	w      *bufio.Writer
+	parent io.Writer
+	buf    []byte // the payload of the last frame read
+	err    error  // the first error, returned by all the following calls
+}
+
+func (w *remoteWriter) Write(b []byte) (int, error) {
+	n := 0
+	for w.err == nil && n < len(b) {
+		chunk := b[n:minInt(len(b), n+remoteMaxFrame)]
+		if w.err = w.exchange(remoteData, chunk); w.err == nil {
+			n += len(chunk)
+		}
+	}
+	return n, w.err
+}
+
+// Flush implements Flusher.
+func (w *remoteWriter) Flush() error {
+	if w.err == nil {
+		w.err = w.exchange(remoteFlush, nil)
+	}
+	return w.err
+}
+
+func (w *remoteWriter) Close() error {
+	if w.conn == nil {
+		return w.err
+	}
+	if w.err == nil {
+		w.err = w.exchange(remoteClose, nil)
+	}
+	if w.err == nil {
+		w.c.release(w.conn)
+	} else {
+		w.conn.Close()
+	}
+	w.conn = nil
+	if w.err == nil {
+		w.err = errClosed
+		return nil
+	}
+	return w.err
+}
+
+// exchange sends a frame to the sidecar, and relays its output to the
+// parent until it is acknowledged.
+func (w *remoteWriter) exchange(typ byte, payload []byte) error {
+	if w.c.opt.Timeout > 0 {
+		w.conn.SetDeadline(time.Now().Add(w.c.opt.Timeout))
+	}
+	if err := writeFrame(w.w, typ, payload); err != nil {
+		return err
+	}
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	for {
+		typ, err := w.readFrame()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case remoteData:
+			if _, err := w.parent.Write(w.buf); err != nil {
+				return err
+			}
+		case remoteAck:
+			return nil
+		case remoteError:
+			return fmt.Errorf("remote compressor: %s", w.buf)
+		default:
+			return fmt.Errorf("remote compressor: unexpected frame %q", typ)
+		}
+	}
+}
+
+func (w *remoteWriter) readFrame() (byte, error) {
+	typ, payload, err := readFrame(w.r, w.buf)
+	if err != nil {
+		return 0, err
+	}
+	w.buf = payload
+	return typ, nil
+}
+
+func writeFrame(w *bufio.Writer, typ byte, payload []byte) error {
+	var hdr [5]byte
+	hdr[0] = typ
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(payload)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readFrame reads a frame from r, reusing buf for its payload.
+func readFrame(r *bufio.Reader, buf []byte) (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, buf, err
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > remoteMaxFrame {
+		return 0, buf, fmt.Errorf("remote compressor: frame too large: %d bytes", n)
+	}
+	if cap(buf) < int(n) {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, buf, err
+	}
+	return hdr[0], buf, nil
+}
+
+// ServeRemoteCompressors accepts the connections of the RemoteCompressors
+// on l, and compresses their streams with the provider of the requested
+// encoding in providers, e.g. in a sidecar process running licensed
+// encoders. It returns when l.Accept fails (e.g. because l has been
+// closed), with its error.
+func ServeRemoteCompressors(l net.Listener, providers map[string]CompressorProvider) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveRemote(conn, providers)
+	}
+}
+
+// serveRemote serves the streams of a connection, until it is closed or
+// the client does not follow the protocol.
+func serveRemote(conn net.Conn, providers map[string]CompressorProvider) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	out := &remoteOutput{w: w}
+	var (
+		buf []byte
+		zw  io.WriteCloser
+	)
+	for {
+		typ, payload, err := readFrame(r, buf)
+		if err != nil {
+			if zw != nil {
+				zw.Close()
+			}
+			return
+		}
+		buf = payload
+		switch {
+		case typ == remoteStart && zw == nil:
+			if p, ok := providers[string(payload)]; ok {
+				zw = p.Get(out)
+			} else {
+				err = fmt.Errorf("unsupported encoding %q", payload)
+			}
+		case typ == remoteData && zw != nil:
+			_, err = zw.Write(payload)
+		case typ == remoteFlush && zw != nil:
+			if f, ok := zw.(Flusher); ok {
+				err = f.Flush()
+			}
+		case typ == remoteClose && zw != nil:
+			err = zw.Close()
+			zw = nil
+		default:
+			err = fmt.Errorf("unexpected frame %q", typ)
+		}
+		if err == nil {
+			err = out.err
+		}
+		if err != nil {
+			writeFrame(w, remoteError, []byte(err.Error()))
+			w.Flush()
+			if zw != nil {
+				zw.Close()
+			}
+			return
+		}
+		if writeFrame(w, remoteAck, nil) != nil || w.Flush() != nil {
+			return
+		}
+	}
+}
+
+// remoteOutput is the parent of the compressors of serveRemote: it sends
+// their output to the client as data frames.
+type remoteOutput struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (o *remoteOutput) Write(b []byte) (int, error) {
+	n := 0
+	for o.err == nil && n < len(b) {
+		chunk := b[n:minInt(len(b), n+remoteMaxFrame)]
+		if o.err = writeFrame(o.w, remoteData, chunk); o.err == nil {
+			n += len(chunk)
+		}
+	}
+	return n, o.err
+}
@@ -0,0 +1,105 @@
+package httpcompression
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingListener counts the accepted connections.
+type countingListener struct {
+	net.Listener
+	n atomic.Int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.n.Add(1)
+	}
+	return conn, err
+}
+
+func TestRemoteCompressor(t *testing.T) {
+	t.Parallel()
+
+	sock := filepath.Join(t.TempDir(), "compressor.sock")
+	ul, err := net.Listen("unix", sock)
+	if !assert.NoError(t, err) {
+		return
+	}
+	l := &countingListener{Listener: ul}
+	gz, err := NewDefaultGzipCompressor(6)
+	if !assert.NoError(t, err) {
+		return
+	}
+	served := make(chan error, 1)
+	go func() { served <- ServeRemoteCompressors(l, map[string]CompressorProvider{"gzip": gz}) }()
+
+	serve := func(enc string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		rc, err := NewRemoteCompressor(RemoteOptions{Address: sock, Encoding: enc, Timeout: 10 * time.Second})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		defer rc.Close()
+		a, err := Adapter(Compressor("gzip", 0, rc))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		h := a(handler)
+		var res *httptest.ResponseRecorder
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(acceptEncoding, "gzip")
+			res = httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+		}
+		return res
+	}
+
+	body := strings.Repeat(testBody, 2000)
+	res := serve("gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		io.WriteString(w, body[:1000])
+		w.(http.Flusher).Flush()
+		io.WriteString(w, body[1000:])
+	})
+	assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+	b, err := decodeGzip(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(b))
+	// The connection is reused by the second response.
+	assert.Equal(t, int32(1), l.n.Load())
+
+	// The responses are sent uncompressed if the sidecar does not support
+	// the encoding.
+	res = serve("zstd", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		io.WriteString(w, testBody)
+	})
+	assert.Empty(t, res.Header().Get(contentEncoding))
+	assert.Equal(t, testBody, res.Body.String())
+
+	// Or if it can not be reached.
+	l.Close()
+	assert.Error(t, <-served)
+	res = serve("gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		io.WriteString(w, testBody)
+	})
+	assert.Empty(t, res.Header().Get(contentEncoding))
+	assert.Equal(t, testBody, res.Body.String())
+
+	_, err = NewRemoteCompressor(RemoteOptions{Encoding: "gzip"})
+	assert.Error(t, err)
+	_, err = NewRemoteCompressor(RemoteOptions{Address: sock})
+	assert.Error(t, err)
+}
@@ -2,12 +2,15 @@ package httpcompression
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"strconv"
-	"sync"
+	"time"
 )
 
 // compressWriter provides an http.ResponseWriter interface, which gzips
@@ -20,12 +23,47 @@ type compressWriter struct {
 	config config
 	accept codings
 	common []string
-	pool   *sync.Pool // pool of buffers (buf []byte); max size of each buf is maxBuf
+	dict   *dictChoice     // the dictionary encoding to use, if any
+	use    *dictRecorder   // records the response to use it as a dictionary, if it is marked as such
+	pools  *pools          // pools of the buffers (buf []byte); max size of each buf is maxBuf
+	ctx    context.Context // the context of the request (see ContextCompressorProvider)
+
+	minSize   int    // the smallest minimum size of the encodings that can be used
+	waitSize  int    // the largest minimum size of the encodings that can be used
+	force     bool   // the response is compressed regardless of its size (see AlwaysCompressContentTypes)
+	streaming bool   // the handler flushed the response before the encoding was chosen (see CapabilityFlush)
+	quota     *quota // the quota acquired for the encoding of the response, if any (see EncodingQuota)
+	complete  bool   // the buffer passed to startCompress is the whole response (see OneShotMaxSize)
+	closed    bool   // Close has been called: it returns closeErr again
+	closeErr  error  // the error returned by the first Close
 
 	w    io.Writer
 	enc  string
 	code int     // Saves the WriteHeader value.
 	buf  *[]byte // Holds the first part of the write before reaching the minSize or the end of the write.
+
+	cacheURL string         // URL part of the cache key; empty if the response can not be cached.
+	cacheKey CacheKey       // Key of the compressed variant being recorded.
+	recorder *cacheRecorder // Records the compressed variant to be added to the cache; nil if not recording.
+	stale    *revalidation  // Collects the response to revalidate the stale variant being served; nil if not revalidating.
+
+	learn    string          // pattern of the request (see LearnEncodings)
+	learnIn  int64           // uncompressed bytes written to the compressor, if learnOut is not nil
+	learnOut *countingWriter // counts the compressed bytes, if the ratio is being recorded
+
+	req     *http.Request  // the request, if there are hooks to call (see WriterHook)
+	capture *http.Request  // the request, if its response is captured (see DebugCapture)
+	signed  *http.Request  // the request, if the signed responses are re-signed (see SignedResponses)
+	digest  *digestWriter  // computes the Content-Digest of the compressed response (see ContentDigest)
+	cost    string         // the pattern of the request, if the costs are tracked (see TrackCosts)
+	timing  *costWriter    // measures the compression time, if it is reported (see ServerTiming)
+	level   *levelParent   // adapts the compression level (see Backpressure)
+	guard   *closeGuard    // the parent of the compressor, if its Close is timed (see CloseTimeout)
+	sent    sentETags      // the ETags sent by the client in the conditional headers (see EncodingETags)
+	teeReq  *http.Request  // the request, if the Tee writer has not been opened yet (see Tee)
+	secret  bool           // whether the request matches SecretURLs, if the responses are marked (see PolicySkipHeader)
+	tee     io.WriteCloser // the Tee writer, if any
+	parts   *partsWriter   // rewrites the multipart/x-mixed-replace response (see MixedReplaceParts)
 }
 
 var (
@@ -35,27 +73,51 @@ var (
 	_ io.StringWriter = &compressWriter{}
 )
 
-type compressWriterWithCloseNotify struct {
-	*compressWriter
-}
-
-func (w compressWriterWithCloseNotify) CloseNotify() <-chan bool {
-	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
-}
-
-var (
-	_ io.WriteCloser  = compressWriterWithCloseNotify{}
-	_ http.Flusher    = compressWriterWithCloseNotify{}
-	_ http.Hijacker   = compressWriterWithCloseNotify{}
-	_ io.StringWriter = compressWriterWithCloseNotify{}
-)
-
 const maxBuf = 1 << 16 // maximum size of recycled buffer
 
+// errClosed is returned by the writes following Close.
+var errClosed = errors.New("httpcompression: write after Close")
+
 // Write compresses and appends the given byte slice to the underlying ResponseWriter.
 func (w *compressWriter) Write(b []byte) (int, error) {
+	poolCheck(w, "Write")
+	if w.closed {
+		return 0, errClosed
+	}
+	if w.use != nil {
+		w.use.write(b)
+	}
+	if w.teeReq != nil || w.tee != nil {
+		w.teeWrite(b)
+	}
+	if w.parts != nil {
+		return w.parts.Write(b)
+	}
+	if w.w == nil && w.config.parts != nil && !uncompressedStatus(w.code) {
+		if err := w.startParts(); err != nil {
+			return 0, err
+		}
+		if w.parts != nil {
+			return w.parts.Write(b)
+		}
+	}
+	heartbeat := w.config.isHeartbeat(b)
+	if heartbeat && w.w == nil {
+		if err := w.startHeartbeat(); err != nil {
+			return 0, err
+		}
+	}
 	if w.w != nil {
 		// The responseWriter is already initialized: use it.
+		if w.learnOut != nil {
+			w.learnIn += int64(len(b))
+		}
+		if heartbeat {
+			return w.writeHeartbeat(b)
+		}
+		if w.level != nil {
+			return w.writeAdjusting(b)
+		}
 		return w.w.Write(b)
 	}
 
@@ -64,20 +126,28 @@ func (w *compressWriter) Write(b []byte) (int, error) {
 		ce = w.Header().Get(contentEncoding)
 		cl = 0
 	)
+	if ce == "" && w.uncompressed(ct) {
+		ce = identity
+	}
 	if clv := w.Header().Get(contentLength); clv != "" {
 		cl, _ = strconv.Atoi(clv)
 	}
+	if !w.force && ct != "" && len(w.config.always) > 0 && handleContentType(ct, w.config.always, false) {
+		w.force, w.minSize, w.waitSize = true, 0, 0
+	}
 
 	// Fast path: we have enough information to know whether we will compress
 	// or not this response from the first write, so we don't need to buffer
 	// writes to defer the decision until we have more data.
-	if w.buf == nil && (ct != "" || len(w.config.contentTypes) == 0) && (cl > 0 || len(b) >= w.config.minSize) {
-		if ce == "" && (cl >= w.config.minSize || len(b) >= w.config.minSize) && handleContentType(ct, w.config.contentTypes, w.config.blacklist) {
-			enc := preferredEncoding(w.accept, w.config.compressor, w.common, w.config.prefer)
-			if err := w.startCompress(enc, b); err != nil {
-				return 0, err
+	if w.buf == nil && (ct != "" || len(w.config.contentTypes) == 0) && (cl > 0 || len(b) >= w.waitSize) {
+		if ce == "" && (cl >= w.minSize || len(b) >= w.minSize) && handleContentType(ct, w.config.contentTypes, w.config.blacklist) {
+			if enc := w.encoding(ct, maxInt(cl, len(b))); enc != "" {
+				w.complete = cl == len(b)
+				if err := w.startCompress(enc, b); err != nil {
+					return 0, err
+				}
+				return len(b), nil
 			}
-			return len(b), nil
 		}
 		if err := w.startPlain(b); err != nil {
 			return 0, err
@@ -93,30 +163,19 @@ func (w *compressWriter) Write(b []byte) (int, error) {
 	*w.buf = append(*w.buf, b...)
 
 	// Only continue if they didn't already choose an encoding or a known unhandled content length or type.
-	if ce == "" && (cl == 0 || cl >= w.config.minSize) && (ct == "" || handleContentType(ct, w.config.contentTypes, w.config.blacklist)) {
-		// If the current buffer is less than minSize and a Content-Length isn't set, then wait until we have more data.
-		if len(*w.buf) < w.config.minSize && cl == 0 {
+	if ce == "" && (cl == 0 || cl >= w.minSize) && (ct == "" || handleContentType(ct, w.config.contentTypes, w.config.blacklist)) {
+		// If the current buffer is less than the minimum size of all the encodings and a Content-Length
+		// isn't set, then wait until we have more data.
+		if len(*w.buf) < w.waitSize && cl == 0 {
 			return len(b), nil
 		}
 		// If the Content-Length is larger than minSize or the current buffer is larger than minSize, then continue.
-		if cl >= w.config.minSize || len(*w.buf) >= w.config.minSize {
-			// If a Content-Type wasn't specified, infer it from the current buffer.
-			if ct == "" {
-				ct = http.DetectContentType(*w.buf)
-				if ct != "" {
-					// net/http by default performs content sniffing but this is disabled if content-encoding is set.
-					// Since we set content-encoding, if content-type was not set and we successfully sniffed it,
-					// set the content-type.
-					w.Header().Set(contentType, ct)
-				}
-			}
-			if handleContentType(ct, w.config.contentTypes, w.config.blacklist) {
-				enc := preferredEncoding(w.accept, w.config.compressor, w.common, w.config.prefer)
-				if err := w.startCompress(enc, *w.buf); err != nil {
-					return 0, err
-				}
-				return len(b), nil
+		if cl >= w.minSize || len(*w.buf) >= w.minSize {
+			w.complete = cl == len(*w.buf)
+			if err := w.startBuffered(ct, maxInt(cl, len(*w.buf))); err != nil {
+				return 0, err
 			}
+			return len(b), nil
 		}
 	}
 	// If we got here, we should not GZIP this response.
@@ -126,16 +185,66 @@ func (w *compressWriter) Write(b []byte) (int, error) {
 	return len(b), nil
 }
 
+// uncompressedStatus reports whether the responses with status code are
+// never compressed: partial responses are sent uncompressed (see the comment
+// about ranges in adapter.go, and CompressByteRanges), and 204 and 304
+// responses have no body.
+func uncompressedStatus(code int) bool {
+	return code == http.StatusPartialContent || code == http.StatusNoContent || code == http.StatusNotModified
+}
+
+// uncompressed reports whether the response, whose Content-Type is ct, is
+// never compressed because of its status code, of its Content-Type, of its
+// signatures (see SignedResponses) or of its no-transform directive (see
+// PolicySkipHeader).
+func (w *compressWriter) uncompressed(ct string) bool {
+	if w.config.skipHeader != nil && noTransform(w.Header()) {
+		return true
+	}
+	if s := w.config.signatures; s != nil && s.resign == nil && signedContent(w.Header()) {
+		return true
+	}
+	if isByteRanges(ct) {
+		return !w.config.byteRanges || w.code == http.StatusNoContent || w.code == http.StatusNotModified
+	}
+	return uncompressedStatus(w.code)
+}
+
+// startBuffered compresses, if possible, the buffered response, whose size
+// is size, and writes it.
+func (w *compressWriter) startBuffered(ct string, size int) error {
+	// If a Content-Type wasn't specified, infer it from the current buffer.
+	if ct == "" {
+		ct = http.DetectContentType(*w.buf)
+		if ct != "" {
+			// net/http by default performs content sniffing but this is disabled if content-encoding is set.
+			// Since we set content-encoding, if content-type was not set and we successfully sniffed it,
+			// set the content-type.
+			w.Header().Set(contentType, ct)
+		}
+	}
+	if handleContentType(ct, w.config.contentTypes, w.config.blacklist) {
+		if enc := w.encoding(ct, size); enc != "" {
+			return w.startCompress(enc, *w.buf)
+		}
+	}
+	return w.startPlain(*w.buf)
+}
+
 // WriteString compresses and appends the given string to the underlying ResponseWriter.
 //
 // This makes use of an optional method (WriteString) exposed by the compressors, or by
 // the underlying ResponseWriter.
 func (w *compressWriter) WriteString(s string) (int, error) {
+	poolCheck(w, "WriteString")
 	// Since WriteString is an optional interface of the compressor, and the actual compressor
 	// is chosen only after the first call to Write, we can't statically know whether the interface
 	// is supported. We therefore have to check dynamically.
-	if ws, _ := w.w.(io.StringWriter); ws != nil {
+	if ws, _ := w.w.(io.StringWriter); ws != nil && w.use == nil && !w.config.heartbeats && w.parts == nil && w.config.tee == nil {
 		// The responseWriter is already initialized and it implements WriteString.
+		if w.learnOut != nil {
+			w.learnIn += int64(len(s))
+		}
 		return ws.WriteString(s)
 	}
 	// Fallback: the writer has not been initialized yet, or it has been initialized
@@ -146,14 +255,99 @@ func (w *compressWriter) WriteString(s string) (int, error) {
 	return w.Write([]byte(s))
 }
 
+// encoding returns the encoding to use to compress the response with
+// Content-Type ct and size bytes, or the empty string if the response can
+// not be compressed.
+func (w *compressWriter) encoding(ct string, size int) string {
+	if w.force {
+		size = math.MaxInt
+	}
+	if w.dict != nil && size >= w.config.encodingMinSize(w.dict.enc) && w.acquireQuota(w.dict.enc) {
+		return w.dict.enc
+	}
+	common := w.common
+	for _, enc := range common {
+		if len(w.config.compressor[enc].contentTypes) > 0 || w.config.encodingMinSize(enc) > size {
+			common = w.config.filterEncodings(w.common, ct, size)
+			break
+		}
+	}
+	if w.streaming || isStreaming(ct) {
+		common = w.config.flushable(common)
+	}
+	if len(common) == 0 {
+		return ""
+	}
+	enc := preferredEncoding(w.accept, w.config.compressor, common, w.config.prefer)
+	if w.config.learn != nil {
+		// preferredEncoding sorted common by preference.
+		enc = w.config.learn.choose(w.learn, common)
+	}
+	if len(w.config.quotas) == 0 || w.acquireQuota(enc) {
+		return enc
+	}
+	// The quota of enc is exhausted: fall back to the next encoding.
+	for _, e := range common {
+		if e != enc && w.acquireQuota(e) {
+			return e
+		}
+	}
+	return ""
+}
+
+// filterEncodings returns the encodings whose compressors can be used for
+// responses with Content-Type ct and size bytes.
+func (c *config) filterEncodings(encs []string, ct string, size int) []string {
+	var s []string
+	for _, enc := range encs {
+		if cts := c.compressor[enc].contentTypes; (len(cts) == 0 || handleContentType(ct, cts, false)) && size >= c.encodingMinSize(enc) {
+			s = append(s, enc)
+		}
+	}
+	return s
+}
+
 // startCompress initializes a compressing writer and writes the buffer.
 func (w *compressWriter) startCompress(enc string, buf []byte) error {
-	comp, ok := w.config.compressor[enc]
-	if !ok {
+	provider, cacheEnc := w.config.compressor[enc].comp, enc
+	if w.dict != nil && enc == w.dict.enc {
+		provider, cacheEnc = w.dict.comp, w.dict.cacheEnc
+	}
+	if provider == nil {
 		panic("unknown compressor")
 	}
+	level := w.config.compressor[enc].level
+	if w.dict == nil || enc != w.dict.enc {
+		overridden := false
+		if w.config.levels != nil {
+			if l, ok := w.levelOverride(enc); ok {
+				if p := w.config.levels.provider(enc, l); p != nil {
+					provider, level, overridden = p, &l, true
+				}
+			}
+		}
+		if w.config.egress != nil && !overridden {
+			if p, l, ok := w.config.egress.provider(enc); ok {
+				provider, level = p, &l
+			}
+		}
+	}
+	var (
+		acquired io.WriteCloser // see ContextCompressorProvider
+		deferred *deferredWriter
+	)
+	if cp, ok := provider.(ContextCompressorProvider); ok && buf != nil {
+		var err error
+		if acquired, deferred, err = getContext(w.ctx, cp); err != nil {
+			return w.startPlain(buf)
+		}
+	}
+	if w.use != nil {
+		w.use.header(w.code, w.Header())
+	}
 
 	w.Header().Set(contentEncoding, enc)
+	w.ensureVary()
 
 	// if the Content-Length is already set, then calls to Write on gzip
 	// will fail to set the Content-Length header since its already set
@@ -163,6 +357,58 @@ func (w *compressWriter) startCompress(enc string, buf []byte) error {
 	// See the comment about ranges in adapter.go
 	w.Header().Del(acceptRanges)
 
+	// The digests of the uncompressed content are invalidated by the
+	// compression (see ContentDigest).
+	w.Header().Del(contentDigest)
+	w.Header().Del(reprDigest)
+
+	var cached []byte
+	if w.cacheURL != "" && len(buf) > 0 {
+		once := w.config.once != nil && longLived(w.Header(), w.config.once.minMaxAge)
+		if v, ok := cacheValidator(w.Header(), w.code, once); ok {
+			w.cacheKey = CacheKey{URL: w.cacheURL, Encoding: cacheEnc, Validator: v}
+			if once && w.dict == nil {
+				if p, ok := w.config.once.comps[enc]; ok {
+					provider = p
+				}
+			}
+			if b, ok := w.config.cache.cache.Get(w.cacheKey); ok {
+				cached = b
+			} else if b, rv, ok := w.getStale(provider); ok {
+				cached, w.stale = b, rv
+			} else {
+				w.recorder = &cacheRecorder{w: w.ResponseWriter, max: w.config.cache.maxEntrySize}
+			}
+			if cached != nil {
+				w.Header().Set(contentLength, strconv.Itoa(len(cached)))
+			}
+		}
+	}
+
+	if len(w.config.digests) > 0 {
+		if cached != nil {
+			w.Header().Set(contentDigest, digestValue(w.config.digests, cached))
+		} else if buf != nil {
+			w.Header().Add(trailer, contentDigest)
+			w.digest = newDigestWriter(w.config.digests)
+		}
+	}
+	if w.config.serverTiming && cached == nil && buf != nil {
+		w.Header().Add(trailer, serverTiming)
+	}
+
+	if w.config.etags {
+		if tag := w.Header().Get(etag); tag != "" {
+			w.Header().Set(etag, w.encodingETag(tag, enc))
+		}
+	}
+
+	if w.signed != nil && signedContent(w.Header()) {
+		w.config.signatures.resign(w.signed, w.Header())
+	}
+
+	w.started(enc)
+
 	// Write the header to gzip response.
 	if w.code != 0 {
 		w.ResponseWriter.WriteHeader(w.code)
@@ -172,12 +418,102 @@ func (w *compressWriter) startCompress(enc string, buf []byte) error {
 
 	defer w.recycleBuffer()
 
-	// Initialize and flush the buffer into the gzip response if there are any bytes.
-	// If there aren't any, we shouldn't initialize it yet because on Close it will
-	// write the gzip header even if nothing was ever written.
-	if len(buf) > 0 {
-		w.w = comp.comp.Get(w.ResponseWriter)
+	if cached != nil && acquired != nil {
+		acquired.Close()
+	}
+	if cached != nil {
+		// The compressed variant is in the cache: serve it, and discard
+		// whatever the handler writes (unless the stale variant is being
+		// revalidated).
+		w.w = discardWriter{}
+		if w.stale != nil {
+			w.w = w.stale
+			w.stale.Write(buf)
+		}
+		w.enc = enc
+		n, err := w.ResponseWriter.Write(cached)
+		if err == nil && n < len(cached) {
+			err = io.ErrShortWrite
+		}
+		return err
+	}
+
+	// Initialize and flush the buffer into the gzip response if Write was called
+	// (or the response was started by Flush, see startEmpty). If it wasn't, we
+	// shouldn't initialize it yet because on Close it will write the gzip header
+	// even if nothing was ever written.
+	if buf != nil {
+		var parent io.Writer = w.ResponseWriter
+		if w.recorder != nil {
+			parent = w.recorder
+		}
+		if w.digest != nil {
+			w.digest.w = parent
+			parent = w.digest
+		}
+		if w.config.learn != nil && w.learn != "" && w.dict == nil {
+			w.learnIn, w.learnOut = int64(len(buf)), &countingWriter{w: parent}
+			parent = w.learnOut
+		}
+		var cw *captureWriter
+		if w.capture != nil {
+			if cw = w.config.capture.start(w.capture, enc, parent); cw != nil {
+				parent = cw.out
+			}
+		}
+		var costs *costWriter
+		if w.config.costs != nil || w.config.serverTiming {
+			costs = &costWriter{}
+			if w.config.costs != nil {
+				costs.cost = w.config.costs.get(w.cost)
+			}
+			if w.config.serverTiming {
+				w.timing = costs
+			}
+			parent = &costParent{w: parent, cw: costs}
+		}
+		var pressure *levelParent
+		if bp := w.config.backpressure; bp != nil && !w.config.deterministic {
+			if levels, ok := bp.levels[enc]; ok {
+				pressure = newLevelParent(parent, bp, levels, level)
+				parent = pressure
+			}
+		}
+		if w.config.closeTimeout > 0 {
+			w.guard = &closeGuard{w: parent}
+			parent = w.guard
+		}
+		if e, ok := provider.(Encoder); ok && w.complete && len(buf) > 0 && len(buf) <= w.config.oneShot && !w.config.deterministic {
+			w.w = &oneShotWriter{e: e, w: parent, cw: w}
+			if acquired != nil {
+				acquired.Close()
+			}
+		} else if acquired != nil {
+			deferred.w = parent
+			w.w = acquired
+		} else {
+			w.w = provider.Get(parent)
+		}
+		if pressure != nil {
+			if ls, ok := w.w.(LevelSetter); ok {
+				pressure.ls, w.level = ls, pressure
+			}
+		}
+		if w.config.deterministic {
+			w.w = newBlockWriter(w.w.(io.WriteCloser))
+		}
+		if cw != nil {
+			cw.WriteCloser = w.w.(io.WriteCloser)
+			w.w = cw
+		}
+		if costs != nil {
+			costs.WriteCloser = w.w.(io.WriteCloser)
+			w.w = costs
+		}
 		w.enc = enc
+		if len(buf) == 0 {
+			return nil
+		}
 
 		n, err := w.w.Write(buf)
 
@@ -192,12 +528,66 @@ func (w *compressWriter) startCompress(enc string, buf []byte) error {
 	return nil
 }
 
+// getStale returns the stale variant to be served, if the StaleWhileRevalidate
+// option is enabled and the validator of the response has changed. If the
+// returned revalidation is not nil, the response written by the handler must
+// be written to it, to compress the new variant in the background.
+func (w *compressWriter) getStale(provider CompressorProvider) ([]byte, *revalidation, bool) {
+	s := w.config.stale
+	if s == nil || w.cacheKey.Validator == "" {
+		return nil, nil, false
+	}
+	e, revalidate, ok := s.stale(w.cacheKey, time.Now())
+	if !ok {
+		return nil, nil, false
+	}
+	old := w.cacheKey
+	old.Validator = e.validator
+	b, ok := w.config.cache.cache.Get(old)
+	if !ok {
+		if revalidate {
+			s.revalidated(w.cacheKey, "", false)
+		}
+		return nil, nil, false
+	}
+	h := w.Header()
+	header := validatorHeader(h)
+	h.Del(etag)
+	h.Del(lastModified)
+	h.Set(e.header, e.validator)
+	if !revalidate {
+		return b, nil, true
+	}
+	return b, &revalidation{
+		stale:         s,
+		cache:         w.config.cache,
+		key:           w.cacheKey,
+		header:        header,
+		provider:      provider,
+		deterministic: w.config.deterministic,
+	}, true
+}
+
 // startPlain writes to sent bytes and buffer the underlying ResponseWriter without gzip.
 func (w *compressWriter) startPlain(buf []byte) error {
-	// See the comment about ranges in adapter.go; we need to do it even in this case
-	// because adapter will strip the range header anyway.
-	w.Header().Del(acceptRanges)
-
+	w.ensureVary()
+	if w.code == http.StatusNotModified {
+		// Caches update the stored response with the headers of the 304
+		// response: a Content-Encoding set by the handler, that does not know
+		// how the stored response was compressed, could contradict it.
+		w.Header().Del(contentEncoding)
+		w.restoreETag()
+	}
+	if w.config.levels != nil && w.config.levels.header != "" {
+		w.Header().Del(w.config.levels.header)
+	}
+	if w.config.skipHeader != nil && w.policySkipped() {
+		w.config.skipHeader.mark(w.Header())
+	}
+	if w.use != nil {
+		w.use.header(w.code, w.Header())
+	}
+	w.started("")
 	if w.code != 0 {
 		w.ResponseWriter.WriteHeader(w.code)
 		// Ensure that no other WriteHeader's happen
@@ -220,24 +610,106 @@ func (w *compressWriter) startPlain(buf []byte) error {
 	return err
 }
 
+// started calls the hooks when the encoding of the response, enc, has been
+// decided, before the headers are written.
+func (w *compressWriter) started(enc string) {
+	if w.req == nil {
+		return
+	}
+	status := w.code
+	if status == 0 {
+		status = http.StatusOK
+	}
+	r := w.req
+	w.req = nil // the hooks are called only once
+	w.config.writerNegotiated(r, enc)
+	w.config.writerStarted(r, status, w.Header())
+}
+
+// ensureVary adds back the Vary headers added by the adapter, in case the
+// handler replaced them, so that all the responses (including the 304 ones)
+// vary on the same request headers.
+func (w *compressWriter) ensureVary() {
+	addVaryHeader(w.Header(), acceptEncoding)
+	if w.config.dict.enabled() {
+		addVaryHeader(w.Header(), availableDictionary)
+	}
+}
+
 // WriteHeader sets the response code that will be returned in the response.
 func (w *compressWriter) WriteHeader(code int) {
+	poolCheck(w, "WriteHeader")
 	if w.code == 0 {
 		w.code = code
 	}
 }
 
-// Close closes the compression Writer.
+// Close closes the compression Writer. Close is idempotent: the handlers (or
+// the frameworks) can call it before the middleware does, and the
+// compressor is closed, and returned to its pool, only once. The following
+// calls return the error of the first one, and the following writes fail.
 func (w *compressWriter) Close() error {
+	poolCheck(w, "Close")
+	if w.closed {
+		return w.closeErr
+	}
+	w.closed = true
+	if w.teeReq != nil {
+		w.openTee()
+	}
+	w.closeErr = w.close()
+	if w.tee != nil {
+		w.closeTee()
+	}
+	return w.closeErr
+}
+
+func (w *compressWriter) close() error {
+	defer w.releaseQuota()
+	if w.parts != nil {
+		return w.parts.close()
+	}
 	if w.w != nil && w.enc == "" {
 		return nil
 	}
 	if cw, ok := w.w.(io.Closer); ok {
 		w.w = nil
-		return cw.Close()
+		err := w.closeCompressor(cw)
+		if w.digest != nil && err == nil {
+			// Sent as a trailer, announced in startCompress.
+			w.Header().Set(contentDigest, w.digest.value())
+		}
+		if w.timing != nil && err == nil {
+			// Sent as a trailer, announced in startCompress.
+			w.Header().Set(serverTiming, serverTimingValue(w.enc, w.timing.duration()))
+		}
+		if w.learnOut != nil && err == nil {
+			w.config.learn.record(w.learn, w.enc, w.learnIn, w.learnOut.n)
+		}
+		if r := w.recorder; r != nil {
+			w.recorder = nil
+			if err == nil && !r.full {
+				w.config.cache.cache.Set(w.cacheKey, r.buf, w.config.cache.ttl)
+				if w.config.stale != nil && w.cacheKey.Validator != "" {
+					w.config.stale.stored(w.cacheKey, validatorHeader(w.Header()))
+				}
+			}
+		}
+		return err
+	}
+
+	// compression not triggered yet: the response may still be compressed
+	// with an encoding with a minimum size smaller than the one that was
+	// waited for.
+	if w.w == nil && w.buf != nil && len(*w.buf) > 0 && len(*w.buf) >= w.minSize && w.Header().Get(contentEncoding) == "" {
+		w.complete = true
+		if err := w.startBuffered(w.Header().Get(contentType), len(*w.buf)); err != nil {
+			return fmt.Errorf("httpcompression: write at close gets error: %v", err)
+		}
+		return w.close()
 	}
 
-	// compression not triggered yet, write out regular response.
+	// write out regular response.
 	var buf []byte
 	if w.buf != nil {
 		buf = *w.buf
@@ -255,47 +727,126 @@ func (w *compressWriter) Close() error {
 // an http.Flusher.
 // Flush is a no-op until enough data has been written to decide whether the
 // response should be compressed or not (e.g. less than MinSize bytes have
-// been written).
+// been written). If it is called before any data has been written, the
+// headers are sent if they are enough to decide (e.g. the Content-Type is
+// not compressible, or the Content-Length is known).
 func (w *compressWriter) Flush() {
+	poolCheck(w, "Flush")
+	_ = w.flush()
+}
+
+// FlushError is like Flush, but it returns the error of the compressor or of
+// the underlying http.ResponseWriter, if any (e.g. if the connection has been
+// closed by the client), so that streaming handlers using
+// http.ResponseController can stop writing. If the underlying
+// http.ResponseWriter can not be flushed, the error satisfies
+// errors.Is(err, http.ErrNotSupported).
+func (w *compressWriter) FlushError() error {
+	poolCheck(w, "FlushError")
+	return w.flush()
+}
+
+func (w *compressWriter) flush() error {
+	if w.closed {
+		return errClosed
+	}
 	if w.w == nil {
+		w.streaming = true
 		// Flush is thus a no-op until we're certain whether a plain
 		// or compressed response will be served.
-		return
+		if w.buf != nil {
+			if w.config.oneShot > 0 && len(*w.buf) >= w.minSize && w.Header().Get(contentEncoding) == "" {
+				// The response is buffered only to be compressed at once
+				// (see OneShotMaxSize), but the handler is streaming it.
+				if err := w.startBuffered(w.Header().Get(contentType), len(*w.buf)); err != nil {
+					return err
+				}
+				return w.flush()
+			}
+			return nil
+		}
+		if ok, err := w.startEmpty(); !ok || err != nil {
+			return err
+		}
+		// Nothing has been written to the compressor yet, so only the
+		// headers are sent (flushing the compressor would write an empty
+		// block).
+		return http.NewResponseController(w.ResponseWriter).Flush()
 	}
 
 	// Flush the compressor, if supported.
 	// note: http.ResponseWriter does not implement Flusher (http.Flusher does not return an error),
-	// so we need to later call ResponseWriter.Flush anyway:
+	// so we need to later flush the parent ResponseWriter anyway:
 	// - in case we are bypassing compression, w.w is the parent ResponseWriter, and therefore we skip
 	//   this as the parent ResponseWriter does not implement Flusher.
 	// - in case we are NOT bypassing compression, w.w is the compressor, and therefore we flush the
 	//   compressor and then we flush the parent ResponseWriter.
 	if fw, ok := w.w.(Flusher); ok {
-		_ = fw.Flush()
+		if err := fw.Flush(); err != nil {
+			return err
+		}
 	}
 
 	// Flush the ResponseWriter (the previous Flusher is not expected to flush the parent writer).
-	if fw, ok := w.ResponseWriter.(http.Flusher); ok {
-		fw.Flush()
+	// The ResponseController uses FlushError, if the ResponseWriter implements it, so the errors
+	// of the parent are reported.
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// startEmpty starts the response before any data has been written to it (e.g.
+// when the handler flushes the response before writing the body, to send the
+// headers early), if the headers are enough to decide whether the response
+// is compressed. It returns false if the decision has to wait for the body.
+func (w *compressWriter) startEmpty() (bool, error) {
+	var (
+		ct    = w.Header().Get(contentType)
+		ce    = w.Header().Get(contentEncoding)
+		cl, _ = strconv.Atoi(w.Header().Get(contentLength))
+	)
+	if !w.force && ct != "" && len(w.config.always) > 0 && handleContentType(ct, w.config.always, false) {
+		w.force, w.minSize, w.waitSize = true, 0, 0
 	}
+	switch {
+	case ce != "" || w.uncompressed(ct),
+		ct != "" && !handleContentType(ct, w.config.contentTypes, w.config.blacklist),
+		cl > 0 && cl < w.minSize:
+		return true, w.startPlain(nil)
+	case (ct != "" || len(w.config.contentTypes) == 0) && (cl > 0 || w.waitSize == 0):
+		if enc := w.encoding(ct, cl); enc != "" {
+			return true, w.startCompress(enc, []byte{})
+		}
+		return true, w.startPlain(nil)
+	}
+	return false, nil
 }
 
 // Hijack implements http.Hijacker. If the underlying ResponseWriter is a
 // Hijacker, its Hijack method is returned. Otherwise an error is returned.
 func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	poolCheck(w, "Hijack")
 	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
 		return hj.Hijack()
 	}
 	return nil, nil, fmt.Errorf("http.Hijacker interface is not supported")
 }
 
+// Unwrap returns the underlying ResponseWriter. It is used by
+// http.ResponseController to reach optional methods (e.g. SetReadDeadline
+// and SetWriteDeadline) of the underlying ResponseWriter that compressWriter
+// does not implement itself. Writing directly to the returned ResponseWriter
+// bypasses compression.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func (w *compressWriter) getBuffer() *[]byte {
-	b := w.pool.Get()
+	b, _ := w.pools.buf.Get().(*[]byte)
+	w.pools.bufStats.got(b == nil)
 	if b == nil {
-		var s []byte
-		return &s
+		b = new([]byte)
 	}
-	return b.(*[]byte)
+	poolGot(b)
+	return b
 }
 
 func (w *compressWriter) recycleBuffer() {
@@ -304,6 +855,10 @@ func (w *compressWriter) recycleBuffer() {
 	}
 	buf := w.buf
 	w.buf = nil
+	w.putBuffer(buf)
+}
+
+func (w *compressWriter) putBuffer(buf *[]byte) {
 	if cap(*buf) > maxBuf {
 		// If the buffer is too big, let's drop it to avoid
 		// keeping huge buffers alive in the pool. In this case
@@ -314,5 +869,8 @@ func (w *compressWriter) recycleBuffer() {
 		// Reset the buffer to zero length.
 		*buf = (*buf)[:0]
 	}
-	w.pool.Put(buf)
+	poolPut(buf)
+	poolPoisonBuffer(buf)
+	w.pools.buf.Put(buf)
+	w.pools.bufStats.put()
 }
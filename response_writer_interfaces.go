@@ -0,0 +1,136 @@
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+)
+
+// wrap returns w as an http.ResponseWriter that also implements the optional
+// interfaces (http.CloseNotifier, http.Pusher and io.ReaderFrom) that are
+// implemented by the underlying ResponseWriter, so that they are still
+// visible via type assertions to the handlers and to the middlewares below
+// (e.g. httputil.ReverseProxy). http.Flusher and http.Hijacker are always
+// implemented by compressWriter, as it needs to flush the compressor, and
+// Hijack returns an error if the underlying ResponseWriter is not a
+// Hijacker.
+func (w *compressWriter) wrap() http.ResponseWriter {
+	const (
+		closeNotifier = 1 << iota
+		pusher
+		readerFrom
+	)
+	cn, _ := w.ResponseWriter.(http.CloseNotifier)
+	p, _ := w.ResponseWriter.(http.Pusher)
+	_, ok := w.ResponseWriter.(io.ReaderFrom)
+	var rf io.ReaderFrom
+	if ok {
+		rf = compressReaderFrom{w}
+	}
+	var flags int
+	if cn != nil {
+		flags |= closeNotifier
+	}
+	if p != nil {
+		flags |= pusher
+	}
+	if rf != nil {
+		flags |= readerFrom
+	}
+
+	switch flags {
+	case closeNotifier:
+		return struct {
+			*compressWriter
+			http.CloseNotifier
+		}{w, cn}
+	case pusher:
+		return struct {
+			*compressWriter
+			http.Pusher
+		}{w, p}
+	case readerFrom:
+		return struct {
+			*compressWriter
+			io.ReaderFrom
+		}{w, rf}
+	case closeNotifier | pusher:
+		return struct {
+			*compressWriter
+			http.CloseNotifier
+			http.Pusher
+		}{w, cn, p}
+	case closeNotifier | readerFrom:
+		return struct {
+			*compressWriter
+			http.CloseNotifier
+			io.ReaderFrom
+		}{w, cn, rf}
+	case pusher | readerFrom:
+		return struct {
+			*compressWriter
+			http.Pusher
+			io.ReaderFrom
+		}{w, p, rf}
+	case closeNotifier | pusher | readerFrom:
+		return struct {
+			*compressWriter
+			http.CloseNotifier
+			http.Pusher
+			io.ReaderFrom
+		}{w, cn, p, rf}
+	}
+	return w
+}
+
+// compressReaderFrom implements io.ReaderFrom for a compressWriter whose
+// underlying ResponseWriter is an io.ReaderFrom.
+type compressReaderFrom struct {
+	w *compressWriter
+}
+
+// readFromBuf is the minimum size of the buffer used by ReadFrom.
+const readFromBuf = 32 << 10
+
+// ReadFrom writes the data read from src to the response, compressing it
+// like Write. Once the response is known to be sent uncompressed, the rest
+// of src is passed to the ReadFrom method of the underlying ResponseWriter
+// (e.g. so that files can be sent with sendfile).
+func (rf compressReaderFrom) ReadFrom(src io.Reader) (int64, error) {
+	w := rf.w
+	poolCheck(w, "ReadFrom")
+	buf := w.getBuffer()
+	defer w.putBuffer(buf)
+	if cap(*buf) < readFromBuf {
+		*buf = make([]byte, readFromBuf)
+	}
+	b := (*buf)[:cap(*buf)]
+	var n int64
+	for w.w == nil {
+		// The encoding has not been chosen yet.
+		m, err := src.Read(b)
+		if m > 0 {
+			m, werr := w.Write(b[:m])
+			n += int64(m)
+			if werr != nil {
+				return n, werr
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+	}
+	if w.plain() {
+		m, err := w.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+		return n + m, err
+	}
+	m, err := io.CopyBuffer(w, src, b)
+	return n + m, err
+}
+
+// plain reports whether the rest of the response can be written directly
+// to the underlying ResponseWriter.
+func (w *compressWriter) plain() bool {
+	return w.w != nil && w.enc == "" && w.parts == nil && w.use == nil && !w.config.heartbeats && w.config.tee == nil && !w.closed
+}
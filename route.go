@@ -0,0 +1,164 @@
+package httpcompression
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Matcher reports whether a request matches a route (see Route).
+type Matcher func(r *http.Request) bool
+
+// MatchHost returns a Matcher matching the requests for any of the specified
+// hosts. The port of the request, if any, is ignored, and hosts are compared
+// case-insensitively. A host starting with "*." matches all its subdomains
+// (e.g. "*.example.com" matches "api.example.com", but not "example.com" or
+// "badexample.com"): other wildcards are not supported.
+func MatchHost(hosts ...string) Matcher {
+	return func(r *http.Request) bool {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		for _, h := range hosts {
+			if suffix, ok := strings.CutPrefix(h, "*"); ok && strings.HasPrefix(suffix, ".") {
+				// The suffix includes the dot, so only whole labels match.
+				if len(host) > len(suffix) && strings.EqualFold(host[len(host)-len(suffix):], suffix) {
+					return true
+				}
+			} else if strings.EqualFold(host, h) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchPathPrefix returns a Matcher matching the requests whose URL path
+// starts with any of the specified prefixes.
+func MatchPathPrefix(prefixes ...string) Matcher {
+	return func(r *http.Request) bool {
+		for _, p := range prefixes {
+			if strings.HasPrefix(r.URL.Path, p) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Route is an option that uses different options for the requests matching
+// match: the options of the middleware are used for these requests, plus
+// opts (e.g. different compression levels, MinSize, ContentTypes, or a nil
+// Compressor to disable an encoding). Routes are checked in the order in
+// which they are specified, and the first matching one is used; requests
+// not matching any route use the options of the middleware.
+//
+// All routes share the pools of the middleware, and the compressors of the
+// middleware are shared as well. Routes can not be nested.
+func Route(match Matcher, opts ...Option) Option {
+	return named("Route", func(c *config) error {
+		if match == nil {
+			return fmt.Errorf("route matcher can not be nil")
+		}
+		ropts := make([]Option, len(opts))
+		copy(ropts, opts)
+		c.routes = append(c.routes, route{match: match, opts: ropts})
+		return nil
+	})
+}
+
+type route struct {
+	match  Matcher
+	opts   any     // []Option, not typed as Yaegi does not support the recursive types
+	config *config // the options of the middleware plus opts, set by validate
+	tenant string  // see Tenant; match is then set by validate
+}
+
+// validateRoutes computes and validates the configuration of each route.
+func (c *config) validateRoutes() error {
+	tenants := map[string]bool{}
+	for i, rt := range c.routes {
+		if rt.tenant != "" {
+			if c.tenants == nil {
+				return fmt.Errorf("tenant %q: the Tenant option requires the TenantKey option", rt.tenant)
+			}
+			if tenants[rt.tenant] {
+				return fmt.Errorf("duplicate tenant %q", rt.tenant)
+			}
+			tenants[rt.tenant] = true
+			key, tenant := c.tenants.key, rt.tenant
+			c.routes[i].match = func(r *http.Request) bool { return key(r) == tenant }
+		}
+		rc := c.clone()
+		rc.routes = nil
+		if err := rc.apply(rt.opts.([]Option)...); err != nil {
+			return err
+		}
+		if len(rc.routes) > 0 {
+			return fmt.Errorf("routes can not be nested")
+		}
+		if err := rc.validate(); err != nil {
+			return err
+		}
+		c.routes[i].config = &rc
+	}
+	return nil
+}
+
+// routesAdapter is like adapter, but it dispatches each request to the
+// middleware of the first matching route.
+func routesAdapter(c config, p *pools) func(http.Handler) http.Handler {
+	routes, key := c.routes, c.tenants.keyFunc()
+	c.routes = nil
+	def := adapter(c, p)
+	return func(h http.Handler) http.Handler {
+		handlers := make([]http.Handler, len(routes))
+		for i, rt := range routes {
+			handlers[i] = adapter(*rt.config, p)(h)
+		}
+		dh := def(h)
+		return &compressHandler{config: &c, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if i := matchRoute(routes, key, r); i >= 0 {
+				handlers[i].ServeHTTP(w, r)
+				return
+			}
+			dh.ServeHTTP(w, r)
+		})}
+	}
+}
+
+// matchRoute returns the index of the first of routes matching r, or -1 if
+// none matches. The key of the tenant of r (see TenantKey) is computed at
+// most once.
+func matchRoute(routes []route, key func(r *http.Request) string, r *http.Request) int {
+	var (
+		tenant string
+		keyed  bool
+	)
+	for i, rt := range routes {
+		if rt.tenant != "" {
+			if !keyed {
+				tenant, keyed = key(r), true
+			}
+			if tenant == rt.tenant {
+				return i
+			}
+			continue
+		}
+		if rt.match(r) {
+			return i
+		}
+	}
+	return -1
+}
+
+// route returns the options used for r: the options of the first matching
+// route, if any, or c.
+func (c *config) route(r *http.Request) *config {
+	if i := matchRoute(c.routes, c.tenants.keyFunc(), r); i >= 0 {
+		return c.routes[i].config
+	}
+	return c
+}
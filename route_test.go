@@ -0,0 +1,85 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoute(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	mw, err := DefaultAdapter(
+		MinSize(10),
+		Route(MatchHost("static.example.com", "*.cdn.example.com"), BrotliCompressor(nil)),
+		Route(MatchPathPrefix("/big/"), MinSize(len(testBody)+1)),
+		Route(MatchPathPrefix("/api/"), ContentTypes([]string{"application/json"}, false)),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(testBody))
+	}))
+
+	cases := []struct {
+		host, path string
+		encoding   string
+	}{
+		{"example.com", "/", "br"},
+		{"static.example.com:8080", "/", "gzip"},
+		{"STATIC.example.com", "/big/file", "gzip"},
+		{"a.cdn.example.com", "/", "gzip"},
+		{"cdn.example.com", "/", "br"},
+		{"example.com", "/big/file", ""},
+		{"example.com", "/api/users", ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Host = c.host
+		req.Header.Set(acceptEncoding, "gzip, br")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, c.encoding, res.Header().Get(contentEncoding), "%s %s", c.host, c.path)
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		pattern, host string
+		match         bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "EXAMPLE.com:443", true},
+		{"example.com", "api.example.com", false},
+		{"*.example.com", "api.example.com", true},
+		{"*.example.com", "a.b.example.com:8080", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "badexample.com", false},
+		{"*.example.com", ".example.com", false},
+		{"*example.com", "badexample.com", false},
+		{"*example.com", "api.example.com", false},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Host = c.host
+		assert.Equal(t, c.match, MatchHost(c.pattern)(req), "%s %s", c.pattern, c.host)
+	}
+}
+
+func TestRouteInvalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := Adapter(Route(nil))
+	assert.Error(t, err)
+	_, err = Adapter(Route(MatchPathPrefix("/"), MinSize(-1)))
+	assert.Error(t, err)
+	_, err = Adapter(Route(MatchPathPrefix("/"), Route(MatchPathPrefix("/a"))))
+	assert.Error(t, err)
+}
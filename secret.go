@@ -0,0 +1,43 @@
+package httpcompression
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// SecretURLs is an option that disables compression for the requests whose
+// URL (path and query, e.g. "/oauth/callback?code=...") matches any of the
+// specified regular expressions, e.g.
+//
+//	httpcompression.SecretURLs(`[?&](access_)?token=`, `^/oauth/`)
+//
+// Compressed responses that reflect attacker-controlled data next to
+// secrets are vulnerable to BREACH-like attacks, that recover the secrets
+// from the compressed size of the responses: the responses to these
+// requests are never compressed. Multiple SecretURLs options add to each
+// other.
+func SecretURLs(patterns ...string) Option {
+	return named("SecretURLs", func(c *config) error {
+		for _, p := range patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return fmt.Errorf("invalid secret URL pattern %q: %w", p, err)
+			}
+			c.secretURLs = append(c.secretURLs, re)
+		}
+		return nil
+	})
+}
+
+// secretURL reports whether the URL of r matches any of the patterns of
+// SecretURLs.
+func (c *config) secretURL(r *http.Request) bool {
+	uri := r.URL.RequestURI()
+	for _, re := range c.secretURLs {
+		if re.MatchString(uri) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretURLs(t *testing.T) {
+	t.Parallel()
+
+	a, err := DefaultAdapter(SecretURLs(`[?&]token=`), SecretURLs(`^/oauth/`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(strings.Repeat(testBody, 10)))
+	}))
+	serve := func(target string) string {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, acceptEncoding, res.Header().Get(vary))
+		return res.Header().Get(contentEncoding)
+	}
+
+	assert.Equal(t, "gzip", serve("/"))
+	assert.Equal(t, "gzip", serve("/?mytoken=1"))
+	assert.Equal(t, "", serve("/?a=1&token=1"))
+	assert.Equal(t, "", serve("/oauth/callback"))
+	assert.Equal(t, "gzip", serve("/api/oauth/"))
+
+	_, err = Adapter(SecretURLs(`(`))
+	assert.Error(t, err)
+}
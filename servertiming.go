@@ -0,0 +1,37 @@
+package httpcompression
+
+import (
+	"strconv"
+	"time"
+)
+
+const serverTiming = "Server-Timing"
+
+// ServerTiming is an option that reports the time spent compressing each
+// compressed response in a Server-Timing entry named "compress", whose
+// description is the Content-Encoding of the response, e.g.:
+//
+//	Server-Timing: compress;dur=1.234;desc="br"
+//
+// so that the browser developer tools and the RUM tools can show the
+// compression latency of each request. Like the time tracked by
+// TrackCosts, the duration, in milliseconds, does not include the time
+// spent writing the response to the client.
+//
+// Since the compression time is only known at the end of the response, the
+// entry is sent as a trailer, announced in the Trailer header; it replaces
+// the Server-Timing entries set by the handler only in the trailer. The
+// responses served from the cache (see VariantCache) are not reported.
+func ServerTiming() Option {
+	return func(c *config) error {
+		c.serverTiming = true
+		return nil
+	}
+}
+
+// serverTimingValue returns the Server-Timing entry of a response compressed
+// with enc in d.
+func serverTimingValue(enc string, d time.Duration) string {
+	ms := strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+	return `compress;dur=` + ms + `;desc="` + enc + `"`
+}
@@ -0,0 +1,50 @@
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerTiming(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Header().Set(serverTiming, "db;dur=53")
+		io.WriteString(w, testBody)
+	})
+	serve := func(opts ...Option) *http.Response {
+		a, err := DefaultAdapter(opts...)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "br")
+		res := httptest.NewRecorder()
+		a(handler).ServeHTTP(res, req)
+		return res.Result()
+	}
+
+	res := serve(ServerTiming())
+	assert.Equal(t, "br", res.Header.Get(contentEncoding))
+	assert.Equal(t, []string{serverTiming}, res.Header.Values(trailer))
+	assert.Equal(t, "db;dur=53", res.Header.Get(serverTiming))
+	io.ReadAll(res.Body)
+	assert.Regexp(t, regexp.MustCompile(`^compress;dur=\d+\.\d{3};desc="br"$`), res.Trailer.Get(serverTiming))
+
+	// The uncompressed responses are not reported.
+	res = serve(ServerTiming(), MinSize(len(testBody)+1))
+	assert.Empty(t, res.Header.Get(contentEncoding))
+	assert.Empty(t, res.Header.Values(trailer))
+	assert.Empty(t, res.Trailer)
+
+	// Without the option there is no trailer.
+	res = serve()
+	assert.Empty(t, res.Header.Values(trailer))
+}
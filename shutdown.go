@@ -0,0 +1,134 @@
+package httpcompression
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// shutdown tracks the requests served by a Middleware, so that Shutdown can
+// wait for them.
+type shutdown struct {
+	mu       sync.RWMutex
+	closed   bool
+	inflight sync.WaitGroup
+}
+
+// begin reports whether the middleware has not been shut down, in which case
+// the request must call end once it has been completed.
+func (s *shutdown) begin() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false
+	}
+	s.inflight.Add(1)
+	return true
+}
+
+func (s *shutdown) end() {
+	s.inflight.Done()
+}
+
+// Shutdown releases the resources of the middleware. The requests received
+// after Shutdown has been called are passed to the wrapped handlers without
+// compressing their responses. Shutdown waits, until ctx is done, for the
+// responses being compressed and for the variants being compressed in the
+// background (see StaleWhileRevalidate); then it drains the pools, and
+// closes the CompressorProviders implementing io.Closer (e.g. the cgo
+// providers holding native memory). If ctx is done before the responses
+// have been completed, ctx.Err() is returned and the resources are not
+// released: Shutdown can then be called again.
+//
+// The middlewares returned by With share the pools and the compressors of m,
+// so they must not be used after m has been shut down. The caches set with
+// VariantCache are not closed, as they can be shared.
+func (m *Middleware) Shutdown(ctx context.Context) error {
+	m.shutdown.mu.Lock()
+	m.shutdown.closed = true
+	m.shutdown.mu.Unlock()
+
+	c := m.current().config
+	configs := []*config{&c}
+	for _, rt := range c.routes {
+		configs = append(configs, rt.config)
+	}
+	done := make(chan struct{})
+	go func() {
+		m.shutdown.inflight.Wait()
+		for _, c := range configs {
+			if c.stale != nil {
+				c.stale.running.Wait()
+			}
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for m.pools.writer.Get() != nil {
+	}
+	for m.pools.buf.Get() != nil {
+	}
+	return closeProviders(configs)
+}
+
+// Close is like Shutdown, but it waits for the responses being compressed
+// with no deadline.
+func (m *Middleware) Close() error {
+	return m.Shutdown(context.Background())
+}
+
+// closeProviders closes, once, the providers of configs implementing
+// io.Closer.
+func closeProviders(configs []*config) error {
+	var (
+		closed []any
+		errs   []error
+	)
+	closeProvider := func(p any) {
+		cl, ok := p.(io.Closer)
+		if !ok || !isComparable(p) {
+			return
+		}
+		for _, q := range closed {
+			if q == p {
+				return
+			}
+		}
+		closed = append(closed, p)
+		if err := cl.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, c := range configs {
+		for _, cc := range c.compressor {
+			if f, ok := cc.comp.(*failover); ok {
+				for _, p := range f.providers {
+					closeProvider(p)
+				}
+				continue
+			}
+			closeProvider(cc.comp)
+		}
+		if c.dict != nil {
+			for _, dc := range c.dict.comps {
+				closeProvider(dc.provider)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isComparable reports whether p can be compared with ==: comparing two values
+// of the same incomparable dynamic type (e.g. a struct with a func field)
+// panics.
+func isComparable(p any) (ok bool) {
+	defer func() { recover() }()
+	_ = p == p
+	return true
+}
@@ -0,0 +1,98 @@
+package httpcompression
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// closingProvider counts how many times it is closed.
+type closingProvider struct {
+	CompressorProvider
+	closed atomic.Int32
+}
+
+func (p *closingProvider) Close() error {
+	p.closed.Add(1)
+	return nil
+}
+
+func TestMiddlewareShutdown(t *testing.T) {
+	t.Parallel()
+
+	gz, err := NewDefaultGzipCompressor(6)
+	if !assert.NoError(t, err) {
+		return
+	}
+	p := &closingProvider{CompressorProvider: gz}
+	m, err := NewMiddleware(GzipCompressor(p), Route(MatchPathPrefix("/small"), MinSize(0)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		w.Write([]byte(testBody))
+	}))
+	get := func(path string) string {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res.Header().Get(contentEncoding)
+	}
+
+	slow := make(chan string)
+	go func() { slow <- get("/slow") }()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, m.Shutdown(ctx), context.DeadlineExceeded)
+	assert.Equal(t, int32(0), p.closed.Load())
+	// The new requests are not compressed once Shutdown has been called.
+	assert.Equal(t, "", get("/"))
+
+	close(release)
+	assert.Equal(t, "gzip", <-slow)
+	assert.NoError(t, m.Close())
+	assert.Equal(t, int32(1), p.closed.Load())
+	assert.Equal(t, "", get("/small"))
+}
+
+// funcProvider is a provider of an incomparable type.
+type funcProvider struct {
+	CompressorProvider
+	close func() error
+}
+
+func (p funcProvider) Close() error { return p.close() }
+
+func TestCloseProvidersIncomparable(t *testing.T) {
+	t.Parallel()
+
+	gz, err := NewDefaultGzipCompressor(6)
+	if !assert.NoError(t, err) {
+		return
+	}
+	closed := 0
+	p := funcProvider{CompressorProvider: gz, close: func() error { closed++; return nil }}
+	m, err := NewMiddleware(GzipCompressor(p))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, m.Close())
+	// It can not be told apart from the other providers, so it is not closed.
+	assert.Equal(t, 0, closed)
+	assert.False(t, isComparable(p))
+	assert.True(t, isComparable(gz))
+}
@@ -0,0 +1,65 @@
+package httpcompression
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	signature      = "Signature"
+	signatureInput = "Signature-Input"
+)
+
+// SignedResponses is an option for the responses signed by the handler with
+// HTTP message signatures (RFC 9421), whose signatures cover components
+// invalidated by the compression (Content-Digest, Repr-Digest,
+// Content-Length or Content-Encoding): if resign is nil these responses are
+// not compressed, otherwise they are compressed and resign is called with
+// the request and the headers of the compressed response (e.g. with the
+// Content-Encoding set, and without the invalidated headers), before they
+// are written, to replace the Signature and Signature-Input headers; if it
+// can not sign the compressed response, it should remove them. The
+// responses whose signatures do not cover the content are compressed as
+// usual.
+func SignedResponses(resign func(r *http.Request, h http.Header)) Option {
+	return func(c *config) error {
+		c.signatures = &signatureConfig{resign: resign}
+		return nil
+	}
+}
+
+type signatureConfig struct {
+	resign func(r *http.Request, h http.Header)
+}
+
+// signedContent reports whether the signatures in h cover components that
+// are invalidated by the compression.
+func signedContent(h http.Header) bool {
+	if len(h.Values(signature)) == 0 {
+		return false
+	}
+	for _, v := range h.Values(signatureInput) {
+		// Each signature is a member of a dictionary, whose value is the
+		// inner list of the covered components, e.g.
+		// sig1=("@status" "content-digest");keyid="key".
+		for v != "" {
+			start := strings.IndexByte(v, '(')
+			if start < 0 {
+				break
+			}
+			end := strings.IndexByte(v[start:], ')')
+			if end < 0 {
+				end = len(v) - start
+			}
+			for _, c := range strings.Fields(v[start+1 : start+end]) {
+				name, _, _ := strings.Cut(c, ";")
+				switch strings.ToLower(strings.Trim(name, `"`)) {
+				case "content-digest", "repr-digest", "content-length", "content-encoding":
+					return true
+				}
+			}
+			v = v[start+end:]
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedResponses(t *testing.T) {
+	t.Parallel()
+
+	serve := func(input string, opts ...Option) *httptest.ResponseRecorder {
+		a, err := DefaultAdapter(opts...)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(contentType, "text/plain")
+			w.Header().Set(signatureInput, input)
+			w.Header().Set(signature, "sig1=:c2lnbmF0dXJl:")
+			io.WriteString(w, testBody)
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+
+	const (
+		content = `sig1=("@status" "content-type" "content-digest");created=1618884473;keyid="test-key"`
+		headers = `sig1=("@status" "content-type");keyid="test-key"`
+	)
+	cases := []struct {
+		input string
+		opts  []Option
+		enc   string
+	}{
+		{content, nil, "gzip"},
+		{content, []Option{SignedResponses(nil)}, ""},
+		{`sig1=("@status"), sig2=("Content-Length";bs)`, []Option{SignedResponses(nil)}, ""},
+		{headers, []Option{SignedResponses(nil)}, "gzip"},
+	}
+	for _, c := range cases {
+		res := serve(c.input, c.opts...)
+		assert.Equal(t, c.enc, res.Header().Get(contentEncoding), c.input)
+		assert.NotEmpty(t, res.Header().Get(signature), c.input)
+	}
+
+	// The compressed responses can be signed again.
+	res := serve(content, SignedResponses(func(r *http.Request, h http.Header) {
+		assert.Equal(t, "/", r.URL.Path)
+		assert.Equal(t, "gzip", h.Get(contentEncoding))
+		h.Set(signature, "sig1=:cmVzaWduZWQ=:")
+	}))
+	assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+	assert.Equal(t, "sig1=:cmVzaWduZWQ=:", res.Header().Get(signature))
+}
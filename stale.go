@@ -0,0 +1,172 @@
+package httpcompression
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	maxStaleEntries    = 1 << 16  // maximum number of tracked variants
+	maxRevalidateBytes = 64 << 20 // maximum size of the uncompressed responses revalidated in the background
+)
+
+// StaleWhileRevalidate is an option that, when the validator of a response
+// whose compressed variant is in the variant cache changes (e.g. because a
+// large asset has been updated), makes the middleware keep serving the stale
+// compressed variant, with its original validator, while the new content is
+// compressed in the background. Once the new variant is in the cache it is
+// served to the following requests. This avoids latency spikes caused by
+// compressing large responses when the cached variants are invalidated.
+//
+// Stale variants are served for at most maxStale after the new validator is
+// first seen; after that (e.g. if the new response was too large to be
+// revalidated in the background) the new content is compressed in the
+// request, as without this option. Responses larger than 64MB are not
+// revalidated in the background.
+//
+// StaleWhileRevalidate requires the VariantCache option.
+func StaleWhileRevalidate(maxStale time.Duration) Option {
+	return named("StaleWhileRevalidate", func(c *config) error {
+		if maxStale <= 0 {
+			return fmt.Errorf("stale-while-revalidate maximum staleness must be positive: %v", maxStale)
+		}
+		c.stale = &staleConfig{maxStale: maxStale, entries: map[staleKey]*staleEntry{}}
+		return nil
+	})
+}
+
+// staleConfig tracks the validators of the variants that have been cached
+// for each URL and encoding, so that the stale variants can be found when the
+// validator changes.
+type staleConfig struct {
+	maxStale time.Duration
+	running  sync.WaitGroup // revalidations running in the background
+
+	mu      sync.Mutex
+	entries map[staleKey]*staleEntry
+}
+
+type staleKey struct {
+	url string
+	enc string
+}
+
+type staleEntry struct {
+	validator    string    // validator of the cached variant
+	header       string    // header holding the validator (ETag or Last-Modified)
+	changed      time.Time // when a different validator was first seen; zero if none was seen
+	revalidating bool      // a new variant is being compressed in the background
+}
+
+// validatorHeader returns the name of the header holding the validator of
+// the response (see cacheValidator).
+func validatorHeader(h http.Header) string {
+	if h.Get(etag) != "" {
+		return etag
+	}
+	return lastModified
+}
+
+// stored records that the variant for key has been stored in the cache.
+func (s *staleConfig) stored(key CacheKey, header string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := staleKey{key.URL, key.Encoding}
+	if _, ok := s.entries[k]; !ok && len(s.entries) >= maxStaleEntries {
+		return
+	}
+	s.entries[k] = &staleEntry{validator: key.Validator, header: header}
+}
+
+// stale returns the entry of the stale variant to be served instead of the
+// missing variant for key, if any. If revalidate is true the caller must
+// compress the new variant and then call revalidated.
+func (s *staleConfig) stale(key CacheKey, now time.Time) (e staleEntry, revalidate bool, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.entries[staleKey{key.URL, key.Encoding}]
+	if p == nil || p.validator == key.Validator {
+		return staleEntry{}, false, false
+	}
+	if p.changed.IsZero() {
+		p.changed = now
+	} else if now.Sub(p.changed) > s.maxStale {
+		return staleEntry{}, false, false
+	}
+	revalidate = !p.revalidating
+	p.revalidating = true
+	return *p, revalidate, true
+}
+
+// revalidated records the end of the revalidation of the variant for key:
+// ok is true if the new variant has been stored in the cache.
+func (s *staleConfig) revalidated(key CacheKey, header string, ok bool) {
+	if ok {
+		s.stored(key, header)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p := s.entries[staleKey{key.URL, key.Encoding}]; p != nil {
+		p.revalidating = false
+	}
+}
+
+// revalidation collects the uncompressed response written by the handler
+// while the stale variant is served, and on Close compresses it in the
+// background and stores it in the cache.
+type revalidation struct {
+	stale    *staleConfig
+	cache    *cacheConfig
+	key      CacheKey
+	header   string
+	provider CompressorProvider
+	buf      []byte
+	full     bool // the response exceeded maxRevalidateBytes
+
+	deterministic bool // see Deterministic
+}
+
+func (r *revalidation) Write(b []byte) (int, error) {
+	if !r.full {
+		if len(r.buf)+len(b) > maxRevalidateBytes {
+			r.full, r.buf = true, nil
+		} else {
+			r.buf = append(r.buf, b...)
+		}
+	}
+	return len(b), nil
+}
+
+func (r *revalidation) Close() error {
+	if r.full {
+		r.stale.revalidated(r.key, r.header, false)
+		return nil
+	}
+	r.stale.running.Add(1)
+	go func() {
+		defer r.stale.running.Done()
+		r.run()
+	}()
+	return nil
+}
+
+func (r *revalidation) run() {
+	var out bytes.Buffer
+	zw := r.provider.Get(&out)
+	if r.deterministic {
+		zw = newBlockWriter(zw)
+	}
+	_, err := zw.Write(r.buf)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	ok := err == nil && out.Len() <= r.cache.maxEntrySize
+	if ok {
+		r.cache.cache.Set(r.key, out.Bytes(), r.cache.ttl)
+	}
+	r.stale.revalidated(r.key, r.header, ok)
+}
@@ -0,0 +1,141 @@
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mu      sync.Mutex
+		version = "v1"
+	)
+	setVersion := func(v string) {
+		mu.Lock()
+		version = v
+		mu.Unlock()
+	}
+	gz, _ := NewDefaultGzipCompressor(6)
+	cp := &countingProvider{CompressorProvider: gz}
+	cache := NewMemoryCache(1 << 20)
+	mw, err := Adapter(GzipCompressor(cp), VariantCache(cache, time.Hour, 1<<20), StaleWhileRevalidate(time.Minute))
+	assert.Nil(t, err)
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		v := version
+		mu.Unlock()
+		w.Header().Set(etag, `"`+v+`"`)
+		io.WriteString(w, v+testBody)
+	}))
+	get := func() (string, string) {
+		req := httptest.NewRequest("GET", "/asset", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		b, err := decodeGzip(res.Body)
+		assert.Nil(t, err)
+		return res.Header().Get(etag), string(b)
+	}
+
+	tag, body := get()
+	assert.Equal(t, `"v1"`, tag)
+	assert.Equal(t, "v1"+testBody, body)
+
+	// The content changes: the stale variant is served, with its validator,
+	// while the new one is compressed in the background.
+	setVersion("v2")
+	tag, body = get()
+	assert.Equal(t, `"v1"`, tag)
+	assert.Equal(t, "v1"+testBody, body)
+
+	key := CacheKey{URL: "example.com/asset", Encoding: "gzip", Validator: `"v2"`}
+	assert.Eventually(t, func() bool {
+		_, ok := cache.Get(key)
+		return ok
+	}, time.Second, time.Millisecond)
+
+	tag, body = get()
+	assert.Equal(t, `"v2"`, tag)
+	assert.Equal(t, "v2"+testBody, body)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&cp.n))
+}
+
+// blockingProvider blocks the compression until release is closed.
+type blockingProvider struct {
+	CompressorProvider
+	release chan struct{}
+}
+
+func (p *blockingProvider) Get(w io.Writer) io.WriteCloser {
+	return blockingWriter{p.CompressorProvider.Get(w), p.release}
+}
+
+type blockingWriter struct {
+	io.WriteCloser
+	release chan struct{}
+}
+
+func (w blockingWriter) Close() error {
+	<-w.release
+	return w.WriteCloser.Close()
+}
+
+func TestStaleWhileRevalidateInProgress(t *testing.T) {
+	t.Parallel()
+
+	gz, _ := NewDefaultGzipCompressor(6)
+	bp := &blockingProvider{CompressorProvider: gz, release: make(chan struct{})}
+	cp := &countingProvider{CompressorProvider: bp}
+	cache := NewMemoryCache(1 << 20)
+	mw, err := Adapter(GzipCompressor(cp), VariantCache(cache, time.Hour, 1<<20), StaleWhileRevalidate(time.Minute))
+	assert.Nil(t, err)
+	var version atomic.Value
+	version.Store("v1")
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(lastModified, version.Load().(string))
+		io.WriteString(w, strings.Repeat("a", 1000))
+	}))
+	get := func() string {
+		req := httptest.NewRequest("GET", "/asset", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res.Header().Get(lastModified)
+	}
+
+	close(bp.release)
+	assert.Equal(t, "v1", get())
+	bp.release = make(chan struct{})
+
+	// Only one revalidation is started, the other requests get the stale
+	// variant without compressing.
+	version.Store("v2")
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "v1", get())
+	}
+
+	close(bp.release)
+	assert.Eventually(t, func() bool {
+		return get() == "v2"
+	}, time.Second, time.Millisecond)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&cp.n))
+}
+
+func TestStaleWhileRevalidateInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	_, err := Adapter(GzipCompressionLevel(5), StaleWhileRevalidate(time.Minute))
+	assert.NotNil(t, err)
+	_, err = Adapter(GzipCompressionLevel(5), VariantCache(NewMemoryCache(1<<20), 0, 1<<20), StaleWhileRevalidate(0))
+	assert.NotNil(t, err)
+}
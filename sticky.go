@@ -0,0 +1,82 @@
+package httpcompression
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// ConnContext is a function to be used as the ConnContext of an http.Server
+// (or to be called by it), that makes the middleware remember the outcome of
+// the negotiation of the encodings for each connection: as the
+// Accept-Encoding header rarely changes between the requests on the same
+// connection (HTTP/1.1 keep-alive or HTTP/2), the requests with the same
+// Accept-Encoding header of the previous request on the connection skip its
+// parsing, e.g.:
+//
+//	srv := &http.Server{Handler: handler, ConnContext: httpcompression.ConnContext}
+//
+// The outcome is not remembered when the options restricting the encodings
+// for each request (AssumeGzip, EgressAware, EncodingProtocols,
+// Intermediaries and SecretURLs) are used.
+func ConnContext(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, &connNegotiation{})
+}
+
+type connKey struct{}
+
+// connNegotiation is the last negotiation of a connection (see ConnContext).
+// It is shared by the concurrent requests of an HTTP/2 connection.
+type connNegotiation struct {
+	last atomic.Value // *negotiation
+}
+
+type negotiation struct {
+	c      *config
+	header []string // the Accept-Encoding header
+	accept codings  // not modified after being stored
+	common []string
+}
+
+// negotiate returns the encodings accepted by the client of r, after the
+// options restricting them (see gateEncodings), and the ones that are
+// accepted and configured.
+func (c *config) negotiate(w http.ResponseWriter, r *http.Request) (codings, []string) {
+	cn, _ := r.Context().Value(connKey{}).(*connNegotiation)
+	if cn != nil && c.gated() {
+		cn = nil
+	}
+	if cn != nil {
+		if n, _ := cn.last.Load().(*negotiation); n != nil && n.c == c && equalStrings(n.header, r.Header[acceptEncoding]) {
+			// preferredEncoding sorts common.
+			return n.accept, append([]string(nil), n.common...)
+		}
+	}
+	accept := parseEncodings(r.Header.Values(acceptEncoding))
+	c.gateEncodings(w, r, accept, nil)
+	common := acceptedCompression(accept, c.compressor)
+	if cn != nil {
+		cn.last.Store(&negotiation{c: c, header: append([]string(nil), r.Header[acceptEncoding]...), accept: accept, common: append([]string(nil), common...)})
+	}
+	return accept, common
+}
+
+// gated reports whether the encodings accepted by the clients are restricted
+// differently for each request (see gateEncodings). The options checked here
+// are listed in the ConnContext comment, that must be kept in sync.
+func (c *config) gated() bool {
+	return c.assumeGzip != nil || len(c.protocols) > 0 || c.proxies != nil || len(c.secretURLs) > 0 || c.egress != nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
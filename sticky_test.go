@@ -0,0 +1,81 @@
+package httpcompression
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnContext(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	c, err := newConfig(defaultOptions()...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx := ConnContext(context.Background(), nil)
+	negotiate := func(c *config, ctx context.Context, accept string) (codings, []string) {
+		req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+		req.Header.Set(acceptEncoding, accept)
+		return c.negotiate(httptest.NewRecorder(), req)
+	}
+	same := func(a, b codings) bool {
+		return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+	}
+
+	a1, common := negotiate(&c, ctx, "gzip, br")
+	assert.ElementsMatch(t, []string{"gzip", "br"}, common)
+	a2, common := negotiate(&c, ctx, "gzip, br")
+	assert.True(t, same(a1, a2), "the negotiation must be remembered")
+	assert.ElementsMatch(t, []string{"gzip", "br"}, common)
+	a3, common := negotiate(&c, ctx, "zstd")
+	assert.False(t, same(a1, a3), "the negotiation must be repeated when the header changes")
+	assert.Equal(t, []string{"zstd"}, common)
+
+	// Without ConnContext, or with options depending on each request, the
+	// negotiation is always repeated.
+	a1, _ = negotiate(&c, context.Background(), "gzip")
+	a2, _ = negotiate(&c, context.Background(), "gzip")
+	assert.False(t, same(a1, a2))
+	g, err := newConfig(append(defaultOptions(), SecretURLs("/secret/"))...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	a1, _ = negotiate(&g, ctx, "gzip")
+	a2, _ = negotiate(&g, ctx, "gzip")
+	assert.False(t, same(a1, a2))
+
+	// End to end, on keep-alive connections.
+	a, err := DefaultAdapter()
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := httptest.NewUnstartedServer(a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		io.WriteString(w, testBody)
+	})))
+	srv.Config.ConnContext = ConnContext
+	srv.Start()
+	defer srv.Close()
+	tr := &http.Transport{DisableCompression: true}
+	defer tr.CloseIdleConnections()
+	for _, enc := range []string{"gzip", "gzip", "br", "gzip"} {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		req.Header.Set(acceptEncoding, enc)
+		res, err := tr.RoundTrip(req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		b, err := decodeBody(res.Body, res.Header.Get(contentEncoding))
+		res.Body.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, enc, res.Header.Get(contentEncoding))
+		assert.Equal(t, testBody, string(b))
+	}
+}
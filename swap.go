@@ -0,0 +1,204 @@
+package httpcompression
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// drain counts the requests served with a middlewareState, so that the
+// providers it uses can be closed once it has been replaced and all its
+// requests have been completed (see SwapCompressor).
+type drain struct {
+	mu     sync.Mutex
+	n      int
+	closed bool
+	idle   chan struct{} // closed once closed is set and n is 0
+}
+
+func newDrain() drain {
+	return drain{idle: make(chan struct{})}
+}
+
+// begin reports whether the state has not been replaced, in which case the
+// request must call end once it has been completed.
+func (d *drain) begin() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return false
+	}
+	d.n++
+	return true
+}
+
+func (d *drain) end() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.n--
+	if d.closed && d.n == 0 {
+		close(d.idle)
+	}
+}
+
+// close marks the state as replaced: no new requests are served with it.
+func (d *drain) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	if d.n == 0 {
+		close(d.idle)
+	}
+}
+
+func (d *drain) drained() bool {
+	select {
+	case <-d.idle:
+		return true
+	default:
+		return false
+	}
+}
+
+// SwapCompressor replaces, at runtime, the CompressorProvider used for the
+// specified Content-Encoding with p (e.g. to upgrade a compressor library
+// without downtime), keeping the other options of the middleware, including
+// the priority of the encoding. The new provider is used for the requests
+// received after SwapCompressor has been called, while the requests being
+// served keep using the previous one: SwapCompressor waits, until ctx is
+// done, for these requests, and then closes the previous provider if it
+// implements io.Closer and it is not used anymore (e.g. by a Route).
+//
+// If ctx is done first, ctx.Err() is returned: the provider has been
+// swapped, but the previous one has not been closed. The routes that set
+// their own provider for the encoding keep using it. Like the other
+// updates of the current options, the swap is undone by the next Reload
+// unless its options include p.
+func (m *Middleware) SwapCompressor(ctx context.Context, contentEncoding string, p CompressorProvider) error {
+	if p == nil {
+		return fmt.Errorf("the provider of %q can not be nil", contentEncoding)
+	}
+	var old CompressorProvider
+	err := m.swap(ctx, func(c *config) error {
+		cc, ok := c.compressor[contentEncoding]
+		if !ok {
+			return fmt.Errorf("encoding %q is not enabled", contentEncoding)
+		}
+		old = cc.comp
+		cc.comp, cc.level = p, nil
+		c.compressor[contentEncoding] = cc
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if m.uses(old) {
+		return nil
+	}
+	return closeProviders([]*config{{compressor: comps{contentEncoding: {comp: old}}}})
+}
+
+// SwapDictionaryCompressor is like SwapCompressor, but for the provider of
+// a dictionary Content-Encoding (see DictionaryCompressor): the providers
+// created by the previous one for each dictionary are closed, if they
+// implement io.Closer, once the requests being served have been completed.
+func (m *Middleware) SwapDictionaryCompressor(ctx context.Context, contentEncoding string, p DictionaryCompressorProvider) error {
+	if p == nil {
+		return fmt.Errorf("the provider of %q can not be nil", contentEncoding)
+	}
+	var old *sync.Map
+	err := m.swap(ctx, func(c *config) error {
+		if !c.dict.enabled() {
+			return fmt.Errorf("dictionary encoding %q is not enabled", contentEncoding)
+		}
+		dc, ok := c.dict.comps[contentEncoding]
+		if !ok {
+			return fmt.Errorf("dictionary encoding %q is not enabled", contentEncoding)
+		}
+		dc.provider = p
+		c.dict.comps[contentEncoding] = dc
+		// The providers of the other encodings can still be used.
+		old, c.dict.providers = c.dict.providers, &sync.Map{}
+		old.Range(func(k, v any) bool {
+			if k.(dictProviderKey).enc != contentEncoding {
+				c.dict.providers.Store(k, v)
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var configs []*config
+	old.Range(func(k, v any) bool {
+		if k.(dictProviderKey).enc == contentEncoding {
+			configs = append(configs, &config{compressor: comps{contentEncoding: {comp: v.(*dictProvider).CompressorProvider}}})
+		}
+		return true
+	})
+	return closeProviders(configs)
+}
+
+// swap applies opt on top of the current options, and then waits, until ctx
+// is done, for the requests served with the previous options.
+func (m *Middleware) swap(ctx context.Context, opt Option) error {
+	m.mu.Lock()
+	if err := m.updateLocked(opt); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	var configs []*config
+	idle := make([]chan struct{}, 0, len(m.retired))
+	for _, s := range m.retired {
+		idle = append(idle, s.requests.idle)
+		configs = append(configs, s.configs()...)
+	}
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		for _, ch := range idle {
+			<-ch
+		}
+		for _, c := range configs {
+			if c.stale != nil {
+				c.stale.running.Wait()
+			}
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// uses reports whether the current options of the middleware use p.
+func (m *Middleware) uses(p CompressorProvider) bool {
+	if p == nil || !isComparable(p) {
+		return true
+	}
+	c := m.current().config
+	configs := []*config{&c}
+	for _, rt := range c.routes {
+		configs = append(configs, rt.config)
+	}
+	for _, c := range configs {
+		for _, cc := range c.compressor {
+			if cc.comp == p {
+				return true
+			}
+			if f, ok := cc.comp.(*failover); ok {
+				for _, q := range f.providers {
+					if q == p {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package httpcompression
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// swapProvider counts its compressors.
+type swapProvider struct {
+	closingProvider
+	gets atomic.Int32
+}
+
+func (p *swapProvider) Get(w io.Writer) io.WriteCloser {
+	p.gets.Add(1)
+	return p.CompressorProvider.Get(w)
+}
+
+func TestSwapCompressor(t *testing.T) {
+	t.Parallel()
+
+	gz, err := NewDefaultGzipCompressor(6)
+	if !assert.NoError(t, err) {
+		return
+	}
+	blue, green := &swapProvider{closingProvider: closingProvider{CompressorProvider: gz}}, &swapProvider{closingProvider: closingProvider{CompressorProvider: gz}}
+	m, err := NewMiddleware(GzipCompressor(blue))
+	if !assert.NoError(t, err) {
+		return
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		w.Write([]byte(testBody))
+	}))
+	get := func(path string) {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		b, err := decodeBody(res.Body, res.Header().Get(contentEncoding))
+		assert.NoError(t, err)
+		assert.Equal(t, testBody, string(b))
+	}
+
+	slow := make(chan struct{})
+	go func() { get("/slow"); close(slow) }()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, m.SwapCompressor(ctx, "gzip", green), context.DeadlineExceeded)
+	get("/")
+	assert.EqualValues(t, 1, green.gets.Load())
+	assert.Zero(t, blue.closed.Load())
+
+	swapped := make(chan error)
+	go func() { swapped <- m.SwapCompressor(context.Background(), "gzip", blue) }()
+	select {
+	case <-swapped:
+		t.Fatal("SwapCompressor returned before the requests completed")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	<-slow
+	assert.NoError(t, <-swapped)
+	assert.EqualValues(t, 1, blue.gets.Load())
+	assert.EqualValues(t, 1, green.closed.Load())
+	assert.Zero(t, blue.closed.Load(), "the provider in use must not be closed")
+
+	assert.Error(t, m.SwapCompressor(context.Background(), "br", green))
+	assert.Error(t, m.SwapCompressor(context.Background(), "gzip", nil))
+	assert.Error(t, m.SwapDictionaryCompressor(context.Background(), DictionaryZstandardEncoding, zstdDictionaryCompressor))
+}
+
+func TestSwapDictionaryCompressor(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	dict := NewDictionary([]byte(testBody), "")
+	m, err := DefaultMiddleware(Dictionaries(dict))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(testBody))
+	}))
+	get := func() string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "dcz, gzip")
+		req.Header.Set(availableDictionary, availableDictionaryHeader(dict))
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, DictionaryZstandardEncoding, res.Header().Get(contentEncoding))
+		return decodeDCZ(t, res.Body.Bytes(), []byte(testBody))
+	}
+
+	var provided []*closingProvider
+	p := func(dict []byte) (CompressorProvider, error) {
+		zp, err := zstdDictionaryCompressor(dict)
+		if err != nil {
+			return nil, err
+		}
+		cp := &closingProvider{CompressorProvider: zp}
+		provided = append(provided, cp)
+		return cp, nil
+	}
+	assert.Equal(t, testBody, get())
+	assert.NoError(t, m.SwapDictionaryCompressor(context.Background(), DictionaryZstandardEncoding, p))
+	assert.Equal(t, testBody, get())
+	assert.Equal(t, testBody, get())
+	if !assert.Len(t, provided, 1) {
+		return
+	}
+	assert.NoError(t, m.SwapDictionaryCompressor(context.Background(), DictionaryZstandardEncoding, zstdDictionaryCompressor))
+	assert.Equal(t, testBody, get())
+	assert.EqualValues(t, 1, provided[0].closed.Load())
+	assert.Error(t, m.SwapDictionaryCompressor(context.Background(), DictionaryBrotliEncoding+"x", p))
+}
+
+func TestSwapDictionaryCompressorStore(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	dict := NewDictionary([]byte(testBody), "")
+	store := NewDictionaryStore()
+	store.Add(dict, 0)
+	m, err := DefaultMiddleware(DictionariesFrom(store))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(testBody))
+	}))
+	get := func() {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "dcz, gzip")
+		req.Header.Set(availableDictionary, availableDictionaryHeader(dict))
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		assert.Equal(t, DictionaryZstandardEncoding, res.Header().Get(contentEncoding))
+	}
+	provider := func() bool {
+		_, ok := m.current().config.dict.providers.Load(dictProviderKey{DictionaryZstandardEncoding, dict.hash})
+		return ok
+	}
+
+	get()
+	assert.NoError(t, m.SwapDictionaryCompressor(context.Background(), DictionaryZstandardEncoding, zstdDictionaryCompressor))
+	get()
+	assert.True(t, provider())
+	store.Remove(dict.hash)
+	assert.False(t, provider(), "the provider of the removed dictionary must be forgotten")
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, m.Reload())
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	assert.LessOrEqual(t, len(store.caches), 2, "the caches of the drained configurations must be unregistered")
+}
@@ -0,0 +1,60 @@
+package httpcompression
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// Tee is an option that writes a copy of the uncompressed body of each
+// response to the writer returned by open (e.g. for audit logging, to
+// populate a cache, or to index the responses), while the client receives
+// the compressed response, so that the handlers do not have to write the
+// body twice.
+//
+// open is called once for each response, when the handler writes the body
+// for the first time (or when it returns, if it never writes it), with the
+// request, the status and the headers of the response, that must not be
+// modified; if it returns nil the body of the response is not copied. The
+// returned writer is closed when the response is complete. If a write to it
+// fails it is closed, and the rest of the body is not copied: the errors of
+// the copy never affect the response.
+func Tee(open func(r *http.Request, status int, h http.Header) io.WriteCloser) Option {
+	if open == nil {
+		return errorOption("Tee", errors.New("tee function can not be nil"))
+	}
+	return func(c *config) error {
+		c.tee = open
+		return nil
+	}
+}
+
+type teeFunc = func(r *http.Request, status int, h http.Header) io.WriteCloser
+
+// teeWrite copies b to the writer of the Tee option, opening it if needed.
+func (w *compressWriter) teeWrite(b []byte) {
+	if w.teeReq != nil {
+		w.openTee()
+	}
+	if w.tee == nil {
+		return
+	}
+	if _, err := w.tee.Write(b); err != nil {
+		w.closeTee()
+	}
+}
+
+func (w *compressWriter) openTee() {
+	r := w.teeReq
+	w.teeReq = nil
+	status := w.code
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.tee = w.config.tee(r, status, w.Header())
+}
+
+func (w *compressWriter) closeTee() {
+	w.tee.Close()
+	w.tee = nil
+}
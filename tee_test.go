@@ -0,0 +1,159 @@
+package httpcompression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type teeBuffer struct {
+	bytes.Buffer
+	status int
+	closed bool
+	err    error
+}
+
+func (b *teeBuffer) Write(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.Buffer.Write(p)
+}
+
+func (b *teeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestTee(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	var (
+		mu   sync.Mutex
+		tees []*teeBuffer
+		fail error
+	)
+	a, err := DefaultAdapter(Tee(func(r *http.Request, status int, h http.Header) io.WriteCloser {
+		if r.URL.Path == "/skip" {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		b := &teeBuffer{status: status, err: fail}
+		tees = append(tees, b)
+		return b
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		if r.URL.Path == "/empty" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		io.WriteString(w, testBody[:100])
+		w.Write([]byte(testBody[100:]))
+	}))
+	serve := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if accept != "" {
+			req.Header.Set(acceptEncoding, accept)
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+	last := func() *teeBuffer {
+		mu.Lock()
+		defer mu.Unlock()
+		return tees[len(tees)-1]
+	}
+
+	// The compressed responses are copied uncompressed.
+	res := serve("/", "br")
+	assert.Equal(t, "br", res.Header().Get(contentEncoding))
+	b, err := decodeBody(res.Body, "br")
+	assert.NoError(t, err)
+	assert.Equal(t, testBody, string(b))
+	assert.Equal(t, testBody, last().String())
+	assert.Equal(t, http.StatusOK, last().status)
+	assert.True(t, last().closed)
+
+	// As are those that are not compressed.
+	res = serve("/", "")
+	assert.Empty(t, res.Header().Get(contentEncoding))
+	assert.Equal(t, testBody, res.Body.String())
+	assert.Equal(t, testBody, last().String())
+	assert.True(t, last().closed)
+
+	// The responses without a body are reported too.
+	serve("/empty", "gzip")
+	assert.Equal(t, http.StatusNoContent, last().status)
+	assert.Empty(t, last().String())
+	assert.True(t, last().closed)
+
+	// The copy can be skipped.
+	n := len(tees)
+	res = serve("/skip", "gzip")
+	assert.Equal(t, "gzip", res.Header().Get(contentEncoding))
+	assert.Len(t, tees, n)
+
+	// The errors of the copy do not affect the response.
+	fail = errors.New("tee failed")
+	res = serve("/", "gzip")
+	b, err = decodeBody(res.Body, "gzip")
+	assert.NoError(t, err)
+	assert.Equal(t, testBody, string(b))
+	assert.True(t, last().closed)
+
+	_, err = DefaultAdapter(Tee(nil))
+	assert.Error(t, err)
+}
+
+func TestSeesAllIdentityRange(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat(testBody, 2)
+	tee := Tee(func(r *http.Request, status int, h http.Header) io.WriteCloser {
+		return &teeBuffer{status: status}
+	})
+	for name, opt := range map[string]Option{
+		"Tee":              tee,
+		"PolicySkipHeader": PolicySkipHeader("X-No-Compress", "1"),
+		"LevelOverrides":   LevelOverrides("X-Compression-Level"),
+	} {
+		a, err := Adapter(GzipCompressionLevel(gzip.DefaultCompression), opt)
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(contentType, "text/plain")
+			w.Header().Set(etag, `"v1"`)
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(body))
+		}))
+		for _, ir := range []string{"", `"v1"`} {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(acceptEncoding, "identity")
+			req.Header.Set(_range, "bytes=10-19")
+			if ir != "" {
+				req.Header.Set(ifRange, ir)
+			}
+			res := httptest.NewRecorder()
+			h.ServeHTTP(res, req)
+			assert.Equal(t, http.StatusPartialContent, res.Code, "%s %q", name, ir)
+			assert.Equal(t, "bytes", res.Header().Get(acceptRanges), "%s %q", name, ir)
+			assert.Equal(t, body[10:20], res.Body.String(), "%s %q", name, ir)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package httpcompression
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// TenantKey is an option that sets the function returning the tenant of each
+// request (e.g. from a header or from the host added by a SaaS gateway), or
+// the empty string if the request has no tenant. The options of the tenants
+// are set with Tenant. The tenant of the request is reported, as seen by the
+// handler wrapped by the middleware and by its WriterHooks (e.g. to label the
+// metrics of each tenant), by TenantFromRequest.
+func TenantKey(key func(r *http.Request) string) Option {
+	return named("TenantKey", func(c *config) error {
+		if key == nil {
+			return fmt.Errorf("tenant key function can not be nil")
+		}
+		c.tenants = &tenantConfig{key: key}
+		return nil
+	})
+}
+
+type tenantConfig struct {
+	key func(r *http.Request) string
+}
+
+// keyFunc returns the function returning the tenant of the requests, or nil if
+// the TenantKey option is not used.
+func (t *tenantConfig) keyFunc() func(r *http.Request) string {
+	if t == nil {
+		return nil
+	}
+	return t.key
+}
+
+// Tenant is an option that uses different options for the requests of the
+// specified tenant, as returned by the function set with TenantKey: the
+// options of the middleware are used for these requests, plus opts (e.g.
+// different compression levels, MinSize, or a nil Compressor to disable an
+// encoding). The tenants are routes (see Route), checked in the same order,
+// but the tenant of each request is computed only once, whatever the number
+// of tenants.
+func Tenant(tenant string, opts ...Option) Option {
+	return named("Tenant", func(c *config) error {
+		if tenant == "" {
+			return fmt.Errorf("tenant name can not be empty")
+		}
+		ropts := make([]Option, len(opts))
+		copy(ropts, opts)
+		c.routes = append(c.routes, route{tenant: tenant, opts: ropts})
+		return nil
+	})
+}
+
+type tenantKey struct{}
+
+// TenantFromRequest returns the tenant of the request r (see TenantKey), as
+// seen by the handler wrapped by the middleware and by its WriterHooks, or
+// the empty string if r has no tenant or the TenantKey option is not used.
+func TenantFromRequest(r *http.Request) string {
+	tenant, _ := r.Context().Value(tenantKey{}).(string)
+	return tenant
+}
@@ -0,0 +1,78 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenants(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	var (
+		keys   atomic.Int32
+		mu     sync.Mutex
+		labels = map[string]string{}
+	)
+	a, err := DefaultAdapter(
+		TenantKey(func(r *http.Request) string {
+			keys.Add(1)
+			return r.Header.Get("X-Tenant")
+		}),
+		Tenant("streaming", MinSize(0)),
+		Tenant("legacy", BrotliCompressor(nil), ZstandardCompressor(nil)),
+		ResponseWriterHook(WriterHook{Closed: func(r *http.Request, enc string, err error) {
+			mu.Lock()
+			labels[TenantFromRequest(r)] = enc
+			mu.Unlock()
+		}}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		if r.URL.Path == "/small" {
+			w.Write([]byte("small"))
+		} else {
+			w.Write([]byte(testBody))
+		}
+	}))
+
+	cases := []struct {
+		tenant, path, enc string
+	}{
+		{"", "/", "zstd"},
+		{"", "/small", ""},
+		{"other", "/", "zstd"},
+		{"streaming", "/small", "zstd"},
+		{"legacy", "/", "gzip"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Header.Set(acceptEncoding, "zstd, br, gzip")
+		if c.tenant != "" {
+			req.Header.Set("X-Tenant", c.tenant)
+		}
+		res := httptest.NewRecorder()
+		keys.Store(0)
+		h.ServeHTTP(res, req)
+		assert.Equal(t, c.enc, res.Header().Get(contentEncoding), c.tenant)
+		assert.EqualValues(t, 2, keys.Load(), "the key is computed once for routing, and once for the label")
+		assert.Equal(t, c.enc, labels[c.tenant], c.tenant)
+	}
+
+	_, err = Adapter(Tenant("a"))
+	assert.Error(t, err)
+	_, err = Adapter(TenantKey(BucketByHeader("X-Tenant")), Tenant(""))
+	assert.Error(t, err)
+	_, err = Adapter(TenantKey(BucketByHeader("X-Tenant")), Tenant("a"), Tenant("a"))
+	assert.Error(t, err)
+	_, err = Adapter(TenantKey(nil))
+	assert.Error(t, err)
+}
@@ -0,0 +1,103 @@
+package httpcompression
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const expect = "Expect"
+
+// Transport is an http.RoundTripper that compresses the bodies of the
+// requests it sends, for servers that accept compressed request bodies.
+//
+// The bodies are compressed while they are sent, so that large uploads
+// do not need to be buffered: the compressed requests are sent with chunked
+// transfer encoding, and with an "Expect: 100-continue" header, so that
+// the servers can reject them (e.g. because of their size, or because they
+// do not support Encoding) before the body is sent (the Base transport
+// must support it, e.g. with a non-zero http.Transport.ExpectContinueTimeout,
+// as http.DefaultTransport). If the server responds with 415 Unsupported
+// Media Type and the body can be obtained again (see http.Request.GetBody),
+// the request is sent again uncompressed.
+type Transport struct {
+	// Base is the RoundTripper used to send the requests. If nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+	// Encoding is the Content-Encoding of the compressed bodies, e.g. "gzip".
+	Encoding string
+	// Compressor is the provider of the compressors for Encoding.
+	Compressor CompressorProvider
+	// MinSize is the minimum size of the bodies that are compressed. Bodies
+	// whose size is not known are always compressed.
+	MinSize int
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Compressor == nil || t.Encoding == "" {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("httpcompression: Transport without Compressor or Encoding")
+	}
+	if req.Body == nil || req.Body == http.NoBody || req.Header.Get(contentEncoding) != "" || (req.ContentLength > 0 && req.ContentLength < int64(t.MinSize)) {
+		return t.base().RoundTrip(req)
+	}
+
+	creq := req.Clone(req.Context())
+	creq.Body = t.compress(req.Body)
+	creq.ContentLength = -1
+	creq.Header.Del(contentLength)
+	creq.Header.Set(contentEncoding, t.Encoding)
+	if creq.Header.Get(expect) == "" {
+		creq.Header.Set(expect, "100-continue")
+	}
+	if req.GetBody != nil {
+		creq.GetBody = func() (io.ReadCloser, error) {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			return t.compress(body), nil
+		}
+	}
+	res, err := t.base().RoundTrip(creq)
+	if err != nil || res.StatusCode != http.StatusUnsupportedMediaType || req.GetBody == nil {
+		return res, err
+	}
+
+	// The server does not accept the compressed body: send it uncompressed.
+	body, err := req.GetBody()
+	if err != nil {
+		return res, nil
+	}
+	res.Body.Close()
+	preq := req.Clone(req.Context())
+	preq.Body = body
+	return t.base().RoundTrip(preq)
+}
+
+// compress returns a reader of body, compressed while it is read. body is
+// closed once it has been compressed, or once the returned reader has been
+// closed.
+func (t *Transport) compress(body io.ReadCloser) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		defer body.Close()
+		w := t.Compressor.Get(pw)
+		_, err := io.Copy(w, body)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
@@ -0,0 +1,66 @@
+package httpcompression
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat(testBody, 100)
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := r.Header.Get(contentEncoding)
+		got = append(got, enc)
+		if r.URL.Path == "/plain" && enc != "" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		b, err := decodeBody(r.Body, enc)
+		assert.NoError(t, err)
+		assert.Equal(t, body, string(b))
+		if enc != "" {
+			assert.EqualValues(t, -1, r.ContentLength)
+			assert.Equal(t, "100-continue", r.Header.Get(expect))
+		}
+	}))
+	defer srv.Close()
+
+	gz, err := NewDefaultGzipCompressor(6)
+	if !assert.NoError(t, err) {
+		return
+	}
+	c := &http.Client{Transport: &Transport{Encoding: "gzip", Compressor: gz, MinSize: 1 << 10}}
+	post := func(path string, r io.Reader) {
+		got = nil
+		res, err := c.Post(srv.URL+path, "text/plain", r)
+		if assert.NoError(t, err) {
+			res.Body.Close()
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+		}
+	}
+
+	// Bodies of unknown length are streamed.
+	post("/", io.MultiReader(strings.NewReader(body)))
+	assert.Equal(t, []string{"gzip"}, got)
+
+	post("/", strings.NewReader(body))
+	assert.Equal(t, []string{"gzip"}, got)
+
+	// Small bodies are not compressed.
+	body = testBody[:100]
+	post("/", strings.NewReader(body))
+	assert.Equal(t, []string{""}, got)
+	body = strings.Repeat(testBody, 100)
+
+	// The server does not accept compressed bodies.
+	post("/plain", bytes.NewReader([]byte(body)))
+	assert.Equal(t, []string{"gzip", ""}, got)
+}
@@ -0,0 +1,25 @@
+package httpcompression
+
+import "net/http"
+
+// upgradeRequest reports whether r asks to switch protocol, i.e. it has an
+// Upgrade header and the "upgrade" option in its Connection header (e.g. the
+// WebSocket handshakes), or it is a CONNECT request (e.g. the WebSocket
+// handshakes over HTTP/2, see RFC 8441). The responses to these requests can
+// never be compressed, so the middleware does not wrap them at all: the
+// handler gets the original ResponseWriter, without the Vary header and
+// with its Range handling untouched, as some upgrade libraries expect.
+func upgradeRequest(r *http.Request) bool {
+	if r.Method == http.MethodConnect {
+		return true
+	}
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		if hasToken(v, "upgrade") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpgradeBypass(t *testing.T) {
+	t.Parallel()
+
+	a, err := DefaultAdapter()
+	if !assert.NoError(t, err) {
+		return
+	}
+	var got http.ResponseWriter
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = w
+		w.Header().Set(contentType, "text/plain")
+		io.WriteString(w, testBody)
+	}))
+	cases := []struct {
+		name       string
+		method     string
+		connection string
+		upgrade    string
+		bypass     bool
+	}{
+		{"websocket", "GET", "Upgrade", "websocket", true},
+		{"connection options", "GET", "keep-alive, upgrade", "websocket", true},
+		{"connect", "CONNECT", "", "", true},
+		{"no upgrade header", "GET", "Upgrade", "", false},
+		{"no connection option", "GET", "keep-alive", "websocket", false},
+		{"plain", "GET", "", "", false},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "/", nil)
+		req.Header.Set(acceptEncoding, "gzip")
+		if c.connection != "" {
+			req.Header.Set("Connection", c.connection)
+		}
+		if c.upgrade != "" {
+			req.Header.Set("Upgrade", c.upgrade)
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if c.bypass {
+			assert.Same(t, res, got, c.name)
+			assert.Empty(t, res.Header().Values(vary), c.name)
+			assert.Empty(t, res.Header().Get(contentEncoding), c.name)
+			assert.Equal(t, testBody, res.Body.String(), c.name)
+		} else {
+			assert.NotSame(t, res, got, c.name)
+			assert.Equal(t, "gzip", res.Header().Get(contentEncoding), c.name)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package httpcompression
+
+import "net/http"
+
+// VariantKeyFunc returns a function computing the key of the variant of the
+// response to each request that a middleware configured with opts (the
+// options of Adapter) serves, e.g. so that the keys of an application-level
+// cache, or the cache key configuration of a CDN, stay consistent with the
+// negotiation of the middleware. To describe DefaultAdapter, include its
+// defaults with DefaultOptions.
+//
+// The URL of the key is the one used by VariantCache, and its Encoding is
+// the encoding negotiated for the request, as the one of the keys of
+// VariantCache ("identity" if the responses are not compressed): the
+// headers the responses vary on (Accept-Encoding, Available-Dictionary, and
+// the User-Agent with AssumeGzip) are normalized to their effect on the
+// negotiation, so the requests whose headers differ but that get the same
+// variant get the same key. The Validator of the key is always empty, as it
+// depends on the response. Like NegotiationHandler, the key does not take
+// into account the options depending on the responses (e.g. MinSize): the
+// small responses, and those whose Content-Type is not compressible, are
+// sent uncompressed regardless of the encoding of the key.
+func VariantKeyFunc(opts ...Option) (func(r *http.Request) CacheKey, error) {
+	c, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return c.variantKey, nil
+}
+
+// VariantKey returns the key of the variant of the response to r served
+// with the current options of the middleware (see VariantKeyFunc).
+func (m *Middleware) VariantKey(r *http.Request) CacheKey {
+	if m.disabled.Load() {
+		return CacheKey{URL: r.Host + r.URL.RequestURI(), Encoding: identity}
+	}
+	c := m.current().config
+	return c.variantKey(r)
+}
+
+func (c *config) variantKey(r *http.Request) CacheKey {
+	key := CacheKey{URL: r.Host + r.URL.RequestURI(), Encoding: identity}
+	if upgradeRequest(r) || nestedRequest(r) {
+		return key
+	}
+	c = c.route(r)
+	accept := parseEncodings(r.Header.Values(acceptEncoding))
+	c.gateEncodings(headerWriter{}, r, accept, nil)
+	if c.dict.enabled() {
+		if dict := c.dict.negotiate(r, accept); dict != nil {
+			key.Encoding = dict.cacheEnc
+			return key
+		}
+	}
+	if common := acceptedCompression(accept, c.compressor); len(common) > 0 {
+		key.Encoding = preferredEncoding(accept, c.compressor, common, c.prefer)
+	}
+	return key
+}
+
+// headerWriter is a ResponseWriter discarding the response, for the
+// functions that only set its headers.
+type headerWriter struct{}
+
+func (headerWriter) Header() http.Header         { return http.Header{} }
+func (headerWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (headerWriter) WriteHeader(int)             {}
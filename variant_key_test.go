@@ -0,0 +1,71 @@
+package httpcompression
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVariantKeyFunc(t *testing.T) {
+	t.Parallel()
+
+	opts := append(DefaultOptions(), ContentTypes([]string{"text/plain"}, false))
+	key, err := VariantKeyFunc(opts...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	a, err := Adapter(opts...)
+	if !assert.NoError(t, err) {
+		return
+	}
+	h := a(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		io.WriteString(w, testBody)
+	}))
+
+	// The key matches the encoding of the responses.
+	for _, accept := range []string{"", "identity", "gzip", "gzip, br", "br;q=0.5, gzip", "zstd, br, gzip", "*", "br;q=0, *"} {
+		req := httptest.NewRequest("GET", "http://example.com/a?b=c", nil)
+		if accept != "" {
+			req.Header.Set(acceptEncoding, accept)
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		enc := res.Header().Get(contentEncoding)
+		if enc == "" {
+			enc = identity
+		}
+		assert.Equal(t, CacheKey{URL: "example.com/a?b=c", Encoding: enc}, key(req), accept)
+	}
+
+	// The requests getting the same variant get the same key.
+	req1 := httptest.NewRequest("GET", "/", nil)
+	req1.Header.Set(acceptEncoding, "gzip, deflate, br")
+	req2 := httptest.NewRequest("GET", "/", nil)
+	req2.Header.Set(acceptEncoding, "br;q=1.0, gzip;q=0.8")
+	assert.Equal(t, key(req1), key(req2))
+	assert.Equal(t, key(req1).String(), key(req2).String())
+
+	_, err = VariantKeyFunc(MinSize(-1))
+	assert.Error(t, err)
+}
+
+func TestMiddlewareVariantKey(t *testing.T) {
+	t.Parallel()
+
+	m, err := DefaultMiddleware()
+	if !assert.NoError(t, err) {
+		return
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(acceptEncoding, "gzip")
+	assert.Equal(t, "gzip", m.VariantKey(req).Encoding)
+	assert.NoError(t, m.Reload(DisableEncoding("gzip")))
+	assert.Equal(t, identity, m.VariantKey(req).Encoding)
+	assert.NoError(t, m.Reload())
+	m.Disable()
+	assert.Equal(t, identity, m.VariantKey(req).Encoding)
+}
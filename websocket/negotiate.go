@@ -0,0 +1,185 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Params are the negotiated parameters of the permessage-deflate extension
+// (RFC 7692, section 7.1).
+type Params struct {
+	// ServerNoContextTakeover disables the context takeover for the messages
+	// sent by the server.
+	ServerNoContextTakeover bool
+	// ClientNoContextTakeover disables the context takeover for the messages
+	// sent by the client.
+	ClientNoContextTakeover bool
+	// ServerMaxWindowBits, if not zero, is the value of the
+	// server_max_window_bits parameter: the server uses a LZ77 window of at
+	// most 1<<ServerMaxWindowBits bytes. Negotiate only accepts 15, the
+	// window size used by compress/flate.
+	ServerMaxWindowBits int
+	// ClientMaxWindowBits, if not zero, is the value of the
+	// client_max_window_bits parameter: the client uses a LZ77 window of at
+	// most 1<<ClientMaxWindowBits bytes.
+	ClientMaxWindowBits int
+}
+
+// String returns the extension with its parameters, in the format used in
+// the Sec-WebSocket-Extensions header.
+func (p Params) String() string {
+	s := ExtensionName
+	if p.ServerNoContextTakeover {
+		s += "; server_no_context_takeover"
+	}
+	if p.ClientNoContextTakeover {
+		s += "; client_no_context_takeover"
+	}
+	if p.ServerMaxWindowBits != 0 {
+		s += "; server_max_window_bits=" + strconv.Itoa(p.ServerMaxWindowBits)
+	}
+	if p.ClientMaxWindowBits != 0 {
+		s += "; client_max_window_bits=" + strconv.Itoa(p.ClientMaxWindowBits)
+	}
+	return s
+}
+
+// Options control the parameters accepted by Negotiate.
+type Options struct {
+	// ServerNoContextTakeover disables the context takeover for the messages
+	// sent by the server, even if not requested by the client. This reduces
+	// the memory used by each connection, at the expense of compression ratio.
+	ServerNoContextTakeover bool
+	// ClientNoContextTakeover asks the client to disable the context
+	// takeover for the messages it sends.
+	ClientNoContextTakeover bool
+	// ClientMaxWindowBits, if not zero (from 8 to 15), asks the clients that
+	// support it to use a LZ77 window of at most 1<<ClientMaxWindowBits
+	// bytes, or of the size they offer if smaller. This reduces the memory
+	// used by each connection to decompress the messages sent by the client
+	// with context takeover.
+	ClientMaxWindowBits int
+}
+
+var errInvalidOffer = errors.New("permessage-deflate: invalid extension offer")
+
+// Negotiate selects the first acceptable permessage-deflate offer in the
+// Sec-WebSocket-Extensions header of the upgrade request h. It returns false
+// if there is no acceptable offer, in which case permessage-deflate must not
+// be used.
+//
+// Offers that require the server to use a LZ77 window smaller than 32KB
+// (server_max_window_bits less than 15) are declined, as they are not
+// supported by compress/flate. No offer is accepted if
+// opts.ClientMaxWindowBits is invalid.
+func Negotiate(h http.Header, opts Options) (Params, bool) {
+	if opts.ClientMaxWindowBits != 0 && (opts.ClientMaxWindowBits < 8 || opts.ClientMaxWindowBits > maxWindowBits) {
+		return Params{}, false
+	}
+	for _, v := range h.Values(HeaderExtensions) {
+		for _, ext := range strings.Split(v, ",") {
+			name, params := parseExtension(ext)
+			if !strings.EqualFold(name, ExtensionName) {
+				continue
+			}
+			p, err := accept(params, opts)
+			if err != nil {
+				continue
+			}
+			return p, true
+		}
+	}
+	return Params{}, false
+}
+
+func accept(params []param, opts Options) (Params, error) {
+	p := Params{
+		ServerNoContextTakeover: opts.ServerNoContextTakeover,
+		ClientNoContextTakeover: opts.ClientNoContextTakeover,
+	}
+	seen := map[string]bool{}
+	for _, pr := range params {
+		if seen[pr.name] {
+			return Params{}, errInvalidOffer
+		}
+		seen[pr.name] = true
+		switch pr.name {
+		case "server_no_context_takeover":
+			if pr.hasValue {
+				return Params{}, errInvalidOffer
+			}
+			p.ServerNoContextTakeover = true
+		case "client_no_context_takeover":
+			if pr.hasValue {
+				return Params{}, errInvalidOffer
+			}
+			p.ClientNoContextTakeover = true
+		case "server_max_window_bits":
+			bits, err := windowBits(pr)
+			if err != nil || bits < maxWindowBits {
+				return Params{}, errInvalidOffer
+			}
+			// The response must carry the parameter offered by the client
+			// (RFC 7692, section 7.1.2.1).
+			p.ServerMaxWindowBits = bits
+		case "client_max_window_bits":
+			// The client supports limiting its window (RFC 7692, section
+			// 7.1.2.2): ask it to do so only if required by opts, as our
+			// decompressor supports the maximum window size.
+			bits := maxWindowBits
+			if pr.hasValue {
+				var err error
+				if bits, err = windowBits(pr); err != nil {
+					return Params{}, errInvalidOffer
+				}
+			}
+			if opts.ClientMaxWindowBits != 0 {
+				p.ClientMaxWindowBits = opts.ClientMaxWindowBits
+				if bits < p.ClientMaxWindowBits {
+					p.ClientMaxWindowBits = bits
+				}
+			}
+		default:
+			return Params{}, errInvalidOffer
+		}
+	}
+	return p, nil
+}
+
+func windowBits(pr param) (int, error) {
+	if !pr.hasValue {
+		return 0, errInvalidOffer
+	}
+	bits, err := strconv.Atoi(pr.value)
+	if err != nil || bits < 8 || bits > 15 || pr.value[0] == '0' {
+		return 0, errInvalidOffer
+	}
+	return bits, nil
+}
+
+type param struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
+// parseExtension parses a single extension in a Sec-WebSocket-Extensions
+// header (e.g. "permessage-deflate; client_max_window_bits=10").
+func parseExtension(ext string) (string, []param) {
+	parts := strings.Split(ext, ";")
+	name := strings.TrimSpace(parts[0])
+	params := make([]param, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		var pr param
+		k, v, ok := strings.Cut(part, "=")
+		pr.name = strings.ToLower(strings.TrimSpace(k))
+		if ok {
+			pr.hasValue = true
+			pr.value = strings.Trim(strings.TrimSpace(v), `"`)
+		}
+		params = append(params, pr)
+	}
+	return name, params
+}
@@ -0,0 +1,277 @@
+// Package websocket implements the permessage-deflate WebSocket extension
+// (RFC 7692): extension negotiation and per-message compression and
+// decompression.
+//
+// The package does not implement the WebSocket protocol itself: it is meant
+// to be plugged into WebSocket implementations that let applications
+// negotiate extensions and access the RSV1 bit of frames (e.g. via an
+// extension or negotiation hook). On the server side:
+//
+//  1. call Negotiate with the headers of the upgrade request and, if it
+//     succeeds, add the returned Params to the Sec-WebSocket-Extensions
+//     header of the handshake response;
+//  2. create the per-connection Extension with Params.Server;
+//  3. compress outgoing data messages with Extension.Compress and send them
+//     with the RSV1 bit set, and decompress incoming data messages that have
+//     the RSV1 bit set with Extension.Decompress;
+//  4. call Extension.Close when the connection is closed.
+//
+// Note that gorilla/websocket and nhooyr.io/websocket (now
+// github.com/coder/websocket) implement permessage-deflate internally and
+// do not allow to replace their implementation.
+//
+// The flate compressors are obtained from a httpcompression.CompressorProvider
+// (by default the pooled provider of the contrib/compress/flate package,
+// shared by all connections). When the context takeover is disabled for the
+// messages sent by the local endpoint, a compressor is held only while a
+// message is being compressed, so idle connections do not retain any
+// compressor.
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/CAFxX/httpcompression"
+	cflate "github.com/CAFxX/httpcompression/contrib/compress/flate"
+)
+
+// ExtensionName is the name of the permessage-deflate extension.
+const ExtensionName = "permessage-deflate"
+
+// HeaderExtensions is the name of the header used to negotiate extensions.
+const HeaderExtensions = "Sec-WebSocket-Extensions"
+
+// maxWindowBits is the base-2 logarithm of the size of the LZ77 sliding
+// window used by compress/flate, the maximum allowed by permessage-deflate.
+const maxWindowBits = 15
+
+// windowSize is the size of the LZ77 sliding window used by compress/flate.
+const windowSize = 1 << maxWindowBits
+
+// tail is the trailer that is removed from compressed messages (RFC 7692,
+// section 7.2.1) and added back before decompressing them.
+var tail = []byte{0x00, 0x00, 0xff, 0xff}
+
+// ErrMessageTooLarge is returned by Decompress if the decompressed message
+// is larger than the configured limit.
+var ErrMessageTooLarge = errors.New("permessage-deflate: decompressed message too large")
+
+// Extension holds the per-connection state of the permessage-deflate
+// extension. An Extension is not safe for concurrent use: Compress and
+// Decompress can be called concurrently with each other, but not with
+// themselves.
+// If Compress or Decompress fail the connection must be closed, as the
+// compression contexts of the two endpoints may not be synchronized anymore.
+type Extension struct {
+	c compressor
+	d decompressor
+}
+
+// Compress compresses the payload of a message, and appends the result to
+// dst. The returned payload must be sent with the RSV1 bit set.
+func (e *Extension) Compress(dst, msg []byte) ([]byte, error) {
+	return e.c.compress(dst, msg)
+}
+
+// Decompress decompresses the payload of a message that was received with
+// the RSV1 bit set, and appends the result to dst.
+func (e *Extension) Decompress(dst, payload []byte) ([]byte, error) {
+	return e.d.decompress(dst, payload)
+}
+
+// Close releases the resources held by the Extension. The Extension must
+// not be used after Close.
+func (e *Extension) Close() {
+	e.c.release()
+	e.d.release()
+}
+
+// Server returns the Extension to be used by a server that negotiated p.
+// level is the flate compression level used for the messages sent by the
+// server; maxSize, if positive, is the maximum size of decompressed
+// messages.
+func (p Params) Server(level int, maxSize int) (*Extension, error) {
+	cp, err := provider(level)
+	if err != nil {
+		return nil, err
+	}
+	return p.ServerProvider(cp, maxSize)
+}
+
+// ServerProvider is like Server, but the messages sent by the server are
+// compressed by cp, that must produce raw DEFLATE streams and compressors
+// implementing httpcompression.Flusher (e.g. the provider of the
+// contrib/compress/flate package).
+// An error is returned if p limits the LZ77 window of the server
+// (server_max_window_bits less than 15), as it is not supported by
+// compress/flate.
+func (p Params) ServerProvider(cp httpcompression.CompressorProvider, maxSize int) (*Extension, error) {
+	if p.ServerMaxWindowBits != 0 && p.ServerMaxWindowBits < maxWindowBits {
+		return nil, fmt.Errorf("permessage-deflate: unsupported server_max_window_bits: %d", p.ServerMaxWindowBits)
+	}
+	return newExtension(cp, maxSize, !p.ServerNoContextTakeover, !p.ClientNoContextTakeover, p.ClientMaxWindowBits), nil
+}
+
+// Client returns the Extension to be used by a client that negotiated p.
+// level is the flate compression level used for the messages sent by the
+// client; maxSize, if positive, is the maximum size of decompressed
+// messages.
+func (p Params) Client(level int, maxSize int) (*Extension, error) {
+	cp, err := provider(level)
+	if err != nil {
+		return nil, err
+	}
+	return p.ClientProvider(cp, maxSize)
+}
+
+// ClientProvider is like Client, but the messages sent by the client are
+// compressed by cp (see ServerProvider).
+// An error is returned if p limits the LZ77 window of the client
+// (client_max_window_bits less than 15), as it is not supported by
+// compress/flate.
+func (p Params) ClientProvider(cp httpcompression.CompressorProvider, maxSize int) (*Extension, error) {
+	if p.ClientMaxWindowBits != 0 && p.ClientMaxWindowBits < maxWindowBits {
+		return nil, fmt.Errorf("permessage-deflate: unsupported client_max_window_bits: %d", p.ClientMaxWindowBits)
+	}
+	return newExtension(cp, maxSize, !p.ClientNoContextTakeover, !p.ServerNoContextTakeover, p.ServerMaxWindowBits), nil
+}
+
+// newExtension returns an Extension compressing with cp. windowBits, if not
+// zero, is the size of the LZ77 window used by the peer.
+func newExtension(cp httpcompression.CompressorProvider, maxSize int, compressTakeover, decompressTakeover bool, windowBits int) *Extension {
+	window := windowSize
+	if windowBits != 0 {
+		// zlib uses a 512 bytes window also when asked for 256 bytes.
+		window = 1 << max(windowBits, 9)
+	}
+	return &Extension{
+		c: compressor{provider: cp, takeover: compressTakeover},
+		d: decompressor{takeover: decompressTakeover, maxSize: maxSize, window: window},
+	}
+}
+
+var providers sync.Map // map[int]httpcompression.CompressorProvider
+
+// provider returns the shared provider of flate compressors for the
+// specified level.
+func provider(level int) (httpcompression.CompressorProvider, error) {
+	if cp, ok := providers.Load(level); ok {
+		return cp.(httpcompression.CompressorProvider), nil
+	}
+	cp, err := cflate.New(cflate.Options{Level: level})
+	if err != nil {
+		return nil, fmt.Errorf("permessage-deflate: %w", err)
+	}
+	p, _ := providers.LoadOrStore(level, cp)
+	return p.(httpcompression.CompressorProvider), nil
+}
+
+type compressor struct {
+	provider httpcompression.CompressorProvider
+	takeover bool
+	w        io.WriteCloser // only retained across messages if takeover is true
+	buf      bytes.Buffer
+}
+
+func (c *compressor) compress(dst, msg []byte) ([]byte, error) {
+	if c.w == nil {
+		c.w = c.provider.Get(&c.buf)
+	}
+	if !c.takeover {
+		defer c.release()
+	}
+	f, ok := c.w.(httpcompression.Flusher)
+	if !ok {
+		return dst, errors.New("permessage-deflate: the compressor does not support Flush")
+	}
+	c.buf.Reset()
+	if _, err := c.w.Write(msg); err != nil {
+		return dst, err
+	}
+	if err := f.Flush(); err != nil {
+		return dst, err
+	}
+	out := c.buf.Bytes()
+	if !bytes.HasSuffix(out, tail) {
+		return dst, errors.New("permessage-deflate: unexpected compressor output")
+	}
+	return append(dst, out[:len(out)-len(tail)]...), nil
+}
+
+func (c *compressor) release() {
+	if c.w == nil {
+		return
+	}
+	// Closing returns the compressor to the pool of the provider: the final
+	// block it writes is discarded.
+	_ = c.w.Close()
+	c.w = nil
+	c.buf = bytes.Buffer{}
+}
+
+type decompressor struct {
+	takeover bool
+	maxSize  int
+	r        io.ReadCloser
+	in       []byte // payload followed by tail
+	src      bytes.Reader
+	window   int    // size of the LZ77 window of the peer
+	dict     []byte // last window bytes of decompressed data, if takeover is true
+}
+
+func (d *decompressor) decompress(dst, payload []byte) ([]byte, error) {
+	d.in = append(append(d.in[:0], payload...), tail...)
+	d.src.Reset(d.in)
+	if d.r == nil {
+		d.r = flate.NewReaderDict(&d.src, d.dict)
+	} else if err := d.r.(flate.Resetter).Reset(&d.src, d.dict); err != nil {
+		return dst, err
+	}
+
+	start := len(dst)
+	var r io.Reader = d.r
+	if d.maxSize > 0 {
+		r = io.LimitReader(d.r, int64(d.maxSize)+1)
+	}
+	buf := bytes.NewBuffer(dst)
+	if _, err := buf.ReadFrom(r); err != nil && err != io.ErrUnexpectedEOF {
+		// The payload ends with a sync flush block and not with a final
+		// block, so the flate reader reaches the end of its input before
+		// the end of the stream: io.ErrUnexpectedEOF is expected.
+		return dst, err
+	}
+	dst = buf.Bytes()
+	if d.maxSize > 0 && len(dst)-start > d.maxSize {
+		return dst[:start], ErrMessageTooLarge
+	}
+
+	if d.takeover {
+		d.dict = appendWindow(d.dict, dst[start:], d.window)
+	}
+	return dst, nil
+}
+
+// appendWindow appends b to the window, keeping only the last size bytes.
+func appendWindow(window, b []byte, size int) []byte {
+	if len(b) >= size {
+		return append(window[:0], b[len(b)-size:]...)
+	}
+	if n := len(window) + len(b) - size; n > 0 {
+		window = append(window[:0], window[n:]...)
+	}
+	return append(window, b...)
+}
+
+func (d *decompressor) release() {
+	if d.r != nil {
+		_ = d.r.Close()
+		d.r = nil
+	}
+	d.dict = nil
+	d.in = nil
+}
@@ -0,0 +1,221 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"math/rand"
+	"net/http"
+	"testing"
+
+	"github.com/CAFxX/httpcompression"
+	cflate "github.com/CAFxX/httpcompression/contrib/compress/flate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		offers   []string
+		opts     Options
+		ok       bool
+		response string
+	}{
+		{nil, Options{}, false, ""},
+		{[]string{"x-webkit-deflate-frame"}, Options{}, false, ""},
+		{[]string{"permessage-deflate"}, Options{}, true, "permessage-deflate"},
+		{[]string{"permessage-deflate; client_max_window_bits"}, Options{}, true, "permessage-deflate"},
+		{[]string{"permessage-deflate; server_no_context_takeover"}, Options{}, true, "permessage-deflate; server_no_context_takeover"},
+		{[]string{"permessage-deflate"}, Options{ServerNoContextTakeover: true, ClientNoContextTakeover: true}, true, "permessage-deflate; server_no_context_takeover; client_no_context_takeover"},
+		{[]string{"permessage-deflate; server_max_window_bits=10"}, Options{}, false, ""},
+		{[]string{"permessage-deflate; server_max_window_bits=10, permessage-deflate"}, Options{}, true, "permessage-deflate"},
+		{[]string{"permessage-deflate; server_max_window_bits=15"}, Options{}, true, "permessage-deflate; server_max_window_bits=15"},
+		{[]string{"permessage-deflate; server_max_window_bits=15; client_max_window_bits"}, Options{ClientMaxWindowBits: 10}, true, "permessage-deflate; server_max_window_bits=15; client_max_window_bits=10"},
+		{[]string{"permessage-deflate; client_max_window_bits=\"10\""}, Options{}, true, "permessage-deflate"},
+		{[]string{"permessage-deflate; client_max_window_bits=16"}, Options{}, false, ""},
+		{[]string{"permessage-deflate; server_no_context_takeover; server_no_context_takeover"}, Options{}, false, ""},
+		{[]string{"permessage-deflate; unknown"}, Options{}, false, ""},
+		{[]string{"foo", "permessage-deflate; client_no_context_takeover"}, Options{}, true, "permessage-deflate; client_no_context_takeover"},
+		{[]string{"permessage-deflate"}, Options{ClientMaxWindowBits: 10}, true, "permessage-deflate"},
+		{[]string{"permessage-deflate; client_max_window_bits"}, Options{ClientMaxWindowBits: 10}, true, "permessage-deflate; client_max_window_bits=10"},
+		{[]string{"permessage-deflate; client_max_window_bits=9"}, Options{ClientMaxWindowBits: 10}, true, "permessage-deflate; client_max_window_bits=9"},
+		{[]string{"permessage-deflate; client_max_window_bits=12"}, Options{ClientMaxWindowBits: 10}, true, "permessage-deflate; client_max_window_bits=10"},
+		{[]string{"permessage-deflate; client_max_window_bits"}, Options{ClientMaxWindowBits: 16}, false, ""},
+	}
+	for _, c := range cases {
+		h := http.Header{}
+		for _, o := range c.offers {
+			h.Add(HeaderExtensions, o)
+		}
+		p, ok := Negotiate(h, c.opts)
+		assert.Equal(t, c.ok, ok, "%q", c.offers)
+		if ok {
+			assert.Equal(t, c.response, p.String(), "%q", c.offers)
+		}
+	}
+}
+
+// Test vectors from RFC 7692, section 7.2.3.
+func TestDecompressRFC(t *testing.T) {
+	t.Parallel()
+
+	hello := []byte{0xf2, 0x48, 0xcd, 0xc9, 0xc9, 0x07, 0x00}
+	helloShared := []byte{0xf2, 0x00, 0x11, 0x00, 0x00}
+	helloStored := []byte{0x00, 0x05, 0x00, 0xfa, 0xff, 0x48, 0x65, 0x6c, 0x6c, 0x6f, 0x00}
+
+	e, err := Params{}.Server(flate.DefaultCompression, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer e.Close()
+	for _, payload := range [][]byte{hello, helloShared, helloStored} {
+		msg, err := e.Decompress(nil, payload)
+		assert.NoError(t, err)
+		assert.Equal(t, "Hello", string(msg))
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	rnd := rand.New(rand.NewSource(0))
+	var msgs [][]byte
+	for i := 0; i < 20; i++ {
+		msg := make([]byte, rnd.Intn(20000))
+		for j := range msg {
+			msg[j] = "abcdefgh"[rnd.Intn(8)]
+		}
+		msgs = append(msgs, msg, msg[:len(msg)/2], nil)
+	}
+
+	for _, p := range []Params{{}, {ServerNoContextTakeover: true}, {ClientNoContextTakeover: true}, {ServerNoContextTakeover: true, ClientNoContextTakeover: true}} {
+		server, err := p.Server(flate.BestSpeed, 0)
+		if !assert.NoError(t, err) {
+			return
+		}
+		client, err := p.Client(flate.DefaultCompression, 0)
+		if !assert.NoError(t, err) {
+			return
+		}
+		for _, msg := range msgs {
+			payload, err := server.Compress(nil, msg)
+			assert.NoError(t, err)
+			dec, err := client.Decompress(nil, payload)
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(msg, dec), "%s: server to client", p)
+
+			payload, err = client.Compress(nil, msg)
+			assert.NoError(t, err)
+			dec, err = server.Decompress(nil, payload)
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(msg, dec), "%s: client to server", p)
+		}
+		server.Close()
+		client.Close()
+	}
+}
+
+func TestContextTakeover(t *testing.T) {
+	t.Parallel()
+
+	msg := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 10)
+	size := func(p Params) int {
+		e, _ := p.Server(flate.BestCompression, 0)
+		defer e.Close()
+		e.Compress(nil, msg)
+		payload, _ := e.Compress(nil, msg)
+		return len(payload)
+	}
+	assert.Less(t, size(Params{}), size(Params{ServerNoContextTakeover: true}))
+}
+
+func TestDecompressMaxSize(t *testing.T) {
+	t.Parallel()
+
+	for _, c := range []struct {
+		size int
+		err  error
+	}{{1000, nil}, {1001, ErrMessageTooLarge}} {
+		e, _ := Params{}.Server(flate.DefaultCompression, 1000)
+		payload, _ := e.Compress(nil, make([]byte, c.size))
+		_, err := e.Decompress(nil, payload)
+		assert.Equal(t, c.err, err, "size %d", c.size)
+		e.Close()
+	}
+}
+
+func TestInvalidLevel(t *testing.T) {
+	t.Parallel()
+
+	_, err := Params{}.Server(42, 0)
+	assert.Error(t, err)
+}
+
+func TestClientMaxWindowBits(t *testing.T) {
+	t.Parallel()
+
+	p := Params{ClientMaxWindowBits: 10}
+	server, err := p.Server(flate.DefaultCompression, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer server.Close()
+	assert.Len(t, server.d.dict, 0)
+	_, err = p.Client(flate.DefaultCompression, 0)
+	assert.Error(t, err, "compress/flate can not limit its window")
+	_, err = Params{ServerMaxWindowBits: 10}.Server(flate.DefaultCompression, 0)
+	assert.Error(t, err, "compress/flate can not limit its window")
+	ext, err := Params{ServerMaxWindowBits: maxWindowBits}.Client(flate.DefaultCompression, 0)
+	if assert.NoError(t, err) {
+		ext.Close()
+	}
+
+	// The messages of the client only refer to the last 1KB.
+	client, _ := Params{}.Client(flate.DefaultCompression, 0)
+	defer client.Close()
+	msg := bytes.Repeat([]byte("0123456789"), 50)
+	for i := 0; i < 10; i++ {
+		payload, err := client.Compress(nil, msg)
+		assert.NoError(t, err)
+		dec, err := server.Decompress(nil, payload)
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(msg, dec))
+		assert.LessOrEqual(t, len(server.d.dict), 1<<10)
+	}
+}
+
+func TestServerProvider(t *testing.T) {
+	t.Parallel()
+
+	cp, err := cflate.New(cflate.Options{Level: flate.BestCompression})
+	if !assert.NoError(t, err) {
+		return
+	}
+	server, err := Params{}.ServerProvider(cp, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer server.Close()
+	client, _ := Params{}.Client(flate.DefaultCompression, 0)
+	defer client.Close()
+	payload, err := server.Compress(nil, []byte("Hello"))
+	assert.NoError(t, err)
+	msg, err := client.Decompress(nil, payload)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", string(msg))
+
+	// The compressors must support Flush.
+	e, _ := Params{}.ServerProvider(noFlushProvider{cp}, 0)
+	defer e.Close()
+	_, err = e.Compress(nil, []byte("Hello"))
+	assert.Error(t, err)
+}
+
+type noFlushProvider struct {
+	cp httpcompression.CompressorProvider
+}
+
+func (p noFlushProvider) Get(w io.Writer) io.WriteCloser {
+	return struct{ io.WriteCloser }{p.cp.Get(w)}
+}
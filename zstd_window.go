@@ -0,0 +1,50 @@
+package httpcompression
+
+import "fmt"
+
+// DefaultZstandardMaxWindow is the default maximum window size of the zstd
+// streams (see ZstandardMaxWindow): RFC 8878 recommends that the decoders
+// support windows of at least 8MB, and that the encoders do not use larger
+// windows for the "zstd" content-coding, as some decoders reject them.
+const DefaultZstandardMaxWindow = 8 << 20
+
+// WindowSizer is an optional interface that can be implemented by the
+// CompressorProviders, reporting the window size advertised in the streams
+// of their compressors (e.g. the zstd Window_Descriptor), that is the
+// amount of memory needed by the clients to decode them.
+type WindowSizer interface {
+	WindowSize() int
+}
+
+// ZstandardMaxWindow is an option that sets the maximum window size of the
+// zstd streams (the default is DefaultZstandardMaxWindow). The zstd
+// encoding is not negotiated if its compressor implements WindowSizer and
+// reports a larger window, so that the clients are never sent streams
+// that their decoders may reject; the clients are then sent one of the
+// other encodings they accept, if any. Compressors that do not implement
+// WindowSizer are assumed to comply with the limit.
+func ZstandardMaxWindow(size int) Option {
+	if size < 1<<10 {
+		return errorOption("ZstandardMaxWindow", fmt.Errorf("invalid zstd window size: %d", size))
+	}
+	return func(c *config) error {
+		c.zstdMaxWindow = size
+		return nil
+	}
+}
+
+// dropLargeZstdWindows disables the zstd compressor if its window is larger
+// than the maximum.
+func (c *config) dropLargeZstdWindows() {
+	max := c.zstdMaxWindow
+	if max == 0 {
+		max = DefaultZstandardMaxWindow
+	}
+	cc, ok := c.compressor[zstandardEncoding]
+	if !ok || cc.comp == nil {
+		return
+	}
+	if ws, ok := cc.comp.(WindowSizer); ok && ws.WindowSize() > max {
+		delete(c.compressor, zstandardEncoding)
+	}
+}
@@ -0,0 +1,52 @@
+package httpcompression
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CAFxX/httpcompression/contrib/klauspost/zstd"
+	kpzstd "github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZstandardMaxWindow(t *testing.T) {
+	skipMinimal(t)
+	t.Parallel()
+
+	large, err := zstd.New(kpzstd.WithWindowSize(16 << 20))
+	if !assert.NoError(t, err) {
+		return
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.Write([]byte(strings.Repeat(testBody, 10)))
+	})
+	serve := func(opts ...Option) string {
+		a, err := DefaultAdapter(opts...)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(acceptEncoding, "zstd, br")
+		res := httptest.NewRecorder()
+		a(handler).ServeHTTP(res, req)
+		return res.Header().Get(contentEncoding)
+	}
+
+	assert.Equal(t, "zstd", serve())
+	assert.Equal(t, "br", serve(ZstandardCompressor(large)))
+	assert.Equal(t, "zstd", serve(ZstandardCompressor(large), ZstandardMaxWindow(16<<20)))
+	assert.Equal(t, "br", serve(ZstandardMaxWindow(4<<20)))
+
+	r, err := Describe(append(DefaultOptions(), ZstandardMaxWindow(4<<20))...)
+	if assert.NoError(t, err) {
+		for _, e := range r.Encodings {
+			assert.NotEqual(t, "zstd", e.Encoding)
+		}
+	}
+
+	_, err = DefaultAdapter(ZstandardMaxWindow(0))
+	assert.Error(t, err)
+}